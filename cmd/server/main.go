@@ -15,8 +15,15 @@ import (
 	"github.com/sydlexius/media-reaper/internal/config"
 	"github.com/sydlexius/media-reaper/internal/connection"
 	"github.com/sydlexius/media-reaper/internal/db"
+	"github.com/sydlexius/media-reaper/internal/directdelete"
+	"github.com/sydlexius/media-reaper/internal/events"
+	"github.com/sydlexius/media-reaper/internal/history"
+	"github.com/sydlexius/media-reaper/internal/notify"
 	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+	"github.com/sydlexius/media-reaper/internal/safeguard"
 	"github.com/sydlexius/media-reaper/internal/server"
+	"github.com/sydlexius/media-reaper/internal/user"
+	"github.com/sydlexius/media-reaper/internal/watch"
 )
 
 // @title Media Reaper API
@@ -27,14 +34,56 @@ import (
 // @securityDefinitions.apikey SessionCookie
 // @in cookie
 // @name media-reaper-session
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-Api-Key
+// @description Personal API token from POST /auth/tokens. "Authorization: Bearer <token>" is accepted too.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		if err := rotateKeys(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := run(); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// rotateKeys re-encrypts all stored secrets with the current master key and exits.
+func rotateKeys() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	database, err := db.New(cfg.DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	encryptor, err := connection.NewEncryptor(cfg.MasterKey, cfg.PreviousMasterKeys...)
+	if err != nil {
+		return fmt.Errorf("failed to initialize encryption: %w", err)
+	}
+
+	rotator := connection.NewKeyRotator(sqliterepo.NewSecretRepository(database), encryptor)
+	result, err := rotator.Rotate(context.Background())
+	if err != nil {
+		return fmt.Errorf("key rotation failed: %w", err)
+	}
+
+	log.Printf("Re-encrypted %d secrets with key %s", result.Rotated, result.PrimaryKeyID)
+	return nil
+}
+
 func run() error {
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
 
 	database, err := db.New(cfg.DBPath)
 	if err != nil {
@@ -43,31 +92,78 @@ func run() error {
 	defer func() { _ = database.Close() }()
 
 	// Encryption
-	encryptor, err := connection.NewEncryptor(cfg.MasterKey)
+	encryptor, err := connection.NewEncryptor(cfg.MasterKey, cfg.PreviousMasterKeys...)
 	if err != nil {
-		return fmt.Errorf("failed to initialize encryption: %w", err)
+		return fmt.Errorf("failed to initialize encryption (master key from %s): %w", cfg.MasterKeySource, err)
 	}
+	log.Printf("Using master key %s from %s", encryptor.PrimaryKeyID(), cfg.MasterKeySource)
 
 	// Repositories
 	userRepo := sqliterepo.NewUserRepository(database)
+	sessionRepo := sqliterepo.NewSessionRepository(database)
+	tokenRepo := sqliterepo.NewAPITokenRepository(database)
+	totpRepo := sqliterepo.NewTOTPRepository(database)
+	loginAttemptRepo := sqliterepo.NewLoginAttemptRepository(database)
+	settingsRepo := sqliterepo.NewSettingsRepository(database)
 	connRepo := sqliterepo.NewConnectionRepository(database)
+	historyRepo := sqliterepo.NewHistoryRepository(database)
+	watchRepo := sqliterepo.NewWatchPlayRepository(database)
+	directDeleteRepo := sqliterepo.NewDirectDeleteRepository(database)
+	notificationRepo := sqliterepo.NewNotificationProviderRepository(database)
+	healthCheckRepo := sqliterepo.NewHealthCheckRepository(database)
+	secretRepo := sqliterepo.NewSecretRepository(database)
+
+	// Internal events
+	bus := events.NewBus()
 
 	// Services
-	authService := auth.NewService(userRepo, cfg)
-	connService := connection.NewService(connRepo, encryptor)
+	authService := auth.NewService(userRepo, sessionRepo, tokenRepo, totpRepo, loginAttemptRepo, settingsRepo, encryptor, cfg)
+	healthChecker := connection.NewHealthChecker(
+		connRepo, healthCheckRepo, encryptor,
+		cfg.HealthCheckInterval, cfg.HealthCheckConcurrency, bus,
+	)
+	connService := connection.NewService(connRepo, encryptor, healthChecker)
+	keyRotator := connection.NewKeyRotator(secretRepo, encryptor)
+	notifyService := notify.NewService(notificationRepo, encryptor)
+	notifyService.Subscribe(bus)
+	historyService := history.NewService(historyRepo, connService, bus)
+	watchService := watch.NewService(watchRepo, connService)
+	directDeleteService := directdelete.NewService(directDeleteRepo, connService, historyService, bus)
+	safeguardService := safeguard.NewService(connService, cfg.RecentImportWindow)
+	userService := user.NewService(userRepo, sessionRepo)
+	if cfg.EmbyAuthConnection != "" {
+		authService.UseEmbyAuth(connService.EmbyAuthenticator(cfg.EmbyAuthConnection))
+		log.Printf("Emby users can log in through connection %q", cfg.EmbyAuthConnection)
+	}
 
 	if err := authService.Bootstrap(context.Background()); err != nil {
 		return fmt.Errorf("failed to bootstrap admin user: %w", err)
 	}
 
-	// Health checker
-	healthChecker := connection.NewHealthChecker(connRepo, encryptor, cfg.HealthCheckInterval)
+	if err := keyRotator.Verify(context.Background()); err != nil {
+		if errors.Is(err, connection.ErrMasterKeyMismatch) {
+			return fmt.Errorf("%w. The master key from %s is not the one used to encrypt this database; "+
+				"restore the original key, or set it in MEDIA_REAPER_PREVIOUS_MASTER_KEYS and rotate", err, cfg.MasterKeySource)
+		}
+		return fmt.Errorf("failed to verify master key: %w", err)
+	}
+	if status, err := keyRotator.Status(context.Background()); err == nil {
+		if n := len(status.Undecryptable); n > 0 {
+			log.Printf("WARNING: %d stored secrets cannot be decrypted with any configured master key", n)
+		}
+		if status.NeedsRotation > 0 {
+			log.Printf("%d stored secrets are not encrypted with the current master key; run key rotation to re-encrypt them", status.NeedsRotation)
+		}
+	}
+
+	// Background jobs
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go healthChecker.Start(ctx)
+	go directDeleteService.WatchGracePeriods(ctx)
 
-	srv := server.New(cfg, authService, connService)
+	srv := server.New(cfg, authService, connService, historyService, watchService, directDeleteService, safeguardService, notifyService, keyRotator, userService)
 	log.Printf("Starting media-reaper on port %d", cfg.Port)
 
 	// Graceful shutdown on interrupt
@@ -86,5 +182,7 @@ func run() error {
 		return fmt.Errorf("server failed: %w", err)
 	}
 
+	// Let notifications that are already on their way finish.
+	notifyService.Wait()
 	return nil
 }
@@ -0,0 +1,79 @@
+package arrclient
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	queuePageSize   = 200
+	historyPageSize = 250
+	// maxHistoryPages bounds how far back a history lookup reads, however
+	// long the window.
+	maxHistoryPages = 40
+)
+
+// History event types that mean a file was imported. An upgrade is an
+// import that replaces an existing file.
+const (
+	EventDownloadFolderImported = "downloadFolderImported"
+	EventSeriesFolderImported   = "seriesFolderImported"
+	EventMovieFolderImported    = "movieFolderImported"
+)
+
+// QueueItem is a download a Sonarr or Radarr instance is tracking. Sonarr
+// items have a series and episode ID, Radarr items a movie ID.
+type QueueItem struct {
+	ID                   int64  `json:"id"`
+	SeriesID             int64  `json:"seriesId,omitempty"`
+	EpisodeID            int64  `json:"episodeId,omitempty"`
+	MovieID              int64  `json:"movieId,omitempty"`
+	Title                string `json:"title"`
+	Status               string `json:"status"`
+	TrackedDownloadState string `json:"trackedDownloadState,omitempty"`
+}
+
+// HistoryEvent is an entry in a Sonarr or Radarr instance's history.
+type HistoryEvent struct {
+	SeriesID    int64     `json:"seriesId,omitempty"`
+	EpisodeID   int64     `json:"episodeId,omitempty"`
+	MovieID     int64     `json:"movieId,omitempty"`
+	SourceTitle string    `json:"sourceTitle"`
+	EventType   string    `json:"eventType"`
+	Date        time.Time `json:"date"`
+}
+
+// Imported reports whether the event is a file being imported or upgraded.
+func (e *HistoryEvent) Imported() bool {
+	switch e.EventType {
+	case EventDownloadFolderImported, EventSeriesFolderImported, EventMovieFolderImported:
+		return true
+	}
+	return false
+}
+
+// historySince reads history pages, newest first, until it reaches an event
+// older than since. fetch returns one page of events and whether it was the
+// last.
+func historySince(ctx context.Context, since time.Time, fetch func(page int) ([]*HistoryEvent, bool, error)) ([]*HistoryEvent, error) {
+	var events []*HistoryEvent
+	for page := 1; page <= maxHistoryPages; page++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch, last, err := fetch(page)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range batch {
+			if e.Date.Before(since) {
+				return events, nil
+			}
+			events = append(events, e)
+		}
+		if last {
+			break
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,52 @@
+package arrclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHistorySince(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	pages := [][]*HistoryEvent{
+		{{MovieID: 1, Date: now}, {MovieID: 2, Date: now.Add(-time.Hour)}},
+		{{MovieID: 3, Date: now.Add(-2 * time.Hour)}, {MovieID: 4, Date: now.Add(-5 * time.Hour)}},
+		{{MovieID: 5, Date: now.Add(-6 * time.Hour)}},
+	}
+	var fetched []int
+	fetch := func(page int) ([]*HistoryEvent, bool, error) {
+		fetched = append(fetched, page)
+		return pages[page-1], page == len(pages), nil
+	}
+
+	events, err := historySince(context.Background(), now.Add(-3*time.Hour), fetch)
+	if err != nil {
+		t.Fatalf("historySince: %v", err)
+	}
+	if len(events) != 3 || events[2].MovieID != 3 {
+		t.Errorf("events = %+v, want movies 1 to 3", events)
+	}
+	if len(fetched) != 2 {
+		t.Errorf("fetched pages %v, want to stop after page 2", fetched)
+	}
+
+	fetched = nil
+	events, err = historySince(context.Background(), now.Add(-24*time.Hour), fetch)
+	if err != nil || len(events) != 5 || len(fetched) != 3 {
+		t.Errorf("reading all pages: %d events from pages %v, %v", len(events), fetched, err)
+	}
+}
+
+func TestHistoryEventImported(t *testing.T) {
+	for eventType, want := range map[string]bool{
+		EventDownloadFolderImported: true,
+		EventSeriesFolderImported:   true,
+		EventMovieFolderImported:    true,
+		"grabbed":                   false,
+		"movieFileDeleted":          false,
+	} {
+		if got := (&HistoryEvent{EventType: eventType}).Imported(); got != want {
+			t.Errorf("Imported(%s) = %v, want %v", eventType, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package arrclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golift.io/starr"
+	"golift.io/starr/lidarr"
+)
+
+// LidarrClient wraps the golift/starr lidarr client.
+type LidarrClient struct {
+	client *lidarr.Lidarr
+}
+
+// NewLidarrClient creates a Lidarr client from a URL and decrypted API key.
+func NewLidarrClient(url, apiKey string) *LidarrClient {
+	config := starr.New(apiKey, url, defaultTimeout)
+	return &LidarrClient{client: lidarr.New(config)}
+}
+
+// TestConnection verifies connectivity by calling GetSystemStatus.
+func (l *LidarrClient) TestConnection(ctx context.Context) (*SystemInfo, error) {
+	status, err := l.client.GetSystemStatusContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lidarr connection test failed: %w", err)
+	}
+	return &SystemInfo{
+		AppName: status.AppName,
+		Version: status.Version,
+	}, nil
+}
+
+// GetRootFolders returns the root folders configured in Lidarr.
+func (l *LidarrClient) GetRootFolders(ctx context.Context) ([]*RootFolder, error) {
+	folders, err := l.client.GetRootFoldersContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting root folders: %w", err)
+	}
+	result := make([]*RootFolder, len(folders))
+	for i, f := range folders {
+		result[i] = &RootFolder{ID: f.ID, Path: f.Path}
+	}
+	return result, nil
+}
+
+// GetArtists returns all artists from Lidarr.
+func (l *LidarrClient) GetArtists(ctx context.Context) ([]*Artist, error) {
+	artists, err := l.client.GetArtistContext(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("getting artists: %w", err)
+	}
+	result := make([]*Artist, len(artists))
+	for i, a := range artists {
+		result[i] = &Artist{
+			ID:              a.ID,
+			ArtistName:      a.ArtistName,
+			ForeignArtistID: a.ForeignArtistID,
+			Path:            a.Path,
+			Monitored:       a.Monitored,
+			Statistics:      musicStatistics(a.Statistics),
+		}
+	}
+	return result, nil
+}
+
+// GetAlbums returns albums for an artist. Pass 0 to get all albums.
+func (l *LidarrClient) GetAlbums(ctx context.Context, artistID int64) ([]*Album, error) {
+	albums, err := l.client.GetAlbumContext(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("getting albums: %w", err)
+	}
+	return albumsFor(albums, artistID), nil
+}
+
+// albumsFor converts starr albums, keeping only those by artistID unless it
+// is 0.
+func albumsFor(albums []*lidarr.Album, artistID int64) []*Album {
+	result := []*Album{}
+	for _, a := range albums {
+		if artistID != 0 && a.ArtistID != artistID {
+			continue
+		}
+		album := &Album{
+			ID:             a.ID,
+			Title:          a.Title,
+			ForeignAlbumID: a.ForeignAlbumID,
+			ArtistID:       a.ArtistID,
+			Monitored:      a.Monitored,
+			Statistics:     musicStatistics(a.Statistics),
+		}
+		if !a.ReleaseDate.IsZero() {
+			album.ReleaseDate = a.ReleaseDate.Format(time.RFC3339)
+		}
+		result = append(result, album)
+	}
+	return result
+}
+
+func musicStatistics(s *lidarr.Statistics) *MusicStatistics {
+	if s == nil {
+		return nil
+	}
+	return &MusicStatistics{
+		TrackFileCount: s.TrackFileCount,
+		TrackCount:     s.TrackCount,
+		SizeOnDisk:     s.SizeOnDisk,
+	}
+}
+
+// DeleteArtist removes an artist with options for deleting files and adding an import exclusion.
+func (l *LidarrClient) DeleteArtist(ctx context.Context, artistID int64, deleteFiles, addImportExclusion bool) error {
+	err := l.client.DeleteArtistContext(ctx, artistID, deleteFiles, addImportExclusion)
+	if err != nil {
+		return fmt.Errorf("deleting artist %d: %w", artistID, err)
+	}
+	return nil
+}
+
+// DeleteAlbum removes an album with options for deleting files and adding an import exclusion.
+func (l *LidarrClient) DeleteAlbum(ctx context.Context, albumID int64, deleteFiles, addImportExclusion bool) error {
+	err := l.client.DeleteAlbumContext(ctx, albumID, deleteFiles, addImportExclusion)
+	if err != nil {
+		return fmt.Errorf("deleting album %d: %w", albumID, err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package arrclient
+
+import (
+	"testing"
+	"time"
+
+	"golift.io/starr/lidarr"
+)
+
+func TestAlbumsFor(t *testing.T) {
+	albums := []*lidarr.Album{
+		{ID: 10, Title: "OK Computer", ForeignAlbumID: "b1392450-e666-3926-a536-22c65f834433", ArtistID: 1,
+			ReleaseDate: time.Date(1997, 5, 21, 0, 0, 0, 0, time.UTC),
+			Statistics:  &lidarr.Statistics{TrackFileCount: 12, TrackCount: 12, SizeOnDisk: 524288000}},
+		{ID: 20, Title: "Dummy", ArtistID: 2},
+	}
+
+	all := albumsFor(albums, 0)
+	if len(all) != 2 {
+		t.Fatalf("albumsFor(0) = %d albums, want 2", len(all))
+	}
+	got := albumsFor(albums, 1)
+	if len(got) != 1 || got[0].ID != 10 || got[0].ReleaseDate != "1997-05-21T00:00:00Z" || got[0].Statistics.SizeOnDisk != 524288000 {
+		t.Fatalf("albumsFor(1) = %+v", got)
+	}
+	if all[1].ReleaseDate != "" || all[1].Statistics != nil {
+		t.Errorf("album without a date or statistics = %+v", all[1])
+	}
+}
@@ -3,6 +3,7 @@ package arrclient
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"golift.io/starr"
 	"golift.io/starr/radarr"
@@ -58,6 +59,68 @@ func (r *RadarrClient) DeleteMovie(ctx context.Context, movieID int64, deleteFil
 	return nil
 }
 
+// GetRootFolders returns the root folders configured in Radarr.
+func (r *RadarrClient) GetRootFolders(ctx context.Context) ([]*RootFolder, error) {
+	folders, err := r.client.GetRootFoldersContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting root folders: %w", err)
+	}
+	result := make([]*RootFolder, len(folders))
+	for i, f := range folders {
+		result[i] = &RootFolder{ID: f.ID, Path: f.Path}
+	}
+	return result, nil
+}
+
+// GetQueue returns every download Radarr is tracking.
+func (r *RadarrClient) GetQueue(ctx context.Context) ([]*QueueItem, error) {
+	queue, err := r.client.GetQueueContext(ctx, 0, queuePageSize)
+	if err != nil {
+		return nil, fmt.Errorf("getting queue: %w", err)
+	}
+	items := make([]*QueueItem, len(queue.Records))
+	for i, q := range queue.Records {
+		items[i] = &QueueItem{
+			ID:                   q.ID,
+			MovieID:              q.MovieID,
+			Title:                q.Title,
+			Status:               q.Status,
+			TrackedDownloadState: q.TrackedDownloadState,
+		}
+	}
+	return items, nil
+}
+
+// GetHistorySince returns Radarr's history events from since onwards, newest
+// first.
+func (r *RadarrClient) GetHistorySince(ctx context.Context, since time.Time) ([]*HistoryEvent, error) {
+	events, err := historySince(ctx, since, func(page int) ([]*HistoryEvent, bool, error) {
+		history, err := r.client.GetHistoryPageContext(ctx, &starr.PageReq{
+			Page:     page,
+			PageSize: historyPageSize,
+			SortKey:  "date",
+			SortDir:  starr.SortDescend,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		batch := make([]*HistoryEvent, len(history.Records))
+		for i, h := range history.Records {
+			batch[i] = &HistoryEvent{
+				MovieID:     h.MovieID,
+				SourceTitle: h.SourceTitle,
+				EventType:   h.EventType,
+				Date:        h.Date,
+			}
+		}
+		return batch, len(history.Records) < historyPageSize || page*historyPageSize >= history.TotalRecords, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting history: %w", err)
+	}
+	return events, nil
+}
+
 // GetRemotePathMappings returns the remote path mappings configured in Radarr.
 func (r *RadarrClient) GetRemotePathMappings(ctx context.Context) ([]*starr.RemotePathMapping, error) {
 	mappings, err := r.client.GetRemotePathMappingsContext(ctx)
@@ -66,3 +129,56 @@ func (r *RadarrClient) GetRemotePathMappings(ctx context.Context) ([]*starr.Remo
 	}
 	return mappings, nil
 }
+
+// Restore re-adds a previously deleted movie by TMDB ID and optionally
+// triggers a search. A matching import exclusion is removed only if the
+// deletion added it; otherwise it is reported as still blocking. A movie that
+// is already back counts as restored.
+func (r *RadarrClient) Restore(ctx context.Context, req RestoreRequest) (*RestoreResult, error) {
+	existing, err := r.client.GetMovieContext(ctx, &radarr.GetMovie{TMDBID: req.TMDBID})
+	if err != nil {
+		return nil, fmt.Errorf("looking up movie %d: %w", req.TMDBID, err)
+	}
+
+	result := &RestoreResult{}
+
+	exclusions, err := r.client.GetExclusionsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting import exclusions: %w", err)
+	}
+	for _, ex := range exclusions {
+		if ex.TMDBID != req.TMDBID {
+			continue
+		}
+		if !req.ImportExclusionAdded {
+			result.ExclusionBlocking = true
+			continue
+		}
+		if err := r.client.DeleteExclusionsContext(ctx, []int64{ex.ID}); err != nil {
+			return nil, fmt.Errorf("removing import exclusion %d: %w", ex.ID, err)
+		}
+		result.ExclusionRemoved = true
+	}
+
+	if len(existing) > 0 {
+		result.ID = existing[0].ID
+		result.AlreadyExisted = true
+		return result, nil
+	}
+
+	movie, err := r.client.AddMovieContext(ctx, &radarr.AddMovieInput{
+		Title:            req.Title,
+		Year:             req.Year,
+		TmdbID:           req.TMDBID,
+		QualityProfileID: req.QualityProfileID,
+		RootFolderPath:   req.RootFolderPath,
+		Monitored:        true,
+		AddOptions:       &radarr.AddMovieOptions{SearchForMovie: req.Search},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("adding movie %d: %w", req.TMDBID, err)
+	}
+	result.ID = movie.ID
+
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package arrclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golift.io/starr"
+	"golift.io/starr/readarr"
+)
+
+// ReadarrClient wraps the golift/starr readarr client.
+type ReadarrClient struct {
+	client *readarr.Readarr
+}
+
+// NewReadarrClient creates a Readarr client from a URL and decrypted API key.
+func NewReadarrClient(url, apiKey string) *ReadarrClient {
+	config := starr.New(apiKey, url, defaultTimeout)
+	return &ReadarrClient{client: readarr.New(config)}
+}
+
+// TestConnection verifies connectivity by calling GetSystemStatus.
+func (r *ReadarrClient) TestConnection(ctx context.Context) (*SystemInfo, error) {
+	status, err := r.client.GetSystemStatusContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("readarr connection test failed: %w", err)
+	}
+	return &SystemInfo{
+		AppName: status.AppName,
+		Version: status.Version,
+	}, nil
+}
+
+// GetRootFolders returns the root folders configured in Readarr.
+func (r *ReadarrClient) GetRootFolders(ctx context.Context) ([]*RootFolder, error) {
+	folders, err := r.client.GetRootFoldersContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting root folders: %w", err)
+	}
+	result := make([]*RootFolder, len(folders))
+	for i, f := range folders {
+		result[i] = &RootFolder{ID: f.ID, Path: f.Path}
+	}
+	return result, nil
+}
+
+// GetAuthors returns every author that has a book in Readarr. starr lists
+// authors only through their books, so each author is read from the book
+// listing once.
+func (r *ReadarrClient) GetAuthors(ctx context.Context) ([]*Author, error) {
+	books, err := r.client.GetBookContext(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("getting authors: %w", err)
+	}
+	return authorsOf(books), nil
+}
+
+// authorsOf returns the distinct authors of books, in the order first seen.
+func authorsOf(books []*readarr.Book) []*Author {
+	result := []*Author{}
+	seen := make(map[int64]bool)
+	for _, b := range books {
+		a := b.Author
+		if a == nil || seen[a.ID] {
+			continue
+		}
+		seen[a.ID] = true
+		result = append(result, &Author{
+			ID:              a.ID,
+			AuthorName:      a.AuthorName,
+			ForeignAuthorID: a.ForeignAuthorID,
+			Path:            a.Path,
+			Monitored:       a.Monitored,
+			Statistics:      bookStatistics(a.Statistics),
+		})
+	}
+	return result
+}
+
+// GetBooks returns books for an author. Pass 0 to get all books.
+func (r *ReadarrClient) GetBooks(ctx context.Context, authorID int64) ([]*Book, error) {
+	books, err := r.client.GetBookContext(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("getting books: %w", err)
+	}
+	return booksFor(books, authorID), nil
+}
+
+// booksFor converts starr books, keeping only those by authorID unless it
+// is 0.
+func booksFor(books []*readarr.Book, authorID int64) []*Book {
+	result := []*Book{}
+	for _, b := range books {
+		if authorID != 0 && b.AuthorID != authorID {
+			continue
+		}
+		book := &Book{
+			ID:            b.ID,
+			Title:         b.Title,
+			ForeignBookID: b.ForeignBookID,
+			AuthorID:      b.AuthorID,
+			Monitored:     b.Monitored,
+			Statistics:    bookStatistics(b.Statistics),
+		}
+		if !b.ReleaseDate.IsZero() {
+			book.ReleaseDate = b.ReleaseDate.Format(time.RFC3339)
+		}
+		result = append(result, book)
+	}
+	return result
+}
+
+func bookStatistics(s *readarr.Statistics) *BookStatistics {
+	if s == nil {
+		return nil
+	}
+	return &BookStatistics{
+		BookFileCount: s.BookFileCount,
+		BookCount:     s.BookCount,
+		SizeOnDisk:    s.SizeOnDisk,
+	}
+}
+
+// DeleteAuthor removes an author with options for deleting files and adding an import exclusion.
+func (r *ReadarrClient) DeleteAuthor(ctx context.Context, authorID int64, deleteFiles, addImportExclusion bool) error {
+	err := r.client.DeleteAuthorContext(ctx, authorID, deleteFiles, addImportExclusion)
+	if err != nil {
+		return fmt.Errorf("deleting author %d: %w", authorID, err)
+	}
+	return nil
+}
+
+// DeleteBook removes a book with options for deleting files and adding an import exclusion.
+func (r *ReadarrClient) DeleteBook(ctx context.Context, bookID int64, deleteFiles, addImportExclusion bool) error {
+	err := r.client.DeleteBookContext(ctx, bookID, deleteFiles, addImportExclusion)
+	if err != nil {
+		return fmt.Errorf("deleting book %d: %w", bookID, err)
+	}
+	return nil
+}
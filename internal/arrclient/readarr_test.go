@@ -0,0 +1,28 @@
+package arrclient
+
+import (
+	"testing"
+
+	"golift.io/starr/readarr"
+)
+
+func TestAuthorsAndBooks(t *testing.T) {
+	leGuin := &readarr.Author{ID: 3, AuthorName: "Ursula K. Le Guin", Path: "/books/Ursula K. Le Guin"}
+	books := []*readarr.Book{
+		{ID: 30, Title: "The Dispossessed", AuthorID: 3, Author: leGuin,
+			Statistics: &readarr.Statistics{BookFileCount: 1, BookCount: 1, SizeOnDisk: 1048576}},
+		{ID: 31, Title: "The Lathe of Heaven", AuthorID: 3, Author: leGuin},
+		{ID: 40, Title: "Kindred", AuthorID: 4, Author: &readarr.Author{ID: 4, AuthorName: "Octavia E. Butler"}},
+	}
+
+	authors := authorsOf(books)
+	if len(authors) != 2 || authors[0].AuthorName != "Ursula K. Le Guin" || authors[1].ID != 4 {
+		t.Fatalf("authorsOf = %+v, want each author once", authors)
+	}
+	if got := booksFor(books, 3); len(got) != 2 || got[0].Statistics.BookFileCount != 1 {
+		t.Fatalf("booksFor(3) = %+v", got)
+	}
+	if got := booksFor(books, 0); len(got) != 3 {
+		t.Errorf("booksFor(0) = %d books, want 3", len(got))
+	}
+}
@@ -3,6 +3,7 @@ package arrclient
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"golift.io/starr"
 	"golift.io/starr/sonarr"
@@ -78,6 +79,70 @@ func (s *SonarrClient) DeleteSeries(ctx context.Context, seriesID int, deleteFil
 	return nil
 }
 
+// GetRootFolders returns the root folders configured in Sonarr.
+func (s *SonarrClient) GetRootFolders(ctx context.Context) ([]*RootFolder, error) {
+	folders, err := s.client.GetRootFoldersContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting root folders: %w", err)
+	}
+	result := make([]*RootFolder, len(folders))
+	for i, f := range folders {
+		result[i] = &RootFolder{ID: f.ID, Path: f.Path}
+	}
+	return result, nil
+}
+
+// GetQueue returns every download Sonarr is tracking.
+func (s *SonarrClient) GetQueue(ctx context.Context) ([]*QueueItem, error) {
+	queue, err := s.client.GetQueueContext(ctx, 0, queuePageSize)
+	if err != nil {
+		return nil, fmt.Errorf("getting queue: %w", err)
+	}
+	items := make([]*QueueItem, len(queue.Records))
+	for i, q := range queue.Records {
+		items[i] = &QueueItem{
+			ID:                   q.ID,
+			SeriesID:             q.SeriesID,
+			EpisodeID:            q.EpisodeID,
+			Title:                q.Title,
+			Status:               q.Status,
+			TrackedDownloadState: q.TrackedDownloadState,
+		}
+	}
+	return items, nil
+}
+
+// GetHistorySince returns Sonarr's history events from since onwards, newest
+// first.
+func (s *SonarrClient) GetHistorySince(ctx context.Context, since time.Time) ([]*HistoryEvent, error) {
+	events, err := historySince(ctx, since, func(page int) ([]*HistoryEvent, bool, error) {
+		history, err := s.client.GetHistoryPageContext(ctx, &starr.PageReq{
+			Page:     page,
+			PageSize: historyPageSize,
+			SortKey:  "date",
+			SortDir:  starr.SortDescend,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		batch := make([]*HistoryEvent, len(history.Records))
+		for i, h := range history.Records {
+			batch[i] = &HistoryEvent{
+				SeriesID:    h.SeriesID,
+				EpisodeID:   h.EpisodeID,
+				SourceTitle: h.SourceTitle,
+				EventType:   h.EventType,
+				Date:        h.Date,
+			}
+		}
+		return batch, len(history.Records) < historyPageSize || page*historyPageSize >= history.TotalRecords, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting history: %w", err)
+	}
+	return events, nil
+}
+
 // GetRemotePathMappings returns the remote path mappings configured in Sonarr.
 func (s *SonarrClient) GetRemotePathMappings(ctx context.Context) ([]*starr.RemotePathMapping, error) {
 	mappings, err := s.client.GetRemotePathMappingsContext(ctx)
@@ -86,3 +151,56 @@ func (s *SonarrClient) GetRemotePathMappings(ctx context.Context) ([]*starr.Remo
 	}
 	return mappings, nil
 }
+
+// Restore re-adds a previously deleted series by TVDB ID and optionally
+// searches for missing episodes. A matching import exclusion is removed only
+// if the deletion added it; otherwise it is reported as still blocking. A
+// series that is already back counts as restored.
+func (s *SonarrClient) Restore(ctx context.Context, req RestoreRequest) (*RestoreResult, error) {
+	existing, err := s.client.GetSeriesContext(ctx, req.TVDBID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up series %d: %w", req.TVDBID, err)
+	}
+
+	result := &RestoreResult{}
+
+	exclusions, err := s.client.GetExclusionsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting import exclusions: %w", err)
+	}
+	for _, ex := range exclusions {
+		if ex.TVDBID != req.TVDBID {
+			continue
+		}
+		if !req.ImportExclusionAdded {
+			result.ExclusionBlocking = true
+			continue
+		}
+		if err := s.client.DeleteExclusionsContext(ctx, []int64{ex.ID}); err != nil {
+			return nil, fmt.Errorf("removing import exclusion %d: %w", ex.ID, err)
+		}
+		result.ExclusionRemoved = true
+	}
+
+	if len(existing) > 0 {
+		result.ID = existing[0].ID
+		result.AlreadyExisted = true
+		return result, nil
+	}
+
+	series, err := s.client.AddSeriesContext(ctx, &sonarr.AddSeriesInput{
+		Title:            req.Title,
+		TvdbID:           req.TVDBID,
+		QualityProfileID: req.QualityProfileID,
+		RootFolderPath:   req.RootFolderPath,
+		Monitored:        true,
+		SeasonFolder:     true,
+		AddOptions:       &sonarr.AddSeriesOptions{SearchForMissingEpisodes: req.Search},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("adding series %d: %w", req.TVDBID, err)
+	}
+	result.ID = series.ID
+
+	return result, nil
+}
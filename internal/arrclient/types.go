@@ -9,3 +9,89 @@ type SystemInfo struct {
 	AppName string `json:"appName"`
 	Version string `json:"version"`
 }
+
+// RootFolder is a folder an *arr instance keeps its media in.
+type RootFolder struct {
+	ID   int64  `json:"id"`
+	Path string `json:"path"`
+}
+
+// RestoreRequest describes a previously deleted title to re-add.
+type RestoreRequest struct {
+	Title            string
+	Year             int
+	TMDBID           int64
+	TVDBID           int64
+	QualityProfileID int64
+	RootFolderPath   string
+	Search           bool
+	// ImportExclusionAdded is whether the deletion added an import exclusion.
+	// Only then is a matching exclusion removed; one added by hand is left.
+	ImportExclusionAdded bool
+}
+
+// RestoreResult reports what a restore did on the *arr side. When the title
+// was already back, ID is the existing entry and AlreadyExisted is set.
+type RestoreResult struct {
+	ID                int64 `json:"id"`
+	AlreadyExisted    bool  `json:"alreadyExisted"`
+	ExclusionRemoved  bool  `json:"exclusionRemoved"`
+	ExclusionBlocking bool  `json:"exclusionBlocking"`
+}
+
+// Artist is a Lidarr artist. ForeignArtistID is the MusicBrainz artist ID.
+type Artist struct {
+	ID              int64            `json:"id"`
+	ArtistName      string           `json:"artistName"`
+	ForeignArtistID string           `json:"foreignArtistId"`
+	Path            string           `json:"path"`
+	Monitored       bool             `json:"monitored"`
+	Statistics      *MusicStatistics `json:"statistics,omitempty"`
+}
+
+// Album is a Lidarr album. ForeignAlbumID is the MusicBrainz release group ID.
+type Album struct {
+	ID             int64            `json:"id"`
+	Title          string           `json:"title"`
+	ForeignAlbumID string           `json:"foreignAlbumId"`
+	ArtistID       int64            `json:"artistId"`
+	Monitored      bool             `json:"monitored"`
+	ReleaseDate    string           `json:"releaseDate,omitempty"`
+	Statistics     *MusicStatistics `json:"statistics,omitempty"`
+}
+
+// MusicStatistics summarizes the files Lidarr holds for an artist or album.
+type MusicStatistics struct {
+	TrackFileCount int   `json:"trackFileCount"`
+	TrackCount     int   `json:"trackCount"`
+	SizeOnDisk     int64 `json:"sizeOnDisk"`
+}
+
+// Author is a Readarr author. ForeignAuthorID is the metadata source's
+// author ID.
+type Author struct {
+	ID              int64           `json:"id"`
+	AuthorName      string          `json:"authorName"`
+	ForeignAuthorID string          `json:"foreignAuthorId"`
+	Path            string          `json:"path"`
+	Monitored       bool            `json:"monitored"`
+	Statistics      *BookStatistics `json:"statistics,omitempty"`
+}
+
+// Book is a Readarr book.
+type Book struct {
+	ID            int64           `json:"id"`
+	Title         string          `json:"title"`
+	ForeignBookID string          `json:"foreignBookId"`
+	AuthorID      int64           `json:"authorId"`
+	Monitored     bool            `json:"monitored"`
+	ReleaseDate   string          `json:"releaseDate,omitempty"`
+	Statistics    *BookStatistics `json:"statistics,omitempty"`
+}
+
+// BookStatistics summarizes the files Readarr holds for an author or book.
+type BookStatistics struct {
+	BookFileCount int   `json:"bookFileCount"`
+	BookCount     int   `json:"bookCount"`
+	SizeOnDisk    int64 `json:"sizeOnDisk"`
+}
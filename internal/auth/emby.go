@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// EmbyAuthenticator checks a username and password against an Emby server.
+// It returns emby.ErrInvalidCredentials when Emby rejects them.
+type EmbyAuthenticator interface {
+	AuthenticateByName(ctx context.Context, username, password string) (*emby.User, error)
+}
+
+// UseEmbyAuth enables password logins for Emby users. Local accounts keep
+// logging in with their own password.
+func (s *Service) UseEmbyAuth(authenticator EmbyAuthenticator) {
+	s.emby = authenticator
+}
+
+// authenticateEmby signs in to Emby and returns the local account linked to
+// the Emby user, creating it on first login. The role follows Emby on every
+// login: Emby administrators become admins and other Emby users viewers. An
+// admin who loses Emby administrator rights is demoted unless they are the
+// last active admin.
+func (s *Service) authenticateEmby(ctx context.Context, username, password string) (*repository.User, error) {
+	embyUser, err := s.emby.AuthenticateByName(ctx, username, password)
+	if errors.Is(err, emby.ErrInvalidCredentials) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+	}
+	isAdmin := embyUser.Policy != nil && embyUser.Policy.IsAdministrator
+
+	user, err := s.users.GetByExternalID(ctx, repository.AuthProviderEmby, embyUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up linked user: %w", err)
+	}
+
+	if user != nil {
+		if user.Disabled {
+			return nil, nil
+		}
+		if err := s.syncExternalRole(ctx, user, embyRole(isAdmin)); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	existing, err := s.users.GetByUsername(ctx, embyUser.Name)
+	if err != nil {
+		return nil, fmt.Errorf("looking up user: %w", err)
+	}
+	if existing != nil {
+		log.Printf("Emby user '%s' not linked: the username belongs to another account", embyUser.Name)
+		return nil, nil
+	}
+
+	user = &repository.User{
+		ID:           uuid.New().String(),
+		Username:     embyUser.Name,
+		Role:         embyRole(isAdmin),
+		AuthProvider: repository.AuthProviderEmby,
+		ExternalID:   embyUser.ID,
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("creating user: %w", err)
+	}
+	log.Printf("Linked Emby user '%s' as %s", user.Username, user.Role)
+	return user, nil
+}
+
+// embyRole is the role of an Emby account.
+func embyRole(isAdmin bool) string {
+	if isAdmin {
+		return repository.RoleAdmin
+	}
+	return repository.RoleViewer
+}
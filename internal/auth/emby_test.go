@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// fakeEmby accepts each user's password and reports them with the given
+// administrator flag.
+type fakeEmby struct {
+	users map[string]*emby.User
+	err   error
+}
+
+func (f *fakeEmby) AuthenticateByName(_ context.Context, username, password string) (*emby.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	u, ok := f.users[username]
+	if !ok || password != "emby-pass" {
+		return nil, emby.ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+func embyUser(id, name string, admin bool) *emby.User {
+	return &emby.User{ID: id, Name: name, Policy: &emby.UserPolicy{IsAdministrator: admin}}
+}
+
+func TestEmbyLogin(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+	fake := &fakeEmby{users: map[string]*emby.User{
+		"dana":  embyUser("e-dana", "dana", false),
+		"erin":  embyUser("e-erin", "erin", true),
+		"alice": embyUser("e-alice", "alice", false),
+	}}
+	env.svc.UseEmbyAuth(fake)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantRole string // empty means login refused
+	}{
+		{name: "emby user becomes viewer", username: "dana", password: "emby-pass", wantRole: repository.RoleViewer},
+		{name: "emby administrator becomes admin", username: "erin", password: "emby-pass", wantRole: repository.RoleAdmin},
+		{name: "wrong emby password", username: "dana", password: "nope"},
+		{name: "unknown emby user", username: "frank", password: "emby-pass"},
+		{name: "local account keeps local password", username: "alice", password: "password", wantRole: repository.RoleViewer},
+		{name: "local account not taken over by emby", username: "alice", password: "emby-pass"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := env.svc.Authenticate(ctx, tt.username, tt.password)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if tt.wantRole == "" {
+				if user != nil {
+					t.Fatalf("expected login to be refused, got %+v", user)
+				}
+				return
+			}
+			if user == nil {
+				t.Fatal("expected login to succeed")
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("role: got %q, want %q", user.Role, tt.wantRole)
+			}
+		})
+	}
+
+	dana, err := env.svc.users.GetByExternalID(ctx, repository.AuthProviderEmby, "e-dana")
+	if err != nil || dana == nil || dana.Username != "dana" {
+		t.Fatalf("expected dana linked to her Emby user, got %+v, %v", dana, err)
+	}
+	if resp := toUserResponse(dana); resp.EmbyUserID != "e-dana" {
+		t.Errorf("expected embyUserId in response, got %q", resp.EmbyUserID)
+	}
+	if err := env.svc.ChangePassword(ctx, dana, "emby-pass", "new-password", ""); !errors.Is(err, ErrExternalPassword) {
+		t.Errorf("expected ErrExternalPassword, got %v", err)
+	}
+}
+
+func TestEmbyLoginSyncsAdministrator(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+	fake := &fakeEmby{users: map[string]*emby.User{"dana": embyUser("e-dana", "dana", true)}}
+	env.svc.UseEmbyAuth(fake)
+
+	user, err := env.svc.Authenticate(ctx, "dana", "emby-pass")
+	if err != nil || user == nil || user.Role != repository.RoleAdmin {
+		t.Fatalf("expected admin, got %+v, %v", user, err)
+	}
+
+	// Losing Emby administrator rights demotes to viewer on the next login,
+	// but not while they are the only active admin.
+	fake.users["dana"] = embyUser("e-dana", "dana", false)
+	admin, _ := env.svc.users.GetByID(ctx, "u-admin")
+	admin.Disabled = true
+	if err := env.svc.users.Update(ctx, admin); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	user, _ = env.svc.Authenticate(ctx, "dana", "emby-pass")
+	if user == nil || user.Role != repository.RoleAdmin {
+		t.Fatalf("expected last admin kept, got %+v", user)
+	}
+	admin.Disabled = false
+	if err := env.svc.users.Update(ctx, admin); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	user, _ = env.svc.Authenticate(ctx, "dana", "emby-pass")
+	if user == nil || user.Role != repository.RoleViewer {
+		t.Fatalf("expected demotion to viewer, got %+v", user)
+	}
+
+	// Disabled accounts stay locked out even with valid Emby credentials.
+	user.Disabled = true
+	if err := env.svc.users.Update(ctx, user); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if user, _ = env.svc.Authenticate(ctx, "dana", "emby-pass"); user != nil {
+		t.Fatal("expected disabled account to be refused")
+	}
+
+	fake.err = errors.New("connection refused")
+	if _, err := env.svc.Authenticate(ctx, "someone", "emby-pass"); !errors.Is(err, ErrAuthUnavailable) {
+		t.Errorf("expected ErrAuthUnavailable, got %v", err)
+	}
+}
+
+func TestEmbyAdminMFA(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+	env.svc.UseEmbyAuth(&fakeEmby{users: map[string]*emby.User{"dana": embyUser("e-dana", "dana", true)}})
+
+	admin, _ := env.svc.users.GetByUsername(ctx, "admin")
+	env.enrollTOTP(t, "admin")
+	if err := env.svc.SetMFAPolicy(ctx, admin, MFAPolicy{RequireForAdmins: true}); err != nil {
+		t.Fatalf("SetMFAPolicy: %v", err)
+	}
+
+	dana, err := env.svc.Authenticate(ctx, "dana", "emby-pass")
+	if err != nil || dana == nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if required, err := env.svc.MFAEnrollmentRequired(ctx, dana); err != nil || !required {
+		t.Fatalf("emby admin: expected enrollment required, got %v, %v", required, err)
+	}
+
+	env.enrollTOTP(t, "dana")
+	login := env.postLogin(t, `{"username":"dana","password":"emby-pass"}`)
+	if login.Code != http.StatusAccepted || sessionCookie(login) != nil {
+		t.Fatalf("expected a second factor challenge, got %d: %s", login.Code, login.Body.String())
+	}
+	if err := env.svc.DisableTOTP(ctx, dana, "emby-pass"); !errors.Is(err, ErrMFARequired) {
+		t.Errorf("expected required MFA to stay on, got %v", err)
+	}
+
+	// Without the policy, turning it off checks the password against Emby.
+	if err := env.svc.SetMFAPolicy(ctx, admin, MFAPolicy{}); err != nil {
+		t.Fatalf("SetMFAPolicy: %v", err)
+	}
+	if err := env.svc.DisableTOTP(ctx, dana, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("expected ErrIncorrectPassword, got %v", err)
+	}
+	if err := env.svc.DisableTOTP(ctx, dana, "emby-pass"); err != nil {
+		t.Errorf("DisableTOTP: %v", err)
+	}
+}
@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
 )
 
 type loginRequest struct {
@@ -12,24 +15,60 @@ type loginRequest struct {
 }
 
 type userResponse struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	ID                 string       `json:"id"`
+	Username           string       `json:"username"`
+	Role               string       `json:"role"`
+	Permissions        []Permission `json:"permissions"`
+	MustChangePassword bool         `json:"mustChangePassword"`
+	AuthProvider       string       `json:"authProvider"`
+	// EmbyUserID links the account to an Emby user so their own watch data
+	// can be shown.
+	EmbyUserID string `json:"embyUserId,omitempty"`
+	// MFAEnrollmentRequired is set when policy requires the user to set up
+	// two-factor authentication before using anything else.
+	MFAEnrollmentRequired bool `json:"mfaEnrollmentRequired,omitempty"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"` //nolint:gosec // request DTO, not a hardcoded secret
+	NewPassword     string `json:"newPassword"`     //nolint:gosec // request DTO, not a hardcoded secret
+}
+
+func toUserResponse(user *repository.User) userResponse {
+	resp := userResponse{
+		ID:                 user.ID,
+		Username:           user.Username,
+		Role:               user.Role,
+		Permissions:        Permissions(user.Role),
+		MustChangePassword: user.MustChangePassword,
+		AuthProvider:       user.AuthProvider,
+	}
+	if user.AuthProvider == repository.AuthProviderEmby {
+		resp.EmbyUserID = user.ExternalID
+	}
+	return resp
 }
 
 // LoginHandler authenticates a user and creates a session.
 // @Summary Login
-// @Description Authenticate with username and password to create a session
+// @Description Authenticate with username and password to create a session. Accounts with two-factor authentication get 202 with mfaRequired and must finish at /auth/login/mfa.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body loginRequest true "Login credentials"
 // @Success 200 {object} userResponse
+// @Success 202 {object} mfaChallengeResponse
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
-// @Failure 429 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 429 {object} map[string]string "Rate limited, or the username is locked after too many failed logins"
+// @Failure 502 {object} map[string]string
 // @Router /auth/login [post]
 func (s *Service) LoginHandler(c echo.Context) error {
+	if s.cfg.PasswordLoginDisabled {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "password login is disabled; sign in with single sign-on"})
+	}
+
 	var req loginRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
@@ -39,23 +78,42 @@ func (s *Service) LoginHandler(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "username and password are required"})
 	}
 
-	user, err := s.Authenticate(c.Request().Context(), req.Username, req.Password)
+	ctx := c.Request().Context()
+	lockedUntil, err := s.loginLockedUntil(ctx, req.Username, time.Now())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if !lockedUntil.IsZero() {
+		return s.lockedResponse(c, req.Username, lockedUntil)
+	}
+
+	user, err := s.Authenticate(ctx, req.Username, req.Password)
+	if errors.Is(err, ErrAuthUnavailable) {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 	}
 	if user == nil {
+		known, _ := s.users.GetByUsername(ctx, req.Username)
+		s.recordLoginFailure(c, req.Username, known, repository.LoginFailureInvalidCredentials)
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
 	}
 
-	if err := s.CreateSession(c.Response(), c.Request(), user.ID); err != nil {
+	challenged, err := s.startMFAChallenge(c, user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if challenged {
+		return c.JSON(http.StatusAccepted, mfaChallengeResponse{MFARequired: true})
+	}
+
+	if err := s.CreateSession(c.Response(), c.Request(), user.ID, c.RealIP()); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
 	}
+	s.recordLoginSuccess(c, user)
 
-	return c.JSON(http.StatusOK, userResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Role:     user.Role,
-	})
+	return c.JSON(http.StatusOK, toUserResponse(user))
 }
 
 // LogoutHandler destroys the current session.
@@ -90,9 +148,199 @@ func (s *Service) MeHandler(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "not authenticated"})
 	}
 
-	return c.JSON(http.StatusOK, userResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Role:     user.Role,
-	})
+	resp := toUserResponse(user)
+	if resp.MFAEnrollmentRequired, err = s.MFAEnrollmentRequired(c.Request().Context(), user); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// ChangePasswordHandler changes the current user's password.
+// @Summary Change my password
+// @Description Change the current user's password. Other sessions are logged out and any forced reset is cleared.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body changePasswordRequest true "Current and new password"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/password [put]
+func (s *Service) ChangePasswordHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+
+	var req changePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	ctx := c.Request().Context()
+	keepID := ""
+	if current, _ := s.CurrentSession(ctx, c.Request()); current != nil {
+		keepID = current.ID
+	}
+
+	err := s.ChangePassword(ctx, user, req.CurrentPassword, req.NewPassword, keepID)
+	if errors.Is(err, ErrIncorrectPassword) || errors.Is(err, ErrPasswordTooShort) || errors.Is(err, ErrExternalPassword) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to change password"})
+	}
+	return c.JSON(http.StatusOK, toUserResponse(user))
+}
+
+type sessionResponse struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IPAddress  string `json:"ipAddress"`
+	CreatedAt  string `json:"createdAt"`
+	LastSeenAt string `json:"lastSeenAt"`
+	ExpiresAt  string `json:"expiresAt"`
+	Current    bool   `json:"current"`
+}
+
+type revokedResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// ListSessionsHandler lists the current user's active sessions.
+// @Summary List my sessions
+// @Description List the current user's active sessions across devices
+// @Tags auth
+// @Produce json
+// @Success 200 {array} sessionResponse
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/sessions [get]
+func (s *Service) ListSessionsHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+
+	ctx := c.Request().Context()
+	records, err := s.ListSessions(ctx, user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list sessions"})
+	}
+	current, _ := s.CurrentSession(ctx, c.Request())
+
+	resp := make([]sessionResponse, len(records))
+	for i, record := range records {
+		resp[i] = sessionResponse{
+			ID:         record.ID,
+			UserAgent:  record.UserAgent,
+			IPAddress:  record.IPAddress,
+			CreatedAt:  record.CreatedAt,
+			LastSeenAt: record.LastSeenAt,
+			ExpiresAt:  record.ExpiresAt,
+			Current:    current != nil && current.ID == record.ID,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// RevokeSessionHandler revokes one of the current user's sessions.
+// @Summary Revoke a session
+// @Description Revoke one of the current user's sessions. Revoking the current session logs out.
+// @Tags auth
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/sessions/{id} [delete]
+func (s *Service) RevokeSessionHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+
+	ctx := c.Request().Context()
+	current, _ := s.CurrentSession(ctx, c.Request())
+
+	found, err := s.RevokeSession(ctx, user.ID, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to revoke session"})
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "session not found"})
+	}
+
+	if current != nil && current.ID == c.Param("id") {
+		_ = s.clearCookie(c.Response(), c.Request())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeOtherSessionsHandler revokes all of the current user's other sessions.
+// @Summary Revoke other sessions
+// @Description Log out every session of the current user except this one
+// @Tags auth
+// @Produce json
+// @Success 200 {object} revokedResponse
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/sessions [delete]
+func (s *Service) RevokeOtherSessionsHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+
+	ctx := c.Request().Context()
+	current, err := s.CurrentSession(ctx, c.Request())
+	if err != nil || current == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+
+	revoked, err := s.RevokeOtherSessions(ctx, user.ID, current.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to revoke sessions"})
+	}
+	return c.JSON(http.StatusOK, revokedResponse{Revoked: int64(revoked)})
+}
+
+// RevokeUserSessionsHandler revokes every session of a user. Requires users:manage.
+// @Summary Revoke a user's sessions
+// @Description Log out every session of the given user
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} revokedResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/{id}/sessions [delete]
+func (s *Service) RevokeUserSessionsHandler(c echo.Context) error {
+	admin, ok := c.Get("user").(*repository.User)
+	if !ok || !HasPermission(admin.Role, PermUsersManage) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "insufficient permissions"})
+	}
+
+	ctx := c.Request().Context()
+	target, err := s.users.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to look up user"})
+	}
+	if target == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+
+	revoked, err := s.RevokeUserSessions(ctx, target.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to revoke sessions"})
+	}
+	return c.JSON(http.StatusOK, revokedResponse{Revoked: revoked})
 }
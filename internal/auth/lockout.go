@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	// lockoutResetAfter is how long a username must go without a failed
+	// login before its failure count starts over.
+	lockoutResetAfter = 24 * time.Hour
+	// loginAuditRetention is how long login attempts are kept.
+	loginAuditRetention = 90 * 24 * time.Hour
+	// unknownUserAttemptsPerIP is how many failed logins for unknown
+	// usernames are kept for each address, so guessing names from one
+	// address cannot fill the audit log.
+	unknownUserAttemptsPerIP = 100
+
+	defaultLoginAttemptLimit = 100
+	maxLoginAttemptLimit     = 1000
+)
+
+type loginAttemptResponse struct {
+	ID        int64   `json:"id"`
+	Username  string  `json:"username"`
+	UserID    *string `json:"userId"`
+	IPAddress string  `json:"ipAddress"`
+	UserAgent string  `json:"userAgent"`
+	Success   bool    `json:"success"`
+	Reason    string  `json:"reason,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+type lockoutResponse struct {
+	Username     string `json:"username"`
+	FailedCount  int    `json:"failedCount"`
+	LockedUntil  string `json:"lockedUntil"`
+	LastFailedAt string `json:"lastFailedAt"`
+}
+
+// loginLockedUntil returns when username's lockout ends, or the zero time if
+// it is not locked.
+func (s *Service) loginLockedUntil(ctx context.Context, username string, now time.Time) (time.Time, error) {
+	lockout, err := s.attempts.GetLockout(ctx, username)
+	if err != nil || lockout == nil || lockout.LockedUntil == nil {
+		return time.Time{}, err
+	}
+	until, err := time.Parse(time.RFC3339, *lockout.LockedUntil)
+	if err != nil || !now.Before(until) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+// lockoutDuration is how long a username is locked after failures
+// consecutive failed logins. It doubles with each failure past the
+// threshold, up to the configured maximum.
+func (s *Service) lockoutDuration(failures int) time.Duration {
+	d := s.cfg.LockoutDuration
+	for i := s.cfg.LockoutThreshold; i < failures && d < s.cfg.LockoutMaxDuration; i++ {
+		d *= 2
+	}
+	return min(d, s.cfg.LockoutMaxDuration)
+}
+
+// recordLoginFailure audits a failed login for username and counts it toward
+// locking the account. user is nil when the username is unknown; such
+// failures are not counted, so guessing names cannot fill the lockout table,
+// and only the newest unknownUserAttemptsPerIP are kept for each address.
+// Errors are logged rather than returned so that the login response does
+// not depend on the audit log.
+func (s *Service) recordLoginFailure(c echo.Context, username string, user *repository.User, reason string) {
+	ctx := c.Request().Context()
+	now := time.Now().UTC()
+	s.recordLoginAttempt(c, username, user, false, reason, now)
+	log.Printf("Failed login for %q from %s: %s", username, c.RealIP(), reason)
+
+	if user == nil && reason == repository.LoginFailureInvalidCredentials {
+		if _, err := s.attempts.TrimUnknownUser(ctx, c.RealIP(), reason, unknownUserAttemptsPerIP); err != nil {
+			log.Printf("Failed to trim login attempts: %v", err)
+		}
+	}
+	if user == nil || reason == repository.LoginFailureLocked || s.cfg.LockoutThreshold == 0 {
+		return
+	}
+	failures, err := s.attempts.RecordFailure(ctx, username, now.Format(time.RFC3339), now.Add(-lockoutResetAfter).Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Failed to count failed login: %v", err)
+		return
+	}
+	if failures < s.cfg.LockoutThreshold {
+		return
+	}
+	lockFor := s.lockoutDuration(failures)
+	if err := s.attempts.SetLockedUntil(ctx, username, now.Add(lockFor).Format(time.RFC3339)); err != nil {
+		log.Printf("Failed to lock login: %v", err)
+		return
+	}
+	log.Printf("Locked logins for %q for %s after %d failed attempts", username, lockFor, failures)
+}
+
+// recordLoginSuccess audits a completed login and clears the user's failure
+// count.
+func (s *Service) recordLoginSuccess(c echo.Context, user *repository.User) {
+	now := time.Now().UTC()
+	s.recordLoginAttempt(c, user.Username, user, true, "", now)
+	if _, err := s.attempts.ClearLockout(c.Request().Context(), user.Username); err != nil {
+		log.Printf("Failed to clear failed logins: %v", err)
+	}
+}
+
+func (s *Service) recordLoginAttempt(c echo.Context, username string, user *repository.User, success bool, reason string, now time.Time) {
+	attempt := &repository.LoginAttempt{
+		Username:  username,
+		IPAddress: c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+		Success:   success,
+		Reason:    reason,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	if user != nil {
+		attempt.UserID = &user.ID
+	}
+	if err := s.attempts.Record(c.Request().Context(), attempt); err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+}
+
+// lockedResponse rejects a login for a locked username without checking its
+// credentials.
+func (s *Service) lockedResponse(c echo.Context, username string, until time.Time) error {
+	s.recordLoginFailure(c, username, nil, repository.LoginFailureLocked)
+	retryAfter := int(time.Until(until).Seconds()) + 1
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	return c.JSON(http.StatusTooManyRequests, map[string]string{
+		"error": "too many failed logins for this account, please try again later",
+	})
+}
+
+// pruneLoginAttempts drops audit entries past their retention and failure
+// counts that have expired, whose next failure would start over anyway.
+func (s *Service) pruneLoginAttempts(ctx context.Context, now time.Time) {
+	if _, err := s.attempts.DeleteBefore(ctx, now.Add(-loginAuditRetention).Format(time.RFC3339)); err != nil {
+		log.Printf("Failed to prune login attempts: %v", err)
+	}
+	if _, err := s.attempts.DeleteStaleLockouts(ctx, now.Format(time.RFC3339), now.Add(-lockoutResetAfter).Format(time.RFC3339)); err != nil {
+		log.Printf("Failed to prune login lockouts: %v", err)
+	}
+}
+
+// UnlockLogin clears a user's failed logins and any lockout, and reports
+// whether there was anything to clear.
+func (s *Service) UnlockLogin(ctx context.Context, user *repository.User) (bool, error) {
+	return s.attempts.ClearLockout(ctx, user.Username)
+}
+
+// ListLoginAttempts returns login attempts, newest first.
+func (s *Service) ListLoginAttempts(ctx context.Context, filter repository.LoginAttemptFilter) ([]*repository.LoginAttempt, error) {
+	return s.attempts.List(ctx, filter)
+}
+
+// ListLockouts returns usernames that are currently locked.
+func (s *Service) ListLockouts(ctx context.Context) ([]*repository.LoginLockout, error) {
+	return s.attempts.ListLocked(ctx, time.Now().UTC().Format(time.RFC3339))
+}
+
+// ListLoginAttemptsHandler lists the login audit log. Requires users:manage.
+// @Summary List login attempts
+// @Description List recent successful and failed logins, newest first. Attempts are kept for 90 days.
+// @Tags users
+// @Produce json
+// @Param username query string false "Only attempts for this username"
+// @Param failedOnly query bool false "Only failed attempts"
+// @Param limit query int false "Maximum results (default 100, max 1000)"
+// @Success 200 {array} loginAttemptResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/login-attempts [get]
+func (s *Service) ListLoginAttemptsHandler(c echo.Context) error {
+	admin, ok := c.Get("user").(*repository.User)
+	if !ok || !HasPermission(admin.Role, PermUsersManage) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "insufficient permissions"})
+	}
+
+	filter := repository.LoginAttemptFilter{
+		Username:   c.QueryParam("username"),
+		FailedOnly: c.QueryParam("failedOnly") == "true",
+		Limit:      defaultLoginAttemptLimit,
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLoginAttemptLimit {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("limit must be between 1 and %d", maxLoginAttemptLimit),
+			})
+		}
+		filter.Limit = limit
+	}
+
+	attempts, err := s.ListLoginAttempts(c.Request().Context(), filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list login attempts"})
+	}
+	resp := make([]loginAttemptResponse, len(attempts))
+	for i, a := range attempts {
+		resp[i] = loginAttemptResponse{
+			ID:        a.ID,
+			Username:  a.Username,
+			UserID:    a.UserID,
+			IPAddress: a.IPAddress,
+			UserAgent: a.UserAgent,
+			Success:   a.Success,
+			Reason:    a.Reason,
+			CreatedAt: a.CreatedAt,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// ListLockoutsHandler lists locked usernames. Requires users:manage.
+// @Summary List login lockouts
+// @Description List usernames that are locked after too many failed logins. Failures for unknown usernames are not counted.
+// @Tags users
+// @Produce json
+// @Success 200 {array} lockoutResponse
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/lockouts [get]
+func (s *Service) ListLockoutsHandler(c echo.Context) error {
+	admin, ok := c.Get("user").(*repository.User)
+	if !ok || !HasPermission(admin.Role, PermUsersManage) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "insufficient permissions"})
+	}
+
+	lockouts, err := s.ListLockouts(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list lockouts"})
+	}
+	resp := make([]lockoutResponse, len(lockouts))
+	for i, l := range lockouts {
+		resp[i] = lockoutResponse{
+			Username:     l.Username,
+			FailedCount:  l.FailedCount,
+			LockedUntil:  deref(l.LockedUntil),
+			LastFailedAt: l.LastFailedAt,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// UnlockUserHandler lifts a user's login lockout. Requires users:manage.
+// @Summary Unlock a user
+// @Description Clear a user's failed logins so they can log in again immediately
+// @Tags users
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/{id}/lockout [delete]
+func (s *Service) UnlockUserHandler(c echo.Context) error {
+	admin, ok := c.Get("user").(*repository.User)
+	if !ok || !HasPermission(admin.Role, PermUsersManage) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "insufficient permissions"})
+	}
+
+	ctx := c.Request().Context()
+	target, err := s.users.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to look up user"})
+	}
+	if target == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+
+	if _, err := s.UnlockLogin(ctx, target); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to unlock user"})
+	}
+	log.Printf("User %s unlocked logins for %q", admin.Username, target.Username)
+	return c.NoContent(http.StatusNoContent)
+}
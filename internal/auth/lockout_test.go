@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	env := setupTestService(t)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{9, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := env.svc.lockoutDuration(tt.failures); got != tt.want {
+			t.Errorf("%d failures: expected %s, got %s", tt.failures, tt.want, got)
+		}
+	}
+}
+
+func (env *testEnv) loginWith(t *testing.T, username, password string) int {
+	t.Helper()
+	req := `{"username":"` + username + `","password":"` + password + `"}`
+	return env.postLogin(t, req).Code
+}
+
+func TestLoginLockout(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+
+	for range 3 {
+		if code := env.loginWith(t, "alice", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", code)
+		}
+	}
+
+	// Locked: even the right password is refused, and it does not count as
+	// another failure.
+	rec := env.postLogin(t, `{"username":"alice","password":"password"}`)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d: %s", rec.Code, rec.Body.String())
+	}
+	lockout, err := env.attempts.GetLockout(ctx, "alice")
+	if err != nil || lockout == nil || lockout.FailedCount != 3 || lockout.LockedUntil == nil {
+		t.Fatalf("unexpected lockout %+v: %v", lockout, err)
+	}
+
+	// Unknown usernames are audited but never counted, so guessing names
+	// cannot grow the lockout table.
+	for range 3 {
+		if code := env.loginWith(t, "ghost", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for unknown username, got %d", code)
+		}
+	}
+	if lockout, _ := env.attempts.GetLockout(ctx, "ghost"); lockout != nil {
+		t.Fatalf("expected no lockout row for an unknown username, got %+v", lockout)
+	}
+	locked, err := env.svc.ListLockouts(ctx)
+	if err != nil || len(locked) != 1 {
+		t.Fatalf("expected 1 lockout, got %d: %v", len(locked), err)
+	}
+
+	attempts, err := env.svc.ListLoginAttempts(ctx, repository.LoginAttemptFilter{Username: "alice"})
+	if err != nil || len(attempts) != 4 {
+		t.Fatalf("expected 4 audited attempts, got %d: %v", len(attempts), err)
+	}
+	if a := attempts[0]; a.Success || a.Reason != repository.LoginFailureLocked || a.UserID != nil {
+		t.Errorf("unexpected latest attempt %+v", a)
+	}
+	if a := attempts[1]; a.Reason != repository.LoginFailureInvalidCredentials || a.UserID == nil || *a.UserID != "u-alice" {
+		t.Errorf("unexpected failed attempt %+v", a)
+	}
+
+	alice, _ := env.svc.users.GetByUsername(ctx, "alice")
+	if found, err := env.svc.UnlockLogin(ctx, alice); err != nil || !found {
+		t.Fatalf("UnlockLogin: %v, %v", found, err)
+	}
+	if code := env.loginWith(t, "alice", "password"); code != http.StatusOK {
+		t.Fatalf("expected login after unlock, got %d", code)
+	}
+
+	attempts, _ = env.svc.ListLoginAttempts(ctx, repository.LoginAttemptFilter{Username: "alice", Limit: 1})
+	if len(attempts) != 1 || !attempts[0].Success {
+		t.Errorf("expected successful login to be audited, got %+v", attempts)
+	}
+	if failed, _ := env.svc.ListLoginAttempts(ctx, repository.LoginAttemptFilter{FailedOnly: true}); len(failed) != 7 {
+		t.Errorf("expected 7 failed attempts, got %d", len(failed))
+	}
+}
+
+func TestPruneStaleLockouts(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+	reset := at(-lockoutResetAfter)
+
+	// stale failed long ago and was never locked, expired was locked but the
+	// lockout has ended, recent failed within the reset window, and locked
+	// is still locked.
+	for _, name := range []string{"stale", "expired", "recent", "locked"} {
+		failedAt := at(-48 * time.Hour)
+		if name == "recent" {
+			failedAt = at(-time.Hour)
+		}
+		if _, err := env.attempts.RecordFailure(ctx, name, failedAt, reset); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+	if err := env.attempts.SetLockedUntil(ctx, "expired", at(-47*time.Hour)); err != nil {
+		t.Fatalf("SetLockedUntil: %v", err)
+	}
+	if err := env.attempts.SetLockedUntil(ctx, "locked", at(time.Hour)); err != nil {
+		t.Fatalf("SetLockedUntil: %v", err)
+	}
+
+	env.svc.pruneLoginAttempts(ctx, now)
+
+	for name, kept := range map[string]bool{"stale": false, "expired": false, "recent": true, "locked": true} {
+		lockout, err := env.attempts.GetLockout(ctx, name)
+		if err != nil {
+			t.Fatalf("GetLockout: %v", err)
+		}
+		if (lockout != nil) != kept {
+			t.Errorf("%s: kept=%v, want %v", name, lockout != nil, kept)
+		}
+	}
+}
+
+func TestUnknownUserAttemptsCappedPerIP(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+	fail := func(ip, username string, user *repository.User) {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		env.svc.recordLoginFailure(echo.New().NewContext(req, httptest.NewRecorder()), username, user, repository.LoginFailureInvalidCredentials)
+	}
+
+	alice, _ := env.svc.users.GetByUsername(ctx, "alice")
+	fail("192.0.2.1", "alice", alice)
+	for i := range unknownUserAttemptsPerIP + 5 {
+		fail("192.0.2.1", fmt.Sprintf("ghost%d", i), nil)
+	}
+	fail("192.0.2.2", "ghost", nil)
+
+	attempts, err := env.svc.ListLoginAttempts(ctx, repository.LoginAttemptFilter{FailedOnly: true})
+	if err != nil {
+		t.Fatalf("ListLoginAttempts: %v", err)
+	}
+	if want := unknownUserAttemptsPerIP + 2; len(attempts) != want {
+		t.Fatalf("expected %d attempts, got %d", want, len(attempts))
+	}
+	if last := fmt.Sprintf("ghost%d", unknownUserAttemptsPerIP+4); attempts[1].Username != last {
+		t.Errorf("expected newest guess %s kept, got %s", last, attempts[1].Username)
+	}
+	if kept, _ := env.svc.ListLoginAttempts(ctx, repository.LoginAttemptFilter{Username: "ghost0"}); len(kept) != 0 {
+		t.Errorf("expected oldest guess trimmed, got %+v", kept)
+	}
+	if kept, _ := env.svc.ListLoginAttempts(ctx, repository.LoginAttemptFilter{Username: "alice"}); len(kept) != 1 {
+		t.Errorf("expected known user's failure kept, got %d", len(kept))
+	}
+}
+
+func TestMFAFailuresCountTowardLockout(t *testing.T) {
+	env := setupTestService(t)
+	env.enrollTOTP(t, "alice")
+
+	login := env.passwordLogin(t, "alice")
+	for range 3 {
+		env.finishMFALogin(t, login, `{"recoveryCode":"aaaaa-aaaaa"}`)
+	}
+	rec := env.finishMFALogin(t, login, `{"recoveryCode":"bbbbb-bbbbb"}`)
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "too many failed logins") {
+		t.Errorf("expected lockout after failed codes, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
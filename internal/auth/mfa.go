@@ -0,0 +1,692 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// mfaChallengeName is a short-lived cookie marking a login whose password
+	// was accepted and which now needs a second factor.
+	mfaChallengeName   = "media-reaper-mfa"
+	mfaChallengeMaxAge = 5 * 60
+	recoveryCodeCount  = 10
+)
+
+var (
+	ErrMFANotLocal            = errors.New("two-factor authentication is managed by your login provider")
+	ErrTOTPAlreadyEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled        = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode         = errors.New("invalid verification code")
+	ErrMFARequired            = errors.New("two-factor authentication is required for admin accounts")
+	ErrEnrollBeforeRequiring  = errors.New("enable two-factor authentication on your own account first")
+	errMFAChallengeNotPending = errors.New("no two-factor login in progress")
+)
+
+// SecretBox encrypts values stored at rest, such as TOTP secrets.
+type SecretBox interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+// MFAStatus describes a user's two-factor setup.
+type MFAStatus struct {
+	TOTPEnabled            bool `json:"totpEnabled"`
+	TOTPPending            bool `json:"totpPending"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+	// Required is true when policy requires this account to use two-factor
+	// authentication.
+	Required bool `json:"required"`
+}
+
+// MFAPolicy holds the two-factor settings admins can change.
+type MFAPolicy struct {
+	RequireForAdmins bool `json:"requireForAdmins"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// provisioning URI to show as a QR code.
+	URI string `json:"uri"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type disableTOTPRequest struct {
+	Password string `json:"password"` //nolint:gosec // request DTO, not a hardcoded secret
+}
+
+type mfaChallengeResponse struct {
+	MFARequired bool `json:"mfaRequired"`
+}
+
+// MFAStatus reports user's two-factor setup.
+func (s *Service) MFAStatus(ctx context.Context, user *repository.User) (*MFAStatus, error) {
+	totp, err := s.totpRepo.Get(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := s.mfaRequiredFor(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MFAStatus{Required: required}
+	if totp != nil {
+		status.TOTPEnabled = totp.Enabled
+		status.TOTPPending = !totp.Enabled
+		status.RecoveryCodesRemaining = len(totp.RecoveryCodes)
+	}
+	return status, nil
+}
+
+// BeginTOTP starts enrollment with a new secret. The enrollment is pending
+// until ConfirmTOTP checks a code from the user's authenticator app.
+func (s *Service) BeginTOTP(ctx context.Context, user *repository.User) (secret, uri string, err error) {
+	if !passwordLogin(user) {
+		return "", "", ErrMFANotLocal
+	}
+	existing, err := s.totpRepo.Get(ctx, user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if existing != nil && existing.Enabled {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+
+	secret, err = newTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	encrypted, err := s.secrets.Encrypt(secret)
+	if err != nil {
+		return "", "", fmt.Errorf("encrypting totp secret: %w", err)
+	}
+	if err := s.totpRepo.Save(ctx, &repository.TOTP{UserID: user.ID, EncryptedSecret: encrypted}); err != nil {
+		return "", "", err
+	}
+	return secret, totpURI(user.Username, secret), nil
+}
+
+// ConfirmTOTP enables a pending enrollment once the user proves their app
+// produces valid codes, and returns fresh recovery codes.
+func (s *Service) ConfirmTOTP(ctx context.Context, user *repository.User, code string) ([]string, error) {
+	totp, err := s.totpRepo.Get(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if totp.Enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	step, ok, err := s.matchTOTP(totp, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	totp.Enabled = true
+	totp.LastStep = step
+	totp.RecoveryCodes = hashes
+	if err := s.totpRepo.Save(ctx, totp); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP removes the user's enrollment after checking their password.
+// Accounts that policy requires to use two-factor authentication cannot
+// turn it off.
+func (s *Service) DisableTOTP(ctx context.Context, user *repository.User, password string) error {
+	if !passwordLogin(user) {
+		return ErrMFANotLocal
+	}
+	if err := s.checkPassword(ctx, user, password); err != nil {
+		return err
+	}
+	required, err := s.mfaRequiredFor(ctx, user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+	return s.totpRepo.Delete(ctx, user.ID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a
+// current authenticator code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, user *repository.User, code string) ([]string, error) {
+	totp, err := s.totpRepo.Get(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil || !totp.Enabled {
+		return nil, ErrTOTPNotEnrolled
+	}
+	ok, err := s.useTOTPCode(ctx, totp, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.totpRepo.ReplaceRecoveryCodes(ctx, user.ID, totp.RecoveryCodes, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ResetUserMFA removes a user's enrollment, for admins helping a user who
+// lost both their device and their recovery codes.
+func (s *Service) ResetUserMFA(ctx context.Context, userID string) error {
+	return s.totpRepo.Delete(ctx, userID)
+}
+
+// MFAPolicy returns the current two-factor policy.
+func (s *Service) MFAPolicy(ctx context.Context) (*MFAPolicy, error) {
+	value, err := s.settings.Get(ctx, repository.SettingRequireAdminMFA)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAPolicy{RequireForAdmins: value == "true"}, nil
+}
+
+// SetMFAPolicy updates the two-factor policy. An admin must have enrolled
+// themselves before requiring it of every admin, so they cannot lock
+// themselves into enrollment by accident.
+func (s *Service) SetMFAPolicy(ctx context.Context, caller *repository.User, policy MFAPolicy) error {
+	if policy.RequireForAdmins && passwordLogin(caller) {
+		totp, err := s.totpRepo.Get(ctx, caller.ID)
+		if err != nil {
+			return err
+		}
+		if totp == nil || !totp.Enabled {
+			return ErrEnrollBeforeRequiring
+		}
+	}
+	return s.settings.Set(ctx, repository.SettingRequireAdminMFA, fmt.Sprint(policy.RequireForAdmins))
+}
+
+// MFAEnrollmentRequired reports whether policy requires user to enroll in
+// two-factor authentication before doing anything else.
+func (s *Service) MFAEnrollmentRequired(ctx context.Context, user *repository.User) (bool, error) {
+	required, err := s.mfaRequiredFor(ctx, user)
+	if err != nil || !required {
+		return false, err
+	}
+	totp, err := s.totpRepo.Get(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return totp == nil || !totp.Enabled, nil
+}
+
+// mfaRequiredFor reports whether policy applies to user. It covers admins
+// who sign in with a password, local or Emby; single sign-on providers
+// handle their own second factor.
+func (s *Service) mfaRequiredFor(ctx context.Context, user *repository.User) (bool, error) {
+	if user.Role != repository.RoleAdmin || !passwordLogin(user) {
+		return false, nil
+	}
+	policy, err := s.MFAPolicy(ctx)
+	if err != nil {
+		return false, err
+	}
+	return policy.RequireForAdmins, nil
+}
+
+// passwordLogin reports whether user signs in with a password checked here,
+// against their local account or Emby, and so can use two-factor
+// authentication.
+func passwordLogin(user *repository.User) bool {
+	return user.AuthProvider == repository.AuthProviderLocal || user.AuthProvider == repository.AuthProviderEmby
+}
+
+// checkPassword checks a password the way user signs in: against the local
+// hash, or against Emby for linked Emby accounts.
+func (s *Service) checkPassword(ctx context.Context, user *repository.User, password string) error {
+	if user.AuthProvider != repository.AuthProviderEmby {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+			return ErrIncorrectPassword
+		}
+		return nil
+	}
+	if s.emby == nil {
+		return fmt.Errorf("%w: emby login is not configured", ErrAuthUnavailable)
+	}
+	embyUser, err := s.emby.AuthenticateByName(ctx, user.Username, password)
+	if errors.Is(err, emby.ErrInvalidCredentials) {
+		return ErrIncorrectPassword
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAuthUnavailable, err)
+	}
+	if embyUser.ID != user.ExternalID {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
+
+// verifyMFA checks a TOTP code or a recovery code for userID. Each code can
+// be used only once.
+func (s *Service) verifyMFA(ctx context.Context, userID, code, recoveryCode string) (bool, error) {
+	totp, err := s.totpRepo.Get(ctx, userID)
+	if err != nil || totp == nil || !totp.Enabled {
+		return false, err
+	}
+
+	if code != "" {
+		return s.useTOTPCode(ctx, totp, code)
+	}
+
+	hash := hashRecoveryCode(recoveryCode)
+	i := slices.Index(totp.RecoveryCodes, hash)
+	if recoveryCode == "" || i < 0 {
+		return false, nil
+	}
+	remaining := slices.Delete(slices.Clone(totp.RecoveryCodes), i, i+1)
+	return s.totpRepo.ReplaceRecoveryCodes(ctx, userID, totp.RecoveryCodes, remaining)
+}
+
+// useTOTPCode checks code and marks its time step used, so a code seen by an
+// attacker cannot be replayed.
+func (s *Service) useTOTPCode(ctx context.Context, totp *repository.TOTP, code string) (bool, error) {
+	step, ok, err := s.matchTOTP(totp, code)
+	if err != nil || !ok || step <= totp.LastStep {
+		return false, err
+	}
+	return s.totpRepo.AdvanceStep(ctx, totp.UserID, step)
+}
+
+func (s *Service) matchTOTP(totp *repository.TOTP, code string) (int64, bool, error) {
+	secret, err := s.secrets.Decrypt(totp.EncryptedSecret)
+	if err != nil {
+		return 0, false, fmt.Errorf("decrypting totp secret: %w", err)
+	}
+	step, ok := matchTOTP(secret, code, time.Now())
+	return step, ok, nil
+}
+
+// newRecoveryCodes returns recovery codes to show the user once and the
+// hashes to store.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(normalized)
+}
+
+// startMFAChallenge begins the second login step if user has two-factor
+// authentication enabled, and reports whether it did.
+func (s *Service) startMFAChallenge(c echo.Context, user *repository.User) (bool, error) {
+	totp, err := s.totpRepo.Get(c.Request().Context(), user.ID)
+	if err != nil || totp == nil || !totp.Enabled {
+		return false, err
+	}
+
+	challenge, _ := s.store.Get(c.Request(), mfaChallengeName)
+	challenge.Values["user_id"] = user.ID
+	challenge.Values["expires"] = time.Now().Add(mfaChallengeMaxAge * time.Second).Unix()
+	challenge.Options = s.mfaChallengeOptions(mfaChallengeMaxAge)
+	return true, challenge.Save(c.Request(), c.Response())
+}
+
+// pendingMFAUser returns the user whose login is waiting for a second factor.
+func (s *Service) pendingMFAUser(c echo.Context) (*repository.User, error) {
+	challenge, _ := s.store.Get(c.Request(), mfaChallengeName)
+	userID, _ := challenge.Values["user_id"].(string)
+	expires, _ := challenge.Values["expires"].(int64)
+	if userID == "" || time.Now().Unix() >= expires {
+		return nil, errMFAChallengeNotPending
+	}
+
+	user, err := s.users.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled {
+		return nil, errMFAChallengeNotPending
+	}
+	return user, nil
+}
+
+func (s *Service) mfaChallengeOptions(maxAge int) *sessions.Options {
+	return &sessions.Options{
+		Path:     "/api/auth/login",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   s.cfg.SecureCookies,
+	}
+}
+
+// MFALoginHandler completes a login that needs a second factor.
+// @Summary Complete two-factor login
+// @Description Finish a login that returned mfaRequired by sending a code from the authenticator app, or a one-time recovery code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body mfaCodeRequest true "Authenticator code or recovery code"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string "Rate limited, or the username is locked after too many failed logins"
+// @Router /auth/login/mfa [post]
+func (s *Service) MFALoginHandler(c echo.Context) error {
+	var req mfaCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code or recoveryCode is required"})
+	}
+
+	user, err := s.pendingMFAUser(c)
+	if errors.Is(err, errMFAChallengeNotPending) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "login expired; sign in again"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+
+	ctx := c.Request().Context()
+	lockedUntil, err := s.loginLockedUntil(ctx, user.Username, time.Now())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if !lockedUntil.IsZero() {
+		return s.lockedResponse(c, user.Username, lockedUntil)
+	}
+
+	ok, err := s.verifyMFA(ctx, user.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if !ok {
+		s.recordLoginFailure(c, user.Username, user, repository.LoginFailureInvalidMFACode)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": ErrInvalidMFACode.Error()})
+	}
+
+	challenge, _ := s.store.Get(c.Request(), mfaChallengeName)
+	challenge.Values = map[any]any{}
+	challenge.Options = s.mfaChallengeOptions(-1)
+	_ = challenge.Save(c.Request(), c.Response())
+
+	if err := s.CreateSession(c.Response(), c.Request(), user.ID, c.RealIP()); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create session"})
+	}
+	s.recordLoginSuccess(c, user)
+	return c.JSON(http.StatusOK, toUserResponse(user))
+}
+
+// MFAStatusHandler reports the current user's two-factor setup.
+// @Summary Two-factor status
+// @Description Report whether the current user has an authenticator app enrolled and how many recovery codes remain
+// @Tags auth
+// @Produce json
+// @Success 200 {object} MFAStatus
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/mfa [get]
+func (s *Service) MFAStatusHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+	status, err := s.MFAStatus(c.Request().Context(), user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to read two-factor status"})
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// BeginTOTPHandler starts authenticator app enrollment.
+// @Summary Start authenticator enrollment
+// @Description Generate a TOTP secret and otpauth:// provisioning URI to scan as a QR code. Enrollment takes effect after confirming a code.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} totpEnrollmentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/mfa/totp [post]
+func (s *Service) BeginTOTPHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+	secret, uri, err := s.BeginTOTP(c.Request().Context(), user)
+	if err != nil {
+		return mfaErrorResponse(c, err, "failed to start enrollment")
+	}
+	return c.JSON(http.StatusOK, totpEnrollmentResponse{Secret: secret, URI: uri})
+}
+
+// ConfirmTOTPHandler finishes authenticator app enrollment.
+// @Summary Confirm authenticator enrollment
+// @Description Enable two-factor authentication by confirming a code from the authenticator app. Returns recovery codes, shown only once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body mfaCodeRequest true "Authenticator code"
+// @Success 200 {object} recoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/mfa/totp/confirm [post]
+func (s *Service) ConfirmTOTPHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+	var req mfaCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	codes, err := s.ConfirmTOTP(c.Request().Context(), user, req.Code)
+	if err != nil {
+		return mfaErrorResponse(c, err, "failed to confirm enrollment")
+	}
+	return c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTPHandler turns off two-factor authentication.
+// @Summary Disable two-factor authentication
+// @Description Remove the authenticator app and recovery codes after confirming the current password. Not allowed when policy requires two-factor authentication.
+// @Tags auth
+// @Accept json
+// @Param request body disableTOTPRequest true "Current password"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/mfa/totp/disable [post]
+func (s *Service) DisableTOTPHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+	var req disableTOTPRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if err := s.DisableTOTP(c.Request().Context(), user, req.Password); err != nil {
+		return mfaErrorResponse(c, err, "failed to disable two-factor authentication")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodesHandler replaces the current user's recovery codes.
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes after confirming an authenticator code. The new codes are shown only once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body mfaCodeRequest true "Authenticator code"
+// @Success 200 {object} recoveryCodesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/mfa/recovery-codes [post]
+func (s *Service) RegenerateRecoveryCodesHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+	var req mfaCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	codes, err := s.RegenerateRecoveryCodes(c.Request().Context(), user, req.Code)
+	if err != nil {
+		return mfaErrorResponse(c, err, "failed to regenerate recovery codes")
+	}
+	return c.JSON(http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// MFAPolicyHandler returns the two-factor policy.
+// @Summary Two-factor policy
+// @Description Report whether two-factor authentication is required for admin accounts
+// @Tags auth
+// @Produce json
+// @Success 200 {object} MFAPolicy
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/mfa/policy [get]
+func (s *Service) MFAPolicyHandler(c echo.Context) error {
+	policy, err := s.MFAPolicy(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to read two-factor policy"})
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// UpdateMFAPolicyHandler changes the two-factor policy.
+// @Summary Update two-factor policy
+// @Description Require two-factor authentication for every local admin account. Admins without it must enroll before using anything else. You must have enrolled yourself first.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MFAPolicy true "Policy"
+// @Success 200 {object} MFAPolicy
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/mfa/policy [put]
+func (s *Service) UpdateMFAPolicyHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+	var policy MFAPolicy
+	if err := c.Bind(&policy); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if err := s.SetMFAPolicy(c.Request().Context(), user, policy); err != nil {
+		return mfaErrorResponse(c, err, "failed to update two-factor policy")
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// ResetUserMFAHandler removes another user's two-factor enrollment.
+// @Summary Reset a user's two-factor authentication
+// @Description Remove a user's authenticator app and recovery codes so they can log in with their password and enroll again
+// @Tags users
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/{id}/mfa [delete]
+func (s *Service) ResetUserMFAHandler(c echo.Context) error {
+	admin, ok := c.Get("user").(*repository.User)
+	if !ok || !HasPermission(admin.Role, PermUsersManage) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "insufficient permissions"})
+	}
+
+	ctx := c.Request().Context()
+	target, err := s.users.GetByID(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to look up user"})
+	}
+	if target == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	if err := s.ResetUserMFA(ctx, target.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to reset two-factor authentication"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// mfaErrorResponse maps two-factor errors to HTTP responses.
+func mfaErrorResponse(c echo.Context, err error, fallback string) error {
+	switch {
+	case errors.Is(err, ErrTOTPAlreadyEnabled), errors.Is(err, ErrMFARequired), errors.Is(err, ErrEnrollBeforeRequiring):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrMFANotLocal), errors.Is(err, ErrTOTPNotEnrolled),
+		errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrIncorrectPassword):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrAuthUnavailable):
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fallback})
+	}
+}
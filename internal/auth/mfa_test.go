@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1, truncated to six digits.
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(secret, tt.unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("totpCode: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("at %d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+
+	now := time.Unix(1111111109, 0)
+	if _, ok := matchTOTP(secret, "081 804", now.Add(totpPeriod*time.Second)); !ok {
+		t.Error("expected a code from the previous step to match")
+	}
+	if _, ok := matchTOTP(secret, "081804", now.Add(3*totpPeriod*time.Second)); ok {
+		t.Error("expected a stale code to be rejected")
+	}
+}
+
+// enrollTOTP enrolls username and returns its secret and recovery codes.
+func (env *testEnv) enrollTOTP(t *testing.T, username string) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	user, err := env.svc.users.GetByUsername(ctx, username)
+	if err != nil || user == nil {
+		t.Fatalf("looking up %s: %v", username, err)
+	}
+
+	secret, uri, err := env.svc.BeginTOTP(ctx, user)
+	if err != nil {
+		t.Fatalf("BeginTOTP: %v", err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/media-reaper:"+username+"?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected provisioning uri %q", uri)
+	}
+	if _, err := env.svc.ConfirmTOTP(ctx, user, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("expected a wrong code to be rejected, got %v", err)
+	}
+
+	code, _ := totpCode(secret, time.Now().Unix()/totpPeriod)
+	codes, err := env.svc.ConfirmTOTP(ctx, user, code)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes))
+	}
+	return secret, codes
+}
+
+// passwordLogin posts a login with the right password and returns the response.
+func (env *testEnv) passwordLogin(t *testing.T, username string) *httptest.ResponseRecorder {
+	t.Helper()
+	return env.postLogin(t, `{"username":"`+username+`","password":"password"}`)
+}
+
+func (env *testEnv) postLogin(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := env.svc.LoginHandler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("LoginHandler: %v", err)
+	}
+	return rec
+}
+
+// finishMFALogin sends the second login step with the cookies from login.
+func (env *testEnv) finishMFALogin(t *testing.T, login *httptest.ResponseRecorder, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login/mfa", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for _, c := range login.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	if err := env.svc.MFALoginHandler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("MFALoginHandler: %v", err)
+	}
+	return rec
+}
+
+func TestMFALogin(t *testing.T) {
+	env := setupTestService(t)
+	secret, recovery := env.enrollTOTP(t, "alice")
+
+	login := env.passwordLogin(t, "alice")
+	if login.Code != http.StatusAccepted || !strings.Contains(login.Body.String(), `"mfaRequired":true`) {
+		t.Fatalf("expected 202 mfaRequired, got %d: %s", login.Code, login.Body.String())
+	}
+	if sessionCookie(login) != nil {
+		t.Fatal("password step alone set a session cookie")
+	}
+
+	enrolled, err := env.totp.Get(context.Background(), "u-alice")
+	if err != nil || enrolled == nil {
+		t.Fatalf("reading enrollment: %v", err)
+	}
+	used, _ := totpCode(secret, enrolled.LastStep)
+	next, _ := totpCode(secret, enrolled.LastStep+1)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantSession bool
+	}{
+		{"code used during enrollment is not replayable", `{"code":"` + used + `"}`, false},
+		{"wrong recovery code", `{"recoveryCode":"aaaaa-aaaaa"}`, false},
+		{"fresh code", `{"code":"` + next + `"}`, true},
+		{"same code again", `{"code":"` + next + `"}`, false},
+		{"recovery code", `{"recoveryCode":"` + strings.ToUpper(recovery[0]) + `"}`, true},
+		{"recovery code is single use", `{"recoveryCode":"` + recovery[0] + `"}`, false},
+	}
+	for _, tt := range tests {
+		rec := env.finishMFALogin(t, login, tt.body)
+		if got := sessionCookie(rec) != nil; got != tt.wantSession {
+			t.Errorf("%s: expected session=%v, got %d: %s", tt.name, tt.wantSession, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Without the pending login cookie there is nothing to finish.
+	rec := env.finishMFALogin(t, httptest.NewRecorder(), `{"code":"`+next+`"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a pending login, got %d", rec.Code)
+	}
+
+	alice, _ := env.svc.users.GetByUsername(context.Background(), "alice")
+	status, err := env.svc.MFAStatus(context.Background(), alice)
+	if err != nil || !status.TOTPEnabled || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("unexpected status %+v: %v", status, err)
+	}
+}
+
+func TestAdminMFAPolicy(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+	admin, _ := env.svc.users.GetByUsername(ctx, "admin")
+	alice, _ := env.svc.users.GetByUsername(ctx, "alice")
+
+	if err := env.svc.SetMFAPolicy(ctx, admin, MFAPolicy{RequireForAdmins: true}); !errors.Is(err, ErrEnrollBeforeRequiring) {
+		t.Fatalf("expected ErrEnrollBeforeRequiring, got %v", err)
+	}
+
+	env.enrollTOTP(t, "admin")
+	if err := env.svc.SetMFAPolicy(ctx, admin, MFAPolicy{RequireForAdmins: true}); err != nil {
+		t.Fatalf("SetMFAPolicy: %v", err)
+	}
+	if err := env.svc.DisableTOTP(ctx, admin, "password"); !errors.Is(err, ErrMFARequired) {
+		t.Errorf("expected required MFA to stay on, got %v", err)
+	}
+
+	if required, err := env.svc.MFAEnrollmentRequired(ctx, admin); err != nil || required {
+		t.Errorf("enrolled admin: expected not required, got %v, %v", required, err)
+	}
+	if required, err := env.svc.MFAEnrollmentRequired(ctx, alice); err != nil || required {
+		t.Errorf("viewer: expected not required, got %v, %v", required, err)
+	}
+
+	// An admin reset leaves the account needing to enroll again.
+	if err := env.svc.ResetUserMFA(ctx, admin.ID); err != nil {
+		t.Fatalf("ResetUserMFA: %v", err)
+	}
+	if required, err := env.svc.MFAEnrollmentRequired(ctx, admin); err != nil || !required {
+		t.Errorf("reset admin: expected required, got %v, %v", required, err)
+	}
+
+	// The policy only covers admins, so other users can still turn two-factor
+	// off with their password.
+	env.enrollTOTP(t, "alice")
+	if err := env.svc.DisableTOTP(ctx, alice, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("expected ErrIncorrectPassword, got %v", err)
+	}
+	if err := env.svc.DisableTOTP(ctx, alice, "password"); err != nil {
+		t.Errorf("DisableTOTP: %v", err)
+	}
+	if rec := env.passwordLogin(t, "alice"); rec.Code != http.StatusOK {
+		t.Errorf("expected password-only login after disabling, got %d", rec.Code)
+	}
+}
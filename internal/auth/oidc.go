@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/oidc"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	// oidcFlowName is a short-lived cookie holding the state, nonce, and PKCE
+	// verifier between the redirect to the provider and the callback.
+	oidcFlowName   = "media-reaper-oidc"
+	oidcFlowMaxAge = 10 * 60
+)
+
+var (
+	ErrSSONoRole        = errors.New("no role is mapped for this account")
+	ErrSSOUsernameTaken = errors.New("username belongs to another account")
+	ErrSSOUserDisabled  = errors.New("account is disabled")
+)
+
+// roleRank orders roles so the most privileged mapped group wins.
+var roleRank = map[string]int{
+	repository.RoleViewer:   1,
+	repository.RoleOperator: 2,
+	repository.RoleAdmin:    3,
+}
+
+type providersResponse struct {
+	Password bool   `json:"password"`
+	OIDC     bool   `json:"oidc"`
+	OIDCName string `json:"oidcName,omitempty"`
+}
+
+// OIDCEnabled reports whether single sign-on is configured.
+func (s *Service) OIDCEnabled() bool {
+	return s.oidc != nil
+}
+
+// ProvisionOIDCUser returns the local account linked to the provider subject
+// in claims, creating it on first login. When a role mapping is configured the
+// account's role is re-synced from the provider's groups on every login,
+// except that the last active admin is not demoted.
+func (s *Service) ProvisionOIDCUser(ctx context.Context, claims oidc.Claims) (*repository.User, error) {
+	cfg := s.cfg.OIDC
+	sub := claims.String("sub")
+
+	role := s.oidcRole(claims.Strings(cfg.GroupsClaim))
+	if role == "" {
+		return nil, ErrSSONoRole
+	}
+
+	user, err := s.users.GetByExternalID(ctx, repository.AuthProviderOIDC, sub)
+	if err != nil {
+		return nil, fmt.Errorf("looking up linked user: %w", err)
+	}
+
+	if user != nil {
+		if user.Disabled {
+			return nil, ErrSSOUserDisabled
+		}
+		if len(cfg.RoleMapping) > 0 {
+			if err := s.syncExternalRole(ctx, user, role); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+
+	username := claims.String(cfg.UsernameClaim)
+	if username == "" {
+		username = claims.String("email")
+	}
+	if username == "" {
+		username = sub
+	}
+
+	existing, err := s.users.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("looking up user: %w", err)
+	}
+	if existing != nil {
+		return nil, ErrSSOUsernameTaken
+	}
+
+	user = &repository.User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		Role:         role,
+		AuthProvider: repository.AuthProviderOIDC,
+		ExternalID:   sub,
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("creating user: %w", err)
+	}
+	log.Printf("Provisioned user '%s' (%s) from single sign-on", username, role)
+	return user, nil
+}
+
+// oidcRole maps the provider's groups to the most privileged configured role,
+// falling back to the default role. It returns "" if the user gets no role.
+func (s *Service) oidcRole(groups []string) string {
+	role := ""
+	for _, g := range groups {
+		if r, ok := s.cfg.OIDC.RoleMapping[g]; ok && roleRank[r] > roleRank[role] {
+			role = r
+		}
+	}
+	if role == "" {
+		role = s.cfg.OIDC.DefaultRole
+	}
+	return role
+}
+
+// ProvidersHandler reports which login methods are available.
+// @Summary Login providers
+// @Description Report whether password login and single sign-on are available
+// @Tags auth
+// @Produce json
+// @Success 200 {object} providersResponse
+// @Router /auth/providers [get]
+func (s *Service) ProvidersHandler(c echo.Context) error {
+	resp := providersResponse{Password: !s.cfg.PasswordLoginDisabled, OIDC: s.OIDCEnabled()}
+	if resp.OIDC {
+		resp.OIDCName = s.cfg.OIDC.DisplayName
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// OIDCLoginHandler starts a single sign-on login.
+// @Summary Start single sign-on
+// @Description Redirect to the OpenID Connect provider using the authorization code flow with PKCE
+// @Tags auth
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/oidc/login [get]
+func (s *Service) OIDCLoginHandler(c echo.Context) error {
+	if s.oidc == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "single sign-on is not configured"})
+	}
+
+	values := make(map[string]string, 3)
+	for _, k := range []string{"state", "nonce", "verifier"} {
+		v, err := oidc.RandomString()
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
+		values[k] = v
+	}
+
+	authURL, err := s.oidc.AuthCodeURL(c.Request().Context(), values["state"], values["nonce"], values["verifier"])
+	if err != nil {
+		log.Printf("Single sign-on unavailable: %v", err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "single sign-on provider is unavailable"})
+	}
+
+	flow, _ := s.store.Get(c.Request(), oidcFlowName)
+	for k, v := range values {
+		flow.Values[k] = v
+	}
+	flow.Options = s.oidcFlowOptions(oidcFlowMaxAge)
+	if err := flow.Save(c.Request(), c.Response()); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallbackHandler completes a single sign-on login.
+// @Summary Single sign-on callback
+// @Description Exchange the authorization code, provision or link the account, and create a session. Redirects to the app, or to the login page with an error code.
+// @Tags auth
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login redirect"
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Router /auth/oidc/callback [get]
+func (s *Service) OIDCCallbackHandler(c echo.Context) error {
+	if s.oidc == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "single sign-on is not configured"})
+	}
+
+	// The flow cookie is single-use whatever the outcome.
+	flow, _ := s.store.Get(c.Request(), oidcFlowName)
+	state, _ := flow.Values["state"].(string)
+	nonce, _ := flow.Values["nonce"].(string)
+	verifier, _ := flow.Values["verifier"].(string)
+	flow.Options = s.oidcFlowOptions(-1)
+	_ = flow.Save(c.Request(), c.Response())
+
+	if c.QueryParam("error") != "" {
+		return loginRedirect(c, "sso_denied")
+	}
+	if state == "" || c.QueryParam("state") != state {
+		return loginRedirect(c, "sso_state_mismatch")
+	}
+
+	ctx := c.Request().Context()
+	claims, err := s.oidc.Exchange(ctx, c.QueryParam("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("Single sign-on login failed: %v", err)
+		return loginRedirect(c, "sso_failed")
+	}
+
+	user, err := s.ProvisionOIDCUser(ctx, claims)
+	switch {
+	case errors.Is(err, ErrSSONoRole):
+		return loginRedirect(c, "sso_no_role")
+	case errors.Is(err, ErrSSOUsernameTaken):
+		return loginRedirect(c, "sso_username_taken")
+	case errors.Is(err, ErrSSOUserDisabled):
+		return loginRedirect(c, "sso_disabled")
+	case err != nil:
+		log.Printf("Single sign-on provisioning failed: %v", err)
+		return loginRedirect(c, "sso_failed")
+	}
+
+	if err := s.CreateSession(c.Response(), c.Request(), user.ID, c.RealIP()); err != nil {
+		return loginRedirect(c, "sso_failed")
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
+
+func (s *Service) oidcFlowOptions(maxAge int) *sessions.Options {
+	return &sessions.Options{
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   s.cfg.SecureCookies,
+	}
+}
+
+func loginRedirect(c echo.Context, code string) error {
+	return c.Redirect(http.StatusFound, "/login?error="+url.QueryEscape(code))
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/sydlexius/media-reaper/internal/config"
+	"github.com/sydlexius/media-reaper/internal/oidc"
+	"github.com/sydlexius/media-reaper/internal/oidc/oidctest"
+	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+)
+
+const testRedirectURL = "http://localhost:8080/api/auth/oidc/callback"
+
+// withOIDC rebuilds env's service with single sign-on pointed at a mock provider.
+func (env *testEnv) withOIDC(t *testing.T, mapping map[string]string, defaultRole string) *oidctest.Server {
+	t.Helper()
+	provider := oidctest.NewServer("media-reaper")
+	t.Cleanup(provider.Close)
+
+	env.cfg.OIDC = config.OIDCConfig{
+		Issuer:        provider.Issuer(),
+		ClientID:      "media-reaper",
+		RedirectURL:   testRedirectURL,
+		DisplayName:   "Test SSO",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		RoleMapping:   mapping,
+		DefaultRole:   defaultRole,
+	}
+	env.svc = NewService(sqliterepo.NewUserRepository(env.db), env.sessions, env.tokens, env.totp, env.attempts, env.settings, env.secrets, env.cfg)
+	return provider
+}
+
+// ssoLogin runs the browser side of a single sign-on login and returns the
+// callback response.
+func (env *testEnv) ssoLogin(t *testing.T, provider *oidctest.Server, tamperState bool) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil)
+	if err := env.svc.OIDCLoginHandler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("OIDCLoginHandler: %v", err)
+	}
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: expected 302, got %d: %s", rec.Code, rec.Body.String())
+	}
+	flowCookies := rec.Result().Cookies()
+
+	client := provider.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(rec.Header().Get(echo.HeaderLocation))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	_ = resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(callback.String(), testRedirectURL) {
+		t.Fatalf("unexpected authorize redirect %q: %v", resp.Header.Get("Location"), err)
+	}
+	if tamperState {
+		q := callback.Query()
+		q.Set("state", "forged")
+		callback.RawQuery = q.Encode()
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+callback.RawQuery, nil)
+	for _, c := range flowCookies {
+		req.AddCookie(c)
+	}
+	if err := env.svc.OIDCCallbackHandler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("OIDCCallbackHandler: %v", err)
+	}
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: expected 302, got %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec
+}
+
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionName && c.MaxAge >= 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestOIDCLoginProvisionsAndLinksUser(t *testing.T) {
+	env := setupTestService(t)
+	provider := env.withOIDC(t, map[string]string{"media-admins": "admin", "media-ops": "operator"}, "viewer")
+	ctx := context.Background()
+	users := sqliterepo.NewUserRepository(env.db)
+
+	provider.SetUser(map[string]any{"sub": "sub-bob", "preferred_username": "bob", "groups": []string{"family", "media-ops"}})
+	rec := env.ssoLogin(t, provider, false)
+	if loc := rec.Header().Get(echo.HeaderLocation); loc != "/" {
+		t.Fatalf("expected redirect to /, got %q", loc)
+	}
+	cookie := sessionCookie(rec)
+	if cookie == nil {
+		t.Fatal("callback did not set a session cookie")
+	}
+
+	user, err := env.svc.GetUserFromSession(ctx, authedRequest(cookie))
+	if err != nil || user == nil {
+		t.Fatalf("session does not resolve to a user: %v", err)
+	}
+	if user.Username != "bob" || user.Role != "operator" || user.AuthProvider != "oidc" || user.ExternalID != "sub-bob" {
+		t.Errorf("unexpected provisioned user: %+v", user)
+	}
+
+	// A second login links the same account and re-syncs the role.
+	provider.SetUser(map[string]any{"sub": "sub-bob", "preferred_username": "bob", "groups": []string{"media-admins"}})
+	env.ssoLogin(t, provider, false)
+	linked, err := users.GetByExternalID(ctx, "oidc", "sub-bob")
+	if err != nil || linked == nil {
+		t.Fatalf("GetByExternalID: %v", err)
+	}
+	if linked.ID != user.ID || linked.Role != "admin" {
+		t.Errorf("expected same account promoted to admin, got %+v", linked)
+	}
+	if n, _ := users.Count(ctx); n != 3 {
+		t.Errorf("expected 3 users, got %d", n)
+	}
+
+	// SSO accounts have no password to log in with.
+	if u, err := env.svc.Authenticate(ctx, "bob", ""); err != nil || u != nil {
+		t.Errorf("expected password login to be refused for SSO user, got %v, %v", u, err)
+	}
+}
+
+func TestOIDCRoleSyncKeepsLastAdmin(t *testing.T) {
+	env := setupTestService(t)
+	env.withOIDC(t, map[string]string{"media-admins": "admin"}, "viewer")
+	ctx := context.Background()
+	users := sqliterepo.NewUserRepository(env.db)
+
+	admin := oidc.Claims{"sub": "sub-carol", "preferred_username": "carol", "groups": []any{"media-admins"}}
+	viewer := oidc.Claims{"sub": "sub-carol", "preferred_username": "carol", "groups": []any{"family"}}
+	if _, err := env.svc.ProvisionOIDCUser(ctx, admin); err != nil {
+		t.Fatalf("ProvisionOIDCUser: %v", err)
+	}
+
+	// With the local admin disabled, carol is the only admin left.
+	local, err := users.GetByID(ctx, "u-admin")
+	if err != nil || local == nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	local.Disabled = true
+	if err := users.Update(ctx, local); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	user, err := env.svc.ProvisionOIDCUser(ctx, viewer)
+	if err != nil {
+		t.Fatalf("ProvisionOIDCUser: %v", err)
+	}
+	if user.Role != "admin" {
+		t.Errorf("last admin demoted to %s by a group change", user.Role)
+	}
+
+	local.Disabled = false
+	if err := users.Update(ctx, local); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if user, err = env.svc.ProvisionOIDCUser(ctx, viewer); err != nil {
+		t.Fatalf("ProvisionOIDCUser: %v", err)
+	}
+	if user.Role != "viewer" {
+		t.Errorf("expected demotion to viewer with another admin, got %s", user.Role)
+	}
+}
+
+func TestOIDCLoginRejections(t *testing.T) {
+	tests := []struct {
+		name        string
+		claims      map[string]any
+		defaultRole string
+		tamper      bool
+		disable     bool
+		wantError   string
+	}{
+		{
+			name:      "state mismatch",
+			claims:    map[string]any{"sub": "s1", "preferred_username": "carol"},
+			tamper:    true,
+			wantError: "sso_state_mismatch",
+		},
+		{
+			name:      "no mapped group and no default role",
+			claims:    map[string]any{"sub": "s1", "preferred_username": "carol", "groups": []string{"family"}},
+			wantError: "sso_no_role",
+		},
+		{
+			name:        "username owned by local account",
+			claims:      map[string]any{"sub": "s1", "preferred_username": "alice"},
+			defaultRole: "viewer",
+			wantError:   "sso_username_taken",
+		},
+		{
+			name:        "linked account disabled",
+			claims:      map[string]any{"sub": "s1", "preferred_username": "carol"},
+			defaultRole: "viewer",
+			disable:     true,
+			wantError:   "sso_disabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setupTestService(t)
+			provider := env.withOIDC(t, map[string]string{"media-admins": "admin"}, tt.defaultRole)
+			provider.SetUser(tt.claims)
+
+			if tt.disable {
+				env.ssoLogin(t, provider, false)
+				if _, err := env.db.Exec(`UPDATE users SET disabled = 1 WHERE external_id = 's1'`); err != nil {
+					t.Fatalf("disabling user: %v", err)
+				}
+			}
+
+			rec := env.ssoLogin(t, provider, tt.tamper)
+			if loc := rec.Header().Get(echo.HeaderLocation); loc != "/login?error="+tt.wantError {
+				t.Errorf("expected error %s, got redirect %q", tt.wantError, loc)
+			}
+			if sessionCookie(rec) != nil {
+				t.Error("rejected login set a session cookie")
+			}
+		})
+	}
+}
+
+func TestPasswordLoginDisabled(t *testing.T) {
+	env := setupTestService(t)
+	env.withOIDC(t, nil, "viewer")
+	env.cfg.PasswordLoginDisabled = true
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login",
+		strings.NewReader(`{"username":"admin","password":"password"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := env.svc.LoginHandler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("LoginHandler: %v", err)
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := env.svc.ProvidersHandler(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/auth/providers", nil), rec)); err != nil {
+		t.Fatalf("ProvidersHandler: %v", err)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"password":false`) || !strings.Contains(body, `"oidcName":"Test SSO"`) {
+		t.Errorf("unexpected providers response: %s", body)
+	}
+}
+
+func authedRequest(cookie *http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.AddCookie(cookie)
+	return req
+}
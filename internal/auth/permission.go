@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"slices"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// Permission names an action a role may perform.
+type Permission string
+
+const (
+	PermConnectionsRead  Permission = "connections:read"
+	PermConnectionsWrite Permission = "connections:write"
+	PermRulesWrite       Permission = "rules:write"
+	PermActionsExecute   Permission = "actions:execute"
+	PermMediaRead        Permission = "media:read"
+	// PermActivityRead covers what every household member watched and what
+	// was deleted. Without it a user sees only their own plays and sessions.
+	PermActivityRead       Permission = "activity:read"
+	PermKeepRequest        Permission = "keep:request"
+	PermNotificationsWrite Permission = "notifications:write"
+	PermUsersManage        Permission = "users:manage"
+	PermSystemManage       Permission = "system:manage"
+)
+
+// rolePermissions maps each role to what it may do. Admins may do everything.
+var rolePermissions = map[string][]Permission{
+	repository.RoleAdmin: {
+		PermConnectionsRead, PermConnectionsWrite, PermRulesWrite, PermActionsExecute,
+		PermMediaRead, PermActivityRead, PermKeepRequest, PermNotificationsWrite, PermUsersManage, PermSystemManage,
+	},
+	repository.RoleOperator: {
+		PermConnectionsRead, PermConnectionsWrite, PermRulesWrite, PermActionsExecute,
+		PermMediaRead, PermActivityRead, PermKeepRequest, PermNotificationsWrite,
+	},
+	repository.RoleViewer: {
+		PermMediaRead, PermKeepRequest,
+	},
+}
+
+// HasPermission reports whether role grants perm. Unknown roles grant nothing.
+func HasPermission(role string, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// Permissions returns the permissions granted to role.
+func Permissions(role string) []Permission {
+	return slices.Clone(rolePermissions[role])
+}
@@ -4,30 +4,50 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/sessions"
 	"github.com/sydlexius/media-reaper/internal/config"
+	"github.com/sydlexius/media-reaper/internal/oidc"
 	"github.com/sydlexius/media-reaper/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	sessionName    = "media-reaper-session"
-	sessionUserKey = "user_id"
-	bcryptCost     = 12
+	sessionName = "media-reaper-session"
+	bcryptCost  = 12
+
+	// MinPasswordLength applies to passwords set through the API.
+	MinPasswordLength = 8
+)
+
+var (
+	ErrPasswordTooShort  = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrExternalPassword  = errors.New("this account's password is managed by its login provider")
+	ErrAuthUnavailable   = errors.New("login provider is unavailable")
 )
 
 type Service struct {
-	users repository.UserRepository
-	store sessions.Store
-	cfg   *config.Config
+	users       repository.UserRepository
+	sessionRepo repository.SessionRepository
+	tokenRepo   repository.APITokenRepository
+	totpRepo    repository.TOTPRepository
+	attempts    repository.LoginAttemptRepository
+	settings    repository.SettingsRepository
+	secrets     SecretBox
+	store       sessions.Store
+	cfg         *config.Config
+	oidc        *oidc.Provider    // nil unless single sign-on is configured
+	emby        EmbyAuthenticator // nil unless Emby logins are configured
 }
 
-func NewService(users repository.UserRepository, cfg *config.Config) *Service {
+func NewService(users repository.UserRepository, sessionRepo repository.SessionRepository, tokenRepo repository.APITokenRepository, totpRepo repository.TOTPRepository, attempts repository.LoginAttemptRepository, settings repository.SettingsRepository, secrets SecretBox, cfg *config.Config) *Service {
 	secret := cfg.SessionSecret
 	if secret == "" {
 		b := make([]byte, 32)
@@ -35,23 +55,60 @@ func NewService(users repository.UserRepository, cfg *config.Config) *Service {
 			log.Fatalf("Failed to generate session secret: %v", err)
 		}
 		secret = hex.EncodeToString(b)
-		log.Println("WARNING: No session secret configured. Generated a random one. Sessions will not persist across restarts.")
+		log.Println("WARNING: No session secret configured. Generated a random one. Users will need to log in again after a restart.")
 	}
 
 	store := sessions.NewCookieStore([]byte(secret))
 	store.Options = &sessions.Options{
 		Path:     "/",
-		MaxAge:   86400 * 7,
+		MaxAge:   int(cfg.SessionMaxAge.Seconds()),
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 		Secure:   cfg.SecureCookies,
 	}
 
-	return &Service{
-		users: users,
-		store: store,
-		cfg:   cfg,
+	svc := &Service{
+		users:       users,
+		sessionRepo: sessionRepo,
+		tokenRepo:   tokenRepo,
+		totpRepo:    totpRepo,
+		attempts:    attempts,
+		settings:    settings,
+		secrets:     secrets,
+		store:       store,
+		cfg:         cfg,
+	}
+	if cfg.OIDC.Enabled() {
+		svc.oidc = oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		}, nil)
+	}
+	return svc
+}
+
+// syncExternalRole sets the role a login provider grants an account. The last
+// active admin is never demoted this way, since nobody would be left to fix
+// it; the change is logged and skipped instead.
+func (s *Service) syncExternalRole(ctx context.Context, user *repository.User, role string) error {
+	if user.Role == role {
+		return nil
+	}
+	if user.Role == repository.RoleAdmin && !user.Disabled {
+		admins, err := s.users.CountActiveAdmins(ctx)
+		if err != nil {
+			return fmt.Errorf("counting admins: %w", err)
+		}
+		if admins <= 1 {
+			log.Printf("Not changing role of '%s' from admin to %s: they are the only active admin", user.Username, role)
+			return nil
+		}
 	}
+	user.Role = role
+	return s.users.Update(ctx, user)
 }
 
 func (s *Service) Bootstrap(ctx context.Context) error {
@@ -76,7 +133,7 @@ func (s *Service) Bootstrap(ctx context.Context) error {
 		ID:           uuid.New().String(),
 		Username:     s.cfg.AdminUser,
 		PasswordHash: string(hash),
-		Role:         "admin",
+		Role:         repository.RoleAdmin,
 	}
 
 	if err := s.users.Create(ctx, user); err != nil {
@@ -87,54 +144,72 @@ func (s *Service) Bootstrap(ctx context.Context) error {
 	return nil
 }
 
+// dummyHash is compared against when a login has no local password to check,
+// so unknown and disabled accounts take as long to refuse as a wrong password.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("media-reaper"), bcryptCost)
+	return hash
+})
+
+// Authenticate checks a username and password. Local accounts are checked
+// against their stored hash; when Emby logins are enabled, any other username
+// is checked against Emby. It returns nil if the credentials are not valid.
 func (s *Service) Authenticate(ctx context.Context, username, password string) (*repository.User, error) {
 	user, err := s.users.GetByUsername(ctx, username)
 	if err != nil {
 		return nil, fmt.Errorf("looking up user: %w", err)
 	}
-	if user == nil {
-		return nil, nil
+
+	if user != nil && user.AuthProvider == repository.AuthProviderLocal {
+		if user.Disabled {
+			_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+			return nil, nil
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+			return nil, nil
+		}
+		return user, nil
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+	if s.emby == nil || (user != nil && user.AuthProvider != repository.AuthProviderEmby) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
 		return nil, nil
 	}
-
-	return user, nil
-}
-
-func (s *Service) GetSession(r *http.Request) (*sessions.Session, error) {
-	return s.store.Get(r, sessionName)
+	return s.authenticateEmby(ctx, username, password)
 }
 
-func (s *Service) GetUserFromSession(ctx context.Context, r *http.Request) (*repository.User, error) {
-	sess, err := s.store.Get(r, sessionName)
+// HashPassword validates a new password and returns its bcrypt hash.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("hashing password: %w", err)
 	}
+	return string(hash), nil
+}
 
-	userID, ok := sess.Values[sessionUserKey].(string)
-	if !ok || userID == "" {
-		return nil, nil
+// ChangePassword replaces a user's password after checking the current one,
+// clears any forced reset, and logs out the user's other sessions.
+func (s *Service) ChangePassword(ctx context.Context, user *repository.User, current, next, keepSessionID string) error {
+	if user.AuthProvider != repository.AuthProviderLocal {
+		return ErrExternalPassword
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)); err != nil {
+		return ErrIncorrectPassword
 	}
 
-	return s.users.GetByID(ctx, userID)
-}
-
-func (s *Service) CreateSession(w http.ResponseWriter, r *http.Request, userID string) error {
-	sess, err := s.store.Get(r, sessionName)
+	hash, err := HashPassword(next)
 	if err != nil {
 		return err
 	}
-	sess.Values[sessionUserKey] = userID
-	return sess.Save(r, w)
-}
-
-func (s *Service) DestroySession(w http.ResponseWriter, r *http.Request) error {
-	sess, err := s.store.Get(r, sessionName)
-	if err != nil {
+	user.PasswordHash = hash
+	user.MustChangePassword = false
+	if err := s.users.Update(ctx, user); err != nil {
 		return err
 	}
-	sess.Options.MaxAge = -1
-	return sess.Save(r, w)
+
+	_, err = s.RevokeOtherSessions(ctx, user.ID, keepSessionID)
+	return err
 }
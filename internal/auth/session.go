@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	// sessionTokenKey holds the random session token in the signed cookie.
+	sessionTokenKey = "token"
+	// sessionTouchInterval limits how often a session's last-seen time is
+	// written, so every request does not cost a database write.
+	sessionTouchInterval = time.Minute
+)
+
+// CreateSession starts a server-side session for userID and sets the session
+// cookie. Expired sessions and old login attempts are pruned at the same time.
+func (s *Service) CreateSession(w http.ResponseWriter, r *http.Request, userID, ipAddress string) error {
+	ctx := r.Context()
+	now := time.Now().UTC()
+	s.pruneSessions(ctx, now)
+	s.pruneLoginAttempts(ctx, now)
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("generating session token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	record := &repository.Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		TokenHash:  hashToken(token),
+		UserAgent:  r.UserAgent(),
+		IPAddress:  ipAddress,
+		CreatedAt:  now.Format(time.RFC3339),
+		LastSeenAt: now.Format(time.RFC3339),
+		ExpiresAt:  now.Add(s.cfg.SessionMaxAge).Format(time.RFC3339),
+	}
+	if err := s.sessionRepo.Create(ctx, record); err != nil {
+		return err
+	}
+
+	// A cookie signed with an old secret fails to decode but still yields a
+	// fresh session to overwrite it with.
+	sess, err := s.store.Get(r, sessionName)
+	if sess == nil {
+		return err
+	}
+	sess.Values[sessionTokenKey] = token
+	return sess.Save(r, w)
+}
+
+// CurrentSession returns the live session for the request's cookie, or nil if
+// there is none or it has expired. It refreshes the session's last-seen time.
+func (s *Service) CurrentSession(ctx context.Context, r *http.Request) (*repository.Session, error) {
+	sess, err := s.store.Get(r, sessionName)
+	if err != nil {
+		return nil, err
+	}
+
+	token, ok := sess.Values[sessionTokenKey].(string)
+	if !ok || token == "" {
+		return nil, nil
+	}
+
+	record, err := s.sessionRepo.GetByTokenHash(ctx, hashToken(token))
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	lastSeen, expired := s.sessionExpired(record, now)
+	if expired {
+		if err := s.sessionRepo.Delete(ctx, record.ID); err != nil {
+			log.Printf("Failed to delete expired session %s: %v", record.ID, err)
+		}
+		return nil, nil
+	}
+
+	if now.Sub(lastSeen) >= sessionTouchInterval {
+		record.LastSeenAt = now.Format(time.RFC3339)
+		if err := s.sessionRepo.Touch(ctx, record.ID, record.LastSeenAt); err != nil {
+			log.Printf("Failed to update session %s: %v", record.ID, err)
+		}
+	}
+	return record, nil
+}
+
+// GetUserFromSession returns the user owning the request's session, or nil
+// if the request has no live session or the user is disabled.
+func (s *Service) GetUserFromSession(ctx context.Context, r *http.Request) (*repository.User, error) {
+	record, err := s.CurrentSession(ctx, r)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, record.UserID)
+	if err != nil || user == nil || user.Disabled {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DestroySession revokes the request's session and clears the cookie.
+func (s *Service) DestroySession(w http.ResponseWriter, r *http.Request) error {
+	if record, err := s.CurrentSession(r.Context(), r); err == nil && record != nil {
+		if err := s.sessionRepo.Delete(r.Context(), record.ID); err != nil {
+			return err
+		}
+	}
+	return s.clearCookie(w, r)
+}
+
+// ListSessions returns the live sessions of a user, most recently used first.
+func (s *Service) ListSessions(ctx context.Context, userID string) ([]*repository.Session, error) {
+	records, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	live := make([]*repository.Session, 0, len(records))
+	for _, record := range records {
+		if _, expired := s.sessionExpired(record, now); !expired {
+			live = append(live, record)
+		}
+	}
+	return live, nil
+}
+
+// RevokeSession deletes one of userID's sessions. It returns false if the
+// session does not exist or belongs to someone else.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID string) (bool, error) {
+	records, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	for _, record := range records {
+		if record.ID == sessionID {
+			return true, s.sessionRepo.Delete(ctx, sessionID)
+		}
+	}
+	return false, nil
+}
+
+// RevokeOtherSessions deletes all of userID's sessions except keepID.
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, keepID string) (int, error) {
+	records, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	revoked := 0
+	for _, record := range records {
+		if record.ID == keepID {
+			continue
+		}
+		if err := s.sessionRepo.Delete(ctx, record.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// RevokeUserSessions deletes every session belonging to userID.
+func (s *Service) RevokeUserSessions(ctx context.Context, userID string) (int64, error) {
+	return s.sessionRepo.DeleteByUser(ctx, userID)
+}
+
+// sessionExpired reports whether a session is past its absolute expiry or has
+// been idle too long, and returns its parsed last-seen time.
+func (s *Service) sessionExpired(record *repository.Session, now time.Time) (time.Time, bool) {
+	lastSeen, err := time.Parse(time.RFC3339, record.LastSeenAt)
+	if err != nil {
+		return time.Time{}, true
+	}
+	expiresAt, err := time.Parse(time.RFC3339, record.ExpiresAt)
+	if err != nil {
+		return lastSeen, true
+	}
+	return lastSeen, !now.Before(expiresAt) || now.Sub(lastSeen) >= s.cfg.SessionIdleTimeout
+}
+
+func (s *Service) pruneSessions(ctx context.Context, now time.Time) {
+	idleBefore := now.Add(-s.cfg.SessionIdleTimeout).Format(time.RFC3339)
+	if _, err := s.sessionRepo.DeleteExpired(ctx, now.Format(time.RFC3339), idleBefore); err != nil {
+		log.Printf("Failed to prune expired sessions: %v", err)
+	}
+}
+
+func (s *Service) clearCookie(w http.ResponseWriter, r *http.Request) error {
+	sess, err := s.store.Get(r, sessionName)
+	if sess == nil {
+		return err
+	}
+	sess.Values = map[any]any{}
+	sess.Options.MaxAge = -1
+	return sess.Save(r, w)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,464 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	_ "modernc.org/sqlite"
+
+	"github.com/sydlexius/media-reaper/internal/config"
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/repository"
+	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+)
+
+type testEnv struct {
+	svc      *Service
+	db       *sql.DB
+	cfg      *config.Config
+	sessions *sqliterepo.SessionRepository
+	tokens   *sqliterepo.APITokenRepository
+	totp     *sqliterepo.TOTPRepository
+	attempts *sqliterepo.LoginAttemptRepository
+	settings *sqliterepo.SettingsRepository
+	secrets  SecretBox
+}
+
+func setupTestService(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := db.Exec("PRAGMA foreign_keys=ON"); err != nil {
+		t.Fatalf("enabling foreign keys: %v", err)
+	}
+
+	schema := `
+	CREATE TABLE users (
+		id                   TEXT PRIMARY KEY,
+		username             TEXT NOT NULL UNIQUE,
+		password_hash        TEXT NOT NULL,
+		role                 TEXT NOT NULL DEFAULT 'admin',
+		disabled             INTEGER NOT NULL DEFAULT 0,
+		must_change_password INTEGER NOT NULL DEFAULT 0,
+		auth_provider        TEXT NOT NULL DEFAULT 'local',
+		external_id          TEXT,
+		created_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE sessions (
+		id           TEXT PRIMARY KEY,
+		user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash   TEXT NOT NULL UNIQUE,
+		user_agent   TEXT NOT NULL DEFAULT '',
+		ip_address   TEXT NOT NULL DEFAULT '',
+		created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at   TIMESTAMP NOT NULL
+	);
+	CREATE TABLE api_tokens (
+		id           TEXT PRIMARY KEY,
+		user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name         TEXT NOT NULL,
+		token_hash   TEXT NOT NULL UNIQUE,
+		prefix       TEXT NOT NULL,
+		scopes       TEXT NOT NULL DEFAULT '[]',
+		created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at   TIMESTAMP,
+		last_used_at TIMESTAMP
+	);
+	CREATE TABLE user_totp (
+		user_id          TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		encrypted_secret TEXT NOT NULL,
+		enabled          INTEGER NOT NULL DEFAULT 0,
+		last_step        INTEGER NOT NULL DEFAULT 0,
+		recovery_codes   TEXT NOT NULL DEFAULT '[]',
+		created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE login_attempts (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		username   TEXT NOT NULL,
+		user_id    TEXT REFERENCES users(id) ON DELETE SET NULL,
+		ip_address TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		success    INTEGER NOT NULL,
+		reason     TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE login_lockouts (
+		username       TEXT PRIMARY KEY,
+		failed_count   INTEGER NOT NULL DEFAULT 0,
+		locked_until   TIMESTAMP,
+		last_failed_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE app_settings (
+		key        TEXT PRIMARY KEY,
+		value      TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+
+	cfg := &config.Config{
+		SessionSecret:      "test-secret-test-secret-test-secret",
+		SessionIdleTimeout: time.Hour,
+		SessionMaxAge:      24 * time.Hour,
+		LockoutThreshold:   3,
+		LockoutDuration:    time.Minute,
+		LockoutMaxDuration: 4 * time.Minute,
+	}
+	users := sqliterepo.NewUserRepository(db)
+	sessions := sqliterepo.NewSessionRepository(db)
+	tokens := sqliterepo.NewAPITokenRepository(db)
+	totp := sqliterepo.NewTOTPRepository(db)
+	attempts := sqliterepo.NewLoginAttemptRepository(db)
+	settings := sqliterepo.NewSettingsRepository(db)
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	secrets, err := connection.NewEncryptor(hex.EncodeToString(key))
+	if err != nil {
+		t.Fatalf("creating encryptor: %v", err)
+	}
+	env := &testEnv{
+		svc: NewService(users, sessions, tokens, totp, attempts, settings, secrets, cfg), db: db, cfg: cfg,
+		sessions: sessions, tokens: tokens, totp: totp, attempts: attempts, settings: settings, secrets: secrets,
+	}
+
+	for _, u := range []struct{ id, name, role string }{
+		{"u-admin", "admin", "admin"},
+		{"u-alice", "alice", "viewer"},
+	} {
+		hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hashing password: %v", err)
+		}
+		if err := users.Create(context.Background(), &repository.User{ID: u.id, Username: u.name, PasswordHash: string(hash), Role: u.role}); err != nil {
+			t.Fatalf("creating user %s: %v", u.name, err)
+		}
+	}
+	return env
+}
+
+// login performs a login and returns the session cookie.
+func (env *testEnv) login(t *testing.T, username, userAgent string) *http.Cookie {
+	t.Helper()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login",
+		strings.NewReader(`{"username":"`+username+`","password":"password"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("User-Agent", userAgent)
+	rec := httptest.NewRecorder()
+	if err := env.svc.LoginHandler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("LoginHandler: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionName {
+			return c
+		}
+	}
+	t.Fatal("login did not set a session cookie")
+	return nil
+}
+
+// authed builds a context carrying cookie, with the user resolved the way
+// RequireAuth does.
+func (env *testEnv) authed(t *testing.T, method, path string, cookie *http.Cookie) (echo.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	e := echo.New()
+	req := httptest.NewRequest(method, path, nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	user, err := env.svc.GetUserFromSession(req.Context(), req)
+	if err != nil {
+		t.Fatalf("GetUserFromSession: %v", err)
+	}
+	if user != nil {
+		c.Set("user", user)
+	}
+	return c, rec
+}
+
+func (env *testEnv) userFor(t *testing.T, cookie *http.Cookie) *repository.User {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	user, err := env.svc.GetUserFromSession(req.Context(), req)
+	if err != nil {
+		t.Fatalf("GetUserFromSession: %v", err)
+	}
+	return user
+}
+
+func TestLogoutRevokesServerSideSession(t *testing.T) {
+	env := setupTestService(t)
+	cookie := env.login(t, "alice", "firefox")
+
+	if user := env.userFor(t, cookie); user == nil || user.Username != "alice" {
+		t.Fatalf("expected alice from session, got %+v", user)
+	}
+
+	c, rec := env.authed(t, http.MethodPost, "/api/auth/logout", cookie)
+	if err := env.svc.LogoutHandler(c); err != nil {
+		t.Fatalf("LogoutHandler: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logout: expected 200, got %d", rec.Code)
+	}
+
+	// Replaying the old cookie must not work once the session is revoked.
+	if user := env.userFor(t, cookie); user != nil {
+		t.Errorf("expected no user after logout, got %s", user.Username)
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		lastSeen  time.Duration
+		expiresIn time.Duration
+		wantValid bool
+	}{
+		{name: "active", lastSeen: -time.Minute, expiresIn: time.Hour, wantValid: true},
+		{name: "idle too long", lastSeen: -2 * time.Hour, expiresIn: time.Hour},
+		{name: "past absolute expiry", lastSeen: -time.Minute, expiresIn: -time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setupTestService(t)
+			cookie := env.login(t, "alice", "firefox")
+
+			now := time.Now().UTC()
+			if _, err := env.db.Exec(`UPDATE sessions SET last_seen_at = ?, expires_at = ?`,
+				now.Add(tt.lastSeen).Format(time.RFC3339), now.Add(tt.expiresIn).Format(time.RFC3339)); err != nil {
+				t.Fatalf("adjusting session: %v", err)
+			}
+
+			user := env.userFor(t, cookie)
+			if (user != nil) != tt.wantValid {
+				t.Errorf("valid: got %v, want %v", user != nil, tt.wantValid)
+			}
+
+			var remaining int
+			if err := env.db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&remaining); err != nil {
+				t.Fatalf("counting sessions: %v", err)
+			}
+			if tt.wantValid != (remaining == 1) {
+				t.Errorf("expected expired sessions to be deleted, %d remain", remaining)
+			}
+		})
+	}
+}
+
+func TestListAndRevokeOwnSessions(t *testing.T) {
+	env := setupTestService(t)
+	laptop := env.login(t, "alice", "laptop")
+	phone := env.login(t, "alice", "phone")
+	adminCookie := env.login(t, "admin", "desk")
+
+	c, rec := env.authed(t, http.MethodGet, "/api/auth/sessions", laptop)
+	if err := env.svc.ListSessionsHandler(c); err != nil {
+		t.Fatalf("ListSessionsHandler: %v", err)
+	}
+	var list []sessionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decoding sessions: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected alice to see 2 sessions, got %d", len(list))
+	}
+	var phoneID string
+	currentCount := 0
+	for _, s := range list {
+		if s.Current {
+			currentCount++
+			if s.UserAgent != "laptop" {
+				t.Errorf("current session should be the laptop, got %q", s.UserAgent)
+			}
+		}
+		if s.UserAgent == "phone" {
+			phoneID = s.ID
+		}
+	}
+	if currentCount != 1 {
+		t.Errorf("expected exactly one current session, got %d", currentCount)
+	}
+
+	// Another user cannot revoke alice's session.
+	adminSessions, err := env.svc.ListSessions(context.Background(), "u-admin")
+	if err != nil || len(adminSessions) != 1 {
+		t.Fatalf("listing admin sessions: %v (%d)", err, len(adminSessions))
+	}
+	c, rec = env.authed(t, http.MethodDelete, "/api/auth/sessions/"+adminSessions[0].ID, laptop)
+	c.SetParamNames("id")
+	c.SetParamValues(adminSessions[0].ID)
+	if err := env.svc.RevokeSessionHandler(c); err != nil {
+		t.Fatalf("RevokeSessionHandler: %v", err)
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("revoking another user's session: expected 404, got %d", rec.Code)
+	}
+	if env.userFor(t, adminCookie) == nil {
+		t.Error("admin session should still be valid")
+	}
+
+	c, rec = env.authed(t, http.MethodDelete, "/api/auth/sessions/"+phoneID, laptop)
+	c.SetParamNames("id")
+	c.SetParamValues(phoneID)
+	if err := env.svc.RevokeSessionHandler(c); err != nil {
+		t.Fatalf("RevokeSessionHandler: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if env.userFor(t, phone) != nil {
+		t.Error("revoked phone session should no longer authenticate")
+	}
+	if env.userFor(t, laptop) == nil {
+		t.Error("laptop session should still be valid")
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	env := setupTestService(t)
+	keep := env.login(t, "alice", "laptop")
+	other1 := env.login(t, "alice", "phone")
+	other2 := env.login(t, "alice", "tablet")
+
+	c, rec := env.authed(t, http.MethodDelete, "/api/auth/sessions", keep)
+	if err := env.svc.RevokeOtherSessionsHandler(c); err != nil {
+		t.Fatalf("RevokeOtherSessionsHandler: %v", err)
+	}
+	var resp revokedResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Revoked != 2 {
+		t.Errorf("expected 2 revoked, got %d", resp.Revoked)
+	}
+	if env.userFor(t, keep) == nil {
+		t.Error("current session should survive")
+	}
+	if env.userFor(t, other1) != nil || env.userFor(t, other2) != nil {
+		t.Error("other sessions should be revoked")
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   string
+		target   string
+		wantCode int
+	}{
+		{name: "admin kills user sessions", caller: "admin", target: "u-alice", wantCode: http.StatusOK},
+		{name: "non-admin forbidden", caller: "alice", target: "u-admin", wantCode: http.StatusForbidden},
+		{name: "unknown user", caller: "admin", target: "missing", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setupTestService(t)
+			aliceCookie := env.login(t, "alice", "laptop")
+			env.login(t, "alice", "phone")
+			callerCookie := env.login(t, tt.caller, "desk")
+
+			c, rec := env.authed(t, http.MethodDelete, "/api/users/"+tt.target+"/sessions", callerCookie)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.target)
+			if err := env.svc.RevokeUserSessionsHandler(c); err != nil {
+				t.Fatalf("RevokeUserSessionsHandler: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if tt.wantCode == http.StatusOK && env.userFor(t, aliceCookie) != nil {
+				t.Error("alice's sessions should be revoked")
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	env := setupTestService(t)
+	current := env.login(t, "alice", "laptop")
+	other := env.login(t, "alice", "phone")
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "wrong current password", body: `{"currentPassword":"nope","newPassword":"brand-new-pass"}`, wantCode: http.StatusBadRequest},
+		{name: "too short", body: `{"currentPassword":"password","newPassword":"short"}`, wantCode: http.StatusBadRequest},
+		{name: "valid", body: `{"currentPassword":"password","newPassword":"brand-new-pass"}`, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := env.authed(t, http.MethodPut, "/api/auth/password", current)
+			req := httptest.NewRequest(http.MethodPut, "/api/auth/password", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.AddCookie(current)
+			c.SetRequest(req)
+
+			if err := env.svc.ChangePasswordHandler(c); err != nil {
+				t.Fatalf("ChangePasswordHandler: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if user, err := env.svc.Authenticate(context.Background(), "alice", "brand-new-pass"); err != nil || user == nil {
+		t.Errorf("expected new password to work: %v", err)
+	}
+	if env.userFor(t, current) == nil {
+		t.Error("the session that changed the password should survive")
+	}
+	if env.userFor(t, other) != nil {
+		t.Error("other sessions should be logged out after a password change")
+	}
+}
+
+func TestDisabledUserCannotAuthenticate(t *testing.T) {
+	env := setupTestService(t)
+	cookie := env.login(t, "alice", "laptop")
+
+	if _, err := env.db.Exec(`UPDATE users SET disabled = 1 WHERE username = 'alice'`); err != nil {
+		t.Fatalf("disabling user: %v", err)
+	}
+	if env.userFor(t, cookie) != nil {
+		t.Error("disabled user's session should not authenticate")
+	}
+	if user, err := env.svc.Authenticate(context.Background(), "alice", "password"); err != nil || user != nil {
+		t.Errorf("disabled user should not log in: %+v, %v", user, err)
+	}
+}
@@ -0,0 +1,275 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	// apiTokenPrefix marks media-reaper tokens so they are easy to spot in
+	// scripts and secret scanners.
+	apiTokenPrefix = "mr_"
+	// apiTokenDisplayLength is how much of a token is kept to identify it.
+	apiTokenDisplayLength = len(apiTokenPrefix) + 8
+	maxTokenNameLength    = 100
+	maxTokenLifetimeDays  = 3650
+)
+
+var ErrInvalidTokenRequest = errors.New("invalid token request")
+
+// CreateTokenInput describes a new API token. Scopes must be permissions the
+// user's role grants. ExpiresInDays of 0 means the token never expires.
+type CreateTokenInput struct {
+	Name          string       `json:"name"`
+	Scopes        []Permission `json:"scopes"`
+	ExpiresInDays int          `json:"expiresInDays"`
+}
+
+type tokenResponse struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"createdAt"`
+	ExpiresAt  *string  `json:"expiresAt"`
+	LastUsedAt *string  `json:"lastUsedAt"`
+	Expired    bool     `json:"expired"`
+}
+
+type createdTokenResponse struct {
+	tokenResponse
+	// Token is the secret itself. It is returned only once.
+	Token string `json:"token"`
+}
+
+// CreateToken issues an API token for user and returns it with the plaintext
+// token, which is not stored.
+func (s *Service) CreateToken(ctx context.Context, user *repository.User, in CreateTokenInput) (*repository.APIToken, string, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		return nil, "", fmt.Errorf("%w: name is required and at most %d characters", ErrInvalidTokenRequest, maxTokenNameLength)
+	}
+	if len(in.Scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidTokenRequest)
+	}
+	if in.ExpiresInDays < 0 || in.ExpiresInDays > maxTokenLifetimeDays {
+		return nil, "", fmt.Errorf("%w: expiresInDays must be between 0 and %d", ErrInvalidTokenRequest, maxTokenLifetimeDays)
+	}
+
+	scopes := make([]string, 0, len(in.Scopes))
+	for _, scope := range in.Scopes {
+		if !HasPermission(user.Role, scope) {
+			return nil, "", fmt.Errorf("%w: scope %q is not granted to the %s role", ErrInvalidTokenRequest, scope, user.Role)
+		}
+		if !slices.Contains(scopes, string(scope)) {
+			scopes = append(scopes, string(scope))
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("generating api token: %w", err)
+	}
+	raw := apiTokenPrefix + hex.EncodeToString(b)
+
+	now := time.Now().UTC()
+	token := &repository.APIToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hashToken(raw),
+		Prefix:    raw[:apiTokenDisplayLength],
+		Scopes:    scopes,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	if in.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, in.ExpiresInDays).Format(time.RFC3339)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, "", err
+	}
+	return token, raw, nil
+}
+
+// ListTokens returns userID's API tokens, including expired ones.
+func (s *Service) ListTokens(ctx context.Context, userID string) ([]*repository.APIToken, error) {
+	return s.tokenRepo.ListByUser(ctx, userID)
+}
+
+// RevokeToken deletes one of userID's tokens and reports whether it existed.
+func (s *Service) RevokeToken(ctx context.Context, userID, id string) (bool, error) {
+	return s.tokenRepo.Delete(ctx, userID, id)
+}
+
+// AuthenticateToken resolves a raw API token to its user. It returns nils if
+// the token is unknown or expired, or its user is disabled. The token's
+// last-used time is refreshed.
+func (s *Service) AuthenticateToken(ctx context.Context, raw string) (*repository.User, *repository.APIToken, error) {
+	if !strings.HasPrefix(raw, apiTokenPrefix) {
+		return nil, nil, nil
+	}
+	token, err := s.tokenRepo.GetByTokenHash(ctx, hashToken(raw))
+	if err != nil || token == nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	if tokenExpired(token, now) {
+		return nil, nil, nil
+	}
+
+	user, err := s.users.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("looking up token user: %w", err)
+	}
+	if user == nil || user.Disabled {
+		return nil, nil, nil
+	}
+
+	if lastUsed, err := time.Parse(time.RFC3339, deref(token.LastUsedAt)); err != nil || now.Sub(lastUsed) >= sessionTouchInterval {
+		stamp := now.Format(time.RFC3339)
+		if err := s.tokenRepo.Touch(ctx, token.ID, stamp); err != nil {
+			log.Printf("Failed to record API token use: %v", err)
+		}
+		token.LastUsedAt = &stamp
+	}
+	return user, token, nil
+}
+
+// TokenAllows reports whether an API token was granted perm. The user's role
+// must grant it too; RequirePermission checks both.
+func TokenAllows(token *repository.APIToken, perm Permission) bool {
+	return slices.Contains(token.Scopes, string(perm))
+}
+
+func tokenExpired(token *repository.APIToken, now time.Time) bool {
+	if token.ExpiresAt == nil {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, *token.ExpiresAt)
+	return err != nil || !now.Before(expiresAt)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func toTokenResponse(token *repository.APIToken, now time.Time) tokenResponse {
+	return tokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		Expired:    tokenExpired(token, now),
+	}
+}
+
+// CreateTokenHandler issues an API token for the current user.
+// @Summary Create API token
+// @Description Create a personal API token for scripts. Send it as "Authorization: Bearer <token>" or "X-Api-Key: <token>". The token is shown only in this response.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body CreateTokenInput true "Token name, scopes, and lifetime"
+// @Success 201 {object} createdTokenResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/tokens [post]
+func (s *Service) CreateTokenHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+
+	var in CreateTokenInput
+	if err := c.Bind(&in); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	token, raw, err := s.CreateToken(c.Request().Context(), user, in)
+	if errors.Is(err, ErrInvalidTokenRequest) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
+	}
+	return c.JSON(http.StatusCreated, createdTokenResponse{tokenResponse: toTokenResponse(token, time.Now()), Token: raw})
+}
+
+// ListTokensHandler lists the current user's API tokens.
+// @Summary List API tokens
+// @Description List the current user's API tokens. Secrets are never returned.
+// @Tags auth
+// @Produce json
+// @Success 200 {array} tokenResponse
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/tokens [get]
+func (s *Service) ListTokensHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+
+	tokens, err := s.ListTokens(c.Request().Context(), user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list tokens"})
+	}
+
+	now := time.Now()
+	resp := make([]tokenResponse, len(tokens))
+	for i, token := range tokens {
+		resp[i] = toTokenResponse(token, now)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// RevokeTokenHandler revokes one of the current user's API tokens.
+// @Summary Revoke API token
+// @Description Revoke one of the current user's API tokens
+// @Tags auth
+// @Param id path string true "Token ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Router /auth/tokens/{id} [delete]
+func (s *Service) RevokeTokenHandler(c echo.Context) error {
+	user, ok := c.Get("user").(*repository.User)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+
+	found, err := s.RevokeToken(c.Request().Context(), user.ID, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to revoke token"})
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "token not found"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
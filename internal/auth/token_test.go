@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+func (env *testEnv) getUser(t *testing.T, id string) *repository.User {
+	t.Helper()
+	user, err := env.svc.users.GetByID(context.Background(), id)
+	if err != nil || user == nil {
+		t.Fatalf("GetByID %s: %v", id, err)
+	}
+	return user
+}
+
+func TestCreateTokenValidation(t *testing.T) {
+	env := setupTestService(t)
+	viewer := env.getUser(t, "u-alice")
+
+	tests := []struct {
+		name    string
+		in      CreateTokenInput
+		wantErr bool
+	}{
+		{name: "valid", in: CreateTokenInput{Name: "script", Scopes: []Permission{PermMediaRead}}},
+		{name: "missing name", in: CreateTokenInput{Scopes: []Permission{PermMediaRead}}, wantErr: true},
+		{name: "no scopes", in: CreateTokenInput{Name: "script"}, wantErr: true},
+		{name: "scope beyond role", in: CreateTokenInput{Name: "script", Scopes: []Permission{PermConnectionsRead}}, wantErr: true},
+		{name: "unknown scope", in: CreateTokenInput{Name: "script", Scopes: []Permission{"everything"}}, wantErr: true},
+		{name: "negative expiry", in: CreateTokenInput{Name: "script", Scopes: []Permission{PermMediaRead}, ExpiresInDays: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, raw, err := env.svc.CreateToken(context.Background(), viewer, tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTokenRequest) {
+					t.Errorf("expected ErrInvalidTokenRequest, got %v", err)
+				}
+				return
+			}
+			if err != nil || raw == "" {
+				t.Fatalf("CreateToken: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+	admin := env.getUser(t, "u-admin")
+
+	token, raw, err := env.svc.CreateToken(ctx, admin, CreateTokenInput{Name: "backup", Scopes: []Permission{PermConnectionsRead}, ExpiresInDays: 30})
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if token.TokenHash == raw || token.Prefix != raw[:apiTokenDisplayLength] {
+		t.Fatal("token must be stored hashed with a display prefix")
+	}
+
+	user, got, err := env.svc.AuthenticateToken(ctx, raw)
+	if err != nil || user == nil || user.ID != admin.ID {
+		t.Fatalf("AuthenticateToken: %v, %v", user, err)
+	}
+	if got.LastUsedAt == nil {
+		t.Error("expected last-used time to be recorded")
+	}
+	if !TokenAllows(got, PermConnectionsRead) || TokenAllows(got, PermConnectionsWrite) {
+		t.Errorf("unexpected scopes: %v", got.Scopes)
+	}
+
+	if user, _, _ := env.svc.AuthenticateToken(ctx, raw+"x"); user != nil {
+		t.Error("expected unknown token to be rejected")
+	}
+
+	// Expired tokens are rejected but still listed.
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	if _, err := env.db.Exec(`UPDATE api_tokens SET expires_at = ? WHERE id = ?`, past, token.ID); err != nil {
+		t.Fatalf("expiring token: %v", err)
+	}
+	if user, _, _ := env.svc.AuthenticateToken(ctx, raw); user != nil {
+		t.Error("expected expired token to be rejected")
+	}
+	if tokens, _ := env.svc.ListTokens(ctx, admin.ID); len(tokens) != 1 {
+		t.Errorf("expected expired token to be listed, got %d", len(tokens))
+	}
+
+	// Tokens of disabled users stop working.
+	_, raw, _ = env.svc.CreateToken(ctx, admin, CreateTokenInput{Name: "second", Scopes: []Permission{PermMediaRead}})
+	if _, err := env.db.Exec(`UPDATE users SET disabled = 1 WHERE id = ?`, admin.ID); err != nil {
+		t.Fatalf("disabling user: %v", err)
+	}
+	if user, _, _ := env.svc.AuthenticateToken(ctx, raw); user != nil {
+		t.Error("expected token of disabled user to be rejected")
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	env := setupTestService(t)
+	ctx := context.Background()
+	admin := env.getUser(t, "u-admin")
+
+	token, raw, err := env.svc.CreateToken(ctx, admin, CreateTokenInput{Name: "ci", Scopes: []Permission{PermMediaRead}})
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	if found, _ := env.svc.RevokeToken(ctx, "u-alice", token.ID); found {
+		t.Error("users must not revoke each other's tokens")
+	}
+	if found, err := env.svc.RevokeToken(ctx, admin.ID, token.ID); err != nil || !found {
+		t.Fatalf("RevokeToken: %v, %v", found, err)
+	}
+	if user, _, _ := env.svc.AuthenticateToken(ctx, raw); user != nil {
+		t.Error("expected revoked token to be rejected")
+	}
+}
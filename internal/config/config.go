@@ -3,33 +3,96 @@ package config
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// masterKeyFileName is the key file created next to the database when no
+// master key is configured.
+const masterKeyFileName = "master.key"
+
+// OIDCConfig configures single sign-on. It is enabled when Issuer is set.
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string //nolint:gosec // config field name, not a hardcoded secret
+	RedirectURL   string
+	Scopes        []string
+	DisplayName   string
+	UsernameClaim string
+	GroupsClaim   string
+	// RoleMapping maps provider group names to local roles. When set, roles
+	// are re-synced from the provider on every login.
+	RoleMapping map[string]string
+	// DefaultRole is given to users in no mapped group; empty rejects them.
+	DefaultRole string
+}
+
+// Enabled reports whether single sign-on is configured.
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
 type Config struct {
-	Port                int
-	DBPath              string
-	SessionSecret       string //nolint:gosec // config field name, not a hardcoded secret
-	AdminUser           string
-	AdminPass           string
-	SecureCookies       bool
-	MasterKey           string //nolint:gosec // config field name, not a hardcoded secret
-	HealthCheckInterval time.Duration
+	Port                   int
+	DBPath                 string
+	SessionSecret          string //nolint:gosec // config field name, not a hardcoded secret
+	AdminUser              string
+	AdminPass              string
+	SecureCookies          bool
+	SessionIdleTimeout     time.Duration
+	SessionMaxAge          time.Duration
+	MasterKey              string   //nolint:gosec // config field name, not a hardcoded secret
+	MasterKeySource        string   // where MasterKey came from, for startup logs and errors
+	PreviousMasterKeys     []string // decrypt-only keys kept until stored secrets are rotated
+	HealthCheckInterval    time.Duration
+	HealthCheckConcurrency int
+	RecentImportWindow     time.Duration // actions skip titles imported or upgraded this recently; 0 disables
+	PasswordLoginDisabled  bool
+	EmbyAuthConnection     string // Emby connection ID or name that password logins are checked against
+	OIDC                   OIDCConfig
+	// LockoutThreshold is how many consecutive failed logins lock a username;
+	// 0 disables lockout. Each further failure doubles the lockout, starting
+	// at LockoutDuration and capped at LockoutMaxDuration.
+	LockoutThreshold   int
+	LockoutDuration    time.Duration
+	LockoutMaxDuration time.Duration
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header is
+	// believed. With none, the peer address is used.
+	TrustedProxies []*net.IPNet
 }
 
-func Load() *Config {
+// Load reads configuration from the environment. Secrets may also be read
+// from files named by the matching _FILE variable, as with Docker secrets.
+func Load() (*Config, error) {
 	cfg := &Config{
-		Port:                8080,
-		DBPath:              "./data/media-reaper.db",
-		SessionSecret:       os.Getenv("MEDIA_REAPER_SESSION_SECRET"),
-		AdminUser:           os.Getenv("MEDIA_REAPER_ADMIN_USER"),
-		AdminPass:           os.Getenv("MEDIA_REAPER_ADMIN_PASS"),
-		SecureCookies:       true,
-		MasterKey:           os.Getenv("MEDIA_REAPER_MASTER_KEY"),
-		HealthCheckInterval: 5 * time.Minute,
+		Port:                   8080,
+		DBPath:                 "./data/media-reaper.db",
+		AdminUser:              os.Getenv("MEDIA_REAPER_ADMIN_USER"),
+		SecureCookies:          true,
+		SessionIdleTimeout:     24 * time.Hour,
+		SessionMaxAge:          7 * 24 * time.Hour,
+		HealthCheckInterval:    5 * time.Minute,
+		HealthCheckConcurrency: 4,
+		RecentImportWindow:     48 * time.Hour,
+		LockoutThreshold:       5,
+		LockoutDuration:        time.Minute,
+		LockoutMaxDuration:     time.Hour,
+	}
+
+	var err error
+	if cfg.SessionSecret, err = envOrFile("MEDIA_REAPER_SESSION_SECRET"); err != nil {
+		return nil, err
+	}
+	if cfg.AdminPass, err = envOrFile("MEDIA_REAPER_ADMIN_PASS"); err != nil {
+		return nil, err
 	}
 
 	if p := os.Getenv("MEDIA_REAPER_PORT"); p != "" {
@@ -46,13 +109,26 @@ func Load() *Config {
 		cfg.SecureCookies = false
 	}
 
-	if cfg.MasterKey == "" {
-		b := make([]byte, 32)
-		if _, err := rand.Read(b); err != nil {
-			log.Fatalf("Failed to generate master key: %v", err)
+	if d := os.Getenv("MEDIA_REAPER_SESSION_IDLE_TIMEOUT"); d != "" {
+		if v, err := time.ParseDuration(d); err == nil && v > 0 {
+			cfg.SessionIdleTimeout = v
+		}
+	}
+
+	if d := os.Getenv("MEDIA_REAPER_SESSION_MAX_AGE"); d != "" {
+		if v, err := time.ParseDuration(d); err == nil && v > 0 {
+			cfg.SessionMaxAge = v
+		}
+	}
+
+	if cfg.MasterKey, cfg.MasterKeySource, err = loadMasterKey(cfg.DBPath); err != nil {
+		return nil, err
+	}
+
+	for _, k := range strings.Split(os.Getenv("MEDIA_REAPER_PREVIOUS_MASTER_KEYS"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			cfg.PreviousMasterKeys = append(cfg.PreviousMasterKeys, k)
 		}
-		cfg.MasterKey = hex.EncodeToString(b)
-		log.Println("WARNING: No master key configured (MEDIA_REAPER_MASTER_KEY). Generated a random one. Encrypted data will not be recoverable across restarts.")
 	}
 
 	if h := os.Getenv("MEDIA_REAPER_HEALTH_CHECK_INTERVAL"); h != "" {
@@ -61,5 +137,216 @@ func Load() *Config {
 		}
 	}
 
-	return cfg
+	if c := os.Getenv("MEDIA_REAPER_HEALTH_CHECK_CONCURRENCY"); c != "" {
+		if v, err := strconv.Atoi(c); err == nil && v > 0 {
+			cfg.HealthCheckConcurrency = v
+		}
+	}
+
+	if w := os.Getenv("MEDIA_REAPER_RECENT_IMPORT_WINDOW"); w != "" {
+		if v, err := time.ParseDuration(w); err == nil && v >= 0 {
+			cfg.RecentImportWindow = v
+		}
+	}
+
+	cfg.EmbyAuthConnection = os.Getenv("MEDIA_REAPER_EMBY_AUTH_CONNECTION")
+
+	if t := os.Getenv("MEDIA_REAPER_LOCKOUT_THRESHOLD"); t != "" {
+		if v, err := strconv.Atoi(t); err == nil && v >= 0 {
+			cfg.LockoutThreshold = v
+		}
+	}
+
+	if d := os.Getenv("MEDIA_REAPER_LOCKOUT_DURATION"); d != "" {
+		if v, err := time.ParseDuration(d); err == nil && v > 0 {
+			cfg.LockoutDuration = v
+		}
+	}
+
+	if d := os.Getenv("MEDIA_REAPER_LOCKOUT_MAX_DURATION"); d != "" {
+		if v, err := time.ParseDuration(d); err == nil && v > 0 {
+			cfg.LockoutMaxDuration = v
+		}
+	}
+	cfg.LockoutMaxDuration = max(cfg.LockoutMaxDuration, cfg.LockoutDuration)
+
+	if cfg.TrustedProxies, err = parseTrustedProxies(os.Getenv("MEDIA_REAPER_TRUSTED_PROXIES")); err != nil {
+		return nil, err
+	}
+
+	if err := loadOIDC(cfg); err != nil {
+		return nil, err
+	}
+
+	if os.Getenv("MEDIA_REAPER_DISABLE_PASSWORD_LOGIN") == "true" {
+		if !cfg.OIDC.Enabled() {
+			return nil, errors.New("MEDIA_REAPER_DISABLE_PASSWORD_LOGIN requires single sign-on to be configured")
+		}
+		cfg.PasswordLoginDisabled = true
+	}
+
+	return cfg, nil
+}
+
+// loadOIDC reads the MEDIA_REAPER_OIDC_* variables.
+func loadOIDC(cfg *Config) error {
+	o := OIDCConfig{
+		Issuer:        os.Getenv("MEDIA_REAPER_OIDC_ISSUER"),
+		ClientID:      os.Getenv("MEDIA_REAPER_OIDC_CLIENT_ID"),
+		RedirectURL:   os.Getenv("MEDIA_REAPER_OIDC_REDIRECT_URL"),
+		Scopes:        strings.Fields(strings.ReplaceAll(os.Getenv("MEDIA_REAPER_OIDC_SCOPES"), ",", " ")),
+		DisplayName:   "SSO",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		RoleMapping:   map[string]string{},
+		DefaultRole:   "viewer",
+	}
+	if !o.Enabled() {
+		return nil
+	}
+
+	var err error
+	if o.ClientSecret, err = envOrFile("MEDIA_REAPER_OIDC_CLIENT_SECRET"); err != nil {
+		return err
+	}
+	if o.ClientID == "" || o.RedirectURL == "" {
+		return errors.New("MEDIA_REAPER_OIDC_CLIENT_ID and MEDIA_REAPER_OIDC_REDIRECT_URL are required when MEDIA_REAPER_OIDC_ISSUER is set")
+	}
+	if v := os.Getenv("MEDIA_REAPER_OIDC_NAME"); v != "" {
+		o.DisplayName = v
+	}
+	if v := os.Getenv("MEDIA_REAPER_OIDC_USERNAME_CLAIM"); v != "" {
+		o.UsernameClaim = v
+	}
+	if v := os.Getenv("MEDIA_REAPER_OIDC_GROUPS_CLAIM"); v != "" {
+		o.GroupsClaim = v
+	}
+
+	for _, pair := range strings.Split(os.Getenv("MEDIA_REAPER_OIDC_ROLE_MAPPING"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok || !validRole(role) {
+			return fmt.Errorf("MEDIA_REAPER_OIDC_ROLE_MAPPING: %q must be group=admin|operator|viewer", pair)
+		}
+		o.RoleMapping[strings.TrimSpace(group)] = role
+	}
+
+	if v, ok := os.LookupEnv("MEDIA_REAPER_OIDC_DEFAULT_ROLE"); ok {
+		switch {
+		case v == "none" || v == "":
+			o.DefaultRole = ""
+		case validRole(v):
+			o.DefaultRole = v
+		default:
+			return fmt.Errorf("MEDIA_REAPER_OIDC_DEFAULT_ROLE: %q must be admin, operator, viewer, or none", v)
+		}
+	}
+
+	cfg.OIDC = o
+	return nil
+}
+
+// parseTrustedProxies reads a comma-separated list of IP addresses and CIDR
+// ranges.
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("MEDIA_REAPER_TRUSTED_PROXIES: invalid address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("MEDIA_REAPER_TRUSTED_PROXIES: invalid range %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func validRole(role string) bool {
+	return role == "admin" || role == "operator" || role == "viewer"
+}
+
+// envOrFile returns the value of the environment variable name, or the
+// trimmed contents of the file named by name+"_FILE". Setting both is an error.
+func envOrFile(name string) (string, error) {
+	value := os.Getenv(name)
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("only one of %s and %s_FILE may be set", name, name)
+	}
+
+	b, err := os.ReadFile(path) //nolint:gosec // path is operator-supplied configuration
+	if err != nil {
+		return "", fmt.Errorf("reading %s_FILE: %w", name, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// loadMasterKey resolves the master key from MEDIA_REAPER_MASTER_KEY,
+// MEDIA_REAPER_MASTER_KEY_FILE, or a key file next to the database, creating
+// that file with a random key on first run. It returns the key and a
+// description of where it came from.
+func loadMasterKey(dbPath string) (string, string, error) {
+	if os.Getenv("MEDIA_REAPER_MASTER_KEY_FILE") != "" {
+		key, err := envOrFile("MEDIA_REAPER_MASTER_KEY")
+		return key, os.Getenv("MEDIA_REAPER_MASTER_KEY_FILE"), err
+	}
+	if key := os.Getenv("MEDIA_REAPER_MASTER_KEY"); key != "" {
+		return key, "MEDIA_REAPER_MASTER_KEY", nil
+	}
+
+	path := filepath.Join(filepath.Dir(dbPath), masterKeyFileName)
+	b, err := os.ReadFile(path) //nolint:gosec // path is derived from the configured database path
+	if err == nil {
+		if info, statErr := os.Stat(path); statErr == nil && info.Mode().Perm()&0o077 != 0 {
+			log.Printf("WARNING: master key file %s is readable by other users (mode %04o); restrict it to 0600", path, info.Mode().Perm())
+		}
+		return strings.TrimSpace(string(b)), path, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", "", fmt.Errorf("reading master key file: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", fmt.Errorf("generating master key: %w", err)
+	}
+	hexKey := hex.EncodeToString(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", "", fmt.Errorf("creating master key directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) //nolint:gosec // path is derived from the configured database path
+	if err != nil {
+		return "", "", fmt.Errorf("creating master key file: %w", err)
+	}
+	if _, err := f.WriteString(hexKey + "\n"); err != nil {
+		_ = f.Close()
+		return "", "", fmt.Errorf("writing master key file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", "", fmt.Errorf("writing master key file: %w", err)
+	}
+
+	log.Printf("No master key configured. Generated one and saved it to %s; back this file up with the database.", path)
+	return hexKey, path, nil
 }
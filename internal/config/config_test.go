@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvOrFile(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("writing secret file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{name: "unset", want: ""},
+		{name: "env only", value: "from-env", want: "from-env"},
+		{name: "file only", file: secretFile, want: "from-file"},
+		{name: "both set", value: "from-env", file: secretFile, wantErr: true},
+		{name: "missing file", file: filepath.Join(dir, "missing"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MEDIA_REAPER_TEST_SECRET", tt.value)
+			t.Setenv("MEDIA_REAPER_TEST_SECRET_FILE", tt.file)
+
+			got, err := envOrFile("MEDIA_REAPER_TEST_SECRET")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: got %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMasterKeyCreatesFile(t *testing.T) {
+	t.Setenv("MEDIA_REAPER_MASTER_KEY", "")
+	t.Setenv("MEDIA_REAPER_MASTER_KEY_FILE", "")
+	dbPath := filepath.Join(t.TempDir(), "data", "media-reaper.db")
+
+	key, source, err := loadMasterKey(dbPath)
+	if err != nil {
+		t.Fatalf("loadMasterKey: %v", err)
+	}
+	if len(key) != 64 {
+		t.Errorf("expected 64 hex characters, got %d", len(key))
+	}
+
+	wantPath := filepath.Join(filepath.Dir(dbPath), masterKeyFileName)
+	if source != wantPath {
+		t.Errorf("source: got %q, want %q", source, wantPath)
+	}
+	info, err := os.Stat(wantPath)
+	if err != nil {
+		t.Fatalf("stat key file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file mode: got %04o, want 0600", perm)
+	}
+
+	again, _, err := loadMasterKey(dbPath)
+	if err != nil {
+		t.Fatalf("second loadMasterKey: %v", err)
+	}
+	if again != key {
+		t.Error("expected the persisted key to be reused")
+	}
+}
+
+func TestLoadMasterKeyPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	fileKey := strings.Repeat("ab", 32)
+	if err := os.WriteFile(keyFile, []byte(fileKey+"\n"), 0o600); err != nil {
+		t.Fatalf("writing key file: %v", err)
+	}
+	envKey := strings.Repeat("cd", 32)
+	dbPath := filepath.Join(dir, "media-reaper.db")
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("MEDIA_REAPER_MASTER_KEY", envKey)
+		t.Setenv("MEDIA_REAPER_MASTER_KEY_FILE", "")
+		key, _, err := loadMasterKey(dbPath)
+		if err != nil || key != envKey {
+			t.Errorf("got %q, %v; want env key", key, err)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		t.Setenv("MEDIA_REAPER_MASTER_KEY", "")
+		t.Setenv("MEDIA_REAPER_MASTER_KEY_FILE", keyFile)
+		key, source, err := loadMasterKey(dbPath)
+		if err != nil || key != fileKey || source != keyFile {
+			t.Errorf("got %q from %q, %v; want file key", key, source, err)
+		}
+	})
+
+	t.Run("both", func(t *testing.T) {
+		t.Setenv("MEDIA_REAPER_MASTER_KEY", envKey)
+		t.Setenv("MEDIA_REAPER_MASTER_KEY_FILE", keyFile)
+		if _, _, err := loadMasterKey(dbPath); err == nil {
+			t.Error("expected error when both are set")
+		}
+	})
+
+	if _, err := os.Stat(filepath.Join(dir, masterKeyFileName)); !os.IsNotExist(err) {
+		t.Error("no key file should be generated when a key is configured")
+	}
+}
+
+func TestLoadOIDC(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantErr     bool
+		wantMapping map[string]string
+		wantDefault string
+	}{
+		{
+			name:        "mapping and default",
+			env:         map[string]string{"MEDIA_REAPER_OIDC_ROLE_MAPPING": "media-admins=admin, media-ops=operator"},
+			wantMapping: map[string]string{"media-admins": "admin", "media-ops": "operator"},
+			wantDefault: "viewer",
+		},
+		{
+			name:        "default none rejects unmapped users",
+			env:         map[string]string{"MEDIA_REAPER_OIDC_DEFAULT_ROLE": "none"},
+			wantMapping: map[string]string{},
+			wantDefault: "",
+		},
+		{name: "invalid mapped role", env: map[string]string{"MEDIA_REAPER_OIDC_ROLE_MAPPING": "media=root"}, wantErr: true},
+		{name: "invalid default role", env: map[string]string{"MEDIA_REAPER_OIDC_DEFAULT_ROLE": "guest"}, wantErr: true},
+		{name: "missing client id", env: map[string]string{"MEDIA_REAPER_OIDC_CLIENT_ID": ""}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MEDIA_REAPER_OIDC_ISSUER", "https://id.example.com")
+			t.Setenv("MEDIA_REAPER_OIDC_CLIENT_ID", "media-reaper")
+			t.Setenv("MEDIA_REAPER_OIDC_REDIRECT_URL", "https://reaper.example.com/api/auth/oidc/callback")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg := &Config{}
+			err := loadOIDC(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: got %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(cfg.OIDC.RoleMapping) != len(tt.wantMapping) {
+				t.Errorf("mapping: got %v, want %v", cfg.OIDC.RoleMapping, tt.wantMapping)
+			}
+			for group, role := range tt.wantMapping {
+				if cfg.OIDC.RoleMapping[group] != role {
+					t.Errorf("mapping[%s]: got %q, want %q", group, cfg.OIDC.RoleMapping[group], role)
+				}
+			}
+			if cfg.OIDC.DefaultRole != tt.wantDefault {
+				t.Errorf("default role: got %q, want %q", cfg.OIDC.DefaultRole, tt.wantDefault)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", list: ""},
+		{name: "single addresses", list: "10.0.0.5, ::1", want: []string{"10.0.0.5/32", "::1/128"}},
+		{name: "ranges", list: "172.16.0.0/12,fd00::/8", want: []string{"172.16.0.0/12", "fd00::/8"}},
+		{name: "invalid address", list: "10.0.0.300", wantErr: true},
+		{name: "invalid range", list: "10.0.0.0/40", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets, err := parseTrustedProxies(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: got %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, n := range nets {
+				got = append(got, n.String())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
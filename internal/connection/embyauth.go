@@ -0,0 +1,46 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+var ErrEmbyAuthConnection = errors.New("emby login connection not found or disabled")
+
+// EmbyAuthenticator checks user credentials against an Emby connection. The
+// connection is looked up on every call, so edits to its URL take effect
+// without a restart.
+type EmbyAuthenticator struct {
+	service *Service
+	ref     string
+}
+
+// EmbyAuthenticator returns an authenticator for the Emby connection with the
+// given ID or name.
+func (s *Service) EmbyAuthenticator(ref string) *EmbyAuthenticator {
+	return &EmbyAuthenticator{service: s, ref: ref}
+}
+
+// AuthenticateByName signs in to Emby with a username and password and
+// returns the Emby user. Wrong credentials yield emby.ErrInvalidCredentials.
+func (a *EmbyAuthenticator) AuthenticateByName(ctx context.Context, username, password string) (*emby.User, error) {
+	conns, err := a.service.repo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing connections: %w", err)
+	}
+
+	for _, conn := range conns {
+		if conn.Type != repository.ConnectionTypeEmby || (conn.ID != a.ref && conn.Name != a.ref) {
+			continue
+		}
+		if !conn.Enabled {
+			break
+		}
+		return emby.New(conn.URL, "").AuthenticateByName(ctx, username, password)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrEmbyAuthConnection, a.ref)
+}
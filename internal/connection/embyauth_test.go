@@ -0,0 +1,53 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sydlexius/media-reaper/internal/emby"
+)
+
+func TestEmbyAuthenticator(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/Sessions/Logout" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(emby.AuthenticationResult{
+			User:        &emby.User{ID: "e-1", Name: "dana"},
+			AccessToken: "token",
+		})
+	}))
+	defer server.Close()
+
+	conn, err := svc.Create(ctx, "Living Room", "emby", server.URL, "key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	for _, ref := range []string{conn.ID, "Living Room"} {
+		user, err := svc.EmbyAuthenticator(ref).AuthenticateByName(ctx, "dana", "pw")
+		if err != nil || user.ID != "e-1" {
+			t.Errorf("ref %q: got %+v, %v", ref, user, err)
+		}
+	}
+
+	if _, err := svc.EmbyAuthenticator("Missing").AuthenticateByName(ctx, "dana", "pw"); !errors.Is(err, ErrEmbyAuthConnection) {
+		t.Errorf("expected ErrEmbyAuthConnection for unknown connection, got %v", err)
+	}
+
+	disabled := false
+	if _, err := svc.Update(ctx, conn.ID, conn.Name, string(conn.Type), conn.URL, "", &disabled, nil, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := svc.EmbyAuthenticator(conn.ID).AuthenticateByName(ctx, "dana", "pw"); !errors.Is(err, ErrEmbyAuthConnection) {
+		t.Errorf("expected ErrEmbyAuthConnection for disabled connection, got %v", err)
+	}
+}
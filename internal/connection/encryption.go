@@ -4,76 +4,190 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
+// ciphertextVersion prefixes ciphertexts that carry a key ID:
+// "v1:<key id>:<hex nonce+ciphertext>". Ciphertexts written before key IDs
+// existed are bare hex and are tried against every known key.
+const ciphertextVersion = "v1"
+
 var (
 	ErrMasterKeyRequired  = errors.New("master key is required")
 	ErrMasterKeyLength    = errors.New("master key must be 32 bytes (64 hex characters)")
 	ErrCiphertextTooShort = errors.New("ciphertext too short")
+	ErrUnknownKeyID       = errors.New("ciphertext was encrypted with an unknown key")
+	ErrMalformedEnvelope  = errors.New("malformed ciphertext envelope")
 )
 
 // Encryptor provides AES-256-GCM encryption and decryption for API keys.
+// It encrypts with the primary key and can decrypt with the primary key or
+// any previous key, so stored values can be re-encrypted after a rotation.
 type Encryptor struct {
-	gcm cipher.AEAD
+	primaryID string
+	keys      map[string]cipher.AEAD
+	// order is the primary key ID followed by previous key IDs, used when
+	// decrypting legacy ciphertexts without a key ID.
+	order []string
 }
 
-// NewEncryptor creates an Encryptor from a hex-encoded 32-byte master key.
-func NewEncryptor(hexKey string) (*Encryptor, error) {
+// NewEncryptor creates an Encryptor from a hex-encoded 32-byte master key and
+// optional previous master keys that remain valid for decryption only.
+func NewEncryptor(hexKey string, previousHexKeys ...string) (*Encryptor, error) {
 	if hexKey == "" {
 		return nil, ErrMasterKeyRequired
 	}
 
+	e := &Encryptor{keys: make(map[string]cipher.AEAD)}
+	for i, k := range append([]string{hexKey}, previousHexKeys...) {
+		id, gcm, err := newKey(k)
+		if err != nil {
+			if i > 0 {
+				return nil, fmt.Errorf("previous master key %d: %w", i, err)
+			}
+			return nil, err
+		}
+		if i == 0 {
+			e.primaryID = id
+		}
+		if _, dup := e.keys[id]; dup {
+			continue
+		}
+		e.keys[id] = gcm
+		e.order = append(e.order, id)
+	}
+
+	return e, nil
+}
+
+func newKey(hexKey string) (string, cipher.AEAD, error) {
 	key, err := hex.DecodeString(hexKey)
 	if err != nil {
-		return nil, fmt.Errorf("decoding master key: %w", err)
+		return "", nil, fmt.Errorf("decoding master key: %w", err)
 	}
 
 	if len(key) != 32 {
-		return nil, ErrMasterKeyLength
+		return "", nil, ErrMasterKeyLength
 	}
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return nil, fmt.Errorf("creating cipher: %w", err)
+		return "", nil, fmt.Errorf("creating cipher: %w", err)
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return nil, fmt.Errorf("creating GCM: %w", err)
+		return "", nil, fmt.Errorf("creating GCM: %w", err)
 	}
 
-	return &Encryptor{gcm: gcm}, nil
+	return KeyID(key), gcm, nil
+}
+
+// KeyID returns the short identifier embedded in ciphertexts for a raw key.
+// It is a truncated SHA-256 of the key and reveals nothing useful about it.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
 }
 
-// Encrypt encrypts plaintext and returns hex-encoded nonce+ciphertext.
+// PrimaryKeyID returns the ID of the key used for new encryptions.
+func (e *Encryptor) PrimaryKeyID() string {
+	return e.primaryID
+}
+
+// KeyIDs returns the IDs of all keys that can decrypt, primary first.
+func (e *Encryptor) KeyIDs() []string {
+	return append([]string(nil), e.order...)
+}
+
+// Encrypt encrypts plaintext with the primary key and returns a versioned
+// envelope carrying the key ID and hex-encoded nonce+ciphertext.
 func (e *Encryptor) Encrypt(plaintext string) (string, error) {
-	nonce := make([]byte, e.gcm.NonceSize())
+	gcm := e.keys[e.primaryID]
+	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", fmt.Errorf("generating nonce: %w", err)
 	}
 
-	sealed := e.gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return hex.EncodeToString(sealed), nil
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return ciphertextVersion + ":" + e.primaryID + ":" + hex.EncodeToString(sealed), nil
 }
 
-// Decrypt decrypts hex-encoded nonce+ciphertext and returns plaintext.
-func (e *Encryptor) Decrypt(hexCiphertext string) (string, error) {
-	data, err := hex.DecodeString(hexCiphertext)
+// Decrypt decrypts a versioned envelope or a legacy bare-hex ciphertext and
+// returns plaintext.
+func (e *Encryptor) Decrypt(ciphertext string) (string, error) {
+	keyID, body, versioned, err := parseEnvelope(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := hex.DecodeString(body)
 	if err != nil {
 		return "", fmt.Errorf("decoding ciphertext: %w", err)
 	}
 
-	nonceSize := e.gcm.NonceSize()
+	if versioned {
+		gcm, ok := e.keys[keyID]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnknownKeyID, keyID)
+		}
+		return open(gcm, data)
+	}
+
+	var lastErr error
+	for _, id := range e.order {
+		plaintext, err := open(e.keys[id], data)
+		if err == nil {
+			return plaintext, nil
+		}
+		if errors.Is(err, ErrCiphertextTooShort) {
+			return "", err
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// KeyIDOf returns the key ID embedded in a ciphertext, or "" for legacy
+// ciphertexts that predate key IDs.
+func KeyIDOf(ciphertext string) string {
+	keyID, _, _, err := parseEnvelope(ciphertext)
+	if err != nil {
+		return ""
+	}
+	return keyID
+}
+
+// NeedsRotation reports whether a ciphertext is not yet encrypted with the
+// primary key in the current envelope format.
+func (e *Encryptor) NeedsRotation(ciphertext string) bool {
+	return KeyIDOf(ciphertext) != e.primaryID
+}
+
+func parseEnvelope(ciphertext string) (keyID, body string, versioned bool, err error) {
+	if !strings.HasPrefix(ciphertext, ciphertextVersion+":") {
+		return "", ciphertext, false, nil
+	}
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[1] == "" {
+		return "", "", false, ErrMalformedEnvelope
+	}
+	return parts[1], parts[2], true, nil
+}
+
+func open(gcm cipher.AEAD, data []byte) (string, error) {
+	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
 		return "", ErrCiphertextTooShort
 	}
 
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := e.gcm.Open(nil, nonce, ciphertext, nil)
+	nonce, sealed := data[:nonceSize], data[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
 	if err != nil {
 		return "", fmt.Errorf("decrypting: %w", err)
 	}
@@ -3,6 +3,8 @@ package connection
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -195,3 +197,106 @@ func TestDecryptWrongKey(t *testing.T) {
 		t.Error("expected error when decrypting with wrong key")
 	}
 }
+
+func TestEncryptWritesVersionedEnvelope(t *testing.T) {
+	key := generateTestKey(t)
+	enc, err := NewEncryptor(key)
+	if err != nil {
+		t.Fatalf("creating encryptor: %v", err)
+	}
+
+	ciphertext, err := enc.Encrypt("api-key")
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+
+	raw, _ := hex.DecodeString(key)
+	want := "v1:" + KeyID(raw) + ":"
+	if !strings.HasPrefix(ciphertext, want) {
+		t.Errorf("expected ciphertext to start with %q, got %q", want, ciphertext)
+	}
+	if KeyIDOf(ciphertext) != enc.PrimaryKeyID() {
+		t.Errorf("KeyIDOf: got %q, want %q", KeyIDOf(ciphertext), enc.PrimaryKeyID())
+	}
+	if enc.NeedsRotation(ciphertext) {
+		t.Error("fresh ciphertext should not need rotation")
+	}
+}
+
+func TestDecryptWithPreviousKey(t *testing.T) {
+	oldKey, newKey := generateTestKey(t), generateTestKey(t)
+
+	old, err := NewEncryptor(oldKey)
+	if err != nil {
+		t.Fatalf("creating old encryptor: %v", err)
+	}
+	ciphertext, err := old.Encrypt("rotated-secret")
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+
+	rotated, err := NewEncryptor(newKey, oldKey)
+	if err != nil {
+		t.Fatalf("creating rotated encryptor: %v", err)
+	}
+	if got, err := rotated.Decrypt(ciphertext); err != nil || got != "rotated-secret" {
+		t.Fatalf("decrypting with previous key: got %q, %v", got, err)
+	}
+	if !rotated.NeedsRotation(ciphertext) {
+		t.Error("ciphertext under previous key should need rotation")
+	}
+	if ids := rotated.KeyIDs(); len(ids) != 2 || ids[0] != rotated.PrimaryKeyID() {
+		t.Errorf("unexpected key IDs: %v", ids)
+	}
+
+	newOnly, err := NewEncryptor(newKey)
+	if err != nil {
+		t.Fatalf("creating new-only encryptor: %v", err)
+	}
+	if _, err := newOnly.Decrypt(ciphertext); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("expected ErrUnknownKeyID, got %v", err)
+	}
+}
+
+func TestDecryptLegacyCiphertext(t *testing.T) {
+	oldKey, newKey := generateTestKey(t), generateTestKey(t)
+
+	// Build a ciphertext the way Encrypt did before key IDs: bare hex nonce+sealed.
+	old, err := NewEncryptor(oldKey)
+	if err != nil {
+		t.Fatalf("creating encryptor: %v", err)
+	}
+	gcm := old.keys[old.PrimaryKeyID()]
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatalf("generating nonce: %v", err)
+	}
+	legacy := hex.EncodeToString(gcm.Seal(nonce, nonce, []byte("legacy-secret"), nil))
+
+	rotated, err := NewEncryptor(newKey, oldKey)
+	if err != nil {
+		t.Fatalf("creating rotated encryptor: %v", err)
+	}
+	if got, err := rotated.Decrypt(legacy); err != nil || got != "legacy-secret" {
+		t.Fatalf("decrypting legacy ciphertext: got %q, %v", got, err)
+	}
+	if KeyIDOf(legacy) != "" || !rotated.NeedsRotation(legacy) {
+		t.Error("legacy ciphertext should have no key ID and need rotation")
+	}
+}
+
+func TestNewEncryptorInvalidPreviousKey(t *testing.T) {
+	if _, err := NewEncryptor(generateTestKey(t), "abcd"); err == nil {
+		t.Error("expected error for invalid previous key")
+	}
+}
+
+func TestDecryptMalformedEnvelope(t *testing.T) {
+	enc, err := NewEncryptor(generateTestKey(t))
+	if err != nil {
+		t.Fatalf("creating encryptor: %v", err)
+	}
+	if _, err := enc.Decrypt("v1:missing-body"); !errors.Is(err, ErrMalformedEnvelope) {
+		t.Errorf("expected ErrMalformedEnvelope, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package connection
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
@@ -8,18 +9,25 @@ import (
 )
 
 type createConnectionRequest struct {
-	Name   string `json:"name"`
-	Type   string `json:"type"`
-	URL    string `json:"url"`
-	APIKey string `json:"apiKey"` //nolint:gosec // request DTO, not a hardcoded secret
+	Name                 string `json:"name"`
+	Type                 string `json:"type"`
+	URL                  string `json:"url"`
+	APIKey               string `json:"apiKey"` //nolint:gosec // request DTO, not a hardcoded secret
+	CheckIntervalSeconds int    `json:"checkIntervalSeconds,omitempty"`
+	CheckTimeoutSeconds  int    `json:"checkTimeoutSeconds,omitempty"`
 }
 
 type updateConnectionRequest struct {
-	Name    string `json:"name"`
-	Type    string `json:"type"`
-	URL     string `json:"url"`
-	APIKey  string `json:"apiKey,omitempty"` //nolint:gosec // request DTO, not a hardcoded secret
-	Enabled *bool  `json:"enabled,omitempty"`
+	Name                 string `json:"name"`
+	Type                 string `json:"type"`
+	URL                  string `json:"url"`
+	APIKey               string `json:"apiKey,omitempty"` //nolint:gosec // request DTO, not a hardcoded secret
+	Enabled              *bool  `json:"enabled,omitempty"`
+	CheckIntervalSeconds *int   `json:"checkIntervalSeconds,omitempty"`
+	CheckTimeoutSeconds  *int   `json:"checkTimeoutSeconds,omitempty"`
+	// AllowDirectDelete lets media-reaper delete items on an Emby server
+	// itself, for media no *arr manages.
+	AllowDirectDelete *bool `json:"allowDirectDelete,omitempty"`
 }
 
 type connectionResponse struct {
@@ -31,31 +39,46 @@ type connectionResponse struct {
 	Enabled       bool   `json:"enabled"`
 	Status        string `json:"status"`
 	LastCheckedAt string `json:"lastCheckedAt,omitempty"`
-	CreatedAt     string `json:"createdAt"`
-	UpdatedAt     string `json:"updatedAt"`
+
+	CheckIntervalSeconds int    `json:"checkIntervalSeconds"`
+	CheckTimeoutSeconds  int    `json:"checkTimeoutSeconds"`
+	ConsecutiveFailures  int    `json:"consecutiveFailures"`
+	NextCheckAt          string `json:"nextCheckAt,omitempty"`
+
+	AllowDirectDelete bool `json:"allowDirectDelete"`
+
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
 }
 
 func (s *Service) toResponse(conn *repository.Connection) connectionResponse {
 	resp := connectionResponse{
-		ID:        conn.ID,
-		Name:      conn.Name,
-		Type:      string(conn.Type),
-		URL:       conn.URL,
-		MaskedAPIKey: MaskAPIKey(conn.EncryptedAPIKey, s.encryptor),
-		Enabled:   conn.Enabled,
-		Status:    string(conn.Status),
-		CreatedAt: conn.CreatedAt,
-		UpdatedAt: conn.UpdatedAt,
+		ID:                   conn.ID,
+		Name:                 conn.Name,
+		Type:                 string(conn.Type),
+		URL:                  conn.URL,
+		MaskedAPIKey:         MaskAPIKey(conn.EncryptedAPIKey, s.encryptor),
+		Enabled:              conn.Enabled,
+		Status:               string(conn.Status),
+		CheckIntervalSeconds: conn.CheckIntervalSeconds,
+		CheckTimeoutSeconds:  conn.CheckTimeoutSeconds,
+		ConsecutiveFailures:  conn.ConsecutiveFailures,
+		AllowDirectDelete:    conn.AllowDirectDelete,
+		CreatedAt:            conn.CreatedAt,
+		UpdatedAt:            conn.UpdatedAt,
 	}
 	if conn.LastCheckedAt != nil {
 		resp.LastCheckedAt = *conn.LastCheckedAt
 	}
+	if conn.NextCheckAt != nil {
+		resp.NextCheckAt = *conn.NextCheckAt
+	}
 	return resp
 }
 
 // CreateHandler creates a new connection.
 // @Summary Create connection
-// @Description Create a new Sonarr, Radarr, or Emby connection with encrypted API key
+// @Description Create a new *arr or media server connection with encrypted API key
 // @Tags connections
 // @Accept json
 // @Produce json
@@ -64,6 +87,7 @@ func (s *Service) toResponse(conn *repository.Connection) connectionResponse {
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security SessionCookie
+// @Security ApiKeyAuth
 // @Router /connections [post]
 func (s *Service) CreateHandler(c echo.Context) error {
 	var req createConnectionRequest
@@ -76,10 +100,15 @@ func (s *Service) CreateHandler(c echo.Context) error {
 	}
 
 	if !isValidConnectionType(req.Type) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "type must be sonarr, radarr, or emby"})
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "type must be sonarr, radarr, lidarr, readarr, emby, jellyfin, or plex"})
 	}
 
-	conn, err := s.Create(c.Request().Context(), req.Name, req.Type, req.URL, req.APIKey)
+	settings := CheckSettings{IntervalSeconds: req.CheckIntervalSeconds, TimeoutSeconds: req.CheckTimeoutSeconds}
+	if err := settings.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	conn, err := s.Create(c.Request().Context(), req.Name, req.Type, req.URL, req.APIKey, settings)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create connection"})
 	}
@@ -94,6 +123,7 @@ func (s *Service) CreateHandler(c echo.Context) error {
 // @Produce json
 // @Success 200 {array} connectionResponse
 // @Security SessionCookie
+// @Security ApiKeyAuth
 // @Router /connections [get]
 func (s *Service) ListHandler(c echo.Context) error {
 	connections, err := s.GetAll(c.Request().Context())
@@ -118,6 +148,7 @@ func (s *Service) ListHandler(c echo.Context) error {
 // @Success 200 {object} connectionResponse
 // @Failure 404 {object} map[string]string
 // @Security SessionCookie
+// @Security ApiKeyAuth
 // @Router /connections/{id} [get]
 func (s *Service) GetHandler(c echo.Context) error {
 	id := c.Param("id")
@@ -134,7 +165,7 @@ func (s *Service) GetHandler(c echo.Context) error {
 
 // UpdateHandler updates an existing connection.
 // @Summary Update connection
-// @Description Update a connection. API key is optional (omit to keep current).
+// @Description Update a connection. API key is optional (omit to keep current). allowDirectDelete opts an Emby connection in to deleting unmanaged items on the server itself.
 // @Tags connections
 // @Accept json
 // @Produce json
@@ -145,6 +176,7 @@ func (s *Service) GetHandler(c echo.Context) error {
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security SessionCookie
+// @Security ApiKeyAuth
 // @Router /connections/{id} [put]
 func (s *Service) UpdateHandler(c echo.Context) error {
 	id := c.Param("id")
@@ -159,10 +191,34 @@ func (s *Service) UpdateHandler(c echo.Context) error {
 	}
 
 	if !isValidConnectionType(req.Type) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "type must be sonarr, radarr, or emby"})
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "type must be sonarr, radarr, lidarr, readarr, emby, jellyfin, or plex"})
 	}
 
-	conn, err := s.Update(c.Request().Context(), id, req.Name, req.Type, req.URL, req.APIKey, req.Enabled)
+	var settings *CheckSettings
+	if req.CheckIntervalSeconds != nil || req.CheckTimeoutSeconds != nil {
+		existing, err := s.GetByID(c.Request().Context(), id)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update connection"})
+		}
+		if existing == nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "connection not found"})
+		}
+		settings = &CheckSettings{IntervalSeconds: existing.CheckIntervalSeconds, TimeoutSeconds: existing.CheckTimeoutSeconds}
+		if req.CheckIntervalSeconds != nil {
+			settings.IntervalSeconds = *req.CheckIntervalSeconds
+		}
+		if req.CheckTimeoutSeconds != nil {
+			settings.TimeoutSeconds = *req.CheckTimeoutSeconds
+		}
+		if err := settings.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	conn, err := s.Update(c.Request().Context(), id, req.Name, req.Type, req.URL, req.APIKey, req.Enabled, req.AllowDirectDelete, settings)
+	if errors.Is(err, ErrDirectDeleteUnsupported) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update connection"})
 	}
@@ -181,6 +237,7 @@ func (s *Service) UpdateHandler(c echo.Context) error {
 // @Success 204
 // @Failure 500 {object} map[string]string
 // @Security SessionCookie
+// @Security ApiKeyAuth
 // @Router /connections/{id} [delete]
 func (s *Service) DeleteHandler(c echo.Context) error {
 	id := c.Param("id")
@@ -198,18 +255,20 @@ type testConnectionRequest struct {
 
 // TestSavedHandler tests a saved connection by ID.
 // @Summary Test saved connection
-// @Description Test connectivity to a saved connection by decrypting its API key and pinging the remote server
+// @Description Test connectivity to a saved connection by decrypting its API key and pinging the remote server. The stored status is updated, but the test is not added to the health history, does not change when the next scheduled check runs, and sends no notifications.
 // @Tags connections
 // @Produce json
 // @Param id path string true "Connection ID"
 // @Success 200 {object} TestResult
+// @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security SessionCookie
+// @Security ApiKeyAuth
 // @Router /connections/{id}/test [post]
 func (s *Service) TestSavedHandler(c echo.Context) error {
-	id := c.Param("id")
-	conn, err := s.repo.GetByID(c.Request().Context(), id)
+	ctx := c.Request().Context()
+	conn, err := s.repo.GetByID(ctx, c.Param("id"))
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 	}
@@ -217,16 +276,13 @@ func (s *Service) TestSavedHandler(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "connection not found"})
 	}
 
-	apiKey, err := s.encryptor.Decrypt(conn.EncryptedAPIKey)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to decrypt api key"})
-	}
-
-	result, err := TestConnection(c.Request().Context(), string(conn.Type), conn.URL, apiKey)
-	if err != nil {
+	result, err := s.checker.CheckNow(ctx, conn)
+	switch {
+	case errors.Is(err, ErrDecryptAPIKey):
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": ErrDecryptAPIKey.Error()})
+	case err != nil:
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
-
 	return c.JSON(http.StatusOK, result)
 }
 
@@ -240,6 +296,7 @@ func (s *Service) TestSavedHandler(c echo.Context) error {
 // @Success 200 {object} TestResult
 // @Failure 400 {object} map[string]string
 // @Security SessionCookie
+// @Security ApiKeyAuth
 // @Router /connections/test [post]
 func (s *Service) TestUnsavedHandler(c echo.Context) error {
 	var req testConnectionRequest
@@ -252,7 +309,7 @@ func (s *Service) TestUnsavedHandler(c echo.Context) error {
 	}
 
 	if !isValidConnectionType(req.Type) {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "type must be sonarr, radarr, or emby"})
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "type must be sonarr, radarr, lidarr, readarr, emby, jellyfin, or plex"})
 	}
 
 	result, err := TestConnection(c.Request().Context(), req.Type, req.URL, req.APIKey)
@@ -265,7 +322,9 @@ func (s *Service) TestUnsavedHandler(c echo.Context) error {
 
 func isValidConnectionType(t string) bool {
 	switch repository.ConnectionType(t) {
-	case repository.ConnectionTypeSonarr, repository.ConnectionTypeRadarr, repository.ConnectionTypeEmby:
+	case repository.ConnectionTypeSonarr, repository.ConnectionTypeRadarr, repository.ConnectionTypeLidarr,
+		repository.ConnectionTypeReadarr, repository.ConnectionTypeEmby, repository.ConnectionTypeJellyfin,
+		repository.ConnectionTypePlex:
 		return true
 	}
 	return false
@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	_ "modernc.org/sqlite"
@@ -34,14 +35,28 @@ func setupTestService(t *testing.T) *Service {
 	CREATE TABLE connections (
 		id              TEXT PRIMARY KEY,
 		name            TEXT NOT NULL,
-		type            TEXT NOT NULL CHECK(type IN ('sonarr', 'radarr', 'emby')),
+		type            TEXT NOT NULL CHECK(type IN ('sonarr', 'radarr', 'lidarr', 'readarr', 'emby', 'jellyfin', 'plex')),
 		url             TEXT NOT NULL,
 		encrypted_api_key TEXT NOT NULL,
 		enabled         INTEGER NOT NULL DEFAULT 1,
 		status          TEXT NOT NULL DEFAULT 'unknown' CHECK(status IN ('healthy', 'unhealthy', 'unknown')),
 		last_checked_at TIMESTAMP,
+		check_interval_seconds INTEGER NOT NULL DEFAULT 0,
+		check_timeout_seconds  INTEGER NOT NULL DEFAULT 15,
+		consecutive_failures   INTEGER NOT NULL DEFAULT 0,
+		next_check_at          TIMESTAMP,
+		allow_direct_delete    INTEGER NOT NULL DEFAULT 0,
 		created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		updated_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE connection_health_checks (
+		id            TEXT PRIMARY KEY,
+		connection_id TEXT NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+		outcome       TEXT NOT NULL CHECK(outcome IN ('healthy', 'unhealthy')),
+		latency_ms    INTEGER NOT NULL DEFAULT 0,
+		error_message TEXT NOT NULL DEFAULT '',
+		app_version   TEXT NOT NULL DEFAULT '',
+		checked_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 	)`
 	if _, err := db.Exec(schema); err != nil {
 		t.Fatalf("creating schema: %v", err)
@@ -57,7 +72,8 @@ func setupTestService(t *testing.T) *Service {
 	}
 
 	repo := sqliterepo.NewConnectionRepository(db)
-	return NewService(repo, encryptor)
+	checker := NewHealthChecker(repo, sqliterepo.NewHealthCheckRepository(db), encryptor, 5*time.Minute, 4, nil)
+	return NewService(repo, encryptor, checker)
 }
 
 func newTestContext(method, path, body string) (echo.Context, *httptest.ResponseRecorder) {
@@ -186,7 +202,7 @@ func TestListHandler(t *testing.T) {
 	}
 
 	// Create one, then list
-	if _, err := svc.Create(ctx, "Test", "sonarr", "http://localhost:8989", "key"); err != nil {
+	if _, err := svc.Create(ctx, "Test", "sonarr", "http://localhost:8989", "key", CheckSettings{}); err != nil {
 		t.Fatalf("Create: %v", err)
 	}
 
@@ -206,7 +222,7 @@ func TestListHandler(t *testing.T) {
 func TestGetHandler(t *testing.T) {
 	svc := setupTestService(t)
 
-	conn, err := svc.Create(context.Background(), "Test", "emby", "http://localhost:8096", "key")
+	conn, err := svc.Create(context.Background(), "Test", "emby", "http://localhost:8096", "key", CheckSettings{})
 	if err != nil {
 		t.Fatalf("Create: %v", err)
 	}
@@ -241,7 +257,7 @@ func TestGetHandlerNotFound(t *testing.T) {
 func TestUpdateHandler(t *testing.T) {
 	svc := setupTestService(t)
 
-	conn, err := svc.Create(context.Background(), "Original", "sonarr", "http://localhost:8989", "original-key")
+	conn, err := svc.Create(context.Background(), "Original", "sonarr", "http://localhost:8989", "original-key", CheckSettings{})
 	if err != nil {
 		t.Fatalf("Create: %v", err)
 	}
@@ -278,7 +294,7 @@ func TestUpdateHandler(t *testing.T) {
 func TestUpdateHandlerNewAPIKey(t *testing.T) {
 	svc := setupTestService(t)
 
-	conn, err := svc.Create(context.Background(), "Test", "radarr", "http://localhost:7878", "old-api-key")
+	conn, err := svc.Create(context.Background(), "Test", "radarr", "http://localhost:7878", "old-api-key", CheckSettings{})
 	if err != nil {
 		t.Fatalf("Create: %v", err)
 	}
@@ -306,7 +322,7 @@ func TestUpdateHandlerNewAPIKey(t *testing.T) {
 func TestDeleteHandler(t *testing.T) {
 	svc := setupTestService(t)
 
-	conn, err := svc.Create(context.Background(), "To Delete", "emby", "http://localhost:8096", "key")
+	conn, err := svc.Create(context.Background(), "To Delete", "emby", "http://localhost:8096", "key", CheckSettings{})
 	if err != nil {
 		t.Fatalf("Create: %v", err)
 	}
@@ -335,7 +351,7 @@ func TestDeleteHandler(t *testing.T) {
 func TestAPIKeyEncryptedAtRest(t *testing.T) {
 	svc := setupTestService(t)
 
-	conn, err := svc.Create(context.Background(), "Test", "sonarr", "http://localhost:8989", "my-secret-api-key")
+	conn, err := svc.Create(context.Background(), "Test", "sonarr", "http://localhost:8989", "my-secret-api-key", CheckSettings{})
 	if err != nil {
 		t.Fatalf("Create: %v", err)
 	}
@@ -364,7 +380,7 @@ func TestAPIKeyEncryptedAtRest(t *testing.T) {
 func TestURLTrailingSlashTrimmed(t *testing.T) {
 	svc := setupTestService(t)
 
-	conn, err := svc.Create(context.Background(), "Test", "sonarr", "http://localhost:8989/", "key")
+	conn, err := svc.Create(context.Background(), "Test", "sonarr", "http://localhost:8989/", "key", CheckSettings{})
 	if err != nil {
 		t.Fatalf("Create: %v", err)
 	}
@@ -0,0 +1,145 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	defaultHealthWindowDays = 7
+	maxHealthWindowDays     = 30
+	defaultFailureLimit     = 10
+	maxFailureLimit         = 100
+)
+
+// HealthReport summarizes a connection's recorded health checks.
+type HealthReport struct {
+	Connection *repository.Connection
+	Since      string
+	Summary    *repository.HealthSummary
+	Failures   []*repository.HealthCheck
+}
+
+// Health returns uptime statistics and recent failures for a connection
+// over the last windowDays days. It returns nil if the connection does not exist.
+func (s *Service) Health(ctx context.Context, id string, windowDays, failureLimit int) (*HealthReport, error) {
+	conn, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching connection: %w", err)
+	}
+	if conn == nil {
+		return nil, nil
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -windowDays).Format(time.RFC3339)
+
+	summary, err := s.checker.checks.Summary(ctx, id, since)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := s.checker.checks.ListFailures(ctx, id, since, failureLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HealthReport{Connection: conn, Since: since, Summary: summary, Failures: failures}, nil
+}
+
+type healthFailureResponse struct {
+	CheckedAt    string `json:"checkedAt"`
+	ErrorMessage string `json:"errorMessage"`
+	LatencyMS    int64  `json:"latencyMs"`
+}
+
+type healthResponse struct {
+	ConnectionID     string                  `json:"connectionId"`
+	Status           string                  `json:"status"`
+	LastCheckedAt    string                  `json:"lastCheckedAt,omitempty"`
+	Since            string                  `json:"since"`
+	TotalChecks      int                     `json:"totalChecks"`
+	HealthyChecks    int                     `json:"healthyChecks"`
+	UptimePercent    *float64                `json:"uptimePercent"`
+	AverageLatencyMS float64                 `json:"averageLatencyMs"`
+	RecentFailures   []healthFailureResponse `json:"recentFailures"`
+}
+
+// HealthHandler returns uptime and recent failures for a connection.
+// @Summary Connection health history
+// @Description Uptime percentage, average latency, and recent failed checks over a window of days. uptimePercent is null when no checks were recorded.
+// @Tags connections
+// @Produce json
+// @Param id path string true "Connection ID"
+// @Param days query int false "Window in days (default 7, max 30)"
+// @Param failures query int false "Maximum recent failures to return (default 10, max 100)"
+// @Success 200 {object} healthResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /connections/{id}/health [get]
+func (s *Service) HealthHandler(c echo.Context) error {
+	days, err := boundedIntParam(c, "days", defaultHealthWindowDays, maxHealthWindowDays)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	limit, err := boundedIntParam(c, "failures", defaultFailureLimit, maxFailureLimit)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	report, err := s.Health(c.Request().Context(), c.Param("id"), days, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to load health history"})
+	}
+	if report == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "connection not found"})
+	}
+
+	resp := healthResponse{
+		ConnectionID:     report.Connection.ID,
+		Status:           string(report.Connection.Status),
+		Since:            report.Since,
+		TotalChecks:      report.Summary.TotalChecks,
+		HealthyChecks:    report.Summary.HealthyChecks,
+		AverageLatencyMS: math.Round(report.Summary.AverageLatencyMS*10) / 10,
+		RecentFailures:   make([]healthFailureResponse, 0, len(report.Failures)),
+	}
+	if report.Connection.LastCheckedAt != nil {
+		resp.LastCheckedAt = *report.Connection.LastCheckedAt
+	}
+	if report.Summary.TotalChecks > 0 {
+		uptime := float64(report.Summary.HealthyChecks) / float64(report.Summary.TotalChecks) * 100
+		uptime = math.Round(uptime*100) / 100
+		resp.UptimePercent = &uptime
+	}
+	for _, f := range report.Failures {
+		resp.RecentFailures = append(resp.RecentFailures, healthFailureResponse{
+			CheckedAt:    f.CheckedAt,
+			ErrorMessage: f.ErrorMessage,
+			LatencyMS:    f.LatencyMS,
+		})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// boundedIntParam parses an optional positive query parameter, capping it at ceiling.
+func boundedIntParam(c echo.Context, name string, def, ceiling int) (int, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return min(v, ceiling), nil
+}
@@ -2,47 +2,121 @@ package connection
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand/v2"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/sydlexius/media-reaper/internal/events"
 	"github.com/sydlexius/media-reaper/internal/repository"
 )
 
-// HealthChecker periodically tests all enabled connections.
+const (
+	// healthHistoryRetention is how long individual check results are kept.
+	healthHistoryRetention = 30 * 24 * time.Hour
+	// scheduleTick is how often the checker looks for connections that are due.
+	scheduleTick = 15 * time.Second
+	// pruneEvery limits how often old check results are deleted.
+	pruneEvery = time.Hour
+	// maxBackoff caps the delay between checks of a failing connection,
+	// unless its own interval is already longer.
+	maxBackoff = time.Hour
+	// backoffJitter spreads retries by up to ±20% so failing connections
+	// that went down together do not retry in lockstep.
+	backoffJitter = 0.2
+
+	defaultCheckTimeout = 15 * time.Second
+)
+
+// ErrDecryptAPIKey means a connection's stored API key could not be decrypted.
+var ErrDecryptAPIKey = errors.New("failed to decrypt api key")
+
+// StateChange is the payload of events.ConnectionStateChanged.
+type StateChange struct {
+	Connection *repository.Connection
+	Previous   repository.ConnectionStatus
+	Current    repository.ConnectionStatus
+	// Reason is the failure message when Current is unhealthy.
+	Reason    string
+	CheckedAt string
+}
+
+// HealthChecker tests enabled connections on their own schedules with a
+// bounded number of checks in flight, records each result, and publishes an
+// event whenever a connection changes state.
 type HealthChecker struct {
-	repo      repository.ConnectionRepository
-	encryptor *Encryptor
-	interval  time.Duration
+	repo        repository.ConnectionRepository
+	checks      repository.HealthCheckRepository
+	encryptor   *Encryptor
+	interval    time.Duration
+	concurrency int
+	publisher   events.Publisher
+
+	sem       chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	inFlight  map[string]bool
+	lastPrune time.Time
 }
 
-// NewHealthChecker creates a health checker.
+// NewHealthChecker creates a health checker. interval is the default for
+// connections without their own interval. publisher may be nil.
 func NewHealthChecker(
 	repo repository.ConnectionRepository,
+	checks repository.HealthCheckRepository,
 	encryptor *Encryptor,
 	interval time.Duration,
+	concurrency int,
+	publisher events.Publisher,
 ) *HealthChecker {
-	return &HealthChecker{repo: repo, encryptor: encryptor, interval: interval}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &HealthChecker{
+		repo:        repo,
+		checks:      checks,
+		encryptor:   encryptor,
+		interval:    interval,
+		concurrency: concurrency,
+		publisher:   publisher,
+		sem:         make(chan struct{}, concurrency),
+		inFlight:    make(map[string]bool),
+	}
 }
 
-// Start runs the health check loop until the context is cancelled.
+// Start runs the scheduling loop until the context is cancelled, then waits
+// for in-flight checks to finish.
 func (h *HealthChecker) Start(ctx context.Context) {
-	h.checkAll(ctx)
+	h.runDue(ctx)
 
-	ticker := time.NewTicker(h.interval)
+	ticker := time.NewTicker(min(scheduleTick, h.interval))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
+			h.wg.Wait()
 			log.Println("Health checker stopped")
 			return
 		case <-ticker.C:
-			h.checkAll(ctx)
+			h.runDue(ctx)
 		}
 	}
 }
 
-func (h *HealthChecker) checkAll(ctx context.Context) {
+// runDue starts a check for every enabled connection whose next check time
+// has passed and that is not already being checked. It does not wait for the
+// checks to finish.
+func (h *HealthChecker) runDue(ctx context.Context) {
+	now := time.Now().UTC()
+	if now.Sub(h.lastPrune) >= pruneEvery {
+		h.prune(ctx, now)
+		h.lastPrune = now
+	}
+
 	connections, err := h.repo.GetAllEnabled(ctx)
 	if err != nil {
 		log.Printf("Health check: failed to fetch connections: %v", err)
@@ -50,33 +124,190 @@ func (h *HealthChecker) checkAll(ctx context.Context) {
 	}
 
 	for _, conn := range connections {
-		if ctx.Err() != nil {
-			return
-		}
-
-		apiKey, err := h.encryptor.Decrypt(conn.EncryptedAPIKey)
-		if err != nil {
-			log.Printf("Health check: failed to decrypt key for %s: %v", conn.Name, err)
-			h.updateStatus(ctx, conn.ID, repository.ConnectionStatusUnhealthy)
+		if !isDue(conn, now) || !h.claim(conn.ID) {
 			continue
 		}
 
-		checkCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
-		result, testErr := TestConnection(checkCtx, string(conn.Type), conn.URL, apiKey)
-		cancel()
+		h.wg.Add(1)
+		go func(conn *repository.Connection) {
+			defer h.wg.Done()
+			defer h.release(conn.ID)
 
-		if testErr != nil || !result.Success {
-			log.Printf("Health check: %s (%s) unhealthy", conn.Name, conn.Type)
-			h.updateStatus(ctx, conn.ID, repository.ConnectionStatusUnhealthy)
-		} else {
-			h.updateStatus(ctx, conn.ID, repository.ConnectionStatusHealthy)
-		}
+			select {
+			case h.sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-h.sem }()
+
+			h.Check(ctx, conn)
+		}(conn)
+	}
+}
+
+// Check tests a single connection, records the result, updates the stored
+// status and schedule, and publishes a state change if the status differs
+// from before. The TestResult is nil when the check could not be attempted.
+func (h *HealthChecker) Check(ctx context.Context, conn *repository.Connection) (*repository.HealthCheck, *TestResult) {
+	record, result, err := h.probe(ctx, conn)
+	if err != nil {
+		log.Printf("Health check: %s: %v", conn.Name, err)
+		record.ErrorMessage = err.Error()
+	}
+	now, _ := time.Parse(time.RFC3339, record.CheckedAt)
+
+	failures := 0
+	if record.Outcome == repository.ConnectionStatusUnhealthy {
+		failures = conn.ConsecutiveFailures + 1
+		log.Printf("Health check: %s (%s) unhealthy (%d consecutive)", conn.Name, conn.Type, failures)
+	}
+
+	if err := h.checks.Create(ctx, record); err != nil {
+		log.Printf("Health check: failed to record result for %s: %v", conn.Name, err)
+	}
+	state := repository.HealthState{
+		Status:              record.Outcome,
+		CheckedAt:           record.CheckedAt,
+		ConsecutiveFailures: failures,
+		NextCheckAt:         now.Add(h.nextDelay(conn, failures)).Format(time.RFC3339),
+	}
+	if err := h.repo.UpdateHealth(ctx, conn.ID, state); err != nil {
+		log.Printf("Health check: failed to update status for %s: %v", conn.ID, err)
+	}
+
+	if conn.Status != record.Outcome && h.publisher != nil {
+		h.publisher.Publish(ctx, events.Event{
+			Type: events.ConnectionStateChanged,
+			Payload: StateChange{
+				Connection: conn,
+				Previous:   conn.Status,
+				Current:    record.Outcome,
+				Reason:     record.ErrorMessage,
+				CheckedAt:  record.CheckedAt,
+			},
+		})
+	}
+	return record, result
+}
+
+// CheckNow tests a connection on request and stores the resulting status.
+// Unlike a scheduled check it leaves the health history, failure count, and
+// next check time alone and publishes nothing. It returns an error only if
+// the check could not be attempted.
+func (h *HealthChecker) CheckNow(ctx context.Context, conn *repository.Connection) (*TestResult, error) {
+	record, result, err := h.probe(ctx, conn)
+	if err != nil {
+		return nil, err
 	}
+	if err := h.repo.UpdateStatus(ctx, conn.ID, record.Outcome, record.CheckedAt); err != nil {
+		log.Printf("Health check: failed to update status for %s: %v", conn.ID, err)
+	}
+	return result, nil
+}
+
+// probe tests conn once within its timeout. The record's outcome is
+// unhealthy unless the test succeeded. err is set, and result nil, when the
+// API key cannot be decrypted or the connection type is unknown.
+func (h *HealthChecker) probe(ctx context.Context, conn *repository.Connection) (*repository.HealthCheck, *TestResult, error) {
+	record := &repository.HealthCheck{
+		ID:           uuid.New().String(),
+		ConnectionID: conn.ID,
+		Outcome:      repository.ConnectionStatusUnhealthy,
+		CheckedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+
+	apiKey, err := h.encryptor.Decrypt(conn.EncryptedAPIKey)
+	if err != nil {
+		return record, nil, fmt.Errorf("%w: %v", ErrDecryptAPIKey, err)
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, checkTimeout(conn))
+	defer cancel()
+	start := time.Now()
+	result, err := TestConnection(checkCtx, string(conn.Type), conn.URL, apiKey)
+	record.LatencyMS = time.Since(start).Milliseconds()
+	record.CheckedAt = time.Now().UTC().Format(time.RFC3339)
+	switch {
+	case err != nil:
+		return record, nil, err
+	case !result.Success:
+		record.ErrorMessage = result.Message
+	default:
+		record.Outcome = repository.ConnectionStatusHealthy
+		record.AppVersion = result.Version
+	}
+	return record, result, nil
+}
+
+// nextDelay returns how long to wait before checking conn again. Healthy
+// connections use their interval; failing ones double it per consecutive
+// failure, capped, with jitter.
+func (h *HealthChecker) nextDelay(conn *repository.Connection, failures int) time.Duration {
+	interval := h.intervalFor(conn)
+	if failures == 0 {
+		return interval
+	}
+	return backoff(interval, failures, rand.Float64()) //nolint:gosec // jitter does not need a CSPRNG
+}
+
+func (h *HealthChecker) intervalFor(conn *repository.Connection) time.Duration {
+	if conn.CheckIntervalSeconds > 0 {
+		return time.Duration(conn.CheckIntervalSeconds) * time.Second
+	}
+	return h.interval
+}
+
+// backoff computes interval * 2^(failures-1), capped at maxBackoff (or the
+// interval itself if that is longer), then scaled by a jitter factor derived
+// from r in [0, 1).
+func backoff(interval time.Duration, failures int, r float64) time.Duration {
+	ceiling := max(maxBackoff, interval)
+	delay := interval
+	for i := 1; i < failures && delay < ceiling; i++ {
+		delay *= 2
+	}
+	delay = min(delay, ceiling)
+
+	factor := 1 + backoffJitter*(2*r-1)
+	return time.Duration(float64(delay) * factor)
+}
+
+func checkTimeout(conn *repository.Connection) time.Duration {
+	if conn.CheckTimeoutSeconds > 0 {
+		return time.Duration(conn.CheckTimeoutSeconds) * time.Second
+	}
+	return defaultCheckTimeout
+}
+
+func isDue(conn *repository.Connection, now time.Time) bool {
+	if conn.NextCheckAt == nil {
+		return true
+	}
+	next, err := time.Parse(time.RFC3339, *conn.NextCheckAt)
+	if err != nil {
+		return true
+	}
+	return !now.Before(next)
+}
+
+func (h *HealthChecker) claim(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.inFlight[id] {
+		return false
+	}
+	h.inFlight[id] = true
+	return true
+}
+
+func (h *HealthChecker) release(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.inFlight, id)
 }
 
-func (h *HealthChecker) updateStatus(ctx context.Context, id string, status repository.ConnectionStatus) {
-	now := time.Now().UTC().Format(time.RFC3339)
-	if err := h.repo.UpdateStatus(ctx, id, status, now); err != nil {
-		log.Printf("Health check: failed to update status for %s: %v", id, err)
+func (h *HealthChecker) prune(ctx context.Context, now time.Time) {
+	cutoff := now.Add(-healthHistoryRetention).Format(time.RFC3339)
+	if _, err := h.checks.DeleteBefore(ctx, cutoff); err != nil {
+		log.Printf("Health check: failed to prune history: %v", err)
 	}
 }
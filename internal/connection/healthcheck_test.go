@@ -0,0 +1,409 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/events"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type recordingPublisher struct {
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, e events.Event) {
+	p.events = append(p.events, e)
+}
+
+// fakeEmby serves /System/Info/Public and fails while healthy is false.
+func fakeEmby(t *testing.T, healthy *atomic.Bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"ServerName": "test", "Version": "4.8.0.0"})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHealthCheckerRecordsHistoryAndTransitions(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	pub := &recordingPublisher{}
+	svc.checker.publisher = pub
+
+	var healthy atomic.Bool
+	server := fakeEmby(t, &healthy)
+
+	conn, err := svc.Create(ctx, "Emby", "emby", server.URL, "key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// unknown -> healthy -> healthy -> unhealthy -> healthy
+	for _, up := range []bool{true, true, false, true} {
+		healthy.Store(up)
+		current, err := svc.GetByID(ctx, conn.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		svc.checker.Check(ctx, current)
+	}
+
+	var transitions []string
+	for _, e := range pub.events {
+		change := e.Payload.(StateChange)
+		transitions = append(transitions, string(change.Previous)+"->"+string(change.Current))
+	}
+	want := []string{"unknown->healthy", "healthy->unhealthy", "unhealthy->healthy"}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions: got %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("transition %d: got %s, want %s", i, transitions[i], want[i])
+		}
+	}
+	if reason := pub.events[1].Payload.(StateChange).Reason; reason == "" {
+		t.Error("expected failure reason on unhealthy transition")
+	}
+
+	report, err := svc.Health(ctx, conn.ID, 7, 10)
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if report.Summary.TotalChecks != 4 || report.Summary.HealthyChecks != 3 {
+		t.Errorf("summary: got %+v", report.Summary)
+	}
+	if len(report.Failures) != 1 {
+		t.Errorf("expected 1 recent failure, got %d", len(report.Failures))
+	}
+	if report.Connection.Status != repository.ConnectionStatusHealthy {
+		t.Errorf("stored status: got %s", report.Connection.Status)
+	}
+}
+
+func TestTestSavedHandlerUpdatesStatus(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	pub := &recordingPublisher{}
+	svc.checker.publisher = pub
+
+	var healthy atomic.Bool
+	server := fakeEmby(t, &healthy)
+
+	conn, err := svc.Create(ctx, "Emby", "emby", server.URL, "key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// A scheduled failure sets the failure count and next check time that a
+	// manual test must leave alone.
+	svc.checker.Check(ctx, conn)
+	scheduled, err := svc.GetByID(ctx, conn.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	pub.events = nil
+
+	for _, tt := range []struct {
+		name       string
+		up         bool
+		wantStatus repository.ConnectionStatus
+	}{
+		{"failure marks unhealthy", false, repository.ConnectionStatusUnhealthy},
+		{"success marks healthy", true, repository.ConnectionStatusHealthy},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			healthy.Store(tt.up)
+			c, rec := newTestContext(http.MethodPost, "/api/connections/"+conn.ID+"/test", "")
+			c.SetParamNames("id")
+			c.SetParamValues(conn.ID)
+
+			if err := svc.TestSavedHandler(c); err != nil {
+				t.Fatalf("TestSavedHandler: %v", err)
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			got, err := svc.GetByID(ctx, conn.ID)
+			if err != nil {
+				t.Fatalf("GetByID: %v", err)
+			}
+			if got.Status != tt.wantStatus || got.LastCheckedAt == nil {
+				t.Errorf("got status=%s checked=%v, want %s", got.Status, got.LastCheckedAt, tt.wantStatus)
+			}
+			if got.ConsecutiveFailures != scheduled.ConsecutiveFailures || *got.NextCheckAt != *scheduled.NextCheckAt {
+				t.Errorf("manual test rescheduled: failures=%d next=%s, want %d/%s",
+					got.ConsecutiveFailures, *got.NextCheckAt, scheduled.ConsecutiveFailures, *scheduled.NextCheckAt)
+			}
+		})
+	}
+
+	if len(pub.events) != 0 {
+		t.Errorf("manual tests published %d events, want none", len(pub.events))
+	}
+	report, err := svc.Health(ctx, conn.ID, 7, 10)
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if report.Summary.TotalChecks != 1 {
+		t.Errorf("health history has %d checks, want only the scheduled one", report.Summary.TotalChecks)
+	}
+
+	// A key that cannot be decrypted means the test was never attempted.
+	broken, err := svc.Create(ctx, "Broken", "emby", server.URL, "key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	broken.EncryptedAPIKey = "not-a-ciphertext"
+	if err := svc.repo.Update(ctx, broken); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	c, rec := newTestContext(http.MethodPost, "/api/connections/"+broken.ID+"/test", "")
+	c.SetParamNames("id")
+	c.SetParamValues(broken.ID)
+	if err := svc.TestSavedHandler(c); err != nil {
+		t.Fatalf("TestSavedHandler: %v", err)
+	}
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), ErrDecryptAPIKey.Error()) {
+		t.Errorf("undecryptable key: status %d body %s, want 500 naming the key", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRunDueBoundsConcurrency(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	svc.checker = NewHealthChecker(svc.repo, svc.checker.checks, svc.encryptor, time.Minute, 2, nil)
+
+	var active, peak, total atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := active.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		active.Add(-1)
+		total.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]string{"ServerName": "test", "Version": "4.8.0.0"})
+	}))
+	defer server.Close()
+
+	for i := range 6 {
+		if _, err := svc.Create(ctx, "Emby "+strconv.Itoa(i), "emby", server.URL, "key", CheckSettings{}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	svc.checker.runDue(ctx)
+	svc.checker.wg.Wait()
+
+	if total.Load() != 6 {
+		t.Errorf("expected 6 checks, got %d", total.Load())
+	}
+	if peak.Load() > 2 {
+		t.Errorf("expected at most 2 concurrent checks, saw %d", peak.Load())
+	}
+
+	// Nothing is due again until the interval has passed.
+	svc.checker.runDue(ctx)
+	svc.checker.wg.Wait()
+	if total.Load() != 6 {
+		t.Errorf("expected no further checks before next_check_at, got %d total", total.Load())
+	}
+}
+
+func TestPerConnectionTimeout(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	conn, err := svc.Create(ctx, "Slow", "emby", server.URL, "key", CheckSettings{TimeoutSeconds: 1})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	start := time.Now()
+	record, _ := svc.checker.Check(ctx, conn)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("check took %s, expected the 1s timeout to apply", elapsed)
+	}
+	if record.Outcome != repository.ConnectionStatusUnhealthy {
+		t.Errorf("expected unhealthy outcome, got %s", record.Outcome)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		failures int
+		r        float64
+		want     time.Duration
+	}{
+		{"first failure uses interval", 5 * time.Minute, 1, 0.5, 5 * time.Minute},
+		{"doubles per failure", 5 * time.Minute, 3, 0.5, 20 * time.Minute},
+		{"capped at max", 5 * time.Minute, 10, 0.5, time.Hour},
+		{"long interval is its own cap", 2 * time.Hour, 4, 0.5, 2 * time.Hour},
+		{"low jitter", 10 * time.Minute, 1, 0, 8 * time.Minute},
+		{"high jitter", 10 * time.Minute, 1, 1, 12 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backoff(tt.interval, tt.failures, tt.r); got != tt.want {
+				t.Errorf("backoff: got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSettingsValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"defaults", `{"name":"a","type":"emby","url":"http://x","apiKey":"k"}`, false},
+		{"custom", `{"name":"a","type":"emby","url":"http://x","apiKey":"k","checkIntervalSeconds":60,"checkTimeoutSeconds":5}`, false},
+		{"interval too short", `{"name":"a","type":"emby","url":"http://x","apiKey":"k","checkIntervalSeconds":5}`, true},
+		{"timeout too long", `{"name":"a","type":"emby","url":"http://x","apiKey":"k","checkTimeoutSeconds":600}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := setupTestService(t)
+			c, rec := newTestContext(http.MethodPost, "/api/connections", tt.body)
+			if err := svc.CreateHandler(c); err != nil {
+				t.Fatalf("CreateHandler: %v", err)
+			}
+			if tt.wantErr && rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", rec.Code)
+			}
+			if !tt.wantErr && rec.Code != http.StatusCreated {
+				t.Errorf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	conn, err := svc.Create(ctx, "Emby", "emby", "http://localhost:8096", "key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	now := time.Now().UTC()
+	checks := []*repository.HealthCheck{
+		{ID: "1", ConnectionID: conn.ID, Outcome: repository.ConnectionStatusHealthy, LatencyMS: 10, CheckedAt: now.Add(-3 * time.Hour).Format(time.RFC3339)},
+		{ID: "2", ConnectionID: conn.ID, Outcome: repository.ConnectionStatusUnhealthy, LatencyMS: 30, ErrorMessage: "timeout", CheckedAt: now.Add(-2 * time.Hour).Format(time.RFC3339)},
+		{ID: "3", ConnectionID: conn.ID, Outcome: repository.ConnectionStatusHealthy, LatencyMS: 20, CheckedAt: now.Add(-time.Hour).Format(time.RFC3339)},
+		{ID: "4", ConnectionID: conn.ID, Outcome: repository.ConnectionStatusUnhealthy, ErrorMessage: "old", CheckedAt: now.AddDate(0, 0, -10).Format(time.RFC3339)},
+	}
+	for _, check := range checks {
+		if err := svc.checker.checks.Create(ctx, check); err != nil {
+			t.Fatalf("creating check: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		id           string
+		query        string
+		wantStatus   int
+		wantTotal    int
+		wantUptime   float64
+		wantFailures int
+	}{
+		{"default window excludes old checks", conn.ID, "", http.StatusOK, 3, 66.67, 1},
+		{"wider window includes old checks", conn.ID, "?days=30", http.StatusOK, 4, 50, 2},
+		{"invalid days", conn.ID, "?days=abc", http.StatusBadRequest, 0, 0, 0},
+		{"unknown connection", "missing", "", http.StatusNotFound, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newTestContext(http.MethodGet, "/api/connections/"+tt.id+"/health"+tt.query, "")
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+
+			if err := svc.HealthHandler(c); err != nil {
+				t.Fatalf("HealthHandler: %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp healthResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.TotalChecks != tt.wantTotal {
+				t.Errorf("totalChecks: got %d, want %d", resp.TotalChecks, tt.wantTotal)
+			}
+			if resp.UptimePercent == nil || *resp.UptimePercent != tt.wantUptime {
+				t.Errorf("uptimePercent: got %v, want %v", resp.UptimePercent, tt.wantUptime)
+			}
+			if len(resp.RecentFailures) != tt.wantFailures {
+				t.Errorf("recentFailures: got %d, want %d", len(resp.RecentFailures), tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestHealthHistoryDeletedWithConnection(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	conn, err := svc.Create(ctx, "Emby", "emby", "http://localhost:8096", "key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := svc.checker.checks.Create(ctx, &repository.HealthCheck{
+		ID: "1", ConnectionID: conn.ID, Outcome: repository.ConnectionStatusHealthy,
+		CheckedAt: time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		t.Fatalf("creating check: %v", err)
+	}
+
+	if err := svc.Delete(ctx, conn.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	summary, err := svc.checker.checks.Summary(ctx, conn.ID, "")
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if summary.TotalChecks != 0 {
+		t.Errorf("expected history to cascade on delete, got %d checks", summary.TotalChecks)
+	}
+}
@@ -0,0 +1,91 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/jellyfin"
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/plex"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+var (
+	ErrNotMediaServer = errors.New("connection is not a media server")
+	ErrNotEmby        = errors.New("connection is not an emby server")
+)
+
+var mediaServerNames = map[repository.ConnectionType]string{
+	repository.ConnectionTypeEmby:     "Emby",
+	repository.ConnectionTypeJellyfin: "Jellyfin",
+	repository.ConnectionTypePlex:     "Plex",
+}
+
+// IsMediaServer reports whether connections of type t are media servers
+// rather than *arr instances.
+func IsMediaServer(t repository.ConnectionType) bool {
+	_, ok := mediaServerNames[t]
+	return ok
+}
+
+// NewMediaServer returns a client for a media server of the given type. It
+// returns ErrNotMediaServer for *arr connection types.
+func NewMediaServer(t repository.ConnectionType, url, apiKey string) (mediaserver.Server, error) {
+	switch t {
+	case repository.ConnectionTypeEmby:
+		return emby.New(url, apiKey), nil
+	case repository.ConnectionTypeJellyfin:
+		return jellyfin.New(url, apiKey), nil
+	case repository.ConnectionTypePlex:
+		return plex.New(url, apiKey), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNotMediaServer, t)
+	}
+}
+
+// MediaServer returns a client for the saved media server connection with
+// the given ID, or nil if the connection does not exist.
+func (s *Service) MediaServer(ctx context.Context, id string) (mediaserver.Server, error) {
+	conn, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching connection: %w", err)
+	}
+	if conn == nil {
+		return nil, nil
+	}
+	if !IsMediaServer(conn.Type) {
+		return nil, fmt.Errorf("%w: %s", ErrNotMediaServer, conn.Type)
+	}
+	apiKey, err := s.encryptor.Decrypt(conn.EncryptedAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting api key: %w", err)
+	}
+	return NewMediaServer(conn.Type, conn.URL, apiKey)
+}
+
+// Emby returns a client for the saved Emby connection with the given ID, or
+// nil if the connection does not exist. The client can delete items only if
+// the connection allows direct deletion.
+func (s *Service) Emby(ctx context.Context, id string) (*emby.Client, error) {
+	conn, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching connection: %w", err)
+	}
+	if conn == nil {
+		return nil, nil
+	}
+	if conn.Type != repository.ConnectionTypeEmby {
+		return nil, fmt.Errorf("%w: %s", ErrNotEmby, conn.Type)
+	}
+	apiKey, err := s.encryptor.Decrypt(conn.EncryptedAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting api key: %w", err)
+	}
+	client := emby.New(conn.URL, apiKey)
+	if conn.AllowDirectDelete {
+		client.AllowItemDeletion()
+	}
+	return client, nil
+}
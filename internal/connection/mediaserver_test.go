@@ -0,0 +1,135 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+)
+
+func TestMediaServer(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != `MediaBrowser Token="jf-key"` {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/System/Info/Public":
+			_ = json.NewEncoder(w).Encode(mediaserver.SystemInfo{ServerName: "Den", Version: "10.10.3"})
+		case "/Users":
+			_ = json.NewEncoder(w).Encode([]*mediaserver.User{{ID: "u1", Name: "dana"}})
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	result, err := TestConnection(ctx, "jellyfin", server.URL, "jf-key")
+	if err != nil || !result.Success || result.AppName != "Jellyfin (Den)" || result.Version != "10.10.3" {
+		t.Errorf("unexpected test result %+v: %v", result, err)
+	}
+
+	conn, err := svc.Create(ctx, "Den", "jellyfin", server.URL, "jf-key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	client, err := svc.MediaServer(ctx, conn.ID)
+	if err != nil {
+		t.Fatalf("MediaServer: %v", err)
+	}
+	users, err := client.GetUsers(ctx)
+	if err != nil || len(users) != 1 || users[0].Name != "dana" {
+		t.Errorf("unexpected users %+v: %v", users, err)
+	}
+
+	if client, err := svc.MediaServer(ctx, "missing"); client != nil || err != nil {
+		t.Errorf("expected nil for unknown connection, got %v, %v", client, err)
+	}
+
+	sonarr, err := svc.Create(ctx, "TV", "sonarr", "http://localhost:8989", "key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := svc.MediaServer(ctx, sonarr.ID); !errors.Is(err, ErrNotMediaServer) {
+		t.Errorf("expected ErrNotMediaServer for sonarr, got %v", err)
+	}
+}
+
+func TestPlexConnectionTest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" || r.Header.Get("X-Plex-Token") != "plex-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"MediaContainer":{"friendlyName":"Den","version":"1.41.3.9314-a0bfb8370"}}`))
+	}))
+	defer server.Close()
+
+	result, err := TestConnection(context.Background(), "plex", server.URL, "plex-token")
+	if err != nil || !result.Success || result.AppName != "Plex (Den)" {
+		t.Errorf("unexpected test result %+v: %v", result, err)
+	}
+
+	result, err = TestConnection(context.Background(), "plex", server.URL, "wrong")
+	if err != nil || result.Success {
+		t.Errorf("expected a failed test with a wrong token, got %+v: %v", result, err)
+	}
+}
+
+func TestEmbyDirectDelete(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	deleted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/Items/i1" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	conn, err := svc.Create(ctx, "Emby", "emby", server.URL, "emby-key", CheckSettings{})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	client, err := svc.Emby(ctx, conn.ID)
+	if err != nil {
+		t.Fatalf("Emby: %v", err)
+	}
+	if err := client.DeleteItem(ctx, "i1"); !errors.Is(err, emby.ErrDeletionNotAllowed) || deleted {
+		t.Fatalf("expected deletion to be refused without opting in, got %v", err)
+	}
+
+	allow := true
+	if _, err := svc.Update(ctx, conn.ID, conn.Name, "emby", conn.URL, "", nil, &allow, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	client, err = svc.Emby(ctx, conn.ID)
+	if err != nil {
+		t.Fatalf("Emby: %v", err)
+	}
+	if err := client.DeleteItem(ctx, "i1"); err != nil || !deleted {
+		t.Errorf("expected the item to be deleted after opting in, got %v", err)
+	}
+
+	if _, err := svc.Update(ctx, conn.ID, conn.Name, "jellyfin", conn.URL, "", nil, &allow, nil); !errors.Is(err, ErrDirectDeleteUnsupported) {
+		t.Errorf("expected ErrDirectDeleteUnsupported for jellyfin, got %v", err)
+	}
+	updated, err := svc.Update(ctx, conn.ID, conn.Name, "jellyfin", conn.URL, "", nil, nil, nil)
+	if err != nil || updated.AllowDirectDelete {
+		t.Errorf("expected changing the type to turn direct deletion off, got %+v: %v", updated, err)
+	}
+	if _, err := svc.Emby(ctx, conn.ID); !errors.Is(err, ErrNotEmby) {
+		t.Errorf("expected ErrNotEmby, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// legacyKeyID labels ciphertexts written before key IDs were embedded.
+const legacyKeyID = "legacy"
+
+var (
+	ErrUndecryptableSecrets = errors.New("stored secret cannot be decrypted with any configured master key")
+	ErrMasterKeyMismatch    = errors.New("master key does not match stored secrets")
+)
+
+// KeyRotator reports on and re-encrypts every secret stored with the master key.
+type KeyRotator struct {
+	secrets   repository.SecretRepository
+	encryptor *Encryptor
+	// undecryptable is how many secrets no configured key could open when
+	// they were last inspected, so health checks need not decrypt them all.
+	undecryptable atomic.Int64
+}
+
+// NewKeyRotator creates a key rotator.
+func NewKeyRotator(secrets repository.SecretRepository, encryptor *Encryptor) *KeyRotator {
+	return &KeyRotator{secrets: secrets, encryptor: encryptor}
+}
+
+// UndecryptableSecret identifies a stored secret that no configured key can open.
+type UndecryptableSecret struct {
+	Kind  string `json:"kind"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	KeyID string `json:"keyId"`
+	Error string `json:"error"`
+}
+
+// KeyStatus describes which keys stored secrets are encrypted with.
+type KeyStatus struct {
+	PrimaryKeyID  string                `json:"primaryKeyId"`
+	KeyIDs        []string              `json:"keyIds"`
+	SecretsByKey  map[string]int        `json:"secretsByKey"`
+	NeedsRotation int                   `json:"needsRotation"`
+	Undecryptable []UndecryptableSecret `json:"undecryptable"`
+}
+
+// RotationResult summarizes a rotation run.
+type RotationResult struct {
+	PrimaryKeyID string `json:"primaryKeyId"`
+	Rotated      int    `json:"rotated"`
+}
+
+// Status inspects every stored secret and reports which key encrypted it and
+// whether it can still be decrypted.
+func (r *KeyRotator) Status(ctx context.Context) (*KeyStatus, error) {
+	secrets, err := r.secrets.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &KeyStatus{
+		PrimaryKeyID:  r.encryptor.PrimaryKeyID(),
+		KeyIDs:        r.encryptor.KeyIDs(),
+		SecretsByKey:  make(map[string]int),
+		Undecryptable: []UndecryptableSecret{},
+	}
+	for _, secret := range secrets {
+		keyID := KeyIDOf(secret.Ciphertext)
+		if keyID == "" {
+			keyID = legacyKeyID
+		}
+		status.SecretsByKey[keyID]++
+
+		if r.encryptor.NeedsRotation(secret.Ciphertext) {
+			status.NeedsRotation++
+		}
+		if _, err := r.encryptor.Decrypt(secret.Ciphertext); err != nil {
+			status.Undecryptable = append(status.Undecryptable, UndecryptableSecret{
+				Kind:  string(secret.Kind),
+				ID:    secret.ID,
+				Name:  secret.Name,
+				KeyID: keyID,
+				Error: err.Error(),
+			})
+		}
+	}
+	r.undecryptable.Store(int64(len(status.Undecryptable)))
+	return status, nil
+}
+
+// Degraded reports whether stored secrets could not all be decrypted when
+// last inspected by Status or Rotate. It does not touch the database.
+func (r *KeyRotator) Degraded() bool {
+	return r.undecryptable.Load() > 0
+}
+
+// Verify returns ErrMasterKeyMismatch when secrets are stored but none of them
+// can be decrypted, which means the configured key is not the one they were
+// encrypted with. Individual undecryptable secrets are left to Status.
+func (r *KeyRotator) Verify(ctx context.Context) error {
+	status, err := r.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, n := range status.SecretsByKey {
+		total += n
+	}
+	if total == 0 || len(status.Undecryptable) < total {
+		return nil
+	}
+
+	stored := make([]string, 0, len(status.SecretsByKey))
+	for keyID := range status.SecretsByKey {
+		stored = append(stored, keyID)
+	}
+	slices.Sort(stored)
+	return fmt.Errorf("%w: none of the %d stored secrets can be decrypted with the configured keys %v (secrets use %v)",
+		ErrMasterKeyMismatch, total, status.KeyIDs, stored)
+}
+
+// Rotate re-encrypts every secret not already under the primary key in a
+// single transaction. If any secret cannot be decrypted nothing is changed.
+func (r *KeyRotator) Rotate(ctx context.Context) (*RotationResult, error) {
+	rotated, err := r.secrets.ReplaceAll(ctx, func(secret *repository.EncryptedSecret) (string, error) {
+		if !r.encryptor.NeedsRotation(secret.Ciphertext) {
+			return secret.Ciphertext, nil
+		}
+		plaintext, err := r.encryptor.Decrypt(secret.Ciphertext)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s %q (%s): %v", ErrUndecryptableSecrets, secret.Kind, secret.Name, secret.ID, err)
+		}
+		return r.encryptor.Encrypt(plaintext)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Rotation only commits when every secret could be decrypted.
+	r.undecryptable.Store(0)
+	return &RotationResult{PrimaryKeyID: r.encryptor.PrimaryKeyID(), Rotated: rotated}, nil
+}
+
+// StatusHandler reports the key status of stored secrets.
+// @Summary Encryption key status
+// @Description Report which master key encrypts each stored secret and list any that cannot be decrypted
+// @Tags encryption
+// @Produce json
+// @Success 200 {object} KeyStatus
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /encryption/status [get]
+func (r *KeyRotator) StatusHandler(c echo.Context) error {
+	status, err := r.Status(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to inspect stored secrets"})
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// RotateHandler re-encrypts stored secrets with the primary master key.
+// @Summary Rotate master key
+// @Description Re-encrypt all stored secrets with the current master key in one transaction. Set the new key as MEDIA_REAPER_MASTER_KEY and the old one in MEDIA_REAPER_PREVIOUS_MASTER_KEYS before calling.
+// @Tags encryption
+// @Produce json
+// @Success 200 {object} RotationResult
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /encryption/rotate [post]
+func (r *KeyRotator) RotateHandler(c echo.Context) error {
+	result, err := r.Rotate(c.Request().Context())
+	if errors.Is(err, ErrUndecryptableSecrets) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to rotate master key"})
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,223 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+)
+
+func setupRotationDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	schema := `
+	CREATE TABLE connections (
+		id                TEXT PRIMARY KEY,
+		name              TEXT NOT NULL,
+		encrypted_api_key TEXT NOT NULL,
+		created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE notification_providers (
+		id               TEXT PRIMARY KEY,
+		name             TEXT NOT NULL,
+		encrypted_config TEXT NOT NULL,
+		created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE users (
+		id       TEXT PRIMARY KEY,
+		username TEXT NOT NULL
+	);
+	CREATE TABLE user_totp (
+		user_id          TEXT PRIMARY KEY,
+		encrypted_secret TEXT NOT NULL,
+		created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	return db
+}
+
+func mustEncryptor(t *testing.T, key string, previous ...string) *Encryptor {
+	t.Helper()
+	enc, err := NewEncryptor(key, previous...)
+	if err != nil {
+		t.Fatalf("creating encryptor: %v", err)
+	}
+	return enc
+}
+
+func mustEncrypt(t *testing.T, enc *Encryptor, plaintext string) string {
+	t.Helper()
+	ciphertext, err := enc.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("encrypting: %v", err)
+	}
+	return ciphertext
+}
+
+func secretValue(t *testing.T, db *sql.DB, query, id string) string {
+	t.Helper()
+	var v string
+	if err := db.QueryRow(query, id).Scan(&v); err != nil {
+		t.Fatalf("reading secret %s: %v", id, err)
+	}
+	return v
+}
+
+func TestKeyRotatorRotate(t *testing.T) {
+	db := setupRotationDB(t)
+	oldKey, newKey := generateTestKey(t), generateTestKey(t)
+	old := mustEncryptor(t, oldKey)
+
+	if _, err := db.Exec(`INSERT INTO connections (id, name, encrypted_api_key) VALUES (?, ?, ?)`,
+		"c1", "Sonarr", mustEncrypt(t, old, "sonarr-key")); err != nil {
+		t.Fatalf("seeding connection: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO notification_providers (id, name, encrypted_config) VALUES (?, ?, ?)`,
+		"n1", "Discord", mustEncrypt(t, old, `{"url":"https://example.com"}`)); err != nil {
+		t.Fatalf("seeding provider: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (id, username) VALUES ('u1', 'admin')`); err != nil {
+		t.Fatalf("seeding user: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO user_totp (user_id, encrypted_secret) VALUES (?, ?)`,
+		"u1", mustEncrypt(t, old, "totp-secret")); err != nil {
+		t.Fatalf("seeding totp: %v", err)
+	}
+
+	enc := mustEncryptor(t, newKey, oldKey)
+	rotator := NewKeyRotator(sqliterepo.NewSecretRepository(db), enc)
+	ctx := context.Background()
+
+	status, err := rotator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.NeedsRotation != 3 || status.SecretsByKey[old.PrimaryKeyID()] != 3 || len(status.Undecryptable) != 0 {
+		t.Fatalf("unexpected status before rotation: %+v", status)
+	}
+	if rotator.Degraded() {
+		t.Error("Degraded with every secret decryptable")
+	}
+
+	result, err := rotator.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if result.Rotated != 3 || result.PrimaryKeyID != enc.PrimaryKeyID() {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// The old key is no longer needed once everything is rotated.
+	newOnly := mustEncryptor(t, newKey)
+	apiKey := secretValue(t, db, `SELECT encrypted_api_key FROM connections WHERE id = ?`, "c1")
+	if got, err := newOnly.Decrypt(apiKey); err != nil || got != "sonarr-key" {
+		t.Errorf("connection secret after rotation: got %q, %v", got, err)
+	}
+	config := secretValue(t, db, `SELECT encrypted_config FROM notification_providers WHERE id = ?`, "n1")
+	if got, err := newOnly.Decrypt(config); err != nil || got != `{"url":"https://example.com"}` {
+		t.Errorf("provider secret after rotation: got %q, %v", got, err)
+	}
+	totp := secretValue(t, db, `SELECT encrypted_secret FROM user_totp WHERE user_id = ?`, "u1")
+	if got, err := newOnly.Decrypt(totp); err != nil || got != "totp-secret" {
+		t.Errorf("totp secret after rotation: got %q, %v", got, err)
+	}
+
+	again, err := rotator.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("second Rotate: %v", err)
+	}
+	if again.Rotated != 0 {
+		t.Errorf("second rotation should be a no-op, rotated %d", again.Rotated)
+	}
+}
+
+func TestKeyRotatorUndecryptableRollsBack(t *testing.T) {
+	db := setupRotationDB(t)
+	oldKey, lostKey, newKey := generateTestKey(t), generateTestKey(t), generateTestKey(t)
+	old, lost := mustEncryptor(t, oldKey), mustEncryptor(t, lostKey)
+
+	original := mustEncrypt(t, old, "readable")
+	if _, err := db.Exec(`INSERT INTO connections (id, name, encrypted_api_key) VALUES (?, ?, ?), (?, ?, ?)`,
+		"c1", "Readable", original,
+		"c2", "Lost", mustEncrypt(t, lost, "unreadable")); err != nil {
+		t.Fatalf("seeding connections: %v", err)
+	}
+
+	rotator := NewKeyRotator(sqliterepo.NewSecretRepository(db), mustEncryptor(t, newKey, oldKey))
+
+	status, err := rotator.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(status.Undecryptable) != 1 || status.Undecryptable[0].ID != "c2" {
+		t.Fatalf("expected c2 to be undecryptable, got %+v", status.Undecryptable)
+	}
+	if !rotator.Degraded() {
+		t.Error("expected Degraded after Status found an undecryptable secret")
+	}
+
+	c, rec := newTestContext(http.MethodPost, "/api/encryption/rotate", "")
+	if err := rotator.RotateHandler(c); err != nil {
+		t.Fatalf("RotateHandler: %v", err)
+	}
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if got := secretValue(t, db, `SELECT encrypted_api_key FROM connections WHERE id = ?`, "c1"); got != original {
+		t.Error("readable secret should be unchanged after a failed rotation")
+	}
+}
+
+func TestKeyRotatorVerify(t *testing.T) {
+	oldKey, otherKey, newKey := generateTestKey(t), generateTestKey(t), generateTestKey(t)
+	old, other := mustEncryptor(t, oldKey), mustEncryptor(t, otherKey)
+
+	tests := []struct {
+		name     string
+		seed     []string
+		key      string
+		previous []string
+		wantErr  bool
+	}{
+		{name: "empty database", key: newKey},
+		{name: "matching key", seed: []string{mustEncrypt(t, old, "a")}, key: oldKey},
+		{name: "wrong key", seed: []string{mustEncrypt(t, old, "a"), mustEncrypt(t, old, "b")}, key: newKey, wantErr: true},
+		{name: "old key kept as previous", seed: []string{mustEncrypt(t, old, "a")}, key: newKey, previous: []string{oldKey}},
+		{name: "partially readable", seed: []string{mustEncrypt(t, old, "a"), mustEncrypt(t, other, "b")}, key: oldKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupRotationDB(t)
+			for i, ciphertext := range tt.seed {
+				id := string(rune('a' + i))
+				if _, err := db.Exec(`INSERT INTO connections (id, name, encrypted_api_key) VALUES (?, ?, ?)`, id, id, ciphertext); err != nil {
+					t.Fatalf("seeding: %v", err)
+				}
+			}
+
+			rotator := NewKeyRotator(sqliterepo.NewSecretRepository(db), mustEncryptor(t, tt.key, tt.previous...))
+			err := rotator.Verify(context.Background())
+			if tt.wantErr != errors.Is(err, ErrMasterKeyMismatch) {
+				t.Errorf("Verify: got %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
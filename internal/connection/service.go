@@ -2,6 +2,7 @@ package connection
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -13,15 +14,42 @@ import (
 type Service struct {
 	repo      repository.ConnectionRepository
 	encryptor *Encryptor
+	checker   *HealthChecker
 }
 
-// NewService creates a connection service.
-func NewService(repo repository.ConnectionRepository, encryptor *Encryptor) *Service {
-	return &Service{repo: repo, encryptor: encryptor}
+// NewService creates a connection service. The health checker runs manual
+// connection tests so they update the stored status.
+func NewService(repo repository.ConnectionRepository, encryptor *Encryptor, checker *HealthChecker) *Service {
+	return &Service{repo: repo, encryptor: encryptor, checker: checker}
+}
+
+var (
+	ErrInvalidCheckSettings = errors.New("checkIntervalSeconds must be 0 or between 30 and 86400, and checkTimeoutSeconds 0 or between 1 and 120")
+	// ErrDirectDeleteUnsupported is returned when direct deletion is turned
+	// on for a connection that is not an Emby server.
+	ErrDirectDeleteUnsupported = errors.New("allowDirectDelete is only supported for emby connections")
+)
+
+// CheckSettings are the per-connection health check overrides. Zero values
+// fall back to the global interval and the default timeout.
+type CheckSettings struct {
+	IntervalSeconds int
+	TimeoutSeconds  int
+}
+
+// Validate reports whether the settings are within accepted bounds.
+func (cs CheckSettings) Validate() error {
+	if cs.IntervalSeconds != 0 && (cs.IntervalSeconds < 30 || cs.IntervalSeconds > 86400) {
+		return ErrInvalidCheckSettings
+	}
+	if cs.TimeoutSeconds != 0 && (cs.TimeoutSeconds < 1 || cs.TimeoutSeconds > 120) {
+		return ErrInvalidCheckSettings
+	}
+	return nil
 }
 
 // Create creates a new connection with an encrypted API key.
-func (s *Service) Create(ctx context.Context, name, connType, url, apiKey string) (*repository.Connection, error) {
+func (s *Service) Create(ctx context.Context, name, connType, url, apiKey string, settings CheckSettings) (*repository.Connection, error) {
 	encrypted, err := s.encryptor.Encrypt(apiKey)
 	if err != nil {
 		return nil, fmt.Errorf("encrypting api key: %w", err)
@@ -35,6 +63,9 @@ func (s *Service) Create(ctx context.Context, name, connType, url, apiKey string
 		EncryptedAPIKey: encrypted,
 		Enabled:         true,
 		Status:          repository.ConnectionStatusUnknown,
+
+		CheckIntervalSeconds: settings.IntervalSeconds,
+		CheckTimeoutSeconds:  settings.TimeoutSeconds,
 	}
 
 	if err := s.repo.Create(ctx, conn); err != nil {
@@ -54,8 +85,15 @@ func (s *Service) GetByID(ctx context.Context, id string) (*repository.Connectio
 	return s.repo.GetByID(ctx, id)
 }
 
-// Update updates a connection. If apiKey is non-empty, re-encrypts it.
-func (s *Service) Update(ctx context.Context, id, name, connType, url, apiKey string, enabled *bool) (*repository.Connection, error) {
+// Update updates a connection. If apiKey is non-empty, re-encrypts it. If
+// settings or allowDirectDelete is nil, that setting is left unchanged,
+// except that direct deletion is turned off when the type changes away from
+// Emby. Any update schedules the connection for an immediate health check.
+func (s *Service) Update(ctx context.Context, id, name, connType, url, apiKey string, enabled, allowDirectDelete *bool, settings *CheckSettings) (*repository.Connection, error) {
+	if allowDirectDelete != nil && *allowDirectDelete && repository.ConnectionType(connType) != repository.ConnectionTypeEmby {
+		return nil, ErrDirectDeleteUnsupported
+	}
+
 	conn, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("fetching connection: %w", err)
@@ -80,6 +118,19 @@ func (s *Service) Update(ctx context.Context, id, name, connType, url, apiKey st
 		conn.Enabled = *enabled
 	}
 
+	if allowDirectDelete != nil {
+		conn.AllowDirectDelete = *allowDirectDelete
+	}
+	if conn.Type != repository.ConnectionTypeEmby {
+		conn.AllowDirectDelete = false
+	}
+
+	if settings != nil {
+		conn.CheckIntervalSeconds = settings.IntervalSeconds
+		conn.CheckTimeoutSeconds = settings.TimeoutSeconds
+	}
+	conn.NextCheckAt = nil
+
 	if err := s.repo.Update(ctx, conn); err != nil {
 		return nil, fmt.Errorf("updating connection: %w", err)
 	}
@@ -0,0 +1,180 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// NowPlaying is an item playing or paused on a media server.
+type NowPlaying struct {
+	ConnectionID   string `json:"connectionId"`
+	ConnectionName string `json:"connectionName"`
+	SessionID      string `json:"sessionId"`
+	UserID         string `json:"userId,omitempty"`
+	UserName       string `json:"userName,omitempty"`
+	Client         string `json:"client,omitempty"`
+	DeviceName     string `json:"deviceName,omitempty"`
+	ItemID         string `json:"itemId"`
+	ItemName       string `json:"itemName"`
+	ItemType       string `json:"itemType"`
+	SeriesID       string `json:"seriesId,omitempty"`
+	SeriesName     string `json:"seriesName,omitempty"`
+	SeasonNumber   *int   `json:"seasonNumber,omitempty"`
+	EpisodeNumber  *int   `json:"episodeNumber,omitempty"`
+	// Positions are in seconds.
+	PositionSeconds int64  `json:"positionSeconds"`
+	RuntimeSeconds  int64  `json:"runtimeSeconds"`
+	IsPaused        bool   `json:"isPaused"`
+	PlayMethod      string `json:"playMethod,omitempty"`
+}
+
+// NowPlayingError reports a server whose sessions could not be read.
+type NowPlayingError struct {
+	ConnectionID   string `json:"connectionId"`
+	ConnectionName string `json:"connectionName"`
+	Error          string `json:"error"`
+}
+
+// NowPlayingResult lists what is playing across media servers.
+type NowPlayingResult struct {
+	Sessions []NowPlaying      `json:"sessions"`
+	Errors   []NowPlayingError `json:"errors"`
+}
+
+// ticksPerSecond converts Emby's 100-nanosecond ticks.
+const ticksPerSecond = 10_000_000
+
+// NowPlaying returns what is playing or paused on every enabled Emby
+// connection. Servers are asked concurrently, and one that cannot be reached
+// is reported in Errors rather than failing the whole listing.
+func (s *Service) NowPlaying(ctx context.Context) (*NowPlayingResult, error) {
+	conns, err := s.repo.GetAllEnabled(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing connections: %w", err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		result = &NowPlayingResult{Sessions: []NowPlaying{}, Errors: []NowPlayingError{}}
+	)
+	for _, conn := range conns {
+		if conn.Type != repository.ConnectionTypeEmby {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			playing, err := s.embyNowPlaying(ctx, conn)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Errors = append(result.Errors, NowPlayingError{
+					ConnectionID: conn.ID, ConnectionName: conn.Name, Error: err.Error(),
+				})
+				return
+			}
+			result.Sessions = append(result.Sessions, playing...)
+		}()
+	}
+	wg.Wait()
+	return result, nil
+}
+
+func (s *Service) embyNowPlaying(ctx context.Context, conn *repository.Connection) ([]NowPlaying, error) {
+	apiKey, err := s.encryptor.Decrypt(conn.EncryptedAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting api key: %w", err)
+	}
+	sessions, err := emby.New(conn.URL, apiKey).GetSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var playing []NowPlaying
+	for _, sess := range sessions {
+		item := sess.NowPlayingItem
+		if item == nil {
+			continue
+		}
+		np := NowPlaying{
+			ConnectionID:   conn.ID,
+			ConnectionName: conn.Name,
+			SessionID:      sess.ID,
+			UserID:         sess.UserID,
+			UserName:       sess.UserName,
+			Client:         sess.Client,
+			DeviceName:     sess.DeviceName,
+			ItemID:         item.ID,
+			ItemName:       item.Name,
+			ItemType:       item.Type,
+			SeriesID:       item.SeriesID,
+			SeriesName:     item.SeriesName,
+			SeasonNumber:   item.ParentIndexNumber,
+			EpisodeNumber:  item.IndexNumber,
+			RuntimeSeconds: item.RunTimeTicks / ticksPerSecond,
+		}
+		if sess.PlayState != nil {
+			np.PositionSeconds = sess.PlayState.PositionTicks / ticksPerSecond
+			np.IsPaused = sess.PlayState.IsPaused
+			np.PlayMethod = sess.PlayState.PlayMethod
+		}
+		playing = append(playing, np)
+	}
+	return playing, nil
+}
+
+// NowPlayingHandler lists what is playing on the media servers.
+// @Summary Now playing
+// @Description List items playing or paused in sessions on every enabled Emby connection. Servers that cannot be reached are listed under errors.
+// @Tags sessions
+// @Produce json
+// @Success 200 {object} NowPlayingResult
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /now-playing [get]
+func (s *Service) NowPlayingHandler(c echo.Context) error {
+	result, err := s.NowPlaying(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list sessions"})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// MyNowPlayingHandler lists what the signed-in user is playing.
+// @Summary My sessions
+// @Description List items playing or paused in the signed-in user's own sessions. Only users who sign in with Emby have sessions; everyone else gets an empty list. Servers that cannot be reached are listed under errors.
+// @Tags sessions
+// @Produce json
+// @Success 200 {object} NowPlayingResult
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /me/now-playing [get]
+func (s *Service) MyNowPlayingHandler(c echo.Context) error {
+	result, err := s.NowPlaying(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list sessions"})
+	}
+
+	var embyUserID string
+	if user, ok := c.Get("user").(*repository.User); ok {
+		embyUserID = user.EmbyUserID()
+	}
+	own := []NowPlaying{}
+	for _, np := range result.Sessions {
+		if embyUserID != "" && np.UserID == embyUserID {
+			own = append(own, np)
+		}
+	}
+	result.Sessions = own
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,83 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+func TestNowPlaying(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Emby-Token") != "emby-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/Sessions" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`[
+			{"Id":"idle","UserId":"e-sam","UserName":"sam"},
+			{"Id":"s1","UserId":"e-dana","UserName":"dana","Client":"Emby Web","DeviceName":"Firefox",
+			 "NowPlayingItem":{"Id":"ep1","Name":"Pilot","Type":"Episode","SeriesId":"ser1","SeriesName":"Show",
+			                   "ParentIndexNumber":1,"IndexNumber":1,"RunTimeTicks":26000000000},
+			 "PlayState":{"PositionTicks":6000000000,"IsPaused":true,"PlayMethod":"DirectPlay"}}
+		]`))
+	}))
+	defer server.Close()
+
+	for _, c := range []struct{ name, connType, key string }{
+		{"Den", "emby", "emby-key"},
+		{"Attic", "emby", "wrong-key"},
+		{"TV", "sonarr", "key"},
+	} {
+		if _, err := svc.Create(ctx, c.name, c.connType, server.URL, c.key, CheckSettings{}); err != nil {
+			t.Fatalf("Create %s: %v", c.name, err)
+		}
+	}
+
+	result, err := svc.NowPlaying(ctx)
+	if err != nil {
+		t.Fatalf("NowPlaying: %v", err)
+	}
+	if len(result.Sessions) != 1 {
+		t.Fatalf("sessions = %+v, want one playing", result.Sessions)
+	}
+	np := result.Sessions[0]
+	if np.ConnectionName != "Den" || np.UserName != "dana" || np.ItemID != "ep1" || np.SeriesID != "ser1" ||
+		!np.IsPaused || np.PositionSeconds != 600 || np.RuntimeSeconds != 2600 || *np.EpisodeNumber != 1 {
+		t.Errorf("unexpected session %+v", np)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].ConnectionName != "Attic" {
+		t.Errorf("errors = %+v, want Attic unreachable", result.Errors)
+	}
+
+	// Users see only their own sessions, and only Emby accounts have any.
+	for _, tt := range []struct {
+		user *repository.User
+		want int
+	}{
+		{&repository.User{Username: "dana", AuthProvider: repository.AuthProviderEmby, ExternalID: "e-dana"}, 1},
+		{&repository.User{Username: "sam", AuthProvider: repository.AuthProviderEmby, ExternalID: "e-sam"}, 0},
+		{&repository.User{Username: "e-dana", AuthProvider: repository.AuthProviderLocal}, 0},
+	} {
+		c, rec := newTestContext(http.MethodGet, "/api/me/now-playing", "")
+		c.Set("user", tt.user)
+		if err := svc.MyNowPlayingHandler(c); err != nil {
+			t.Fatalf("MyNowPlayingHandler: %v", err)
+		}
+		var mine NowPlayingResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &mine); err != nil {
+			t.Fatalf("decoding: %v", err)
+		}
+		if len(mine.Sessions) != tt.want {
+			t.Errorf("%s sees %d sessions, want %d", tt.user.Username, len(mine.Sessions), tt.want)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/sydlexius/media-reaper/internal/arrclient"
-	"github.com/sydlexius/media-reaper/internal/emby"
 	"github.com/sydlexius/media-reaper/internal/repository"
 )
 
@@ -36,15 +35,31 @@ func TestConnection(ctx context.Context, connType, url, apiKey string) (*TestRes
 		}
 		return &TestResult{Success: true, AppName: info.AppName, Version: info.Version}, nil
 
-	case repository.ConnectionTypeEmby:
-		client := emby.New(url, apiKey)
+	case repository.ConnectionTypeLidarr:
+		client := arrclient.NewLidarrClient(url, apiKey)
 		info, err := client.TestConnection(ctx)
 		if err != nil {
 			return &TestResult{Success: false, Message: err.Error()}, nil
 		}
+		return &TestResult{Success: true, AppName: info.AppName, Version: info.Version}, nil
+
+	case repository.ConnectionTypeReadarr:
+		client := arrclient.NewReadarrClient(url, apiKey)
+		info, err := client.TestConnection(ctx)
+		if err != nil {
+			return &TestResult{Success: false, Message: err.Error()}, nil
+		}
+		return &TestResult{Success: true, AppName: info.AppName, Version: info.Version}, nil
+
+	case repository.ConnectionTypeEmby, repository.ConnectionTypeJellyfin, repository.ConnectionTypePlex:
+		server, _ := NewMediaServer(repository.ConnectionType(connType), url, apiKey)
+		info, err := server.TestConnection(ctx)
+		if err != nil {
+			return &TestResult{Success: false, Message: err.Error()}, nil
+		}
 		return &TestResult{
 			Success: true,
-			AppName: "Emby (" + info.ServerName + ")",
+			AppName: mediaServerNames[repository.ConnectionType(connType)] + " (" + info.ServerName + ")",
 			Version: info.Version,
 		}, nil
 
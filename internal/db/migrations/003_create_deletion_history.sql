@@ -0,0 +1,38 @@
+-- +goose Up
+-- connection_id is intentionally not a foreign key: history must outlive the
+-- connection it was deleted through.
+CREATE TABLE deletion_history (
+    id                     TEXT PRIMARY KEY,
+    connection_id          TEXT NOT NULL,
+    connection_name        TEXT NOT NULL,
+    connection_type        TEXT NOT NULL,
+    media_type             TEXT NOT NULL,
+    title                  TEXT NOT NULL,
+    year                   INTEGER NOT NULL DEFAULT 0,
+    season_number          INTEGER,
+    episode_number         INTEGER,
+    arr_id                 INTEGER NOT NULL DEFAULT 0,
+    tmdb_id                INTEGER NOT NULL DEFAULT 0,
+    tvdb_id                INTEGER NOT NULL DEFAULT 0,
+    imdb_id                TEXT NOT NULL DEFAULT '',
+    size_bytes             INTEGER NOT NULL DEFAULT 0,
+    file_path              TEXT NOT NULL DEFAULT '',
+    quality                TEXT NOT NULL DEFAULT '',
+    quality_profile_id     INTEGER NOT NULL DEFAULT 0,
+    root_folder_path       TEXT NOT NULL DEFAULT '',
+    rule_name              TEXT NOT NULL DEFAULT '',
+    watched_by             TEXT NOT NULL DEFAULT '[]',
+    approved_by            TEXT NOT NULL DEFAULT '',
+    import_exclusion_added INTEGER NOT NULL DEFAULT 0,
+    deleted_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_deletion_history_deleted_at ON deletion_history(deleted_at);
+CREATE INDEX idx_deletion_history_connection_id ON deletion_history(connection_id);
+CREATE INDEX idx_deletion_history_title ON deletion_history(title);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_deletion_history_title;
+DROP INDEX IF EXISTS idx_deletion_history_connection_id;
+DROP INDEX IF EXISTS idx_deletion_history_deleted_at;
+DROP TABLE IF EXISTS deletion_history;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE deletion_history ADD COLUMN restored_at TIMESTAMP;
+ALTER TABLE deletion_history ADD COLUMN restored_by TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE deletion_history DROP COLUMN restored_by;
+ALTER TABLE deletion_history DROP COLUMN restored_at;
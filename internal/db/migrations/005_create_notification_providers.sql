@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE notification_providers (
+    id               TEXT PRIMARY KEY,
+    name             TEXT NOT NULL,
+    type             TEXT NOT NULL CHECK(type IN ('discord', 'slack', 'webhook', 'smtp', 'apprise')),
+    encrypted_config TEXT NOT NULL,
+    events           TEXT NOT NULL DEFAULT '[]',
+    title_template   TEXT NOT NULL DEFAULT '',
+    body_template    TEXT NOT NULL DEFAULT '',
+    enabled          INTEGER NOT NULL DEFAULT 1,
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notification_providers_enabled ON notification_providers(enabled);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_notification_providers_enabled;
+DROP TABLE IF EXISTS notification_providers;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE connection_health_checks (
+    id            TEXT PRIMARY KEY,
+    connection_id TEXT NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    outcome       TEXT NOT NULL CHECK(outcome IN ('healthy', 'unhealthy')),
+    latency_ms    INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT NOT NULL DEFAULT '',
+    app_version   TEXT NOT NULL DEFAULT '',
+    checked_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_connection_health_checks_connection ON connection_health_checks(connection_id, checked_at);
+CREATE INDEX idx_connection_health_checks_checked_at ON connection_health_checks(checked_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_connection_health_checks_checked_at;
+DROP INDEX IF EXISTS idx_connection_health_checks_connection;
+DROP TABLE IF EXISTS connection_health_checks;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- A zero interval means "use MEDIA_REAPER_HEALTH_CHECK_INTERVAL".
+ALTER TABLE connections ADD COLUMN check_interval_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE connections ADD COLUMN check_timeout_seconds INTEGER NOT NULL DEFAULT 15;
+ALTER TABLE connections ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE connections ADD COLUMN next_check_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE connections DROP COLUMN next_check_at;
+ALTER TABLE connections DROP COLUMN consecutive_failures;
+ALTER TABLE connections DROP COLUMN check_timeout_seconds;
+ALTER TABLE connections DROP COLUMN check_interval_seconds;
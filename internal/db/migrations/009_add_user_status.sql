@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN must_change_password INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN must_change_password;
+ALTER TABLE users DROP COLUMN disabled;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE login_attempts (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    username   TEXT NOT NULL,
+    user_id    TEXT REFERENCES users(id) ON DELETE SET NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    success    INTEGER NOT NULL,
+    reason     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_login_attempts_username ON login_attempts(username, created_at);
+CREATE INDEX idx_login_attempts_created_at ON login_attempts(created_at);
+
+-- Failed-login counters are kept per username rather than per IP, so an
+-- attack spread over many addresses is still slowed down.
+CREATE TABLE login_lockouts (
+    username       TEXT PRIMARY KEY,
+    failed_count   INTEGER NOT NULL DEFAULT 0,
+    locked_until   TIMESTAMP,
+    last_failed_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_lockouts;
+DROP TABLE IF EXISTS login_attempts;
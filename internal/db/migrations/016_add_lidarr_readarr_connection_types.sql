@@ -0,0 +1,70 @@
+-- +goose NO TRANSACTION
+-- Rebuilds connections to extend the type CHECK constraint, as in 014.
+
+-- +goose Up
+PRAGMA foreign_keys=OFF;
+
+CREATE TABLE connections_new (
+    id                     TEXT PRIMARY KEY,
+    name                   TEXT NOT NULL,
+    type                   TEXT NOT NULL CHECK(type IN ('sonarr', 'radarr', 'lidarr', 'readarr', 'emby', 'jellyfin', 'plex')),
+    url                    TEXT NOT NULL,
+    encrypted_api_key      TEXT NOT NULL,
+    enabled                INTEGER NOT NULL DEFAULT 1,
+    status                 TEXT NOT NULL DEFAULT 'unknown' CHECK(status IN ('healthy', 'unhealthy', 'unknown')),
+    last_checked_at        TIMESTAMP,
+    created_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    check_interval_seconds INTEGER NOT NULL DEFAULT 0,
+    check_timeout_seconds  INTEGER NOT NULL DEFAULT 15,
+    consecutive_failures   INTEGER NOT NULL DEFAULT 0,
+    next_check_at          TIMESTAMP
+);
+
+INSERT INTO connections_new SELECT
+    id, name, type, url, encrypted_api_key, enabled, status, last_checked_at, created_at, updated_at,
+    check_interval_seconds, check_timeout_seconds, consecutive_failures, next_check_at
+FROM connections;
+
+DROP TABLE connections;
+ALTER TABLE connections_new RENAME TO connections;
+
+CREATE INDEX idx_connections_type ON connections(type);
+CREATE INDEX idx_connections_enabled ON connections(enabled);
+
+PRAGMA foreign_keys=ON;
+
+-- +goose Down
+DELETE FROM connections WHERE type IN ('lidarr', 'readarr');
+
+PRAGMA foreign_keys=OFF;
+
+CREATE TABLE connections_old (
+    id                     TEXT PRIMARY KEY,
+    name                   TEXT NOT NULL,
+    type                   TEXT NOT NULL CHECK(type IN ('sonarr', 'radarr', 'emby', 'jellyfin', 'plex')),
+    url                    TEXT NOT NULL,
+    encrypted_api_key      TEXT NOT NULL,
+    enabled                INTEGER NOT NULL DEFAULT 1,
+    status                 TEXT NOT NULL DEFAULT 'unknown' CHECK(status IN ('healthy', 'unhealthy', 'unknown')),
+    last_checked_at        TIMESTAMP,
+    created_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    check_interval_seconds INTEGER NOT NULL DEFAULT 0,
+    check_timeout_seconds  INTEGER NOT NULL DEFAULT 15,
+    consecutive_failures   INTEGER NOT NULL DEFAULT 0,
+    next_check_at          TIMESTAMP
+);
+
+INSERT INTO connections_old SELECT
+    id, name, type, url, encrypted_api_key, enabled, status, last_checked_at, created_at, updated_at,
+    check_interval_seconds, check_timeout_seconds, consecutive_failures, next_check_at
+FROM connections;
+
+DROP TABLE connections;
+ALTER TABLE connections_old RENAME TO connections;
+
+CREATE INDEX idx_connections_type ON connections(type);
+CREATE INDEX idx_connections_enabled ON connections(enabled);
+
+PRAGMA foreign_keys=ON;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- Plays imported from external watch history, such as an Emby Playback
+-- Reporting export, kept alongside the play state media servers report.
+CREATE TABLE watch_plays (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    connection_id    TEXT NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    media_user_id    TEXT NOT NULL DEFAULT '',
+    user_name        TEXT NOT NULL DEFAULT '',
+    item_id          TEXT NOT NULL DEFAULT '',
+    item_name        TEXT NOT NULL DEFAULT '',
+    item_type        TEXT NOT NULL DEFAULT '',
+    tmdb_id          TEXT NOT NULL DEFAULT '',
+    tvdb_id          TEXT NOT NULL DEFAULT '',
+    imdb_id          TEXT NOT NULL DEFAULT '',
+    played_at        TIMESTAMP NOT NULL,
+    duration_seconds INTEGER NOT NULL DEFAULT 0,
+    source           TEXT NOT NULL CHECK(source IN ('playback_reporting', 'csv')),
+    imported_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Importing the same export twice must not count plays twice.
+CREATE UNIQUE INDEX idx_watch_plays_unique ON watch_plays(
+    connection_id, media_user_id, user_name, item_id, tmdb_id, tvdb_id, imdb_id, played_at
+);
+CREATE INDEX idx_watch_plays_played_at ON watch_plays(connection_id, played_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS watch_plays;
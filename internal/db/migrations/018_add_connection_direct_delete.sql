@@ -0,0 +1,7 @@
+-- +goose Up
+-- Deleting items directly on the media server bypasses the *arrs, so it is
+-- off unless turned on for the connection.
+ALTER TABLE connections ADD COLUMN allow_direct_delete INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE connections DROP COLUMN allow_direct_delete;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Guardrails for deleting unmanaged items directly on an Emby server. A
+-- connection without a policy cannot delete anything directly.
+CREATE TABLE direct_delete_policies (
+    connection_id     TEXT PRIMARY KEY REFERENCES connections(id) ON DELETE CASCADE,
+    library_ids       TEXT NOT NULL DEFAULT '[]',
+    grace_period_days INTEGER NOT NULL CHECK(grace_period_days >= 1),
+    max_bytes_per_run INTEGER NOT NULL CHECK(max_bytes_per_run > 0),
+    updated_by        TEXT NOT NULL DEFAULT '',
+    updated_at        TIMESTAMP NOT NULL
+);
+
+-- Items flagged for direct deletion. The grace period runs from flagged_at.
+CREATE TABLE direct_delete_candidates (
+    connection_id TEXT NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    item_id       TEXT NOT NULL,
+    item_name     TEXT NOT NULL DEFAULT '',
+    path          TEXT NOT NULL DEFAULT '',
+    size_bytes    INTEGER NOT NULL DEFAULT 0,
+    flagged_by    TEXT NOT NULL DEFAULT '',
+    flagged_at    TIMESTAMP NOT NULL,
+    PRIMARY KEY (connection_id, item_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS direct_delete_candidates;
+DROP TABLE IF EXISTS direct_delete_policies;
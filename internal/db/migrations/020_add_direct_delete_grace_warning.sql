@@ -0,0 +1,7 @@
+-- +goose Up
+-- When the notice that a candidate's grace period is about to end was sent,
+-- so it is sent only once.
+ALTER TABLE direct_delete_candidates ADD COLUMN grace_warned_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE direct_delete_candidates DROP COLUMN grace_warned_at;
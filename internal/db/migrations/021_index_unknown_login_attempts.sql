@@ -0,0 +1,7 @@
+-- +goose Up
+-- Failed logins for unknown usernames are capped per address, which looks
+-- them up by address newest first.
+CREATE INDEX idx_login_attempts_unknown_ip ON login_attempts(ip_address, id) WHERE user_id IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_login_attempts_unknown_ip;
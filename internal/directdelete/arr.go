@@ -0,0 +1,199 @@
+package directdelete
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/sydlexius/media-reaper/internal/arrclient"
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// arrContents is what one *arr instance manages: its root folders and the
+// provider IDs of its titles.
+type arrContents struct {
+	RootFolders []string
+	// Movies holds Radarr movie IDs and Series Sonarr series IDs, each as
+	// "tmdb:ID", "tvdb:ID", or "imdb:ID".
+	Movies []string
+	Series []string
+}
+
+// readArr reads the root folders of any *arr instance and the titles of a
+// Sonarr or Radarr instance.
+func readArr(ctx context.Context, conn *repository.Connection, apiKey string) (*arrContents, error) {
+	var (
+		contents = &arrContents{}
+		folders  []*arrclient.RootFolder
+		err      error
+	)
+	switch conn.Type {
+	case repository.ConnectionTypeSonarr:
+		client := arrclient.NewSonarrClient(conn.URL, apiKey)
+		if folders, err = client.GetRootFolders(ctx); err != nil {
+			return nil, err
+		}
+		series, err := client.GetAllSeries(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range series {
+			contents.Series = append(contents.Series, providerKeys(s.TmdbID, s.TvdbID, s.ImdbID)...)
+		}
+	case repository.ConnectionTypeRadarr:
+		client := arrclient.NewRadarrClient(conn.URL, apiKey)
+		if folders, err = client.GetRootFolders(ctx); err != nil {
+			return nil, err
+		}
+		movies, err := client.GetMovie(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range movies {
+			contents.Movies = append(contents.Movies, providerKeys(m.TmdbID, 0, m.ImdbID)...)
+		}
+	case repository.ConnectionTypeLidarr:
+		folders, err = arrclient.NewLidarrClient(conn.URL, apiKey).GetRootFolders(ctx)
+	case repository.ConnectionTypeReadarr:
+		folders, err = arrclient.NewReadarrClient(conn.URL, apiKey).GetRootFolders(ctx)
+	default:
+		return contents, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range folders {
+		contents.RootFolders = append(contents.RootFolders, f.Path)
+	}
+	return contents, nil
+}
+
+// arrIndex is what every *arr instance manages, combined.
+type arrIndex struct {
+	roots  []string
+	movies map[string]bool
+	series map[string]bool
+}
+
+// loadArrIndex reads every saved *arr connection, enabled or not. An
+// instance that cannot be read fails the whole load, since anything it
+// manages would otherwise look unmanaged.
+func (s *Service) loadArrIndex(ctx context.Context) (*arrIndex, error) {
+	conns, err := s.connections.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing connections: %w", err)
+	}
+	index := &arrIndex{movies: make(map[string]bool), series: make(map[string]bool)}
+	for _, conn := range conns {
+		if connection.IsMediaServer(conn.Type) {
+			continue
+		}
+		apiKey, err := s.connections.DecryptAPIKey(conn.EncryptedAPIKey)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting api key for %s: %w", conn.Name, err)
+		}
+		contents, err := s.readArr(ctx, conn, apiKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrArrUnavailable, conn.Name, err)
+		}
+		for _, root := range contents.RootFolders {
+			index.roots = append(index.roots, normalizePath(root))
+		}
+		for _, key := range contents.Movies {
+			index.movies[key] = true
+		}
+		for _, key := range contents.Series {
+			index.series[key] = true
+		}
+	}
+	return index, nil
+}
+
+// owner returns why an *arr instance appears to manage item, or "" if none
+// does. An item is managed if any of its files is under an *arr root folder,
+// or if it is a movie Radarr has or an episode of a series Sonarr has.
+func (x *arrIndex) owner(item *emby.Item, ancestors []*emby.Item) string {
+	paths := []string{item.Path}
+	for _, src := range item.MediaSources {
+		paths = append(paths, src.Path)
+	}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		p = normalizePath(p)
+		for _, root := range x.roots {
+			if underRoot(p, root) {
+				return "file is under an *arr root folder"
+			}
+		}
+	}
+
+	if item.Type == "Movie" && matchProvider(x.movies, item.ProviderIDs) != "" {
+		return "movie is managed by radarr"
+	}
+	if item.Type == "Episode" {
+		for _, a := range ancestors {
+			if a.Type == "Series" && matchProvider(x.series, a.ProviderIDs) != "" {
+				return "series is managed by sonarr"
+			}
+		}
+	}
+	return ""
+}
+
+// sharesPaths reports whether any *arr root folder and Emby library folder
+// overlap, one inside the other. If none do, Emby sees the files at other
+// paths than the *arr instances, and no item would ever be found under a
+// root folder.
+func (x *arrIndex) sharesPaths(folders []*emby.VirtualFolder) bool {
+	for _, f := range folders {
+		for _, loc := range f.Locations {
+			loc = normalizePath(loc)
+			for _, root := range x.roots {
+				if underRoot(loc, root) || underRoot(root, loc) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matchProvider returns the first of ids found in set, or "".
+func matchProvider(set map[string]bool, ids emby.Providers) string {
+	for _, key := range []string{"tmdb:" + ids.TMDB, "tvdb:" + ids.TVDB, "imdb:" + ids.IMDB} {
+		if !strings.HasSuffix(key, ":") && set[key] {
+			return key
+		}
+	}
+	return ""
+}
+
+func providerKeys(tmdb, tvdb int64, imdb string) []string {
+	var keys []string
+	if tmdb != 0 {
+		keys = append(keys, "tmdb:"+strconv.FormatInt(tmdb, 10))
+	}
+	if tvdb != 0 {
+		keys = append(keys, "tvdb:"+strconv.FormatInt(tvdb, 10))
+	}
+	if imdb != "" {
+		keys = append(keys, "imdb:"+imdb)
+	}
+	return keys
+}
+
+// normalizePath makes Windows and Unix paths comparable: backslashes become
+// slashes, the path is cleaned, and case is ignored.
+func normalizePath(p string) string {
+	return strings.ToLower(path.Clean(strings.ReplaceAll(p, `\`, "/")))
+}
+
+func underRoot(p, root string) bool {
+	return root == "/" || p == root || strings.HasPrefix(p, root+"/")
+}
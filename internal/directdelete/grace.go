@@ -0,0 +1,157 @@
+package directdelete
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/events"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	// graceWarning is how long before a grace period ends notice is sent.
+	graceWarning = 24 * time.Hour
+	// graceCheckEvery is how often candidates are checked for grace periods
+	// that are about to end.
+	graceCheckEvery = 15 * time.Minute
+)
+
+// Flagged is the payload of events.ItemFlagged and events.GraceExpiring.
+type Flagged struct {
+	Candidate      *repository.DirectDeleteCandidate
+	ConnectionName string
+	// EligibleAt is when the candidate can first be deleted, as of the event.
+	EligibleAt string
+}
+
+// WatchGracePeriods publishes events.GraceExpiring for candidates whose grace
+// period is about to end, until the context is cancelled.
+func (s *Service) WatchGracePeriods(ctx context.Context) {
+	ticker := time.NewTicker(graceCheckEvery)
+	defer ticker.Stop()
+
+	for {
+		if err := s.warnExpiring(ctx); err != nil {
+			log.Printf("Direct delete: checking grace periods failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// warnExpiring publishes events.GraceExpiring once for each candidate whose
+// grace period ends within graceWarning, on every connection that allows
+// direct deletion and has a policy.
+func (s *Service) warnExpiring(ctx context.Context) error {
+	if s.publisher == nil {
+		return nil
+	}
+	now := s.now().UTC()
+	return s.eachPolicy(ctx, func(conn *repository.Connection, policy *repository.DirectDeletePolicy, candidates []*repository.DirectDeleteCandidate) error {
+		var warned []string
+		for _, c := range candidates {
+			if c.GraceWarnedAt != "" {
+				continue
+			}
+			eligible, ok := eligibleAt(c, policy)
+			if !ok || eligible.Sub(now) > graceWarning {
+				continue
+			}
+			s.publisher.Publish(ctx, events.Event{Type: events.GraceExpiring, Payload: Flagged{
+				Candidate:      c,
+				ConnectionName: conn.Name,
+				EligibleAt:     eligible.Format(time.RFC3339),
+			}})
+			warned = append(warned, c.ItemID)
+		}
+		if len(warned) == 0 {
+			return nil
+		}
+		return s.repo.MarkGraceWarned(ctx, conn.ID, warned, now.Format(time.RFC3339))
+	})
+}
+
+// LeavingSoonItem is a flagged item as shown to users who may not see the
+// candidate lists: it leaves out the path and who flagged it.
+type LeavingSoonItem struct {
+	ConnectionName string `json:"connectionName"`
+	ItemID         string `json:"itemId"`
+	ItemName       string `json:"itemName"`
+	SizeBytes      int64  `json:"sizeBytes"`
+	// EligibleAt orders the list, soonest first.
+	EligibleAt string `json:"eligibleAt"`
+}
+
+// LeavingSoon lists flagged items on every connection that allows direct
+// deletion and has a policy, soonest to be deleted first.
+func (s *Service) LeavingSoon(ctx context.Context) ([]LeavingSoonItem, error) {
+	items := []LeavingSoonItem{}
+	err := s.eachPolicy(ctx, func(conn *repository.Connection, policy *repository.DirectDeletePolicy, candidates []*repository.DirectDeleteCandidate) error {
+		for _, c := range candidates {
+			eligible, ok := eligibleAt(c, policy)
+			if !ok {
+				continue
+			}
+			items = append(items, LeavingSoonItem{
+				ConnectionName: conn.Name,
+				ItemID:         c.ItemID,
+				ItemName:       c.ItemName,
+				SizeBytes:      c.SizeBytes,
+				EligibleAt:     eligible.Format(time.RFC3339),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(items, func(a, b LeavingSoonItem) int {
+		return strings.Compare(a.EligibleAt, b.EligibleAt)
+	})
+	return items, nil
+}
+
+// eachPolicy calls fn with the policy and candidates of every Emby connection
+// that allows direct deletion and has a policy.
+func (s *Service) eachPolicy(ctx context.Context, fn func(*repository.Connection, *repository.DirectDeletePolicy, []*repository.DirectDeleteCandidate) error) error {
+	conns, err := s.connections.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("listing connections: %w", err)
+	}
+	for _, conn := range conns {
+		if conn.Type != repository.ConnectionTypeEmby || !conn.AllowDirectDelete {
+			continue
+		}
+		policy, err := s.repo.GetPolicy(ctx, conn.ID)
+		if err != nil {
+			return fmt.Errorf("fetching policy for %s: %w", conn.Name, err)
+		}
+		if policy == nil {
+			continue
+		}
+		candidates, err := s.repo.ListCandidates(ctx, conn.ID)
+		if err != nil {
+			return fmt.Errorf("listing candidates for %s: %w", conn.Name, err)
+		}
+		if err := fn(conn, policy, candidates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eligibleAt is when a candidate's grace period ends under policy.
+func eligibleAt(c *repository.DirectDeleteCandidate, policy *repository.DirectDeletePolicy) (time.Time, bool) {
+	flagged, err := time.Parse(time.RFC3339, c.FlaggedAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return flagged.AddDate(0, 0, policy.GracePeriodDays).UTC(), true
+}
@@ -0,0 +1,282 @@
+package directdelete
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type policyRequest struct {
+	LibraryIDs      []string `json:"libraryIds"`
+	GracePeriodDays int      `json:"gracePeriodDays"`
+	MaxBytesPerRun  int64    `json:"maxBytesPerRun"`
+}
+
+type policyResponse struct {
+	ConnectionID    string   `json:"connectionId"`
+	LibraryIDs      []string `json:"libraryIds"`
+	GracePeriodDays int      `json:"gracePeriodDays"`
+	MaxBytesPerRun  int64    `json:"maxBytesPerRun"`
+	UpdatedBy       string   `json:"updatedBy"`
+	UpdatedAt       string   `json:"updatedAt"`
+}
+
+type candidateResponse struct {
+	ItemID    string `json:"itemId"`
+	ItemName  string `json:"itemName"`
+	Path      string `json:"path"`
+	SizeBytes int64  `json:"sizeBytes"`
+	FlaggedBy string `json:"flaggedBy"`
+	FlaggedAt string `json:"flaggedAt"`
+	// EligibleAt is empty when the connection has no policy.
+	EligibleAt string `json:"eligibleAt,omitempty"`
+}
+
+type flagRequest struct {
+	ItemIDs []string `json:"itemIds"`
+}
+
+type runRequest struct {
+	DryRun bool `json:"dryRun"`
+}
+
+// GetPolicyHandler returns a connection's direct deletion policy.
+// @Summary Get direct deletion policy
+// @Description Get the libraries, grace period, and size cap that govern direct deletion on an Emby connection
+// @Tags direct-delete
+// @Produce json
+// @Param id path string true "Connection ID"
+// @Success 200 {object} policyResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /connections/{id}/direct-delete [get]
+func (s *Service) GetPolicyHandler(c echo.Context) error {
+	policy, err := s.Policy(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return errorResponse(c, err, "failed to get direct deletion policy")
+	}
+	if policy == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": ErrNoPolicy.Error()})
+	}
+	return c.JSON(http.StatusOK, toPolicyResponse(policy))
+}
+
+// SetPolicyHandler saves a connection's direct deletion policy.
+// @Summary Set direct deletion policy
+// @Description Set the Emby libraries items may be deleted from directly, the days a flagged item waits before it can be deleted (1 to 365), and the most bytes one run may delete
+// @Tags direct-delete
+// @Accept json
+// @Produce json
+// @Param id path string true "Connection ID"
+// @Param request body policyRequest true "Policy"
+// @Success 200 {object} policyResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /connections/{id}/direct-delete [put]
+func (s *Service) SetPolicyHandler(c echo.Context) error {
+	var req policyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	policy := &repository.DirectDeletePolicy{
+		ConnectionID:    c.Param("id"),
+		LibraryIDs:      req.LibraryIDs,
+		GracePeriodDays: req.GracePeriodDays,
+		MaxBytesPerRun:  req.MaxBytesPerRun,
+		UpdatedBy:       username(c),
+	}
+	if err := s.SetPolicy(c.Request().Context(), policy); err != nil {
+		return errorResponse(c, err, "failed to save direct deletion policy")
+	}
+	return c.JSON(http.StatusOK, toPolicyResponse(policy))
+}
+
+// ListCandidatesHandler lists a connection's flagged items.
+// @Summary List direct deletion candidates
+// @Description List items flagged for direct deletion, oldest flag first, with when each becomes eligible under the current policy
+// @Tags direct-delete
+// @Produce json
+// @Param id path string true "Connection ID"
+// @Success 200 {array} candidateResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /connections/{id}/direct-delete/candidates [get]
+func (s *Service) ListCandidatesHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	candidates, err := s.Candidates(ctx, c.Param("id"))
+	if err != nil {
+		return errorResponse(c, err, "failed to list direct deletion candidates")
+	}
+	policy, err := s.repo.GetPolicy(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list direct deletion candidates"})
+	}
+
+	resp := make([]candidateResponse, len(candidates))
+	for i, cand := range candidates {
+		resp[i] = candidateResponse{
+			ItemID:    cand.ItemID,
+			ItemName:  cand.ItemName,
+			Path:      cand.Path,
+			SizeBytes: cand.SizeBytes,
+			FlaggedBy: cand.FlaggedBy,
+			FlaggedAt: cand.FlaggedAt,
+		}
+		if policy == nil {
+			continue
+		}
+		if eligible, ok := eligibleAt(cand, policy); ok {
+			resp[i].EligibleAt = eligible.Format(time.RFC3339)
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// LeavingSoonHandler lists flagged items across media servers.
+// @Summary List items leaving soon
+// @Description List items flagged for direct deletion on every connection that allows it, soonest to be deleted first. Unlike the candidate lists this leaves out file paths and who flagged each item.
+// @Tags direct-delete
+// @Produce json
+// @Success 200 {array} LeavingSoonItem
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /leaving-soon [get]
+func (s *Service) LeavingSoonHandler(c echo.Context) error {
+	items, err := s.LeavingSoon(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list items leaving soon"})
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+// FlagHandler flags items for direct deletion.
+// @Summary Flag items for direct deletion
+// @Description Check Emby items against the direct deletion guardrails and flag those that pass, starting their grace period. Items must be movies, episodes, or videos in an allowed library, outside every *arr root folder, and not managed by Sonarr or Radarr. Requires the connection to allow direct deletion. Refused if no *arr root folder lies inside an Emby library folder, since Emby then sees the files at other paths.
+// @Tags direct-delete
+// @Accept json
+// @Produce json
+// @Param id path string true "Connection ID"
+// @Param request body flagRequest true "Emby item IDs"
+// @Success 200 {array} ItemResult
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /connections/{id}/direct-delete/candidates [post]
+func (s *Service) FlagHandler(c echo.Context) error {
+	var req flagRequest
+	if err := c.Bind(&req); err != nil || len(req.ItemIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "itemIds is required"})
+	}
+
+	results, err := s.Flag(c.Request().Context(), c.Param("id"), req.ItemIDs, username(c))
+	if err != nil {
+		return errorResponse(c, err, "failed to flag items")
+	}
+	return c.JSON(http.StatusOK, results)
+}
+
+// UnflagHandler removes an item from the direct deletion candidates.
+// @Summary Unflag item
+// @Description Remove an item from the direct deletion candidates
+// @Tags direct-delete
+// @Param id path string true "Connection ID"
+// @Param itemId path string true "Emby item ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /connections/{id}/direct-delete/candidates/{itemId} [delete]
+func (s *Service) UnflagHandler(c echo.Context) error {
+	found, err := s.Unflag(c.Request().Context(), c.Param("id"), c.Param("itemId"))
+	if err != nil {
+		return errorResponse(c, err, "failed to unflag item")
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "item is not flagged"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RunHandler deletes flagged items whose grace period has ended.
+// @Summary Run direct deletion
+// @Description Delete flagged items whose grace period has ended, oldest flag first, up to the policy's size cap. Every guardrail is checked again first. Fails without deleting anything if any *arr connection cannot be read, or if no *arr root folder lies inside an Emby library folder. Deletions are recorded in the deletion history.
+// @Tags direct-delete
+// @Accept json
+// @Produce json
+// @Param id path string true "Connection ID"
+// @Param request body runRequest false "Run options"
+// @Success 200 {object} RunResult
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /connections/{id}/direct-delete/run [post]
+func (s *Service) RunHandler(c echo.Context) error {
+	var req runRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	result, err := s.Run(c.Request().Context(), c.Param("id"), username(c), req.DryRun)
+	if err != nil {
+		return errorResponse(c, err, "direct deletion failed")
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func errorResponse(c echo.Context, err error, fallback string) error {
+	switch {
+	case errors.Is(err, ErrConnectionNotFound), errors.Is(err, ErrNoPolicy):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, connection.ErrNotEmby), errors.Is(err, ErrInvalidPolicy), errors.Is(err, ErrUnknownLibrary),
+		errors.Is(err, ErrPathMismatch):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, emby.ErrDeletionNotAllowed):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrArrUnavailable), errors.Is(err, emby.ErrUnauthorized), errors.Is(err, emby.ErrServerError):
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fallback})
+	}
+}
+
+func username(c echo.Context) string {
+	if user, ok := c.Get("user").(*repository.User); ok {
+		return user.Username
+	}
+	return ""
+}
+
+func toPolicyResponse(p *repository.DirectDeletePolicy) policyResponse {
+	return policyResponse{
+		ConnectionID:    p.ConnectionID,
+		LibraryIDs:      p.LibraryIDs,
+		GracePeriodDays: p.GracePeriodDays,
+		MaxBytesPerRun:  p.MaxBytesPerRun,
+		UpdatedBy:       p.UpdatedBy,
+		UpdatedAt:       p.UpdatedAt,
+	}
+}
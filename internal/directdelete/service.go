@@ -0,0 +1,475 @@
+package directdelete
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/events"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	minGracePeriodDays = 1
+	maxGracePeriodDays = 365
+
+	// itemBatchSize is how many items are looked up on Emby per request.
+	itemBatchSize = 100
+)
+
+var (
+	ErrConnectionNotFound = errors.New("connection not found")
+	ErrNoPolicy           = errors.New("connection has no direct delete policy")
+	ErrInvalidPolicy      = fmt.Errorf("policy needs at least one library, a grace period of %d to %d days, and a positive maxBytesPerRun",
+		minGracePeriodDays, maxGracePeriodDays)
+	ErrUnknownLibrary = errors.New("library not found on emby")
+	ErrArrUnavailable = errors.New("could not read *arr instance")
+	ErrPathMismatch   = errors.New("no *arr root folder is inside an emby library folder; emby and the *arr instances must see media at the same paths")
+)
+
+// Item statuses reported by Flag and Run.
+const (
+	StatusFlagged        = "flagged"
+	StatusAlreadyFlagged = "already_flagged"
+	StatusRejected       = "rejected"
+	StatusDeleted        = "deleted"
+	StatusWouldDelete    = "would_delete"
+	StatusSkipped        = "skipped"
+	StatusFailed         = "failed"
+)
+
+// deletableTypes are the Emby item types that map to files on disk. Folders,
+// series, and seasons are never deleted directly.
+var deletableTypes = []string{"Movie", "Episode", "Video", "MusicVideo"}
+
+// ConnectionSource looks up saved connections and builds Emby clients.
+type ConnectionSource interface {
+	GetByID(ctx context.Context, id string) (*repository.Connection, error)
+	GetAll(ctx context.Context) ([]*repository.Connection, error)
+	DecryptAPIKey(encrypted string) (string, error)
+	Emby(ctx context.Context, id string) (*emby.Client, error)
+}
+
+// Recorder records executed deletions. Implemented by history.Service.
+type Recorder interface {
+	Record(ctx context.Context, record *repository.DeletionRecord) error
+}
+
+// Service deletes media that no *arr manages directly on an Emby server,
+// behind guardrails: the connection must opt in, items must be in an
+// allowlisted library and outside every *arr root folder, each must wait out
+// a grace period after being flagged, and a run deletes at most a set number
+// of bytes.
+type Service struct {
+	repo        repository.DirectDeleteRepository
+	connections ConnectionSource
+	history     Recorder
+	publisher   events.Publisher
+	readArr     func(ctx context.Context, conn *repository.Connection, apiKey string) (*arrContents, error)
+	now         func() time.Time
+}
+
+// NewService creates a direct deletion service. publisher may be nil.
+func NewService(repo repository.DirectDeleteRepository, connections ConnectionSource, history Recorder, publisher events.Publisher) *Service {
+	return &Service{
+		repo:        repo,
+		connections: connections,
+		history:     history,
+		publisher:   publisher,
+		readArr:     readArr,
+		now:         time.Now,
+	}
+}
+
+// ItemResult reports what Flag or Run did with one item.
+type ItemResult struct {
+	ItemID    string `json:"itemId"`
+	Name      string `json:"name,omitempty"`
+	Path      string `json:"path,omitempty"`
+	SizeBytes int64  `json:"sizeBytes,omitempty"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// RunResult reports what a run deleted, or would delete in a dry run.
+type RunResult struct {
+	DryRun         bool          `json:"dryRun"`
+	DeletedBytes   int64         `json:"deletedBytes"`
+	MaxBytesPerRun int64         `json:"maxBytesPerRun"`
+	Results        []*ItemResult `json:"results"`
+}
+
+// Policy returns a connection's policy, or nil if it has none.
+func (s *Service) Policy(ctx context.Context, connectionID string) (*repository.DirectDeletePolicy, error) {
+	if _, err := s.embyConnection(ctx, connectionID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPolicy(ctx, connectionID)
+}
+
+// SetPolicy validates and saves a connection's policy. Every library must
+// exist on the Emby server.
+func (s *Service) SetPolicy(ctx context.Context, policy *repository.DirectDeletePolicy) error {
+	if len(policy.LibraryIDs) == 0 || policy.MaxBytesPerRun <= 0 ||
+		policy.GracePeriodDays < minGracePeriodDays || policy.GracePeriodDays > maxGracePeriodDays {
+		return ErrInvalidPolicy
+	}
+	client, err := s.embyClient(ctx, policy.ConnectionID)
+	if err != nil {
+		return err
+	}
+
+	libraries, err := client.GetLibraries(ctx)
+	if err != nil {
+		return fmt.Errorf("listing emby libraries: %w", err)
+	}
+	for _, id := range policy.LibraryIDs {
+		if !slices.ContainsFunc(libraries, func(l emby.Library) bool { return l.ID == id }) {
+			return fmt.Errorf("%w: %s", ErrUnknownLibrary, id)
+		}
+	}
+
+	policy.UpdatedAt = s.now().UTC().Format(time.RFC3339)
+	return s.repo.SavePolicy(ctx, policy)
+}
+
+// Candidates returns a connection's flagged items, oldest first.
+func (s *Service) Candidates(ctx context.Context, connectionID string) ([]*repository.DirectDeleteCandidate, error) {
+	if _, err := s.embyConnection(ctx, connectionID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListCandidates(ctx, connectionID)
+}
+
+// Unflag removes an item from a connection's candidates and reports whether
+// it was flagged.
+func (s *Service) Unflag(ctx context.Context, connectionID, itemID string) (bool, error) {
+	if _, err := s.embyConnection(ctx, connectionID); err != nil {
+		return false, err
+	}
+	return s.repo.Unflag(ctx, connectionID, itemID)
+}
+
+// Flag checks items against the guardrails and flags those that pass, which
+// starts their grace period. Items flagged before keep their original flag
+// time. This is how rules hand unmanaged items over for deletion.
+func (s *Service) Flag(ctx context.Context, connectionID string, itemIDs []string, flaggedBy string) ([]*ItemResult, error) {
+	g, err := s.prepare(ctx, connectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.lookupItems(ctx, g.client, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.ListCandidates(ctx, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("listing candidates: %w", err)
+	}
+
+	now := s.now().UTC().Format(time.RFC3339)
+	results := make([]*ItemResult, 0, len(itemIDs))
+	var flag []*repository.DirectDeleteCandidate
+	for _, id := range itemIDs {
+		item := items[id]
+		if item == nil {
+			results = append(results, &ItemResult{ItemID: id, Status: StatusRejected, Reason: "not found on emby"})
+			continue
+		}
+		result := newItemResult(item)
+		results = append(results, result)
+		if result.Reason = g.check(ctx, item); result.Reason != "" {
+			result.Status = StatusRejected
+			continue
+		}
+		if slices.ContainsFunc(existing, func(c *repository.DirectDeleteCandidate) bool { return c.ItemID == id }) {
+			result.Status = StatusAlreadyFlagged
+			continue
+		}
+		result.Status = StatusFlagged
+		flag = append(flag, &repository.DirectDeleteCandidate{
+			ConnectionID: connectionID,
+			ItemID:       id,
+			ItemName:     item.Name,
+			Path:         item.Path,
+			SizeBytes:    result.SizeBytes,
+			FlaggedBy:    flaggedBy,
+			FlaggedAt:    now,
+		})
+	}
+
+	if _, err := s.repo.Flag(ctx, flag); err != nil {
+		return nil, fmt.Errorf("flagging items: %w", err)
+	}
+	if s.publisher != nil {
+		for _, c := range flag {
+			eligible, _ := eligibleAt(c, g.policy)
+			s.publisher.Publish(ctx, events.Event{Type: events.ItemFlagged, Payload: Flagged{
+				Candidate:      c,
+				ConnectionName: g.conn.Name,
+				EligibleAt:     eligible.Format(time.RFC3339),
+			}})
+		}
+	}
+	return results, nil
+}
+
+// Run deletes flagged items whose grace period is over, oldest flag first,
+// until the policy's size cap for a run is reached. Every guardrail is
+// checked again against the item as it is now, and items playing or paused
+// in an Emby session, or episodes of a series that is, are left alone. With
+// dryRun nothing is deleted and the results say what would have been.
+func (s *Service) Run(ctx context.Context, connectionID, runBy string, dryRun bool) (*RunResult, error) {
+	g, err := s.prepare(ctx, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.repo.ListCandidates(ctx, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("listing candidates: %w", err)
+	}
+
+	ids := make([]string, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.ItemID
+	}
+	items, err := s.lookupItems(ctx, g.client, ids)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := g.client.GetSessions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("checking active sessions: %w", err)
+	}
+
+	now := s.now()
+	grace := time.Duration(g.policy.GracePeriodDays) * 24 * time.Hour
+	run := &RunResult{DryRun: dryRun, MaxBytesPerRun: g.policy.MaxBytesPerRun, Results: make([]*ItemResult, 0, len(candidates))}
+	for _, c := range candidates {
+		item := items[c.ItemID]
+		if item == nil {
+			run.Results = append(run.Results, &ItemResult{
+				ItemID: c.ItemID, Name: c.ItemName, Path: c.Path, Status: StatusSkipped, Reason: "no longer on emby",
+			})
+			if !dryRun {
+				s.unflag(ctx, connectionID, c.ItemID)
+			}
+			continue
+		}
+
+		result := newItemResult(item)
+		run.Results = append(run.Results, result)
+		result.Status = StatusSkipped
+
+		flaggedAt, err := time.Parse(time.RFC3339, c.FlaggedAt)
+		if err != nil {
+			result.Reason = "invalid flag time"
+			continue
+		}
+		if eligible := flaggedAt.Add(grace); now.Before(eligible) {
+			result.Reason = "grace period ends " + eligible.UTC().Format(time.RFC3339)
+			continue
+		}
+		if emby.Playing(sessions, item.ID, item.SeriesID) {
+			result.Reason = "playing or paused on emby"
+			continue
+		}
+		if result.Reason = g.check(ctx, item); result.Reason != "" {
+			continue
+		}
+		if run.DeletedBytes+result.SizeBytes > g.policy.MaxBytesPerRun {
+			result.Reason = "would exceed the size cap for this run"
+			continue
+		}
+
+		if dryRun {
+			result.Status = StatusWouldDelete
+			run.DeletedBytes += result.SizeBytes
+			continue
+		}
+		if err := g.client.DeleteItem(ctx, item.ID); err != nil {
+			if errors.Is(err, emby.ErrNotFound) {
+				result.Reason = "no longer on emby"
+				s.unflag(ctx, connectionID, item.ID)
+				continue
+			}
+			result.Status = StatusFailed
+			result.Reason = err.Error()
+			continue
+		}
+		result.Status = StatusDeleted
+		run.DeletedBytes += result.SizeBytes
+		s.unflag(ctx, connectionID, item.ID)
+		s.record(ctx, g.conn, item, result.SizeBytes, runBy)
+	}
+	return run, nil
+}
+
+// guard holds what a flag or run checks items against.
+type guard struct {
+	conn   *repository.Connection
+	client *emby.Client
+	policy *repository.DirectDeletePolicy
+	arrs   *arrIndex
+}
+
+// prepare loads the connection, its policy, and the contents of every *arr
+// instance. It fails rather than continuing without an *arr it cannot read,
+// or when no *arr root folder lies inside an Emby library folder, since the
+// root folder check cannot work if Emby sees the files at other paths.
+func (s *Service) prepare(ctx context.Context, connectionID string) (*guard, error) {
+	conn, err := s.embyConnection(ctx, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !conn.AllowDirectDelete {
+		return nil, emby.ErrDeletionNotAllowed
+	}
+	policy, err := s.repo.GetPolicy(ctx, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching policy: %w", err)
+	}
+	if policy == nil {
+		return nil, ErrNoPolicy
+	}
+	client, err := s.embyClient(ctx, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	arrs, err := s.loadArrIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(arrs.roots) > 0 {
+		folders, err := client.GetVirtualFolders(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing emby library folders: %w", err)
+		}
+		if !arrs.sharesPaths(folders) {
+			return nil, ErrPathMismatch
+		}
+	}
+	return &guard{conn: conn, client: client, policy: policy, arrs: arrs}, nil
+}
+
+// check returns why item cannot be deleted directly, or "" if it can.
+func (g *guard) check(ctx context.Context, item *emby.Item) string {
+	if !slices.Contains(deletableTypes, item.Type) {
+		return "only movies, episodes, and videos can be deleted directly"
+	}
+	if itemSize(item) <= 0 {
+		return "item size is unknown"
+	}
+	ancestors, err := g.client.GetAncestors(ctx, item.ID)
+	if err != nil {
+		return "could not look up the item's library: " + err.Error()
+	}
+	if reason := g.arrs.owner(item, ancestors); reason != "" {
+		return reason
+	}
+	for _, a := range ancestors {
+		if slices.Contains(g.policy.LibraryIDs, a.ID) {
+			return ""
+		}
+	}
+	return "library is not allowed for direct deletion"
+}
+
+func (s *Service) embyConnection(ctx context.Context, connectionID string) (*repository.Connection, error) {
+	conn, err := s.connections.GetByID(ctx, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching connection: %w", err)
+	}
+	if conn == nil {
+		return nil, ErrConnectionNotFound
+	}
+	if conn.Type != repository.ConnectionTypeEmby {
+		return nil, fmt.Errorf("%w: %s", connection.ErrNotEmby, conn.Type)
+	}
+	return conn, nil
+}
+
+func (s *Service) embyClient(ctx context.Context, connectionID string) (*emby.Client, error) {
+	client, err := s.connections.Emby(ctx, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrConnectionNotFound
+	}
+	return client, nil
+}
+
+// lookupItems fetches items from Emby in batches, keyed by ID.
+func (s *Service) lookupItems(ctx context.Context, client *emby.Client, ids []string) (map[string]*emby.Item, error) {
+	items := make(map[string]*emby.Item, len(ids))
+	for batch := range slices.Chunk(ids, itemBatchSize) {
+		found, err := client.GetItems(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("looking up items on emby: %w", err)
+		}
+		for _, item := range found {
+			items[item.ID] = item
+		}
+	}
+	return items, nil
+}
+
+func (s *Service) unflag(ctx context.Context, connectionID, itemID string) {
+	if _, err := s.repo.Unflag(ctx, connectionID, itemID); err != nil {
+		log.Printf("Failed to unflag item %s: %v", itemID, err)
+	}
+}
+
+// record adds a direct deletion to the deletion history. Failures are logged,
+// since the item is already gone.
+func (s *Service) record(ctx context.Context, conn *repository.Connection, item *emby.Item, size int64, deletedBy string) {
+	mediaType := repository.MediaTypeVideo
+	switch item.Type {
+	case "Movie":
+		mediaType = repository.MediaTypeMovie
+	case "Episode":
+		mediaType = repository.MediaTypeEpisode
+	}
+	tmdbID, _ := strconv.ParseInt(item.ProviderIDs.TMDB, 10, 64)
+	tvdbID, _ := strconv.ParseInt(item.ProviderIDs.TVDB, 10, 64)
+
+	rec := &repository.DeletionRecord{
+		ConnectionID:   conn.ID,
+		ConnectionName: conn.Name,
+		ConnectionType: conn.Type,
+		MediaType:      mediaType,
+		Title:          item.Name,
+		SeasonNumber:   item.ParentIndexNumber,
+		EpisodeNumber:  item.IndexNumber,
+		TMDBID:         tmdbID,
+		TVDBID:         tvdbID,
+		IMDBID:         item.ProviderIDs.IMDB,
+		SizeBytes:      size,
+		FilePath:       item.Path,
+		ApprovedBy:     deletedBy,
+	}
+	if err := s.history.Record(ctx, rec); err != nil {
+		log.Printf("Failed to record direct deletion of %q: %v", item.Name, err)
+	}
+}
+
+func newItemResult(item *emby.Item) *ItemResult {
+	return &ItemResult{ItemID: item.ID, Name: item.Name, Path: item.Path, SizeBytes: itemSize(item)}
+}
+
+// itemSize is the total size of an item's files.
+func itemSize(item *emby.Item) int64 {
+	var size int64
+	for _, src := range item.MediaSources {
+		size += src.Size
+	}
+	return size
+}
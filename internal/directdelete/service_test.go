@@ -0,0 +1,514 @@
+package directdelete
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/emby"
+	"github.com/sydlexius/media-reaper/internal/events"
+	"github.com/sydlexius/media-reaper/internal/repository"
+	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+	_ "modernc.org/sqlite"
+)
+
+type stubConnections struct {
+	conns   map[string]*repository.Connection
+	embyURL string
+}
+
+func (s *stubConnections) GetByID(_ context.Context, id string) (*repository.Connection, error) {
+	return s.conns[id], nil
+}
+
+func (s *stubConnections) GetAll(_ context.Context) ([]*repository.Connection, error) {
+	var all []*repository.Connection
+	for _, c := range s.conns {
+		all = append(all, c)
+	}
+	return all, nil
+}
+
+func (s *stubConnections) DecryptAPIKey(encrypted string) (string, error) {
+	return encrypted, nil
+}
+
+func (s *stubConnections) Emby(_ context.Context, id string) (*emby.Client, error) {
+	conn := s.conns[id]
+	if conn == nil {
+		return nil, nil
+	}
+	client := emby.New(s.embyURL, "key")
+	if conn.AllowDirectDelete {
+		client.AllowItemDeletion()
+	}
+	return client, nil
+}
+
+type fakeRecorder struct {
+	records []*repository.DeletionRecord
+}
+
+func (f *fakeRecorder) Record(_ context.Context, rec *repository.DeletionRecord) error {
+	f.records = append(f.records, rec)
+	return nil
+}
+
+type fakePublisher struct {
+	events []events.Event
+}
+
+func (f *fakePublisher) Publish(_ context.Context, event events.Event) {
+	f.events = append(f.events, event)
+}
+
+// fakeEmby serves items, their ancestors, and libraries, and records deletions.
+type fakeEmby struct {
+	mu        sync.Mutex
+	items     map[string]*emby.Item
+	ancestors map[string][]*emby.Item
+	sessions  []*emby.Session
+	folders   []*emby.VirtualFolder
+	deleted   []string
+}
+
+func (f *fakeEmby) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/Library/MediaFolders":
+		_ = json.NewEncoder(w).Encode(emby.MediaFoldersResponse{Items: []emby.Library{
+			{ID: "lib-movies", Name: "Home Videos"}, {ID: "lib-tv", Name: "TV"},
+		}})
+	case r.URL.Path == "/Library/VirtualFolders":
+		_ = json.NewEncoder(w).Encode(f.folders)
+	case r.URL.Path == "/Sessions":
+		_ = json.NewEncoder(w).Encode(f.sessions)
+	case r.URL.Path == "/Items":
+		var result emby.ItemsResult
+		for _, id := range strings.Split(r.URL.Query().Get("Ids"), ",") {
+			if item := f.items[id]; item != nil {
+				result.Items = append(result.Items, item)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	case strings.HasSuffix(r.URL.Path, "/Ancestors"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/Items/"), "/Ancestors")
+		_ = json.NewEncoder(w).Encode(f.ancestors[id])
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/Items/"):
+		id := strings.TrimPrefix(r.URL.Path, "/Items/")
+		if f.items[id] == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.items, id)
+		f.deleted = append(f.deleted, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func movie(id, path string, size int64, tmdb string) *emby.Item {
+	return &emby.Item{
+		ID: id, Name: id, Type: "Movie", Path: path,
+		ProviderIDs:  emby.Providers{TMDB: tmdb},
+		MediaSources: []emby.MediaSource{{ID: id, Path: path, Size: size}},
+	}
+}
+
+func setupTestService(t *testing.T) (*Service, *stubConnections, *fakeEmby, *fakeRecorder) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	schema := `
+	CREATE TABLE direct_delete_policies (
+		connection_id     TEXT PRIMARY KEY,
+		library_ids       TEXT NOT NULL DEFAULT '[]',
+		grace_period_days INTEGER NOT NULL CHECK(grace_period_days >= 1),
+		max_bytes_per_run INTEGER NOT NULL CHECK(max_bytes_per_run > 0),
+		updated_by        TEXT NOT NULL DEFAULT '',
+		updated_at        TIMESTAMP NOT NULL
+	);
+	CREATE TABLE direct_delete_candidates (
+		connection_id TEXT NOT NULL,
+		item_id       TEXT NOT NULL,
+		item_name     TEXT NOT NULL DEFAULT '',
+		path          TEXT NOT NULL DEFAULT '',
+		size_bytes    INTEGER NOT NULL DEFAULT 0,
+		flagged_by    TEXT NOT NULL DEFAULT '',
+		flagged_at    TIMESTAMP NOT NULL,
+		grace_warned_at TIMESTAMP,
+		PRIMARY KEY (connection_id, item_id)
+	)`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+
+	lib := &emby.Item{ID: "lib-movies", Type: "CollectionFolder"}
+	series := &emby.Item{ID: "series-1", Type: "Series", ProviderIDs: emby.Providers{TVDB: "42"}}
+	fake := &fakeEmby{
+		items: map[string]*emby.Item{
+			"m1": movie("m1", `D:\Other\Home Movie.mkv`, 100, "1"),
+			"m2": movie("m2", "/Media/Movies/Managed.mkv", 100, ""),
+			"m3": movie("m3", "/media/other/Matrix.mkv", 100, "603"),
+			"m4": movie("m4", "/media/tv-other/Show.mkv", 100, ""),
+			"m5": movie("m5", "/media/other/Big.mkv", 300, ""),
+			"m6": movie("m6", "/media/other/Unknown.mkv", 0, ""),
+			"e1": {
+				ID: "e1", Name: "Pilot", Type: "Episode", Path: "/media/other/Pilot.mkv",
+				MediaSources: []emby.MediaSource{{ID: "e1", Size: 100}},
+			},
+			"e2": {
+				ID: "e2", Name: "Birthday", Type: "Episode", SeriesID: "series-2", Path: "/media/other/Birthday.mkv",
+				MediaSources: []emby.MediaSource{{ID: "e2", Size: 50}},
+			},
+			"s1": {ID: "s1", Name: "Show", Type: "Series"},
+		},
+		ancestors: map[string][]*emby.Item{
+			"m1": {lib}, "m2": {lib}, "m3": {lib}, "m5": {lib}, "m6": {lib}, "s1": {lib}, "e2": {lib},
+			"m4": {{ID: "lib-tv", Type: "CollectionFolder"}},
+			"e1": {series, lib},
+		},
+		folders: []*emby.VirtualFolder{
+			{ItemID: "lib-movies", Locations: []string{"/media/other", `D:\Other`, "/media/movies"}},
+			{ItemID: "lib-tv", Locations: []string{"/media"}},
+		},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	conns := &stubConnections{
+		embyURL: server.URL,
+		conns: map[string]*repository.Connection{
+			"emby-1":   {ID: "emby-1", Name: "Emby", Type: repository.ConnectionTypeEmby},
+			"radarr-1": {ID: "radarr-1", Name: "Radarr", Type: repository.ConnectionTypeRadarr},
+			"sonarr-1": {ID: "sonarr-1", Name: "Sonarr", Type: repository.ConnectionTypeSonarr},
+		},
+	}
+	recorder := &fakeRecorder{}
+	svc := NewService(sqliterepo.NewDirectDeleteRepository(db), conns, recorder, nil)
+	svc.readArr = func(_ context.Context, conn *repository.Connection, _ string) (*arrContents, error) {
+		switch conn.Type {
+		case repository.ConnectionTypeRadarr:
+			return &arrContents{RootFolders: []string{"/media/movies/"}, Movies: []string{"tmdb:603"}}, nil
+		case repository.ConnectionTypeSonarr:
+			return &arrContents{RootFolders: []string{"/media/tv"}, Series: []string{"tvdb:42"}}, nil
+		}
+		return &arrContents{}, nil
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	return svc, conns, fake, recorder
+}
+
+func statuses(results []*ItemResult) map[string]string {
+	m := make(map[string]string, len(results))
+	for _, r := range results {
+		m[r.ItemID] = r.Status
+	}
+	return m
+}
+
+func TestFlagGuardrails(t *testing.T) {
+	svc, conns, _, _ := setupTestService(t)
+	ctx := context.Background()
+	ids := []string{"m1", "m2", "m3", "m4", "m5", "m6", "e1", "s1", "gone"}
+
+	if _, err := svc.Flag(ctx, "emby-1", ids, "admin"); !errors.Is(err, emby.ErrDeletionNotAllowed) {
+		t.Fatalf("Flag without opt-in: got %v, want ErrDeletionNotAllowed", err)
+	}
+	conns.conns["emby-1"].AllowDirectDelete = true
+	if _, err := svc.Flag(ctx, "emby-1", ids, "admin"); !errors.Is(err, ErrNoPolicy) {
+		t.Fatalf("Flag without policy: got %v, want ErrNoPolicy", err)
+	}
+	if _, err := svc.Flag(ctx, "radarr-1", ids, "admin"); err == nil {
+		t.Fatal("Flag on a radarr connection should fail")
+	}
+
+	for _, p := range []*repository.DirectDeletePolicy{
+		{ConnectionID: "emby-1", GracePeriodDays: 7, MaxBytesPerRun: 1},
+		{ConnectionID: "emby-1", LibraryIDs: []string{"lib-movies"}, GracePeriodDays: 0, MaxBytesPerRun: 1},
+		{ConnectionID: "emby-1", LibraryIDs: []string{"lib-movies"}, GracePeriodDays: 7},
+	} {
+		if err := svc.SetPolicy(ctx, p); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("SetPolicy(%+v): got %v, want ErrInvalidPolicy", p, err)
+		}
+	}
+	err := svc.SetPolicy(ctx, &repository.DirectDeletePolicy{
+		ConnectionID: "emby-1", LibraryIDs: []string{"lib-missing"}, GracePeriodDays: 7, MaxBytesPerRun: 1,
+	})
+	if !errors.Is(err, ErrUnknownLibrary) {
+		t.Fatalf("SetPolicy with unknown library: got %v, want ErrUnknownLibrary", err)
+	}
+	if err := svc.SetPolicy(ctx, &repository.DirectDeletePolicy{
+		ConnectionID: "emby-1", LibraryIDs: []string{"lib-movies"}, GracePeriodDays: 7, MaxBytesPerRun: 350,
+	}); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+
+	results, err := svc.Flag(ctx, "emby-1", ids, "admin")
+	if err != nil {
+		t.Fatalf("Flag: %v", err)
+	}
+	want := map[string]string{
+		"m1":   StatusFlagged,
+		"m2":   StatusRejected, // under the radarr root folder, despite the case
+		"m3":   StatusRejected, // radarr has tmdb:603
+		"m4":   StatusRejected, // library not allowed
+		"m5":   StatusFlagged,
+		"m6":   StatusRejected, // size unknown
+		"e1":   StatusRejected, // sonarr has the series
+		"s1":   StatusRejected, // series cannot be deleted directly
+		"gone": StatusRejected,
+	}
+	got := statuses(results)
+	for id, status := range want {
+		if got[id] != status {
+			t.Errorf("%s: status %q, want %q", id, got[id], status)
+		}
+	}
+
+	results, err = svc.Flag(ctx, "emby-1", []string{"m1"}, "admin")
+	if err != nil {
+		t.Fatalf("Flag again: %v", err)
+	}
+	if results[0].Status != StatusAlreadyFlagged {
+		t.Errorf("reflagging m1: status %q, want %q", results[0].Status, StatusAlreadyFlagged)
+	}
+
+	candidates, err := svc.Candidates(ctx, "emby-1")
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if len(candidates) != 2 || candidates[0].ItemID != "m1" || candidates[0].SizeBytes != 100 {
+		t.Errorf("candidates = %+v, want m1 and m5", candidates)
+	}
+}
+
+func TestRun(t *testing.T) {
+	svc, conns, fake, recorder := setupTestService(t)
+	ctx := context.Background()
+	conns.conns["emby-1"].AllowDirectDelete = true
+	if err := svc.SetPolicy(ctx, &repository.DirectDeletePolicy{
+		ConnectionID: "emby-1", LibraryIDs: []string{"lib-movies"}, GracePeriodDays: 7, MaxBytesPerRun: 350,
+	}); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	if _, err := svc.Flag(ctx, "emby-1", []string{"m1", "m5"}, "admin"); err != nil {
+		t.Fatalf("Flag: %v", err)
+	}
+
+	run, err := svc.Run(ctx, "emby-1", "admin", false)
+	if err != nil {
+		t.Fatalf("Run in grace period: %v", err)
+	}
+	if run.DeletedBytes != 0 || len(fake.deleted) != 0 {
+		t.Fatalf("Run in grace period deleted %v", fake.deleted)
+	}
+
+	flaggedAt := svc.now()
+	svc.now = func() time.Time { return flaggedAt.Add(8 * 24 * time.Hour) }
+
+	run, err = svc.Run(ctx, "emby-1", "admin", true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	got := statuses(run.Results)
+	if got["m1"] != StatusWouldDelete || got["m5"] != StatusSkipped || run.DeletedBytes != 100 {
+		t.Errorf("dry run = %v, %d bytes; want m1 would_delete, m5 over the cap", got, run.DeletedBytes)
+	}
+	if len(fake.deleted) != 0 {
+		t.Fatalf("dry run deleted %v", fake.deleted)
+	}
+
+	run, err = svc.Run(ctx, "emby-1", "admin", false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := statuses(run.Results); got["m1"] != StatusDeleted || got["m5"] != StatusSkipped {
+		t.Errorf("Run = %v, want m1 deleted and m5 skipped", got)
+	}
+	if len(fake.deleted) != 1 || fake.deleted[0] != "m1" {
+		t.Errorf("deleted %v, want [m1]", fake.deleted)
+	}
+	if len(recorder.records) != 1 || recorder.records[0].MediaType != repository.MediaTypeMovie ||
+		recorder.records[0].TMDBID != 1 || recorder.records[0].ApprovedBy != "admin" ||
+		recorder.records[0].ConnectionType != repository.ConnectionTypeEmby {
+		t.Errorf("history records = %+v", recorder.records)
+	}
+
+	candidates, err := svc.Candidates(ctx, "emby-1")
+	if err != nil {
+		t.Fatalf("Candidates: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].ItemID != "m5" {
+		t.Errorf("candidates after run = %+v, want only m5", candidates)
+	}
+}
+
+func TestRunFailsClosed(t *testing.T) {
+	svc, conns, fake, _ := setupTestService(t)
+	ctx := context.Background()
+	conns.conns["emby-1"].AllowDirectDelete = true
+	if err := svc.SetPolicy(ctx, &repository.DirectDeletePolicy{
+		ConnectionID: "emby-1", LibraryIDs: []string{"lib-movies"}, GracePeriodDays: 1, MaxBytesPerRun: 1000,
+	}); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	if _, err := svc.Flag(ctx, "emby-1", []string{"m1"}, "admin"); err != nil {
+		t.Fatalf("Flag: %v", err)
+	}
+
+	flaggedAt := svc.now()
+	svc.now = func() time.Time { return flaggedAt.Add(48 * time.Hour) }
+	svc.readArr = func(context.Context, *repository.Connection, string) (*arrContents, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	if _, err := svc.Run(ctx, "emby-1", "admin", false); !errors.Is(err, ErrArrUnavailable) {
+		t.Fatalf("Run with unreachable *arr: got %v, want ErrArrUnavailable", err)
+	}
+	if len(fake.deleted) != 0 {
+		t.Errorf("deleted %v with an unreachable *arr", fake.deleted)
+	}
+}
+
+func TestPathMismatchFailsClosed(t *testing.T) {
+	svc, conns, fake, _ := setupTestService(t)
+	ctx := context.Background()
+	conns.conns["emby-1"].AllowDirectDelete = true
+	if err := svc.SetPolicy(ctx, &repository.DirectDeletePolicy{
+		ConnectionID: "emby-1", LibraryIDs: []string{"lib-movies"}, GracePeriodDays: 1, MaxBytesPerRun: 1000,
+	}); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	if _, err := svc.Flag(ctx, "emby-1", []string{"m1"}, "admin"); err != nil {
+		t.Fatalf("Flag: %v", err)
+	}
+
+	// Emby mounts the share at /mnt/user, the *arr instances at /media, so a
+	// managed file would not be found under any root folder.
+	fake.folders = []*emby.VirtualFolder{{ItemID: "lib-movies", Locations: []string{"/mnt/user/movies", "/mnt/user/other"}}}
+	flaggedAt := svc.now()
+	svc.now = func() time.Time { return flaggedAt.Add(48 * time.Hour) }
+
+	if _, err := svc.Flag(ctx, "emby-1", []string{"m5"}, "admin"); !errors.Is(err, ErrPathMismatch) {
+		t.Errorf("Flag with differing paths: got %v, want ErrPathMismatch", err)
+	}
+	if _, err := svc.Run(ctx, "emby-1", "admin", false); !errors.Is(err, ErrPathMismatch) {
+		t.Fatalf("Run with differing paths: got %v, want ErrPathMismatch", err)
+	}
+	if len(fake.deleted) != 0 {
+		t.Errorf("deleted %v with differing paths", fake.deleted)
+	}
+}
+
+func TestRunSkipsPlaying(t *testing.T) {
+	svc, conns, fake, _ := setupTestService(t)
+	ctx := context.Background()
+	conns.conns["emby-1"].AllowDirectDelete = true
+	if err := svc.SetPolicy(ctx, &repository.DirectDeletePolicy{
+		ConnectionID: "emby-1", LibraryIDs: []string{"lib-movies"}, GracePeriodDays: 1, MaxBytesPerRun: 1000,
+	}); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	if _, err := svc.Flag(ctx, "emby-1", []string{"m1", "e2", "m5"}, "admin"); err != nil {
+		t.Fatalf("Flag: %v", err)
+	}
+
+	flaggedAt := svc.now()
+	svc.now = func() time.Time { return flaggedAt.Add(48 * time.Hour) }
+	fake.sessions = []*emby.Session{
+		{ID: "idle", UserName: "sam"},
+		{
+			ID: "s1", UserName: "dana",
+			NowPlayingItem: &emby.NowPlayingItem{ID: "m1", Type: "Movie"},
+			PlayState:      &emby.PlayState{IsPaused: true},
+		},
+		{
+			ID: "s2", UserName: "lee",
+			NowPlayingItem: &emby.NowPlayingItem{ID: "e3", Type: "Episode", SeriesID: "series-2"},
+		},
+	}
+
+	run, err := svc.Run(ctx, "emby-1", "admin", false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	got := statuses(run.Results)
+	if got["m1"] != StatusSkipped || got["e2"] != StatusSkipped || got["m5"] != StatusDeleted {
+		t.Errorf("Run = %v, want m1 and e2 skipped while playing, m5 deleted", got)
+	}
+	if len(fake.deleted) != 1 || fake.deleted[0] != "m5" {
+		t.Errorf("deleted %v, want [m5]", fake.deleted)
+	}
+}
+
+func TestFlagAndGraceEvents(t *testing.T) {
+	svc, conns, _, _ := setupTestService(t)
+	ctx := context.Background()
+	pub := &fakePublisher{}
+	svc.publisher = pub
+	conns.conns["emby-1"].AllowDirectDelete = true
+	if err := svc.SetPolicy(ctx, &repository.DirectDeletePolicy{
+		ConnectionID: "emby-1", LibraryIDs: []string{"lib-movies"}, GracePeriodDays: 7, MaxBytesPerRun: 1000,
+	}); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	if _, err := svc.Flag(ctx, "emby-1", []string{"m1", "m3"}, "admin"); err != nil {
+		t.Fatalf("Flag: %v", err)
+	}
+	if _, err := svc.Flag(ctx, "emby-1", []string{"m1"}, "admin"); err != nil {
+		t.Fatalf("Flag again: %v", err)
+	}
+	if len(pub.events) != 1 || pub.events[0].Type != events.ItemFlagged {
+		t.Fatalf("events after flagging = %+v, want one item.flagged for m1", pub.events)
+	}
+	flagged := pub.events[0].Payload.(Flagged)
+	if flagged.Candidate.ItemID != "m1" || flagged.ConnectionName != "Emby" || flagged.EligibleAt != "2026-01-08T12:00:00Z" {
+		t.Errorf("flagged payload = %+v", flagged)
+	}
+
+	flaggedAt := svc.now()
+	for _, tt := range []struct {
+		after time.Duration
+		want  int
+	}{
+		{5 * 24 * time.Hour, 1}, // more than a day left
+		{6*24*time.Hour + time.Hour, 2},
+		{6*24*time.Hour + 2*time.Hour, 2}, // warned only once
+	} {
+		svc.now = func() time.Time { return flaggedAt.Add(tt.after) }
+		if err := svc.warnExpiring(ctx); err != nil {
+			t.Fatalf("warnExpiring: %v", err)
+		}
+		if len(pub.events) != tt.want {
+			t.Fatalf("after %v: %d events, want %d", tt.after, len(pub.events), tt.want)
+		}
+	}
+	if e := pub.events[1]; e.Type != events.GraceExpiring || e.Payload.(Flagged).Candidate.ItemID != "m1" {
+		t.Errorf("grace event = %+v", e)
+	}
+
+	leaving, err := svc.LeavingSoon(ctx)
+	if err != nil {
+		t.Fatalf("LeavingSoon: %v", err)
+	}
+	if len(leaving) != 1 || leaving[0].ItemID != "m1" || leaving[0].ConnectionName != "Emby" || leaving[0].EligibleAt != "2026-01-08T12:00:00Z" {
+		t.Errorf("leaving soon = %+v", leaving)
+	}
+}
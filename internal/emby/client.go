@@ -1,38 +1,48 @@
 package emby
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/mediaserver/restclient"
+)
+
+const (
+	// clientAuthorization identifies media-reaper to Emby when signing in as a
+	// user rather than with an API key.
+	clientAuthorization = `Emby Client="media-reaper", Device="media-reaper", DeviceId="media-reaper", Version="0.1.0"`
 )
 
-const defaultTimeout = 30 * time.Second
+var _ mediaserver.Server = (*Client)(nil)
 
 // Client provides access to the Emby REST API.
 type Client struct {
-	baseURL    string
-	apiKey     string
-	httpClient *http.Client
+	rest *restclient.Client
+
+	allowDelete bool
 }
 
 // New creates an Emby API client.
 func New(baseURL, apiKey string) *Client {
 	return &Client{
-		baseURL:    strings.TrimRight(baseURL, "/"),
-		apiKey:     apiKey,
-		httpClient: &http.Client{Timeout: defaultTimeout},
+		rest: restclient.New("emby", baseURL, func(req *http.Request) {
+			req.Header.Set("X-Emby-Token", apiKey)
+		}),
 	}
 }
 
-// TestConnection verifies connectivity by fetching system info.
+// TestConnection verifies connectivity by fetching system info. It makes a
+// single attempt, since health checks schedule their own retries.
 func (c *Client) TestConnection(ctx context.Context) (*SystemInfo, error) {
 	var info SystemInfo
-	if err := c.get(ctx, "/System/Info/Public", nil, &info); err != nil {
+	if err := c.rest.Once(ctx, http.MethodGet, "/System/Info/Public", nil, &info); err != nil {
 		return nil, fmt.Errorf("emby connection test failed: %w", err)
 	}
 	return &info, nil
@@ -41,7 +51,7 @@ func (c *Client) TestConnection(ctx context.Context) (*SystemInfo, error) {
 // GetUsers returns all users (requires admin API key).
 func (c *Client) GetUsers(ctx context.Context) ([]*User, error) {
 	var users []*User
-	if err := c.get(ctx, "/Users", nil, &users); err != nil {
+	if err := c.rest.Get(ctx, "/Users", nil, &users); err != nil {
 		return nil, fmt.Errorf("getting users: %w", err)
 	}
 	return users, nil
@@ -50,12 +60,21 @@ func (c *Client) GetUsers(ctx context.Context) ([]*User, error) {
 // GetLibraries returns all media libraries (folders).
 func (c *Client) GetLibraries(ctx context.Context) ([]Library, error) {
 	var resp MediaFoldersResponse
-	if err := c.get(ctx, "/Library/MediaFolders", nil, &resp); err != nil {
+	if err := c.rest.Get(ctx, "/Library/MediaFolders", nil, &resp); err != nil {
 		return nil, fmt.Errorf("getting libraries: %w", err)
 	}
 	return resp.Items, nil
 }
 
+// GetVirtualFolders returns every library with the folders on disk it reads.
+func (c *Client) GetVirtualFolders(ctx context.Context) ([]*VirtualFolder, error) {
+	var folders []*VirtualFolder
+	if err := c.rest.Get(ctx, "/Library/VirtualFolders", nil, &folders); err != nil {
+		return nil, fmt.Errorf("getting library folders: %w", err)
+	}
+	return folders, nil
+}
+
 // GetUserItems returns items for a specific user with optional query parameters.
 func (c *Client) GetUserItems(ctx context.Context, userID string, params *ItemQuery) (*ItemsResult, error) {
 	qp := make(map[string]string)
@@ -90,46 +109,169 @@ func (c *Client) GetUserItems(ctx context.Context, userID string, params *ItemQu
 	}
 
 	var result ItemsResult
-	if err := c.get(ctx, "/Users/"+userID+"/Items", qp, &result); err != nil {
+	if err := c.rest.Get(ctx, "/Users/"+userID+"/Items", qp, &result); err != nil {
 		return nil, fmt.Errorf("getting user items: %w", err)
 	}
 	return &result, nil
 }
 
-// get performs a GET request with the Emby API key header and decodes the JSON response.
-func (c *Client) get(ctx context.Context, path string, queryParams map[string]string, result any) error {
-	url := c.baseURL + path
+// GetItems returns the items with the given IDs, with their paths, media
+// sources, and provider IDs. IDs Emby does not have are left out.
+func (c *Client) GetItems(ctx context.Context, ids []string) ([]*Item, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var result ItemsResult
+	query := map[string]string{"Ids": strings.Join(ids, ","), "Fields": "Path,MediaSources,ProviderIds"}
+	if err := c.rest.Get(ctx, "/Items", query, &result); err != nil {
+		return nil, fmt.Errorf("getting items: %w", err)
+	}
+	return result.Items, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+// GetAncestors returns the folders containing an item, nearest first, with
+// their provider IDs. The library the item belongs to is among them, as is
+// the series an episode belongs to.
+func (c *Client) GetAncestors(ctx context.Context, itemID string) ([]*Item, error) {
+	var ancestors []*Item
+	query := map[string]string{"Fields": "ProviderIds"}
+	if err := c.rest.Get(ctx, "/Items/"+itemID+"/Ancestors", query, &ancestors); err != nil {
+		return nil, fmt.Errorf("getting item ancestors: %w", err)
 	}
+	return ancestors, nil
+}
 
-	req.Header.Set("X-Emby-Token", c.apiKey)
-	req.Header.Set("Accept", "application/json")
+// GetSessions returns the clients connected to the server, including what
+// each is playing.
+func (c *Client) GetSessions(ctx context.Context) ([]*Session, error) {
+	var sessions []*Session
+	if err := c.rest.Get(ctx, "/Sessions", nil, &sessions); err != nil {
+		return nil, fmt.Errorf("getting sessions: %w", err)
+	}
+	return sessions, nil
+}
 
-	if len(queryParams) > 0 {
-		q := req.URL.Query()
-		for k, v := range queryParams {
-			q.Set(k, v)
-		}
-		req.URL.RawQuery = q.Encode()
+// MarkPlayed marks an item played for a user and returns the user's updated
+// play state for it.
+func (c *Client) MarkPlayed(ctx context.Context, userID, itemID string) (*UserData, error) {
+	var data UserData
+	if err := c.rest.Do(ctx, http.MethodPost, "/Users/"+userID+"/PlayedItems/"+itemID, nil, &data); err != nil {
+		return nil, fmt.Errorf("marking item played: %w", err)
 	}
+	return &data, nil
+}
+
+// MarkUnplayed clears an item's played state for a user and returns the
+// user's updated play state for it.
+func (c *Client) MarkUnplayed(ctx context.Context, userID, itemID string) (*UserData, error) {
+	var data UserData
+	if err := c.rest.Do(ctx, http.MethodDelete, "/Users/"+userID+"/PlayedItems/"+itemID, nil, &data); err != nil {
+		return nil, fmt.Errorf("marking item unplayed: %w", err)
+	}
+	return &data, nil
+}
 
-	resp, err := c.httpClient.Do(req) //nolint:gosec // URL is constructed from admin-configured baseURL, not user input
+// SetFavorite adds an item to or removes it from a user's favorites and
+// returns the user's updated data for it.
+func (c *Client) SetFavorite(ctx context.Context, userID, itemID string, favorite bool) (*UserData, error) {
+	method := http.MethodPost
+	if !favorite {
+		method = http.MethodDelete
+	}
+	var data UserData
+	if err := c.rest.Do(ctx, method, "/Users/"+userID+"/FavoriteItems/"+itemID, nil, &data); err != nil {
+		return nil, fmt.Errorf("setting favorite: %w", err)
+	}
+	return &data, nil
+}
+
+// RefreshLibrary asks Emby to rescan a library for added and removed files.
+// An empty libraryID scans every library.
+func (c *Client) RefreshLibrary(ctx context.Context, libraryID string) error {
+	path, query := "/Library/Refresh", map[string]string(nil)
+	if libraryID != "" {
+		path, query = "/Items/"+libraryID+"/Refresh", map[string]string{"Recursive": "true"}
+	}
+	if err := c.rest.Do(ctx, http.MethodPost, path, query, nil); err != nil {
+		return fmt.Errorf("refreshing library: %w", err)
+	}
+	return nil
+}
+
+// AllowItemDeletion lets DeleteItem delete items. It is only called for
+// connections that opted in to direct deletion.
+func (c *Client) AllowItemDeletion() {
+	c.allowDelete = true
+}
+
+// DeleteItem deletes an item and its files from Emby. It returns
+// ErrDeletionNotAllowed unless AllowItemDeletion was called. An item that is
+// already gone, possibly removed by an earlier attempt that timed out,
+// yields an error matching ErrNotFound.
+func (c *Client) DeleteItem(ctx context.Context, itemID string) error {
+	if !c.allowDelete {
+		return ErrDeletionNotAllowed
+	}
+	if err := c.rest.Do(ctx, http.MethodDelete, "/Items/"+itemID, nil, nil); err != nil {
+		return fmt.Errorf("deleting item: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateByName signs in to Emby as a user and returns that user with
+// their policy. The access token Emby issues is revoked straight away, since
+// media-reaper keeps its own session.
+func (c *Client) AuthenticateByName(ctx context.Context, username, password string) (*User, error) {
+	body, err := json.Marshal(map[string]string{"Username": username, "Pw": password})
+	if err != nil {
+		return nil, fmt.Errorf("encoding credentials: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.rest.BaseURL()+"/Users/AuthenticateByName", bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("executing request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("X-Emby-Authorization", clientAuthorization)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.rest.HTTPClient.Do(req) //nolint:gosec // URL is constructed from admin-configured baseURL, not user input
+	if err != nil {
+		return nil, fmt.Errorf("executing request: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrInvalidCredentials
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+		return nil, restclient.NewStatusError("emby", resp)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
-		return fmt.Errorf("decoding response: %w", err)
+	var result AuthenticationResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	if result.User == nil || result.User.ID == "" {
+		return nil, errors.New("emby returned no user")
 	}
 
-	return nil
+	if result.AccessToken != "" {
+		c.logout(ctx, result.AccessToken)
+	}
+	return result.User, nil
+}
+
+// logout revokes a user access token. Failures are ignored; the token is
+// simply left to expire on the Emby side.
+func (c *Client) logout(ctx context.Context, token string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.rest.BaseURL()+"/Sessions/Logout", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Emby-Token", token)
+	resp, err := c.rest.HTTPClient.Do(req) //nolint:gosec // URL is constructed from admin-configured baseURL, not user input
+	if err == nil {
+		_ = resp.Body.Close()
+	}
 }
@@ -3,9 +3,15 @@ package emby
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver/restclient"
 )
 
 func TestTestConnection(t *testing.T) {
@@ -98,6 +104,24 @@ func TestGetLibraries(t *testing.T) {
 	}
 }
 
+func TestGetVirtualFolders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Library/VirtualFolders" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`[{"Name":"Movies","ItemId":"lib1","Locations":["/mnt/media/movies","/mnt/archive/movies"]}]`))
+	}))
+	defer server.Close()
+
+	folders, err := New(server.URL, "test-key").GetVirtualFolders(context.Background())
+	if err != nil {
+		t.Fatalf("GetVirtualFolders failed: %v", err)
+	}
+	if len(folders) != 1 || folders[0].ItemID != "lib1" || len(folders[0].Locations) != 2 {
+		t.Errorf("unexpected folders: %+v", folders)
+	}
+}
+
 func TestGetUserItems(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/Users/user1/Items" {
@@ -139,6 +163,56 @@ func TestGetUserItems(t *testing.T) {
 	}
 }
 
+func TestAuthenticateByName(t *testing.T) {
+	loggedOut := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Users/AuthenticateByName":
+			if r.Header.Get("X-Emby-Token") != "" {
+				t.Error("user sign-in must not send the API key")
+			}
+			if r.Header.Get("X-Emby-Authorization") == "" {
+				t.Error("missing X-Emby-Authorization header")
+			}
+			var creds map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&creds)
+			if creds["Username"] != "alice" || creds["Pw"] != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(AuthenticationResult{
+				User:        &User{ID: "emby-alice", Name: "alice", Policy: &UserPolicy{IsAdministrator: true}},
+				AccessToken: "user-token",
+			})
+		case "/Sessions/Logout":
+			if r.Header.Get("X-Emby-Token") != "user-token" {
+				t.Errorf("logout sent wrong token %q", r.Header.Get("X-Emby-Token"))
+			}
+			loggedOut = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "")
+	user, err := client.AuthenticateByName(context.Background(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("AuthenticateByName failed: %v", err)
+	}
+	if user.ID != "emby-alice" || user.Policy == nil || !user.Policy.IsAdministrator {
+		t.Errorf("unexpected user: %+v", user)
+	}
+	if !loggedOut {
+		t.Error("expected the Emby access token to be revoked")
+	}
+
+	if _, err := client.AuthenticateByName(context.Background(), "alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected ErrInvalidCredentials, got %v", err)
+	}
+}
+
 func TestConnectionFailure(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -168,3 +242,247 @@ func TestTrailingSlashTrimmed(t *testing.T) {
 		t.Fatalf("TestConnection with trailing slash failed: %v", err)
 	}
 }
+
+func TestMusicProviderIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"Items":[{"Id":"a1","Name":"OK Computer","Type":"MusicAlbum","ProviderIds":{` +
+			`"MusicBrainzAlbumArtist":"a74b1b7f-71a5-4011-9441-d0b5e4122711",` +
+			`"MusicBrainzReleaseGroup":"b1392450-e666-3926-a536-22c65f834433",` +
+			`"MusicBrainzAlbum":"0b6b4ba0-d36f-47bd-b4ea-6a5b91842d29"}}],"TotalRecordCount":1}`))
+	}))
+	defer server.Close()
+
+	result, err := New(server.URL, "test-key").GetUserItems(context.Background(), "user1", &ItemQuery{IncludeTypes: "MusicAlbum"})
+	if err != nil {
+		t.Fatalf("GetUserItems failed: %v", err)
+	}
+	ids := result.Items[0].ProviderIDs
+	if ids.MusicBrainzReleaseGroup != "b1392450-e666-3926-a536-22c65f834433" || ids.MusicBrainzAlbumArtist != "a74b1b7f-71a5-4011-9441-d0b5e4122711" {
+		t.Errorf("unexpected provider IDs: %+v", ids)
+	}
+}
+
+// newTestClient returns a client for server that retries without waiting.
+func newTestClient(server *httptest.Server) *Client {
+	client := New(server.URL, "test-key")
+	client.rest.RetryDelay = time.Millisecond
+	return client
+}
+
+func TestRetries(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		switch attempts.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			// Drop the connection without a response.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		default:
+			_ = json.NewEncoder(w).Encode(MediaFoldersResponse{Items: []Library{{ID: "lib1"}}})
+		}
+	}))
+	defer server.Close()
+
+	libs, err := newTestClient(server).GetLibraries(context.Background())
+	if err != nil {
+		t.Fatalf("GetLibraries failed: %v", err)
+	}
+	if len(libs) != 1 || attempts.Load() != 4 {
+		t.Errorf("expected success on attempt 4, got %v after %d", libs, attempts.Load())
+	}
+
+	// Connection tests are not retried.
+	attempts.Store(0)
+	if _, err := newTestClient(server).TestConnection(context.Background()); !errors.Is(err, ErrServerError) || attempts.Load() != 1 {
+		t.Errorf("expected one failed attempt, got %v after %d", err, attempts.Load())
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	tests := []struct {
+		status       int
+		want         error
+		wantAttempts int32
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized, 1},
+		{http.StatusForbidden, ErrUnauthorized, 1},
+		{http.StatusNotFound, ErrNotFound, 1},
+		{http.StatusInternalServerError, ErrServerError, restclient.MaxAttempts},
+		{http.StatusTooManyRequests, ErrRateLimited, restclient.MaxAttempts},
+	}
+	for _, tt := range tests {
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			attempts.Add(1)
+			http.Error(w, "nope", tt.status)
+		}))
+
+		_, err := newTestClient(server).GetUsers(context.Background())
+		server.Close()
+
+		if !errors.Is(err, tt.want) {
+			t.Errorf("status %d: expected %v, got %v", tt.status, tt.want, err)
+		}
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status || statusErr.Body != "nope" {
+			t.Errorf("status %d: expected a StatusError, got %v", tt.status, err)
+		}
+		if attempts.Load() != tt.wantAttempts {
+			t.Errorf("status %d: expected %d attempts, got %d", tt.status, tt.wantAttempts, attempts.Load())
+		}
+	}
+}
+
+func TestWriteOperations(t *testing.T) {
+	type call struct{ method, path string }
+	var calls []call
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Emby-Token") != "test-key" {
+			t.Errorf("missing or wrong X-Emby-Token header: %s", r.Header.Get("X-Emby-Token"))
+		}
+		calls = append(calls, call{r.Method, r.URL.RequestURI()})
+		switch {
+		case strings.Contains(r.URL.Path, "/PlayedItems/"):
+			_ = json.NewEncoder(w).Encode(UserData{Played: r.Method == http.MethodPost, PlayCount: 1})
+		case strings.Contains(r.URL.Path, "/FavoriteItems/"):
+			_ = json.NewEncoder(w).Encode(UserData{IsFavorite: r.Method == http.MethodPost})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := newTestClient(server)
+
+	if data, err := client.MarkPlayed(ctx, "u1", "i1"); err != nil || !data.Played {
+		t.Errorf("MarkPlayed: %+v, %v", data, err)
+	}
+	if data, err := client.MarkUnplayed(ctx, "u1", "i1"); err != nil || data.Played {
+		t.Errorf("MarkUnplayed: %+v, %v", data, err)
+	}
+	if data, err := client.SetFavorite(ctx, "u1", "i1", true); err != nil || !data.IsFavorite {
+		t.Errorf("SetFavorite: %+v, %v", data, err)
+	}
+	if data, err := client.SetFavorite(ctx, "u1", "i1", false); err != nil || data.IsFavorite {
+		t.Errorf("SetFavorite: %+v, %v", data, err)
+	}
+	if err := client.RefreshLibrary(ctx, "lib1"); err != nil {
+		t.Errorf("RefreshLibrary: %v", err)
+	}
+	if err := client.RefreshLibrary(ctx, ""); err != nil {
+		t.Errorf("RefreshLibrary: %v", err)
+	}
+	if err := client.DeleteItem(ctx, "i1"); !errors.Is(err, ErrDeletionNotAllowed) {
+		t.Errorf("expected ErrDeletionNotAllowed, got %v", err)
+	}
+	client.AllowItemDeletion()
+	if err := client.DeleteItem(ctx, "i1"); err != nil {
+		t.Errorf("DeleteItem: %v", err)
+	}
+
+	want := []call{
+		{http.MethodPost, "/Users/u1/PlayedItems/i1"},
+		{http.MethodDelete, "/Users/u1/PlayedItems/i1"},
+		{http.MethodPost, "/Users/u1/FavoriteItems/i1"},
+		{http.MethodDelete, "/Users/u1/FavoriteItems/i1"},
+		{http.MethodPost, "/Items/lib1/Refresh?Recursive=true"},
+		{http.MethodPost, "/Library/Refresh"},
+		{http.MethodDelete, "/Items/i1"},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("expected %d requests, got %v", len(want), calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("request %d: expected %v, got %v", i, want[i], calls[i])
+		}
+	}
+}
+
+func TestGetItems(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Items":
+			if got := r.URL.Query().Get("Ids"); got != "a,b" {
+				t.Errorf("Ids = %q, want a,b", got)
+			}
+			if got := r.URL.Query().Get("Fields"); !strings.Contains(got, "MediaSources") {
+				t.Errorf("Fields = %q, want MediaSources included", got)
+			}
+			_, _ = w.Write([]byte(`{"Items":[{"Id":"a","Type":"Movie","Path":"/m/a.mkv",
+				"MediaSources":[{"Id":"s1","Path":"/m/a.mkv","Size":1234}]}],"TotalRecordCount":1}`))
+		case "/Items/a/Ancestors":
+			_, _ = w.Write([]byte(`[{"Id":"series","Type":"Series","ProviderIds":{"Tvdb":"42"}},
+				{"Id":"lib","Type":"CollectionFolder"}]`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := newTestClient(server)
+
+	items, err := client.GetItems(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("GetItems: %v", err)
+	}
+	if len(items) != 1 || len(items[0].MediaSources) != 1 || items[0].MediaSources[0].Size != 1234 {
+		t.Errorf("items = %+v", items)
+	}
+	if items, err := client.GetItems(ctx, nil); err != nil || items != nil {
+		t.Errorf("GetItems(nil) = %v, %v; want no request", items, err)
+	}
+
+	ancestors, err := client.GetAncestors(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetAncestors: %v", err)
+	}
+	if len(ancestors) != 2 || ancestors[0].ProviderIDs.TVDB != "42" || ancestors[1].ID != "lib" {
+		t.Errorf("ancestors = %+v", ancestors)
+	}
+}
+
+func TestGetSessions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Sessions" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`[
+			{"Id":"a","UserName":"dana","Client":"Emby Web"},
+			{"Id":"b","UserName":"lee","DeviceName":"Living Room",
+			 "NowPlayingItem":{"Id":"ep1","Name":"Pilot","Type":"Episode","SeriesId":"ser1","RunTimeTicks":100},
+			 "PlayState":{"PositionTicks":40,"IsPaused":true}}
+		]`))
+	}))
+	defer server.Close()
+
+	sessions, err := newTestClient(server).GetSessions(context.Background())
+	if err != nil {
+		t.Fatalf("GetSessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].NowPlayingItem != nil || !sessions[1].PlayState.IsPaused {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+
+	for _, tc := range []struct {
+		item, series string
+		want         bool
+	}{
+		{"ep1", "", true},
+		{"ep2", "ser1", true},
+		{"ser1", "", true},
+		{"ep2", "ser2", false},
+		{"", "", false},
+	} {
+		if got := Playing(sessions, tc.item, tc.series); got != tc.want {
+			t.Errorf("Playing(%q, %q) = %v, want %v", tc.item, tc.series, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package emby
+
+import (
+	"errors"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver/restclient"
+)
+
+var (
+	// ErrInvalidCredentials is returned when Emby rejects a username and password.
+	ErrInvalidCredentials = errors.New("invalid emby credentials")
+	// ErrDeletionNotAllowed is returned by DeleteItem on clients for
+	// connections that have not opted in to direct deletion.
+	ErrDeletionNotAllowed = errors.New("direct deletion is not enabled for this emby connection")
+
+	// Errors matched by a *StatusError; see restclient.
+	ErrUnauthorized = restclient.ErrUnauthorized
+	ErrNotFound     = restclient.ErrNotFound
+	ErrServerError  = restclient.ErrServerError
+	ErrRateLimited  = restclient.ErrRateLimited
+)
+
+// StatusError is restclient.StatusError, re-exported for callers of this package.
+type StatusError = restclient.StatusError
@@ -1,31 +1,25 @@
 package emby
 
-// SystemInfo represents Emby server system information.
-type SystemInfo struct {
-	ServerName string `json:"ServerName"`
-	Version    string `json:"Version"`
-	ID         string `json:"Id"`
-}
-
-// User represents an Emby user.
-type User struct {
-	ID     string      `json:"Id"`
-	Name   string      `json:"Name"`
-	Policy *UserPolicy `json:"Policy,omitempty"`
-}
+import "github.com/sydlexius/media-reaper/internal/mediaserver"
 
-// UserPolicy represents an Emby user's access policy.
-type UserPolicy struct {
-	IsAdministrator  bool     `json:"IsAdministrator"`
-	EnableAllFolders bool     `json:"EnableAllFolders"`
-	EnabledFolders   []string `json:"EnabledFolders"`
-}
+// The types Emby shares with other media servers live in mediaserver.
+type (
+	SystemInfo  = mediaserver.SystemInfo
+	User        = mediaserver.User
+	UserPolicy  = mediaserver.UserPolicy
+	Library     = mediaserver.Library
+	ItemQuery   = mediaserver.ItemQuery
+	ItemsResult = mediaserver.ItemsResult
+	Item        = mediaserver.Item
+	Providers   = mediaserver.Providers
+	UserData    = mediaserver.UserData
+	MediaSource = mediaserver.MediaSource
+)
 
-// Library represents an Emby media library (folder).
-type Library struct {
-	ID             string `json:"Id"`
-	Name           string `json:"Name"`
-	CollectionType string `json:"CollectionType"`
+// AuthenticationResult is the response to a username and password sign-in.
+type AuthenticationResult struct {
+	User        *User  `json:"User"`
+	AccessToken string `json:"AccessToken"`
 }
 
 // MediaFoldersResponse wraps the response from GET /Library/MediaFolders.
@@ -33,51 +27,63 @@ type MediaFoldersResponse struct {
 	Items []Library `json:"Items"`
 }
 
-// ItemQuery specifies query parameters for fetching user items.
-type ItemQuery struct {
-	ParentID     string
-	IncludeTypes string
-	Recursive    bool
-	Limit        int
-	StartIndex   int
-	SortBy       string
-	SortOrder    string
-	IsPlayed     *bool
-	Fields       string
+// VirtualFolder is a library as configured, from GET /Library/VirtualFolders.
+// Locations are the folders on disk it reads, as Emby sees them.
+type VirtualFolder struct {
+	ItemID    string   `json:"ItemId"`
+	Name      string   `json:"Name"`
+	Locations []string `json:"Locations"`
 }
 
-// ItemsResult wraps a paginated list of items.
-type ItemsResult struct {
-	Items            []*Item `json:"Items"`
-	TotalRecordCount int     `json:"TotalRecordCount"`
+// Session is a client connected to Emby, from GET /Sessions.
+// NowPlayingItem is nil unless something is playing or paused.
+type Session struct {
+	ID               string          `json:"Id"`
+	UserID           string          `json:"UserId,omitempty"`
+	UserName         string          `json:"UserName,omitempty"`
+	Client           string          `json:"Client,omitempty"`
+	DeviceID         string          `json:"DeviceId,omitempty"`
+	DeviceName       string          `json:"DeviceName,omitempty"`
+	LastActivityDate string          `json:"LastActivityDate,omitempty"`
+	NowPlayingItem   *NowPlayingItem `json:"NowPlayingItem,omitempty"`
+	PlayState        *PlayState      `json:"PlayState,omitempty"`
 }
 
-// Item represents an Emby media item.
-type Item struct {
-	ID                string    `json:"Id"`
-	Name              string    `json:"Name"`
-	Type              string    `json:"Type"`
-	SeriesName        string    `json:"SeriesName,omitempty"`
-	SeasonName        string    `json:"SeasonName,omitempty"`
-	IndexNumber       *int      `json:"IndexNumber,omitempty"`
-	ParentIndexNumber *int      `json:"ParentIndexNumber,omitempty"`
-	Path              string    `json:"Path,omitempty"`
-	ProviderIDs       Providers `json:"ProviderIds,omitempty"`
-	UserData          *UserData `json:"UserData,omitempty"`
+// NowPlayingItem is the item a session is playing.
+type NowPlayingItem struct {
+	ID                string `json:"Id"`
+	Name              string `json:"Name"`
+	Type              string `json:"Type"`
+	SeriesID          string `json:"SeriesId,omitempty"`
+	SeriesName        string `json:"SeriesName,omitempty"`
+	ParentIndexNumber *int   `json:"ParentIndexNumber,omitempty"`
+	IndexNumber       *int   `json:"IndexNumber,omitempty"`
+	RunTimeTicks      int64  `json:"RunTimeTicks,omitempty"`
 }
 
-// Providers holds external IDs for an item.
-type Providers struct {
-	TMDB string `json:"Tmdb,omitempty"`
-	TVDB string `json:"Tvdb,omitempty"`
-	IMDB string `json:"Imdb,omitempty"`
+// PlayState is where a session is in its item. Positions are in ticks of
+// 100 nanoseconds.
+type PlayState struct {
+	PositionTicks int64  `json:"PositionTicks,omitempty"`
+	IsPaused      bool   `json:"IsPaused"`
+	PlayMethod    string `json:"PlayMethod,omitempty"`
 }
 
-// UserData holds per-user play state for an item.
-type UserData struct {
-	PlaybackPositionTicks int64  `json:"PlaybackPositionTicks"`
-	PlayCount             int    `json:"PlayCount"`
-	IsFavorite            bool   `json:"IsFavorite"`
-	Played                bool   `json:"Played"`
-	LastPlayedDate        string `json:"LastPlayedDate,omitempty"`
+// Playing reports whether any session is playing or has paused the item
+// with the given ID, or an episode of the series with the given ID. Either
+// ID may be empty.
+func Playing(sessions []*Session, itemID, seriesID string) bool {
+	for _, s := range sessions {
+		np := s.NowPlayingItem
+		if np == nil {
+			continue
+		}
+		if itemID != "" && (np.ID == itemID || np.SeriesID == itemID) {
+			return true
+		}
+		if seriesID != "" && (np.SeriesID == seriesID || np.ID == seriesID) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,78 @@
+// Package events is a small in-process publish/subscribe bus that lets
+// subsystems react to things happening elsewhere without importing each other.
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Type identifies a kind of internal event.
+type Type string
+
+const (
+	// ConnectionStateChanged carries a connection.StateChange payload.
+	ConnectionStateChanged Type = "connection.state_changed"
+	// DeletionRecorded carries a *repository.DeletionRecord payload.
+	DeletionRecorded Type = "deletion.recorded"
+	// ItemFlagged carries a directdelete.Flagged payload.
+	ItemFlagged Type = "item.flagged"
+	// GraceExpiring carries a directdelete.Flagged payload.
+	GraceExpiring Type = "grace.expiring"
+)
+
+// Event is a typed payload published on the bus.
+type Event struct {
+	Type    Type
+	Payload any
+}
+
+// Handler reacts to a published event.
+type Handler func(ctx context.Context, event Event)
+
+// Publisher is the side of the bus that producers depend on.
+type Publisher interface {
+	Publish(ctx context.Context, event Event)
+}
+
+// Bus delivers events synchronously to every handler subscribed to their type.
+// Publish runs inside the producer, so handlers that do slow work, such as
+// sending notifications, must hand it off rather than block.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[Type][]Handler
+}
+
+// NewBus creates an empty bus.
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[Type][]Handler)}
+}
+
+// Subscribe registers a handler for an event type.
+func (b *Bus) Subscribe(t Type, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[t] = append(b.handlers[t], h)
+}
+
+// Publish calls each subscribed handler in registration order. A panicking
+// handler is logged and does not prevent the others from running.
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	b.mu.RLock()
+	handlers := append([]Handler(nil), b.handlers[event.Type]...)
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		b.dispatch(ctx, h, event)
+	}
+}
+
+func (b *Bus) dispatch(ctx context.Context, h Handler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Events: handler for %s panicked: %v", event.Type, r)
+		}
+	}()
+	h(ctx, event)
+}
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPublishDeliversToSubscribers(t *testing.T) {
+	bus := NewBus()
+	var got []string
+
+	bus.Subscribe(ConnectionStateChanged, func(_ context.Context, e Event) {
+		got = append(got, "first:"+e.Payload.(string))
+	})
+	bus.Subscribe(ConnectionStateChanged, func(_ context.Context, e Event) {
+		got = append(got, "second:"+e.Payload.(string))
+	})
+	bus.Subscribe(DeletionRecorded, func(_ context.Context, _ Event) {
+		got = append(got, "wrong type")
+	})
+
+	bus.Publish(context.Background(), Event{Type: ConnectionStateChanged, Payload: "x"})
+
+	if len(got) != 2 || got[0] != "first:x" || got[1] != "second:x" {
+		t.Errorf("unexpected deliveries: %v", got)
+	}
+}
+
+func TestPublishSurvivesPanickingHandler(t *testing.T) {
+	bus := NewBus()
+	called := false
+
+	bus.Subscribe(DeletionRecorded, func(context.Context, Event) { panic("boom") })
+	bus.Subscribe(DeletionRecorded, func(context.Context, Event) { called = true })
+
+	bus.Publish(context.Background(), Event{Type: DeletionRecorded})
+
+	if !called {
+		t.Error("expected handler after panicking handler to run")
+	}
+}
@@ -0,0 +1,246 @@
+package history
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type recordResponse struct {
+	ID                   string   `json:"id"`
+	ConnectionID         string   `json:"connectionId"`
+	ConnectionName       string   `json:"connectionName"`
+	ConnectionType       string   `json:"connectionType"`
+	MediaType            string   `json:"mediaType"`
+	Title                string   `json:"title"`
+	Year                 int      `json:"year,omitempty"`
+	SeasonNumber         *int     `json:"seasonNumber,omitempty"`
+	EpisodeNumber        *int     `json:"episodeNumber,omitempty"`
+	ArrID                int64    `json:"arrId,omitempty"`
+	TMDBID               int64    `json:"tmdbId,omitempty"`
+	TVDBID               int64    `json:"tvdbId,omitempty"`
+	IMDBID               string   `json:"imdbId,omitempty"`
+	SizeBytes            int64    `json:"sizeBytes"`
+	FilePath             string   `json:"filePath,omitempty"`
+	Quality              string   `json:"quality,omitempty"`
+	QualityProfileID     int64    `json:"qualityProfileId,omitempty"`
+	RootFolderPath       string   `json:"rootFolderPath,omitempty"`
+	RuleName             string   `json:"ruleName,omitempty"`
+	WatchedBy            []string `json:"watchedBy"`
+	ApprovedBy           string   `json:"approvedBy,omitempty"`
+	ImportExclusionAdded bool     `json:"importExclusionAdded"`
+	DeletedAt            string   `json:"deletedAt"`
+	RestoredAt           string   `json:"restoredAt,omitempty"`
+	RestoredBy           string   `json:"restoredBy,omitempty"`
+}
+
+type restoreRequest struct {
+	Search bool `json:"search"`
+}
+
+type restoreResponse struct {
+	Record            recordResponse `json:"record"`
+	ArrID             int64          `json:"arrId"`
+	AlreadyExisted    bool           `json:"alreadyExisted"`
+	ExclusionRemoved  bool           `json:"exclusionRemoved"`
+	ExclusionBlocking bool           `json:"exclusionBlocking"`
+}
+
+type listResponse struct {
+	Items []recordResponse `json:"items"`
+	Total int              `json:"total"`
+}
+
+func toResponse(rec *repository.DeletionRecord) recordResponse {
+	watchedBy := rec.WatchedBy
+	if watchedBy == nil {
+		watchedBy = []string{}
+	}
+	resp := recordResponse{
+		ID:                   rec.ID,
+		ConnectionID:         rec.ConnectionID,
+		ConnectionName:       rec.ConnectionName,
+		ConnectionType:       string(rec.ConnectionType),
+		MediaType:            string(rec.MediaType),
+		Title:                rec.Title,
+		Year:                 rec.Year,
+		SeasonNumber:         rec.SeasonNumber,
+		EpisodeNumber:        rec.EpisodeNumber,
+		ArrID:                rec.ArrID,
+		TMDBID:               rec.TMDBID,
+		TVDBID:               rec.TVDBID,
+		IMDBID:               rec.IMDBID,
+		SizeBytes:            rec.SizeBytes,
+		FilePath:             rec.FilePath,
+		Quality:              rec.Quality,
+		QualityProfileID:     rec.QualityProfileID,
+		RootFolderPath:       rec.RootFolderPath,
+		RuleName:             rec.RuleName,
+		WatchedBy:            watchedBy,
+		ApprovedBy:           rec.ApprovedBy,
+		ImportExclusionAdded: rec.ImportExclusionAdded,
+		DeletedAt:            rec.DeletedAt,
+		RestoredBy:           rec.RestoredBy,
+	}
+	if rec.RestoredAt != nil {
+		resp.RestoredAt = *rec.RestoredAt
+	}
+	return resp
+}
+
+// ListHandler searches the deletion history.
+// @Summary List deletion history
+// @Description Search executed deletions, newest first
+// @Tags history
+// @Produce json
+// @Param q query string false "Match against title, file path, or IMDB ID"
+// @Param mediaType query string false "Filter by media type (movie, series, episode)"
+// @Param connectionId query string false "Filter by originating connection"
+// @Param since query string false "Only deletions at or after this RFC3339 time or YYYY-MM-DD date (UTC)"
+// @Param until query string false "Only deletions at or before this RFC3339 time, or on or before this YYYY-MM-DD date (UTC)"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Page offset"
+// @Success 200 {object} listResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /history [get]
+func (s *Service) ListHandler(c echo.Context) error {
+	filter := repository.HistoryFilter{
+		Query:        c.QueryParam("q"),
+		MediaType:    repository.MediaType(c.QueryParam("mediaType")),
+		ConnectionID: c.QueryParam("connectionId"),
+	}
+
+	var err error
+	if filter.Since, err = timeParam(c, "since", false); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "since must be an RFC3339 time or a YYYY-MM-DD date"})
+	}
+	if filter.Until, err = timeParam(c, "until", true); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "until must be an RFC3339 time or a YYYY-MM-DD date"})
+	}
+	if filter.Limit, err = intParam(c, "limit"); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be an integer"})
+	}
+	if filter.Offset, err = intParam(c, "offset"); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "offset must be an integer"})
+	}
+
+	records, total, err := s.List(c.Request().Context(), filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list history"})
+	}
+
+	items := make([]recordResponse, 0, len(records))
+	for _, rec := range records {
+		items = append(items, toResponse(rec))
+	}
+
+	return c.JSON(http.StatusOK, listResponse{Items: items, Total: total})
+}
+
+// GetHandler returns a single deletion record.
+// @Summary Get deletion record
+// @Description Get a deletion history record by ID
+// @Tags history
+// @Produce json
+// @Param id path string true "Record ID"
+// @Success 200 {object} recordResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /history/{id} [get]
+func (s *Service) GetHandler(c echo.Context) error {
+	rec, err := s.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get history record"})
+	}
+	if rec == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "history record not found"})
+	}
+
+	return c.JSON(http.StatusOK, toResponse(rec))
+}
+
+// RestoreHandler re-adds a deleted title to its original *arr connection.
+// @Summary Restore deleted title
+// @Description Re-add a deleted movie or series to the original Sonarr/Radarr connection using the recorded provider ID, quality profile, and root folder, and optionally trigger a search. An import exclusion for the title is removed only if the deletion added it; any other is reported as exclusionBlocking. A title that is already back is marked restored with alreadyExisted set.
+// @Tags history
+// @Accept json
+// @Produce json
+// @Param id path string true "Record ID"
+// @Param request body restoreRequest false "Restore options"
+// @Success 200 {object} restoreResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /history/{id}/restore [post]
+func (s *Service) RestoreHandler(c echo.Context) error {
+	var req restoreRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	restoredBy := ""
+	if user, ok := c.Get("user").(*repository.User); ok {
+		restoredBy = user.Username
+	}
+
+	rec, result, err := s.Restore(c.Request().Context(), c.Param("id"), restoredBy, req.Search)
+	switch {
+	case errors.Is(err, ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrNotRestorable), errors.Is(err, ErrMissingProviderID):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrAlreadyRestored), errors.Is(err, ErrConnectionMissing),
+		errors.Is(err, ErrConnectionMismatch):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "restore failed: " + err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, restoreResponse{
+		Record:            toResponse(rec),
+		ArrID:             result.ID,
+		AlreadyExisted:    result.AlreadyExisted,
+		ExclusionRemoved:  result.ExclusionRemoved,
+		ExclusionBlocking: result.ExclusionBlocking,
+	})
+}
+
+// timeParam parses an RFC3339 time or a YYYY-MM-DD date and returns it in
+// UTC as stored in deleted_at. A date means the start of that day, or its
+// last second when endOfDay is set.
+func timeParam(c echo.Context, name string, endOfDay bool) (string, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, v); err != nil {
+			return "", err
+		}
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Second)
+		}
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+func intParam(c echo.Context, name string) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
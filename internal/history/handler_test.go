@@ -0,0 +1,219 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	_ "modernc.org/sqlite"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+)
+
+func setupTestService(t *testing.T) *Service {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	schema := `
+	CREATE TABLE deletion_history (
+		id                     TEXT PRIMARY KEY,
+		connection_id          TEXT NOT NULL,
+		connection_name        TEXT NOT NULL,
+		connection_type        TEXT NOT NULL,
+		media_type             TEXT NOT NULL,
+		title                  TEXT NOT NULL,
+		year                   INTEGER NOT NULL DEFAULT 0,
+		season_number          INTEGER,
+		episode_number         INTEGER,
+		arr_id                 INTEGER NOT NULL DEFAULT 0,
+		tmdb_id                INTEGER NOT NULL DEFAULT 0,
+		tvdb_id                INTEGER NOT NULL DEFAULT 0,
+		imdb_id                TEXT NOT NULL DEFAULT '',
+		size_bytes             INTEGER NOT NULL DEFAULT 0,
+		file_path              TEXT NOT NULL DEFAULT '',
+		quality                TEXT NOT NULL DEFAULT '',
+		quality_profile_id     INTEGER NOT NULL DEFAULT 0,
+		root_folder_path       TEXT NOT NULL DEFAULT '',
+		rule_name              TEXT NOT NULL DEFAULT '',
+		watched_by             TEXT NOT NULL DEFAULT '[]',
+		approved_by            TEXT NOT NULL DEFAULT '',
+		import_exclusion_added INTEGER NOT NULL DEFAULT 0,
+		deleted_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		restored_at            TIMESTAMP,
+		restored_by            TEXT NOT NULL DEFAULT ''
+	)`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+
+	return NewService(sqliterepo.NewHistoryRepository(db), &fakeConnections{}, nil)
+}
+
+func newTestContext(method, path string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(method, path, nil)
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+func TestRecordFillsDefaults(t *testing.T) {
+	svc := setupTestService(t)
+
+	rec := &repository.DeletionRecord{
+		ConnectionID:   "conn-1",
+		ConnectionName: "Sonarr",
+		ConnectionType: repository.ConnectionTypeSonarr,
+		MediaType:      repository.MediaTypeSeries,
+		Title:          "Firefly",
+		TVDBID:         78874,
+	}
+	if err := svc.Record(context.Background(), rec); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if rec.ID == "" {
+		t.Error("expected generated ID")
+	}
+	if rec.DeletedAt == "" {
+		t.Error("expected deletedAt to be set")
+	}
+}
+
+func TestRecordRejectsIncomplete(t *testing.T) {
+	svc := setupTestService(t)
+
+	err := svc.Record(context.Background(), &repository.DeletionRecord{ConnectionID: "conn-1"})
+	if err != ErrIncompleteRecord {
+		t.Errorf("expected ErrIncompleteRecord, got %v", err)
+	}
+}
+
+func TestListHandler(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	for _, title := range []string{"Alien", "Aliens", "Heat"} {
+		err := svc.Record(ctx, &repository.DeletionRecord{
+			ConnectionID:   "conn-1",
+			ConnectionName: "Radarr",
+			ConnectionType: repository.ConnectionTypeRadarr,
+			MediaType:      repository.MediaTypeMovie,
+			Title:          title,
+		})
+		if err != nil {
+			t.Fatalf("Record %s: %v", title, err)
+		}
+	}
+
+	c, rec := newTestContext(http.MethodGet, "/api/history?q=alien")
+	if err := svc.ListHandler(c); err != nil {
+		t.Fatalf("ListHandler: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var resp listResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Total != 2 || len(resp.Items) != 2 {
+		t.Errorf("expected 2 matches, got total=%d items=%d", resp.Total, len(resp.Items))
+	}
+	for _, item := range resp.Items {
+		if item.WatchedBy == nil {
+			t.Error("watchedBy should serialize as an empty array, not null")
+		}
+	}
+}
+
+func TestListHandlerBadLimit(t *testing.T) {
+	svc := setupTestService(t)
+
+	c, rec := newTestContext(http.MethodGet, "/api/history?limit=lots")
+	if err := svc.ListHandler(c); err != nil {
+		t.Fatalf("ListHandler: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGetHandlerNotFound(t *testing.T) {
+	svc := setupTestService(t)
+
+	c, rec := newTestContext(http.MethodGet, "/api/history/nonexistent")
+	c.SetParamNames("id")
+	c.SetParamValues("nonexistent")
+
+	if err := svc.GetHandler(c); err != nil {
+		t.Fatalf("GetHandler: %v", err)
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status: got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestListHandlerTimeRange(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	for _, r := range []struct{ title, deletedAt string }{
+		{"Alien", "2025-01-01T23:30:00Z"},
+		{"Aliens", "2025-01-02T12:00:00Z"},
+		{"Heat", "2025-01-03T00:30:00Z"},
+	} {
+		err := svc.Record(ctx, &repository.DeletionRecord{
+			ConnectionID:   "conn-1",
+			ConnectionName: "Radarr",
+			ConnectionType: repository.ConnectionTypeRadarr,
+			MediaType:      repository.MediaTypeMovie,
+			Title:          r.title,
+			DeletedAt:      r.deletedAt,
+		})
+		if err != nil {
+			t.Fatalf("Record %s: %v", r.title, err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		code  int
+		total int
+	}{
+		{"since=2025-01-02&until=2025-01-02", http.StatusOK, 1},
+		{"since=2025-01-01T23:00:00-02:00", http.StatusOK, 2},
+		{"until=2025-01-02T01:00:00-01:00", http.StatusOK, 1},
+		{"since=yesterday", http.StatusBadRequest, 0},
+		{"until=2025-01-02%2012:00:00", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		c, rec := newTestContext(http.MethodGet, "/api/history?"+tt.query)
+		if err := svc.ListHandler(c); err != nil {
+			t.Fatalf("ListHandler %s: %v", tt.query, err)
+		}
+		if rec.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.query, rec.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var resp listResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if resp.Total != tt.total {
+			t.Errorf("%s: total %d, want %d", tt.query, resp.Total, tt.total)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/arrclient"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+var (
+	ErrRecordNotFound     = errors.New("history record not found")
+	ErrAlreadyRestored    = errors.New("record has already been restored")
+	ErrNotRestorable      = errors.New("only movies and series can be restored")
+	ErrConnectionMissing  = errors.New("original connection no longer exists")
+	ErrMissingProviderID  = errors.New("record has no provider id to restore by")
+	ErrConnectionMismatch = errors.New("original connection type does not match media type")
+)
+
+// restorer re-adds a title to an *arr instance. Implemented by
+// arrclient.RadarrClient and arrclient.SonarrClient.
+type restorer interface {
+	Restore(ctx context.Context, req arrclient.RestoreRequest) (*arrclient.RestoreResult, error)
+}
+
+// ConnectionSource looks up saved connections and decrypts their API keys.
+type ConnectionSource interface {
+	GetByID(ctx context.Context, id string) (*repository.Connection, error)
+	DecryptAPIKey(encrypted string) (string, error)
+}
+
+func newArrRestorer(conn *repository.Connection, apiKey string) (restorer, error) {
+	switch conn.Type {
+	case repository.ConnectionTypeRadarr:
+		return arrclient.NewRadarrClient(conn.URL, apiKey), nil
+	case repository.ConnectionTypeSonarr:
+		return arrclient.NewSonarrClient(conn.URL, apiKey), nil
+	default:
+		return nil, ErrConnectionMismatch
+	}
+}
+
+// Restore re-adds a deleted movie or series to its original *arr connection
+// using the recorded provider ID, quality profile, and root folder. If the
+// title is already back, for instance because marking an earlier restore
+// failed, the record is marked restored all the same.
+func (s *Service) Restore(ctx context.Context, id, restoredBy string, search bool) (*repository.DeletionRecord, *arrclient.RestoreResult, error) {
+	rec, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching history record: %w", err)
+	}
+	if rec == nil {
+		return nil, nil, ErrRecordNotFound
+	}
+	if rec.RestoredAt != nil {
+		return nil, nil, ErrAlreadyRestored
+	}
+
+	req := arrclient.RestoreRequest{
+		Title:                rec.Title,
+		Year:                 rec.Year,
+		TMDBID:               rec.TMDBID,
+		TVDBID:               rec.TVDBID,
+		QualityProfileID:     rec.QualityProfileID,
+		RootFolderPath:       rec.RootFolderPath,
+		Search:               search,
+		ImportExclusionAdded: rec.ImportExclusionAdded,
+	}
+
+	var wantType repository.ConnectionType
+	switch rec.MediaType {
+	case repository.MediaTypeMovie:
+		wantType = repository.ConnectionTypeRadarr
+		if rec.TMDBID == 0 {
+			return nil, nil, ErrMissingProviderID
+		}
+	case repository.MediaTypeSeries:
+		wantType = repository.ConnectionTypeSonarr
+		if rec.TVDBID == 0 {
+			return nil, nil, ErrMissingProviderID
+		}
+	default:
+		return nil, nil, ErrNotRestorable
+	}
+
+	conn, err := s.connections.GetByID(ctx, rec.ConnectionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching connection: %w", err)
+	}
+	if conn == nil {
+		return nil, nil, ErrConnectionMissing
+	}
+	if conn.Type != wantType {
+		return nil, nil, ErrConnectionMismatch
+	}
+
+	apiKey, err := s.connections.DecryptAPIKey(conn.EncryptedAPIKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decrypting api key: %w", err)
+	}
+
+	client, err := s.newRestorer(conn, apiKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := client.Restore(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.MarkRestored(ctx, rec.ID, restoredBy, now); err != nil {
+		return nil, nil, fmt.Errorf("marking record restored: %w", err)
+	}
+	rec.RestoredAt = &now
+	rec.RestoredBy = restoredBy
+
+	return rec, result, nil
+}
@@ -0,0 +1,195 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/sydlexius/media-reaper/internal/arrclient"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type fakeConnections struct {
+	conns map[string]*repository.Connection
+}
+
+func (f *fakeConnections) GetByID(_ context.Context, id string) (*repository.Connection, error) {
+	return f.conns[id], nil
+}
+
+func (f *fakeConnections) DecryptAPIKey(encrypted string) (string, error) {
+	return "decrypted-" + encrypted, nil
+}
+
+type fakeRestorer struct {
+	got    *arrclient.RestoreRequest
+	result *arrclient.RestoreResult
+	err    error
+}
+
+func (f *fakeRestorer) Restore(_ context.Context, req arrclient.RestoreRequest) (*arrclient.RestoreResult, error) {
+	f.got = &req
+	return f.result, f.err
+}
+
+func setupRestoreService(t *testing.T, fake *fakeRestorer) (*Service, *repository.Connection) {
+	t.Helper()
+
+	svc := setupTestService(t)
+	conn := &repository.Connection{
+		ID:              "radarr-1",
+		Name:            "Radarr",
+		Type:            repository.ConnectionTypeRadarr,
+		URL:             "http://radarr:7878",
+		EncryptedAPIKey: "key",
+	}
+	svc.connections = &fakeConnections{conns: map[string]*repository.Connection{conn.ID: conn}}
+	svc.newRestorer = func(c *repository.Connection, apiKey string) (restorer, error) {
+		if apiKey != "decrypted-key" {
+			t.Errorf("restorer got api key %q", apiKey)
+		}
+		return fake, nil
+	}
+	return svc, conn
+}
+
+func recordMovie(t *testing.T, svc *Service, connID string) *repository.DeletionRecord {
+	t.Helper()
+
+	rec := &repository.DeletionRecord{
+		ConnectionID:         connID,
+		ConnectionName:       "Radarr",
+		ConnectionType:       repository.ConnectionTypeRadarr,
+		MediaType:            repository.MediaTypeMovie,
+		Title:                "Heat",
+		Year:                 1995,
+		TMDBID:               949,
+		QualityProfileID:     6,
+		RootFolderPath:       "/movies",
+		ImportExclusionAdded: true,
+	}
+	if err := svc.Record(context.Background(), rec); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	return rec
+}
+
+func TestRestoreMovie(t *testing.T) {
+	fake := &fakeRestorer{result: &arrclient.RestoreResult{ID: 77, ExclusionRemoved: true}}
+	svc, conn := setupRestoreService(t, fake)
+	rec := recordMovie(t, svc, conn.ID)
+
+	c, resp := newTestContext(http.MethodPost, "/api/history/"+rec.ID+"/restore")
+	c.SetParamNames("id")
+	c.SetParamValues(rec.ID)
+	c.Set("user", &repository.User{Username: "admin"})
+
+	if err := svc.RestoreHandler(c); err != nil {
+		t.Fatalf("RestoreHandler: %v", err)
+	}
+	if resp.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want %d (%s)", resp.Code, http.StatusOK, resp.Body.String())
+	}
+
+	var body restoreResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if body.ArrID != 77 || !body.ExclusionRemoved {
+		t.Errorf("unexpected result: %+v", body)
+	}
+	if body.Record.RestoredBy != "admin" || body.Record.RestoredAt == "" {
+		t.Errorf("record not marked restored: %+v", body.Record)
+	}
+
+	if fake.got == nil {
+		t.Fatal("restorer was not called")
+	}
+	if fake.got.TMDBID != 949 || fake.got.QualityProfileID != 6 || fake.got.RootFolderPath != "/movies" ||
+		!fake.got.ImportExclusionAdded {
+		t.Errorf("unexpected restore request: %+v", fake.got)
+	}
+
+	// A second restore must be refused
+	_, _, err := svc.Restore(context.Background(), rec.ID, "admin", false)
+	if !errors.Is(err, ErrAlreadyRestored) {
+		t.Errorf("expected ErrAlreadyRestored, got %v", err)
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	fake := &fakeRestorer{err: errors.New("radarr unreachable")}
+	svc, conn := setupRestoreService(t, fake)
+	ctx := context.Background()
+
+	failing := recordMovie(t, svc, conn.ID)
+	orphaned := recordMovie(t, svc, "deleted-connection")
+
+	episode := &repository.DeletionRecord{
+		ConnectionID:   conn.ID,
+		ConnectionName: "Sonarr",
+		MediaType:      repository.MediaTypeEpisode,
+		Title:          "Pilot",
+	}
+	if err := svc.Record(ctx, episode); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		want error
+	}{
+		{"missing record", "nonexistent", ErrRecordNotFound},
+		{"episode", episode.ID, ErrNotRestorable},
+		{"connection deleted", orphaned.ID, ErrConnectionMissing},
+		{"radarr fails", failing.ID, fake.err},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := svc.Restore(ctx, tt.id, "admin", false)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	got, err := svc.GetByID(ctx, failing.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.RestoredAt != nil {
+		t.Error("failed restore must not mark the record restored")
+	}
+}
+
+func TestRestoreAlreadyExisting(t *testing.T) {
+	// The title was re-added but the record never marked, as when marking
+	// failed after an earlier restore. Retrying must finish the restore.
+	fake := &fakeRestorer{result: &arrclient.RestoreResult{ID: 12, AlreadyExisted: true}}
+	svc, conn := setupRestoreService(t, fake)
+	ctx := context.Background()
+	rec := recordMovie(t, svc, conn.ID)
+
+	got, result, err := svc.Restore(ctx, rec.ID, "admin", false)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if result.ID != 12 || !result.AlreadyExisted {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if got.RestoredAt == nil || got.RestoredBy != "admin" {
+		t.Errorf("record not marked restored: %+v", got)
+	}
+
+	stored, err := svc.GetByID(ctx, rec.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.RestoredAt == nil {
+		t.Error("stored record not marked restored")
+	}
+}
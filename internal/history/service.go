@@ -0,0 +1,75 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sydlexius/media-reaper/internal/events"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+var ErrIncompleteRecord = errors.New("deletion record requires connection, media type, and title")
+
+// Service records executed deletions and serves the deletion history.
+type Service struct {
+	repo        repository.HistoryRepository
+	connections ConnectionSource
+	publisher   events.Publisher
+	newRestorer func(conn *repository.Connection, apiKey string) (restorer, error)
+}
+
+// NewService creates a history service. publisher may be nil.
+func NewService(repo repository.HistoryRepository, connections ConnectionSource, publisher events.Publisher) *Service {
+	return &Service{repo: repo, connections: connections, publisher: publisher, newRestorer: newArrRestorer}
+}
+
+// Record persists a deletion. ID and DeletedAt are filled in when empty.
+func (s *Service) Record(ctx context.Context, record *repository.DeletionRecord) error {
+	if record.ConnectionID == "" || record.MediaType == "" || record.Title == "" {
+		return ErrIncompleteRecord
+	}
+
+	if record.ID == "" {
+		record.ID = uuid.New().String()
+	}
+	if record.DeletedAt == "" {
+		record.DeletedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if err := s.repo.Create(ctx, record); err != nil {
+		return fmt.Errorf("recording deletion: %w", err)
+	}
+
+	if s.publisher != nil {
+		s.publisher.Publish(ctx, events.Event{Type: events.DeletionRecorded, Payload: record})
+	}
+	return nil
+}
+
+// GetByID returns a single deletion record by ID.
+func (s *Service) GetByID(ctx context.Context, id string) (*repository.DeletionRecord, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// List returns a page of deletion records matching the filter, newest first,
+// along with the total number of matches.
+func (s *Service) List(ctx context.Context, filter repository.HistoryFilter) ([]*repository.DeletionRecord, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultPageSize
+	}
+	if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.repo.List(ctx, filter)
+}
@@ -0,0 +1,99 @@
+package jellyfin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/mediaserver/restclient"
+)
+
+var _ mediaserver.Server = (*Client)(nil)
+
+// Client provides access to the Jellyfin REST API. Failed requests return a
+// *restclient.StatusError; server errors, rate limiting, and network
+// failures are retried first.
+type Client struct {
+	rest *restclient.Client
+}
+
+// New creates a Jellyfin API client.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		rest: restclient.New("jellyfin", baseURL, func(req *http.Request) {
+			req.Header.Set("Authorization", `MediaBrowser Token="`+apiKey+`"`)
+		}),
+	}
+}
+
+// TestConnection verifies connectivity by fetching system info. It makes a
+// single attempt, since health checks schedule their own retries.
+func (c *Client) TestConnection(ctx context.Context) (*mediaserver.SystemInfo, error) {
+	var info mediaserver.SystemInfo
+	if err := c.rest.Once(ctx, http.MethodGet, "/System/Info/Public", nil, &info); err != nil {
+		return nil, fmt.Errorf("jellyfin connection test failed: %w", err)
+	}
+	return &info, nil
+}
+
+// GetUsers returns all users (requires admin API key).
+func (c *Client) GetUsers(ctx context.Context) ([]*mediaserver.User, error) {
+	var users []*mediaserver.User
+	if err := c.rest.Get(ctx, "/Users", nil, &users); err != nil {
+		return nil, fmt.Errorf("getting users: %w", err)
+	}
+	return users, nil
+}
+
+// GetLibraries returns all media libraries (folders).
+func (c *Client) GetLibraries(ctx context.Context) ([]mediaserver.Library, error) {
+	var resp mediaFoldersResponse
+	if err := c.rest.Get(ctx, "/Library/MediaFolders", nil, &resp); err != nil {
+		return nil, fmt.Errorf("getting libraries: %w", err)
+	}
+	return resp.Items, nil
+}
+
+// GetUserItems returns items for a specific user with optional query
+// parameters. Unlike Emby, Jellyfin takes the user as a query parameter on
+// /Items; the /Users/{id}/Items form is deprecated.
+func (c *Client) GetUserItems(ctx context.Context, userID string, params *mediaserver.ItemQuery) (*mediaserver.ItemsResult, error) {
+	qp := map[string]string{"userId": userID}
+	if params != nil {
+		if params.ParentID != "" {
+			qp["parentId"] = params.ParentID
+		}
+		if params.IncludeTypes != "" {
+			qp["includeItemTypes"] = params.IncludeTypes
+		}
+		if params.Recursive {
+			qp["recursive"] = "true"
+		}
+		if params.Limit > 0 {
+			qp["limit"] = strconv.Itoa(params.Limit)
+		}
+		if params.StartIndex > 0 {
+			qp["startIndex"] = strconv.Itoa(params.StartIndex)
+		}
+		if params.SortBy != "" {
+			qp["sortBy"] = params.SortBy
+		}
+		if params.SortOrder != "" {
+			qp["sortOrder"] = params.SortOrder
+		}
+		if params.IsPlayed != nil {
+			qp["isPlayed"] = strconv.FormatBool(*params.IsPlayed)
+		}
+		if params.Fields != "" {
+			qp["fields"] = params.Fields
+		}
+	}
+
+	var result mediaserver.ItemsResult
+	if err := c.rest.Get(ctx, "/Items", qp, &result); err != nil {
+		return nil, fmt.Errorf("getting user items: %w", err)
+	}
+	return &result, nil
+}
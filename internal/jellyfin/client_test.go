@@ -0,0 +1,174 @@
+package jellyfin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/mediaserver/restclient"
+)
+
+func TestTestConnection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/System/Info/Public" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != `MediaBrowser Token="test-key"` {
+			t.Errorf("missing or wrong Authorization header: %s", got)
+		}
+
+		_ = json.NewEncoder(w).Encode(mediaserver.SystemInfo{
+			ServerName: "Test Jellyfin",
+			Version:    "10.10.3",
+			ID:         "abc123",
+		})
+	}))
+	defer server.Close()
+
+	client := New(server.URL+"/", "test-key")
+	info, err := client.TestConnection(context.Background())
+	if err != nil {
+		t.Fatalf("TestConnection failed: %v", err)
+	}
+
+	if info.ServerName != "Test Jellyfin" {
+		t.Errorf("expected server name 'Test Jellyfin', got %q", info.ServerName)
+	}
+	if info.Version != "10.10.3" {
+		t.Errorf("expected version '10.10.3', got %q", info.Version)
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Users" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		_ = json.NewEncoder(w).Encode([]*mediaserver.User{
+			{ID: "user1", Name: "Admin", Policy: &mediaserver.UserPolicy{IsAdministrator: true, EnableAllFolders: true}},
+			{ID: "user2", Name: "Viewer"},
+		})
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "test-key")
+	users, err := client.GetUsers(context.Background())
+	if err != nil {
+		t.Fatalf("GetUsers failed: %v", err)
+	}
+
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(users))
+	}
+	if !users[0].Policy.IsAdministrator {
+		t.Error("expected first user to be admin")
+	}
+}
+
+func TestGetLibraries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Library/MediaFolders" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		_ = json.NewEncoder(w).Encode(mediaFoldersResponse{
+			Items: []mediaserver.Library{
+				{ID: "lib1", Name: "Movies", CollectionType: "movies"},
+				{ID: "lib2", Name: "Shows", CollectionType: "tvshows"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "test-key")
+	libs, err := client.GetLibraries(context.Background())
+	if err != nil {
+		t.Fatalf("GetLibraries failed: %v", err)
+	}
+
+	if len(libs) != 2 || libs[1].CollectionType != "tvshows" {
+		t.Errorf("unexpected libraries: %+v", libs)
+	}
+}
+
+func TestGetUserItems(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Items" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("userId") != "user1" {
+			t.Errorf("expected userId=user1, got %q", q.Get("userId"))
+		}
+		if q.Get("includeItemTypes") != "Movie" || q.Get("recursive") != "true" || q.Get("isPlayed") != "false" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+
+		_, _ = w.Write([]byte(`{"Items":[{"Id":"item1","Name":"Test Movie","Type":"Movie",` +
+			`"ProviderIds":{"Tmdb":"603","Imdb":"tt0133093"},"UserData":{"PlayCount":0,"Played":false}}],"TotalRecordCount":1}`))
+	}))
+	defer server.Close()
+
+	var client mediaserver.Server = New(server.URL, "test-key")
+	played := false
+	result, err := client.GetUserItems(context.Background(), "user1", &mediaserver.ItemQuery{
+		IncludeTypes: "Movie",
+		Recursive:    true,
+		IsPlayed:     &played,
+	})
+	if err != nil {
+		t.Fatalf("GetUserItems failed: %v", err)
+	}
+
+	if result.TotalRecordCount != 1 || len(result.Items) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	item := result.Items[0]
+	if item.ProviderIDs.TMDB != "603" || item.ProviderIDs.IMDB != "tt0133093" {
+		t.Errorf("unexpected provider IDs: %+v", item.ProviderIDs)
+	}
+	if item.UserData == nil || item.UserData.Played {
+		t.Errorf("unexpected user data: %+v", item.UserData)
+	}
+}
+
+func TestConnectionFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "bad-key")
+	if _, err := client.TestConnection(context.Background()); !errors.Is(err, restclient.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Items":[{"Id":"lib1","Name":"Movies"}]}`))
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "test-key")
+	client.rest.RetryDelay = time.Millisecond
+	libs, err := client.GetLibraries(context.Background())
+	if err != nil {
+		t.Fatalf("GetLibraries failed: %v", err)
+	}
+	if len(libs) != 1 || attempts.Load() != 3 {
+		t.Errorf("expected success on attempt 3, got %v after %d", libs, attempts.Load())
+	}
+}
@@ -0,0 +1,8 @@
+package jellyfin
+
+import "github.com/sydlexius/media-reaper/internal/mediaserver"
+
+// mediaFoldersResponse wraps the response from GET /Library/MediaFolders.
+type mediaFoldersResponse struct {
+	Items []mediaserver.Library `json:"Items"`
+}
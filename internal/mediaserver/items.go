@@ -0,0 +1,120 @@
+package mediaserver
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync"
+)
+
+const (
+	// DefaultPageSize is how many items UserItems asks for at a time when
+	// the query sets no limit.
+	DefaultPageSize = 500
+	// DefaultUserConcurrency is how many users ItemsByUser fetches at once
+	// when given no limit.
+	DefaultUserConcurrency = 4
+)
+
+// UserItems iterates over every item matching params for a user, fetching
+// pages of params.Limit items (DefaultPageSize if unset) from
+// params.StartIndex onward. Iteration stops at the first error, which is
+// yielded with a nil item. Items added or removed on the server
+// mid-iteration can shift the pages, so callers wanting a stable order
+// should set SortBy.
+func UserItems(ctx context.Context, server Server, userID string, params *ItemQuery) iter.Seq2[*Item, error] {
+	return func(yield func(*Item, error) bool) {
+		var query ItemQuery
+		if params != nil {
+			query = *params
+		}
+		if query.Limit <= 0 {
+			query.Limit = DefaultPageSize
+		}
+
+		for {
+			page, err := server.GetUserItems(ctx, userID, &query)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			query.StartIndex += len(page.Items)
+			if len(page.Items) < query.Limit || query.StartIndex >= page.TotalRecordCount {
+				return
+			}
+		}
+	}
+}
+
+// AllUserItems returns every item matching params for a user, following
+// pagination.
+func AllUserItems(ctx context.Context, server Server, userID string, params *ItemQuery) ([]*Item, error) {
+	var items []*Item
+	for item, err := range UserItems(ctx, server, userID, params) {
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// ItemsByUser fetches every item matching params for each user, at most
+// concurrency users at a time (DefaultUserConcurrency if not positive), and
+// returns them keyed by user ID. The first failure cancels the remaining
+// fetches and is returned.
+func ItemsByUser(ctx context.Context, server Server, userIDs []string, params *ItemQuery, concurrency int) (map[string][]*Item, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if concurrency <= 0 {
+		concurrency = DefaultUserConcurrency
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, concurrency)
+		results  = make(map[string][]*Item, len(userIDs))
+	)
+	for _, userID := range userIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			items, err := AllUserItems(ctx, server, userID, params)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("user %s: %w", userID, err)
+					cancel()
+				}
+				return
+			}
+			results[userID] = items
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
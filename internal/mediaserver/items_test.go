@@ -0,0 +1,106 @@
+package mediaserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errBroken = errors.New("broken")
+
+// pagedServer serves total items per user, honoring StartIndex and Limit.
+// The user "broken" fails.
+type pagedServer struct {
+	total     int
+	requests  atomic.Int32
+	delay     time.Duration
+	mu        sync.Mutex
+	inFlight  int
+	peak      int
+	wantLimit int
+}
+
+func (s *pagedServer) TestConnection(context.Context) (*SystemInfo, error) { return nil, nil }
+func (s *pagedServer) GetUsers(context.Context) ([]*User, error)           { return nil, nil }
+func (s *pagedServer) GetLibraries(context.Context) ([]Library, error)     { return nil, nil }
+
+func (s *pagedServer) GetUserItems(_ context.Context, userID string, q *ItemQuery) (*ItemsResult, error) {
+	s.requests.Add(1)
+	s.mu.Lock()
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(s.delay)
+
+	if userID == "broken" {
+		return nil, errBroken
+	}
+	if s.wantLimit != 0 && q.Limit != s.wantLimit {
+		return nil, fmt.Errorf("expected Limit=%d, got %d", s.wantLimit, q.Limit)
+	}
+	result := &ItemsResult{TotalRecordCount: s.total}
+	for i := q.StartIndex; i < min(q.StartIndex+q.Limit, s.total); i++ {
+		result.Items = append(result.Items, &Item{ID: fmt.Sprintf("%s/item%d", userID, i)})
+	}
+	return result, nil
+}
+
+func TestUserItemsPagination(t *testing.T) {
+	const total = 7
+	server := &pagedServer{total: total, wantLimit: 3}
+
+	items, err := AllUserItems(context.Background(), server, "user1", &ItemQuery{Recursive: true, Limit: 3})
+	if err != nil {
+		t.Fatalf("AllUserItems failed: %v", err)
+	}
+	if len(items) != total || items[0].ID != "user1/item0" || items[total-1].ID != "user1/item6" {
+		t.Errorf("expected all %d items in order, got %d", total, len(items))
+	}
+	if server.requests.Load() != 3 {
+		t.Errorf("expected 3 page requests, got %d", server.requests.Load())
+	}
+
+	// Breaking out of the loop stops fetching further pages.
+	server.requests.Store(0)
+	for range UserItems(context.Background(), server, "user1", &ItemQuery{Limit: 3}) {
+		break
+	}
+	if server.requests.Load() != 1 {
+		t.Errorf("expected 1 page request after breaking early, got %d", server.requests.Load())
+	}
+
+	// Without a limit, pages are DefaultPageSize items.
+	server = &pagedServer{total: total, wantLimit: DefaultPageSize}
+	if items, err := AllUserItems(context.Background(), server, "user1", nil); err != nil || len(items) != total {
+		t.Errorf("expected %d items in one page, got %d: %v", total, len(items), err)
+	}
+}
+
+func TestItemsByUser(t *testing.T) {
+	server := &pagedServer{total: 1, delay: 10 * time.Millisecond}
+	users := []string{"u1", "u2", "u3", "u4", "u5"}
+
+	results, err := ItemsByUser(context.Background(), server, users, nil, 2)
+	if err != nil {
+		t.Fatalf("ItemsByUser failed: %v", err)
+	}
+	if len(results) != len(users) || results["u3"][0].ID != "u3/item0" {
+		t.Errorf("unexpected results: %v", results)
+	}
+	if server.peak > 2 {
+		t.Errorf("expected at most 2 concurrent requests, saw %d", server.peak)
+	}
+
+	if _, err := ItemsByUser(context.Background(), server, []string{"u1", "broken"}, nil, 2); !errors.Is(err, errBroken) {
+		t.Errorf("expected the failure to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+// Package mediaserver defines what media-reaper needs from a media server.
+// Emby and Jellyfin share most of their API, so their clients return the
+// same types and either can stand behind a Server.
+package mediaserver
+
+import "context"
+
+// Server is a media server client.
+type Server interface {
+	// TestConnection verifies connectivity by fetching system info.
+	TestConnection(ctx context.Context) (*SystemInfo, error)
+	// GetUsers returns all users.
+	GetUsers(ctx context.Context) ([]*User, error)
+	// GetLibraries returns all media libraries.
+	GetLibraries(ctx context.Context) ([]Library, error)
+	// GetUserItems returns items visible to a user, with their play state.
+	GetUserItems(ctx context.Context, userID string, params *ItemQuery) (*ItemsResult, error)
+}
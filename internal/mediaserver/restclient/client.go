@@ -0,0 +1,150 @@
+// Package restclient is the HTTP layer shared by the Emby, Jellyfin, and
+// Plex clients: it sends JSON requests with the server's credentials, retries
+// server errors, rate limiting, and network failures with backoff, and
+// returns typed errors for other failures.
+package restclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+
+	// MaxAttempts is how many times Do sends a request before a server
+	// error, rate limit, or network failure is returned to the caller.
+	MaxAttempts = 4
+	// MaxErrorBody is how much of an error response is kept.
+	MaxErrorBody = 4096
+
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
+)
+
+// Client sends requests to one media server.
+type Client struct {
+	server    string
+	baseURL   string
+	authorize func(*http.Request)
+
+	// HTTPClient sends the requests.
+	HTTPClient *http.Client
+	// RetryDelay is the wait before the first retry. It doubles with each
+	// further attempt.
+	RetryDelay time.Duration
+}
+
+// New creates a client for the server at baseURL. server names the kind of
+// server in errors, and authorize adds the credentials to each request.
+func New(server, baseURL string, authorize func(*http.Request)) *Client {
+	return &Client{
+		server:     server,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		authorize:  authorize,
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+		RetryDelay: defaultRetryDelay,
+	}
+}
+
+// BaseURL returns the server's URL without a trailing slash.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// Get sends a GET request and decodes the JSON response into result.
+func (c *Client) Get(ctx context.Context, path string, queryParams map[string]string, result any) error {
+	return c.Do(ctx, http.MethodGet, path, queryParams, result)
+}
+
+// Do sends a request and decodes the JSON response into result, if result is
+// not nil. Server errors, rate limiting, and network failures are retried
+// with exponential backoff, honoring Retry-After. Other failures return a
+// *StatusError straight away.
+func (c *Client) Do(ctx context.Context, method, path string, queryParams map[string]string, result any) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = c.send(ctx, method, path, queryParams, result)
+		if err == nil {
+			return nil
+		}
+		if retryAfter < 0 || attempt == MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := max(retryAfter, c.RetryDelay<<(attempt-1))
+		timer := time.NewTimer(min(delay, maxRetryDelay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Once is Do without retries, for callers such as health checks that
+// schedule their own.
+func (c *Client) Once(ctx context.Context, method, path string, queryParams map[string]string, result any) error {
+	_, err := c.send(ctx, method, path, queryParams, result)
+	return err
+}
+
+// send makes a single attempt at a request. When the attempt failed in a way
+// worth retrying, retryAfter is zero or the delay the server asked for;
+// otherwise it is negative.
+func (c *Client) send(ctx context.Context, method, path string, queryParams map[string]string, result any) (retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return -1, fmt.Errorf("creating request: %w", err)
+	}
+
+	c.authorize(req)
+	req.Header.Set("Accept", "application/json")
+
+	if len(queryParams) > 0 {
+		q := req.URL.Query()
+		for k, v := range queryParams {
+			q.Set(k, v)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+
+	resp, err := c.HTTPClient.Do(req) //nolint:gosec // URL is constructed from admin-configured baseURL, not user input
+	if err != nil {
+		return 0, fmt.Errorf("executing request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		statusErr := NewStatusError(c.server, resp)
+		if !retryable(resp.StatusCode) {
+			return -1, statusErr
+		}
+		return parseRetryAfter(resp.Header.Get("Retry-After")), statusErr
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return -1, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return -1, fmt.Errorf("decoding response: %w", err)
+	}
+	return -1, nil
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds. Dates and
+// missing or malformed values yield zero, leaving the delay to the backoff.
+func parseRetryAfter(v string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
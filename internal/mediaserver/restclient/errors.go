@@ -0,0 +1,65 @@
+package restclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrUnauthorized is matched by responses rejecting the API key.
+	ErrUnauthorized = errors.New("media server rejected the api key")
+	// ErrNotFound is matched by responses for an item, user, or path the
+	// server does not have.
+	ErrNotFound = errors.New("not found on media server")
+	// ErrServerError is matched by 5xx responses, after retries are used up.
+	ErrServerError = errors.New("media server error")
+	// ErrRateLimited is matched by 429 responses, after retries are used up.
+	ErrRateLimited = errors.New("media server rate limit exceeded")
+)
+
+// StatusError is a response with a status outside the 2xx range. Use
+// errors.Is with ErrUnauthorized, ErrNotFound, ErrServerError, or
+// ErrRateLimited to tell the common cases apart.
+type StatusError struct {
+	// Server names the kind of server that answered, such as "emby".
+	Server     string
+	StatusCode int
+	Body       string
+}
+
+// NewStatusError reads up to MaxErrorBody bytes of resp's body into a
+// StatusError.
+func NewStatusError(server string, resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxErrorBody))
+	return &StatusError{Server: server, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s returned status %d", e.Server, e.StatusCode)
+	}
+	return fmt.Sprintf("%s returned status %d: %s", e.Server, e.StatusCode, e.Body)
+}
+
+// Is reports whether the status falls under target.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrServerError:
+		return e.StatusCode >= 500
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// retryable reports whether a request that got status is worth sending again.
+func retryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
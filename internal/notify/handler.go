@@ -0,0 +1,225 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type providerRequest struct {
+	Name          string         `json:"name"`
+	Type          string         `json:"type"`
+	Config        map[string]any `json:"config"`
+	Events        []string       `json:"events"`
+	TitleTemplate string         `json:"titleTemplate,omitempty"`
+	BodyTemplate  string         `json:"bodyTemplate,omitempty"`
+	Enabled       *bool          `json:"enabled,omitempty"`
+}
+
+type providerResponse struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	Type          string         `json:"type"`
+	Config        map[string]any `json:"config"`
+	Events        []string       `json:"events"`
+	TitleTemplate string         `json:"titleTemplate,omitempty"`
+	BodyTemplate  string         `json:"bodyTemplate,omitempty"`
+	Enabled       bool           `json:"enabled"`
+	CreatedAt     string         `json:"createdAt"`
+	UpdatedAt     string         `json:"updatedAt"`
+}
+
+func (r providerRequest) input() ProviderInput {
+	return ProviderInput{
+		Name:          r.Name,
+		Type:          r.Type,
+		Config:        r.Config,
+		Events:        r.Events,
+		TitleTemplate: r.TitleTemplate,
+		BodyTemplate:  r.BodyTemplate,
+		Enabled:       r.Enabled,
+	}
+}
+
+func (s *Service) toResponse(p *repository.NotificationProvider) providerResponse {
+	events := p.Events
+	if events == nil {
+		events = []string{}
+	}
+	return providerResponse{
+		ID:            p.ID,
+		Name:          p.Name,
+		Type:          string(p.Type),
+		Config:        s.MaskedConfig(p),
+		Events:        events,
+		TitleTemplate: p.TitleTemplate,
+		BodyTemplate:  p.BodyTemplate,
+		Enabled:       p.Enabled,
+		CreatedAt:     p.CreatedAt,
+		UpdatedAt:     p.UpdatedAt,
+	}
+}
+
+// EventsHandler lists the subscribable event types.
+// @Summary List notification events
+// @Description List the event types a notification provider can subscribe to
+// @Tags notifications
+// @Produce json
+// @Success 200 {array} string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /notifications/events [get]
+func (s *Service) EventsHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, Events)
+}
+
+// CreateHandler creates a notification provider.
+// @Summary Create notification provider
+// @Description Create a Discord, Slack, webhook, SMTP, or Apprise provider. Config is stored encrypted.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param request body providerRequest true "Provider details"
+// @Success 201 {object} providerResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /notifications [post]
+func (s *Service) CreateHandler(c echo.Context) error {
+	var req providerRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	p, err := s.Create(c.Request().Context(), req.input())
+	if errors.Is(err, ErrInvalidConfig) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to create notification provider"})
+	}
+
+	return c.JSON(http.StatusCreated, s.toResponse(p))
+}
+
+// ListHandler lists notification providers.
+// @Summary List notification providers
+// @Description List all notification providers with secret config values masked
+// @Tags notifications
+// @Produce json
+// @Success 200 {array} providerResponse
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /notifications [get]
+func (s *Service) ListHandler(c echo.Context) error {
+	providers, err := s.GetAll(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list notification providers"})
+	}
+
+	responses := make([]providerResponse, 0, len(providers))
+	for _, p := range providers {
+		responses = append(responses, s.toResponse(p))
+	}
+	return c.JSON(http.StatusOK, responses)
+}
+
+// GetHandler returns a single notification provider.
+// @Summary Get notification provider
+// @Description Get a notification provider by ID with secret config values masked
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Provider ID"
+// @Success 200 {object} providerResponse
+// @Failure 404 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /notifications/{id} [get]
+func (s *Service) GetHandler(c echo.Context) error {
+	p, err := s.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get notification provider"})
+	}
+	if p == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "notification provider not found"})
+	}
+	return c.JSON(http.StatusOK, s.toResponse(p))
+}
+
+// UpdateHandler updates a notification provider.
+// @Summary Update notification provider
+// @Description Update a notification provider. Secret config values that are omitted or still masked are kept.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param id path string true "Provider ID"
+// @Param request body providerRequest true "Provider details"
+// @Success 200 {object} providerResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /notifications/{id} [put]
+func (s *Service) UpdateHandler(c echo.Context) error {
+	var req providerRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	p, err := s.Update(c.Request().Context(), c.Param("id"), req.input())
+	if errors.Is(err, ErrInvalidConfig) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update notification provider"})
+	}
+	if p == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "notification provider not found"})
+	}
+
+	return c.JSON(http.StatusOK, s.toResponse(p))
+}
+
+// DeleteHandler deletes a notification provider.
+// @Summary Delete notification provider
+// @Description Delete a notification provider by ID
+// @Tags notifications
+// @Param id path string true "Provider ID"
+// @Success 204
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /notifications/{id} [delete]
+func (s *Service) DeleteHandler(c echo.Context) error {
+	if err := s.Delete(c.Request().Context(), c.Param("id")); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete notification provider"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// TestHandler sends a test notification through a saved provider.
+// @Summary Test notification provider
+// @Description Send a test message through a saved provider
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Provider ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /notifications/{id}/test [post]
+func (s *Service) TestHandler(c echo.Context) error {
+	err := s.Test(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, ErrProviderNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "test notification sent"})
+}
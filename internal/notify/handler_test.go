@@ -0,0 +1,474 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	_ "modernc.org/sqlite"
+
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/directdelete"
+	"github.com/sydlexius/media-reaper/internal/events"
+	"github.com/sydlexius/media-reaper/internal/repository"
+	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+)
+
+func setupTestService(t *testing.T) *Service {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	schema := `
+	CREATE TABLE notification_providers (
+		id               TEXT PRIMARY KEY,
+		name             TEXT NOT NULL,
+		type             TEXT NOT NULL CHECK(type IN ('discord', 'slack', 'webhook', 'smtp', 'apprise')),
+		encrypted_config TEXT NOT NULL,
+		events           TEXT NOT NULL DEFAULT '[]',
+		title_template   TEXT NOT NULL DEFAULT '',
+		body_template    TEXT NOT NULL DEFAULT '',
+		enabled          INTEGER NOT NULL DEFAULT 1,
+		created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	encryptor, err := connection.NewEncryptor(hex.EncodeToString(key))
+	if err != nil {
+		t.Fatalf("creating encryptor: %v", err)
+	}
+
+	return NewService(sqliterepo.NewNotificationProviderRepository(db), encryptor)
+}
+
+func newTestContext(method, path, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	var req *http.Request
+	if body != "" {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	rec := httptest.NewRecorder()
+	return e.NewContext(req, rec), rec
+}
+
+// webhookRecorder is a local stand-in for a webhook endpoint that records every payload.
+type webhookRecorder struct {
+	mu       sync.Mutex
+	payloads []webhookPayload
+	server   *httptest.Server
+}
+
+func newWebhookRecorder(t *testing.T) *webhookRecorder {
+	t.Helper()
+	w := &webhookRecorder{}
+	w.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		w.mu.Lock()
+		w.payloads = append(w.payloads, p)
+		w.mu.Unlock()
+	}))
+	t.Cleanup(w.server.Close)
+	return w
+}
+
+func (w *webhookRecorder) received() []webhookPayload {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]webhookPayload(nil), w.payloads...)
+}
+
+func TestCreateHandlerMasksSecrets(t *testing.T) {
+	svc := setupTestService(t)
+
+	body := `{"name":"Ops","type":"discord","config":{"webhookUrl":"https://discord.test/api/webhooks/1/secret-token"},"events":["deletion.executed"]}`
+	c, rec := newTestContext(http.MethodPost, "/api/notifications", body)
+	if err := svc.CreateHandler(c); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp providerResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Config["webhookUrl"] != "****oken" {
+		t.Errorf("expected masked webhookUrl, got %v", resp.Config["webhookUrl"])
+	}
+	if strings.Contains(rec.Body.String(), "secret-token") {
+		t.Error("response leaked the webhook secret")
+	}
+}
+
+func TestCreateHandlerValidation(t *testing.T) {
+	svc := setupTestService(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing name", `{"type":"slack","config":{"webhookUrl":"http://x"}}`},
+		{"unknown type", `{"name":"x","type":"pager","config":{}}`},
+		{"unknown event", `{"name":"x","type":"slack","config":{"webhookUrl":"http://x"},"events":["nope"]}`},
+		{"missing required config", `{"name":"x","type":"webhook","config":{}}`},
+		{"bad template", `{"name":"x","type":"slack","config":{"webhookUrl":"http://x"},"titleTemplate":"{{.Fields"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newTestContext(http.MethodPost, "/api/notifications", tt.body)
+			if err := svc.CreateHandler(c); err != nil {
+				t.Fatalf("handler error: %v", err)
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsMaskedSecrets(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	hook := newWebhookRecorder(t)
+
+	p, err := svc.Create(ctx, ProviderInput{
+		Name: "Hook",
+		Type: string(repository.NotificationTypeWebhook),
+		Config: map[string]any{
+			"url":     hook.server.URL,
+			"headers": map[string]any{"Authorization": "Bearer keep-me"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Send back exactly what the API returned: the headers are masked.
+	masked := svc.MaskedConfig(p)
+	if _, err := svc.Update(ctx, p.ID, ProviderInput{
+		Name:   "Hook renamed",
+		Type:   string(repository.NotificationTypeWebhook),
+		Config: masked,
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	updated, err := svc.GetByID(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	config, err := svc.decryptConfig(updated)
+	if err != nil {
+		t.Fatalf("decryptConfig: %v", err)
+	}
+	headers, _ := config["headers"].(map[string]any)
+	if headers["Authorization"] != "Bearer keep-me" {
+		t.Errorf("expected stored header to survive update, got %v", config["headers"])
+	}
+	if updated.Name != "Hook renamed" {
+		t.Errorf("expected name to update, got %q", updated.Name)
+	}
+}
+
+func TestNotifyOnlySubscribedProviders(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	subscribed := newWebhookRecorder(t)
+	other := newWebhookRecorder(t)
+	disabled := newWebhookRecorder(t)
+	off := false
+
+	inputs := []ProviderInput{
+		{Name: "subscribed", Type: "webhook", Config: map[string]any{"url": subscribed.server.URL}, Events: []string{"deletion.executed"}},
+		{Name: "other", Type: "webhook", Config: map[string]any{"url": other.server.URL}, Events: []string{"item.flagged"}},
+		{Name: "disabled", Type: "webhook", Config: map[string]any{"url": disabled.server.URL}, Events: []string{"deletion.executed"}, Enabled: &off},
+	}
+	for _, in := range inputs {
+		if _, err := svc.Create(ctx, in); err != nil {
+			t.Fatalf("Create %s: %v", in.Name, err)
+		}
+	}
+
+	bus := events.NewBus()
+	svc.Subscribe(bus)
+	bus.Publish(ctx, events.Event{Type: events.DeletionRecorded, Payload: &repository.DeletionRecord{
+		Title:          "Firefly",
+		ConnectionName: "Sonarr",
+		RuleName:       "Unwatched 1y",
+		SizeBytes:      3 << 30,
+	}})
+	svc.Wait()
+
+	got := subscribed.received()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 delivery to subscribed provider, got %d", len(got))
+	}
+	if got[0].Title != "Deleted: Firefly" {
+		t.Errorf("unexpected title: %q", got[0].Title)
+	}
+	if !strings.Contains(got[0].Body, "3.0 GiB") {
+		t.Errorf("expected size in body, got %q", got[0].Body)
+	}
+	if n := len(other.received()); n != 0 {
+		t.Errorf("unsubscribed provider received %d messages", n)
+	}
+	if n := len(disabled.received()); n != 0 {
+		t.Errorf("disabled provider received %d messages", n)
+	}
+}
+
+func TestCustomTemplates(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	hook := newWebhookRecorder(t)
+
+	p, err := svc.Create(ctx, ProviderInput{
+		Name:          "Templated",
+		Type:          "webhook",
+		Config:        map[string]any{"url": hook.server.URL},
+		Events:        []string{"connection.unhealthy"},
+		TitleTemplate: "[{{.Type}}] {{.Fields.connection}}",
+		BodyTemplate:  "down: {{.Fields.error}}",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	bus := events.NewBus()
+	svc.Subscribe(bus)
+	bus.Publish(ctx, events.Event{Type: events.ConnectionStateChanged, Payload: connection.StateChange{
+		Connection: &repository.Connection{Name: "Radarr", Type: repository.ConnectionTypeRadarr},
+		Previous:   repository.ConnectionStatusHealthy,
+		Current:    repository.ConnectionStatusUnhealthy,
+		Reason:     "connection refused",
+	}})
+	svc.Wait()
+
+	got := hook.received()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(got))
+	}
+	if got[0].Title != "[connection.unhealthy] Radarr" || got[0].Body != "down: connection refused" {
+		t.Errorf("unexpected rendering: %+v", got[0])
+	}
+
+	c, rec := newTestContext(http.MethodPost, "/api/notifications/"+p.ID+"/test", "")
+	c.SetParamNames("id")
+	c.SetParamValues(p.ID)
+	if err := svc.TestHandler(c); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from test send, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := hook.received(); len(got) != 2 || got[1].Event != string(EventTest) {
+		t.Errorf("expected a test event delivery, got %+v", got)
+	}
+}
+
+func TestConnectionStateChangeEvents(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	hook := newWebhookRecorder(t)
+
+	if _, err := svc.Create(ctx, ProviderInput{
+		Name:   "Health",
+		Type:   "webhook",
+		Config: map[string]any{"url": hook.server.URL},
+		Events: []string{"connection.unhealthy", "connection.recovered"},
+	}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	bus := events.NewBus()
+	svc.Subscribe(bus)
+
+	tests := []struct {
+		name     string
+		previous repository.ConnectionStatus
+		current  repository.ConnectionStatus
+		want     string
+	}{
+		{"unknown to healthy is silent", repository.ConnectionStatusUnknown, repository.ConnectionStatusHealthy, ""},
+		{"unknown to unhealthy", repository.ConnectionStatusUnknown, repository.ConnectionStatusUnhealthy, "connection.unhealthy"},
+		{"healthy to unhealthy", repository.ConnectionStatusHealthy, repository.ConnectionStatusUnhealthy, "connection.unhealthy"},
+		{"unhealthy to healthy", repository.ConnectionStatusUnhealthy, repository.ConnectionStatusHealthy, "connection.recovered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(hook.received())
+			bus.Publish(ctx, events.Event{Type: events.ConnectionStateChanged, Payload: connection.StateChange{
+				Connection: &repository.Connection{Name: "Emby", Type: repository.ConnectionTypeEmby},
+				Previous:   tt.previous,
+				Current:    tt.current,
+			}})
+			svc.Wait()
+
+			got := hook.received()[before:]
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Errorf("expected no delivery, got %+v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Event != tt.want {
+				t.Errorf("expected one %s delivery, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFlaggedEvents(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	hook := newWebhookRecorder(t)
+
+	if _, err := svc.Create(ctx, ProviderInput{
+		Name:   "Flags",
+		Type:   "webhook",
+		Config: map[string]any{"url": hook.server.URL},
+		Events: []string{"item.flagged", "grace.expiring"},
+	}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	bus := events.NewBus()
+	svc.Subscribe(bus)
+	flagged := directdelete.Flagged{
+		Candidate:      &repository.DirectDeleteCandidate{ItemName: "Birthday 2019", FlaggedBy: "admin", SizeBytes: 2 << 30},
+		ConnectionName: "Emby",
+		EligibleAt:     "2026-01-08T12:00:00Z",
+	}
+	bus.Publish(ctx, events.Event{Type: events.ItemFlagged, Payload: flagged})
+	svc.Wait()
+	bus.Publish(ctx, events.Event{Type: events.GraceExpiring, Payload: flagged})
+	svc.Wait()
+
+	got := hook.received()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 deliveries, got %+v", got)
+	}
+	if got[0].Event != "item.flagged" || got[0].Body !=
+		"Birthday 2019 was flagged by admin and will become actionable on 2026-01-08T12:00:00Z." {
+		t.Errorf("unexpected flagged message: %+v", got[0])
+	}
+	if got[1].Event != "grace.expiring" || got[1].Title != "Grace period ending: Birthday 2019" {
+		t.Errorf("unexpected grace message: %+v", got[1])
+	}
+}
+
+func TestDeliveryDoesNotBlockPublisher(t *testing.T) {
+	svc := setupTestService(t)
+	release := make(chan struct{})
+	delivered := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-release
+		var p webhookPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		delivered <- p.Title
+	}))
+	t.Cleanup(server.Close)
+
+	if _, err := svc.Create(context.Background(), ProviderInput{
+		Name:   "Slow",
+		Type:   "webhook",
+		Config: map[string]any{"url": server.URL},
+		Events: []string{"deletion.executed"},
+	}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	bus := events.NewBus()
+	svc.Subscribe(bus)
+
+	// The publisher's context ends as soon as Publish returns, as a
+	// request's does when the client goes away.
+	ctx, cancel := context.WithCancel(context.Background())
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(ctx, events.Event{Type: events.DeletionRecorded, Payload: &repository.DeletionRecord{Title: "Firefly"}})
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish waited for the provider")
+	}
+	cancel()
+
+	close(release)
+	svc.Wait()
+	select {
+	case title := <-delivered:
+		if title != "Deleted: Firefly" {
+			t.Errorf("unexpected title %q", title)
+		}
+	default:
+		t.Fatal("notification was not delivered after the publisher's context ended")
+	}
+}
+
+func TestTestHandlerErrors(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	p, err := svc.Create(ctx, ProviderInput{Name: "Broken", Type: "slack", Config: map[string]any{"webhookUrl": failing.URL}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		want int
+	}{
+		{"unknown provider", "missing", http.StatusNotFound},
+		{"delivery failure", p.ID, http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newTestContext(http.MethodPost, "/api/notifications/"+tt.id+"/test", "")
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+			if err := svc.TestHandler(c); err != nil {
+				t.Fatalf("handler error: %v", err)
+			}
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
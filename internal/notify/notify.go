@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// EventType identifies something a provider can subscribe to.
+type EventType string
+
+const (
+	EventItemFlagged         EventType = "item.flagged"
+	EventGraceExpiring       EventType = "grace.expiring"
+	EventConnectionUnhealthy EventType = "connection.unhealthy"
+	EventConnectionRecovered EventType = "connection.recovered"
+	EventDeletionExecuted    EventType = "deletion.executed"
+	EventTest                EventType = "test"
+)
+
+// Events lists every subscribable event type.
+var Events = []EventType{
+	EventItemFlagged,
+	EventGraceExpiring,
+	EventConnectionUnhealthy,
+	EventConnectionRecovered,
+	EventDeletionExecuted,
+}
+
+// Event is something worth telling someone about. Fields carry the
+// event-specific values that templates can reference as {{.Fields.name}}.
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Fields map[string]string
+}
+
+// Message is a rendered notification ready to hand to a provider.
+type Message struct {
+	Event EventType
+	Title string
+	Body  string
+	// Fields are passed through for providers that send structured payloads.
+	Fields map[string]string
+	Time   time.Time
+}
+
+// Provider delivers a rendered message to an external service.
+type Provider interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var defaultTemplates = map[EventType]struct{ title, body string }{
+	EventItemFlagged: {
+		title: "Flagged for deletion: {{.Fields.title}}",
+		body:  "{{.Fields.title}} was flagged {{if .Fields.rule}}by rule \"{{.Fields.rule}}\"{{else}}by {{.Fields.flaggedBy}}{{end}} and will become actionable on {{.Fields.actionableAt}}.",
+	},
+	EventGraceExpiring: {
+		title: "Grace period ending: {{.Fields.title}}",
+		body:  "The grace period for {{.Fields.title}} ends on {{.Fields.actionableAt}}. Unflag it before then to keep it.",
+	},
+	EventConnectionUnhealthy: {
+		title: "Connection unhealthy: {{.Fields.connection}}",
+		body:  "{{.Fields.connection}} ({{.Fields.type}}) failed its health check: {{.Fields.error}}",
+	},
+	EventConnectionRecovered: {
+		title: "Connection recovered: {{.Fields.connection}}",
+		body:  "{{.Fields.connection}} ({{.Fields.type}}) is passing health checks again.",
+	},
+	EventDeletionExecuted: {
+		title: "Deleted: {{.Fields.title}}",
+		body:  "{{.Fields.title}} was deleted through {{.Fields.connection}}{{if .Fields.rule}} by rule \"{{.Fields.rule}}\"{{end}}. Freed {{.Fields.size}}.",
+	},
+	EventTest: {
+		title: "media-reaper test notification",
+		body:  "If you can read this, the {{.Fields.provider}} provider is configured correctly.",
+	},
+}
+
+// render produces a message for an event, preferring the provider's own
+// templates and falling back to the per-event defaults.
+func render(event Event, titleTmpl, bodyTmpl string) (Message, error) {
+	defaults := defaultTemplates[event.Type]
+	if titleTmpl == "" {
+		titleTmpl = defaults.title
+	}
+	if bodyTmpl == "" {
+		bodyTmpl = defaults.body
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Fields == nil {
+		event.Fields = map[string]string{}
+	}
+
+	title, err := execute("title", titleTmpl, event)
+	if err != nil {
+		return Message{}, err
+	}
+	body, err := execute("body", bodyTmpl, event)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{Event: event.Type, Title: title, Body: body, Fields: event.Fields, Time: event.Time}, nil
+}
+
+func execute(name, text string, event Event) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s template: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", fmt.Errorf("rendering %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// validateTemplate reports whether a user-supplied template parses.
+func validateTemplate(text string) error {
+	if text == "" {
+		return nil
+	}
+	_, err := template.New("custom").Parse(text)
+	return err
+}
+
+func isKnownEvent(e string) bool {
+	for _, known := range Events {
+		if EventType(e) == known {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedFieldKeys returns field names in a stable order for plain-text rendering.
+func sortedFieldKeys(fields map[string]string) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
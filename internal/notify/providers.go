@@ -0,0 +1,341 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const defaultTimeout = 15 * time.Second
+
+var ErrInvalidConfig = errors.New("invalid provider config")
+
+// secretFields lists the config keys that are masked in API responses.
+var secretFields = map[repository.NotificationType][]string{
+	repository.NotificationTypeDiscord: {"webhookUrl"},
+	repository.NotificationTypeSlack:   {"webhookUrl"},
+	repository.NotificationTypeWebhook: {"headers"},
+	repository.NotificationTypeSMTP:    {"password"},
+	repository.NotificationTypeApprise: {"urls"},
+}
+
+// newProvider builds a provider from its decrypted JSON config.
+func newProvider(providerType repository.NotificationType, config []byte, client *http.Client) (Provider, error) {
+	var (
+		p   Provider
+		err error
+	)
+	switch providerType {
+	case repository.NotificationTypeDiscord:
+		var c DiscordConfig
+		err = json.Unmarshal(config, &c)
+		if err == nil && c.WebhookURL == "" {
+			err = errors.New("webhookUrl is required")
+		}
+		p = &Discord{cfg: c, client: client}
+	case repository.NotificationTypeSlack:
+		var c SlackConfig
+		err = json.Unmarshal(config, &c)
+		if err == nil && c.WebhookURL == "" {
+			err = errors.New("webhookUrl is required")
+		}
+		p = &Slack{cfg: c, client: client}
+	case repository.NotificationTypeWebhook:
+		var c WebhookConfig
+		err = json.Unmarshal(config, &c)
+		if err == nil && c.URL == "" {
+			err = errors.New("url is required")
+		}
+		p = &Webhook{cfg: c, client: client}
+	case repository.NotificationTypeSMTP:
+		var c SMTPConfig
+		err = json.Unmarshal(config, &c)
+		if err == nil && (c.Host == "" || c.From == "" || len(c.To) == 0) {
+			err = errors.New("host, from, and to are required")
+		}
+		p = &SMTP{cfg: c}
+	case repository.NotificationTypeApprise:
+		var c AppriseConfig
+		err = json.Unmarshal(config, &c)
+		if err == nil && c.URL == "" {
+			err = errors.New("url is required")
+		}
+		if err == nil && c.Key == "" && c.URLs == "" {
+			err = errors.New("either key or urls is required")
+		}
+		p = &Apprise{cfg: c, client: client}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidConfig, providerType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return p, nil
+}
+
+// DiscordConfig configures a Discord channel webhook.
+type DiscordConfig struct {
+	WebhookURL string `json:"webhookUrl"`
+	Username   string `json:"username,omitempty"`
+}
+
+// Discord posts an embed to a Discord webhook.
+type Discord struct {
+	cfg    DiscordConfig
+	client *http.Client
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Timestamp   string         `json:"timestamp"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordPayload struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+func (d *Discord) Send(ctx context.Context, msg Message) error {
+	embed := discordEmbed{
+		Title:       msg.Title,
+		Description: msg.Body,
+		Timestamp:   msg.Time.Format(time.RFC3339),
+	}
+	for _, k := range sortedFieldKeys(msg.Fields) {
+		if msg.Fields[k] == "" {
+			continue
+		}
+		embed.Fields = append(embed.Fields, discordField{Name: k, Value: msg.Fields[k], Inline: true})
+	}
+
+	username := d.cfg.Username
+	if username == "" {
+		username = "media-reaper"
+	}
+	return postJSON(ctx, d.client, d.cfg.WebhookURL, nil, discordPayload{Username: username, Embeds: []discordEmbed{embed}})
+}
+
+// SlackConfig configures a Slack incoming webhook.
+type SlackConfig struct {
+	WebhookURL string `json:"webhookUrl"`
+}
+
+// Slack posts a message to a Slack incoming webhook.
+type Slack struct {
+	cfg    SlackConfig
+	client *http.Client
+}
+
+func (s *Slack) Send(ctx context.Context, msg Message) error {
+	payload := map[string]string{"text": "*" + msg.Title + "*\n" + msg.Body}
+	return postJSON(ctx, s.client, s.cfg.WebhookURL, nil, payload)
+}
+
+// WebhookConfig configures a generic JSON webhook.
+type WebhookConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Webhook posts the full message as JSON to an arbitrary URL.
+type Webhook struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+type webhookPayload struct {
+	Event     string            `json:"event"`
+	Title     string            `json:"title"`
+	Body      string            `json:"body"`
+	Fields    map[string]string `json:"fields"`
+	Timestamp string            `json:"timestamp"`
+}
+
+func (w *Webhook) Send(ctx context.Context, msg Message) error {
+	return postJSON(ctx, w.client, w.cfg.URL, w.cfg.Headers, webhookPayload{
+		Event:     string(msg.Event),
+		Title:     msg.Title,
+		Body:      msg.Body,
+		Fields:    msg.Fields,
+		Timestamp: msg.Time.Format(time.RFC3339),
+	})
+}
+
+// SMTPConfig configures email delivery. Security is "none", "starttls", or "tls".
+type SMTPConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"` //nolint:gosec // config DTO, not a hardcoded secret
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Security string   `json:"security,omitempty"`
+}
+
+// SMTP sends plain-text email.
+type SMTP struct {
+	cfg SMTPConfig
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	port := s.cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host, MinVersion: tls.VersionTLS12}
+
+	dialer := &net.Dialer{Timeout: defaultTimeout}
+	var conn net.Conn
+	var err error
+	if s.cfg.Security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("starting smtp session: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if s.cfg.Security == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starting tls: %w", err)
+		}
+	}
+
+	if s.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.cfg.From); err != nil {
+		return fmt.Errorf("setting sender: %w", err)
+	}
+	for _, rcpt := range s.cfg.To {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("adding recipient %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("starting message body: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + s.cfg.From + "\r\n")
+	b.WriteString("To: " + strings.Join(s.cfg.To, ", ") + "\r\n")
+	b.WriteString("Subject: " + sanitizeHeader(msg.Title) + "\r\n")
+	b.WriteString("Date: " + msg.Time.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body + "\r\n")
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("writing message body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("finishing message body: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func sanitizeHeader(v string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(v)
+}
+
+// AppriseConfig configures an Apprise API server. Key selects a stateful
+// configuration on the server; otherwise URLs are sent with each request.
+type AppriseConfig struct {
+	URL  string `json:"url"`
+	Key  string `json:"key,omitempty"`
+	URLs string `json:"urls,omitempty"`
+	Tag  string `json:"tag,omitempty"`
+}
+
+// Apprise forwards messages through an Apprise API server.
+type Apprise struct {
+	cfg    AppriseConfig
+	client *http.Client
+}
+
+func (a *Apprise) Send(ctx context.Context, msg Message) error {
+	endpoint := strings.TrimRight(a.cfg.URL, "/") + "/notify/"
+	if a.cfg.Key != "" {
+		endpoint += a.cfg.Key
+	}
+
+	payload := map[string]string{
+		"title": msg.Title,
+		"body":  msg.Body,
+		"type":  "info",
+	}
+	if a.cfg.URLs != "" {
+		payload["urls"] = a.cfg.URLs
+	}
+	if a.cfg.Tag != "" {
+		payload["tag"] = a.cfg.Tag
+	}
+	return postJSON(ctx, a.client, endpoint, nil, payload)
+}
+
+// postJSON sends a JSON payload and treats any non-2xx response as an error.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req) //nolint:gosec // URL is admin-configured provider endpoint, not user input
+	if err != nil {
+		return fmt.Errorf("executing request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+var testMessage = Message{
+	Event:  EventConnectionUnhealthy,
+	Title:  "Connection unhealthy: Sonarr",
+	Body:   "Sonarr (sonarr) failed its health check: timeout",
+	Fields: map[string]string{"connection": "Sonarr", "error": "timeout"},
+	Time:   time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+}
+
+// captureServer records the last JSON body posted to it.
+func captureServer(t *testing.T, status int) (*httptest.Server, *map[string]any, *http.Header) {
+	t.Helper()
+	var body map[string]any
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		headers = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &body, &headers
+}
+
+func buildProvider(t *testing.T, providerType repository.NotificationType, config any) Provider {
+	t.Helper()
+	raw, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("encoding config: %v", err)
+	}
+	p, err := newProvider(providerType, raw, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("newProvider: %v", err)
+	}
+	return p
+}
+
+func TestDiscordSend(t *testing.T) {
+	server, body, _ := captureServer(t, http.StatusNoContent)
+	p := buildProvider(t, repository.NotificationTypeDiscord, DiscordConfig{WebhookURL: server.URL})
+
+	if err := p.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	embeds, ok := (*body)["embeds"].([]any)
+	if !ok || len(embeds) != 1 {
+		t.Fatalf("expected one embed, got %v", (*body)["embeds"])
+	}
+	embed := embeds[0].(map[string]any)
+	if embed["title"] != testMessage.Title {
+		t.Errorf("title: got %v", embed["title"])
+	}
+	if (*body)["username"] != "media-reaper" {
+		t.Errorf("username: got %v", (*body)["username"])
+	}
+}
+
+func TestSlackSend(t *testing.T) {
+	server, body, _ := captureServer(t, http.StatusOK)
+	p := buildProvider(t, repository.NotificationTypeSlack, SlackConfig{WebhookURL: server.URL})
+
+	if err := p.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	text, _ := (*body)["text"].(string)
+	if !strings.Contains(text, testMessage.Title) || !strings.Contains(text, testMessage.Body) {
+		t.Errorf("unexpected text: %q", text)
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	server, body, headers := captureServer(t, http.StatusOK)
+	p := buildProvider(t, repository.NotificationTypeWebhook, WebhookConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer hook-token"},
+	})
+
+	if err := p.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if (*body)["event"] != string(EventConnectionUnhealthy) {
+		t.Errorf("event: got %v", (*body)["event"])
+	}
+	if fields, _ := (*body)["fields"].(map[string]any); fields["error"] != "timeout" {
+		t.Errorf("fields: got %v", (*body)["fields"])
+	}
+	if headers.Get("Authorization") != "Bearer hook-token" {
+		t.Errorf("custom header not sent: %v", *headers)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	server, _, _ := captureServer(t, http.StatusInternalServerError)
+	p := buildProvider(t, repository.NotificationTypeWebhook, WebhookConfig{URL: server.URL})
+
+	if err := p.Send(context.Background(), testMessage); err == nil {
+		t.Error("expected error for non-2xx response")
+	}
+}
+
+func TestAppriseSend(t *testing.T) {
+	var path string
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer server.Close()
+
+	p := buildProvider(t, repository.NotificationTypeApprise, AppriseConfig{URL: server.URL + "/", Key: "reaper", Tag: "admins"})
+	if err := p.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if path != "/notify/reaper" {
+		t.Errorf("path: got %q, want /notify/reaper", path)
+	}
+	if body["tag"] != "admins" || body["title"] != testMessage.Title {
+		t.Errorf("unexpected body: %v", body)
+	}
+}
+
+func TestProviderConfigValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		providerType repository.NotificationType
+		config       string
+	}{
+		{"discord without url", repository.NotificationTypeDiscord, `{}`},
+		{"smtp without recipients", repository.NotificationTypeSMTP, `{"host":"mail","from":"a@b.c"}`},
+		{"apprise without key or urls", repository.NotificationTypeApprise, `{"url":"http://apprise"}`},
+		{"unknown type", "pigeon", `{}`},
+		{"malformed json", repository.NotificationTypeSlack, `{`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newProvider(tt.providerType, []byte(tt.config), http.DefaultClient); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+// fakeSMTPServer accepts a single unauthenticated SMTP session and captures the message data.
+type fakeSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	from     string
+	rcpts    []string
+	data     string
+	done     chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	s := &fakeSMTPServer{listener: l, done: make(chan struct{})}
+	t.Cleanup(func() { _ = l.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP fake")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		upper := strings.ToUpper(cmd)
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.Trim(cmd[len("MAIL FROM:"):], "<> ")
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(cmd[len("RCPT TO:"):], "<> "))
+			s.mu.Unlock()
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var b strings.Builder
+			for {
+				dl, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dl == ".\r\n" {
+					break
+				}
+				b.WriteString(dl)
+			}
+			s.mu.Lock()
+			s.data = b.String()
+			s.mu.Unlock()
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPSend(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, portStr, _ := net.SplitHostPort(server.listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	p := buildProvider(t, repository.NotificationTypeSMTP, SMTPConfig{
+		Host:     host,
+		Port:     port,
+		From:     "reaper@example.com",
+		To:       []string{"admin@example.com", "ops@example.com"},
+		Security: "none",
+	})
+
+	if err := p.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	<-server.done
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.from != "reaper@example.com" {
+		t.Errorf("from: got %q", server.from)
+	}
+	if len(server.rcpts) != 2 {
+		t.Errorf("expected 2 recipients, got %v", server.rcpts)
+	}
+	if !strings.Contains(server.data, "Subject: "+testMessage.Title) {
+		t.Errorf("subject missing from message: %q", server.data)
+	}
+	if !strings.Contains(server.data, testMessage.Body) {
+		t.Errorf("body missing from message: %q", server.data)
+	}
+}
@@ -0,0 +1,408 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/directdelete"
+	"github.com/sydlexius/media-reaper/internal/events"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+var ErrProviderNotFound = errors.New("notification provider not found")
+
+// ProviderInput holds the user-editable fields of a notification provider.
+type ProviderInput struct {
+	Name          string
+	Type          string
+	Config        map[string]any
+	Events        []string
+	TitleTemplate string
+	BodyTemplate  string
+	Enabled       *bool
+}
+
+// deliveryTimeout bounds the background delivery of one event to all of its
+// providers.
+const deliveryTimeout = time.Minute
+
+// Service manages notification providers and dispatches events to them.
+type Service struct {
+	repo      repository.NotificationProviderRepository
+	encryptor *connection.Encryptor
+	client    *http.Client
+	// deliveries tracks events being sent in the background.
+	deliveries sync.WaitGroup
+}
+
+// NewService creates a notification service. Provider configs are encrypted
+// with the same encryptor used for connection API keys.
+func NewService(repo repository.NotificationProviderRepository, encryptor *connection.Encryptor) *Service {
+	return &Service{
+		repo:      repo,
+		encryptor: encryptor,
+		client:    &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// Create validates and stores a new provider.
+func (s *Service) Create(ctx context.Context, in ProviderInput) (*repository.NotificationProvider, error) {
+	p := &repository.NotificationProvider{
+		ID:      uuid.New().String(),
+		Enabled: true,
+	}
+	if err := s.apply(p, in, nil); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, p); err != nil {
+		return nil, fmt.Errorf("creating notification provider: %w", err)
+	}
+	return p, nil
+}
+
+// GetAll returns all providers.
+func (s *Service) GetAll(ctx context.Context) ([]*repository.NotificationProvider, error) {
+	return s.repo.GetAll(ctx)
+}
+
+// GetByID returns a single provider by ID.
+func (s *Service) GetByID(ctx context.Context, id string) (*repository.NotificationProvider, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// Update replaces a provider's settings. Secret config values that are
+// omitted or still masked keep their stored value.
+func (s *Service) Update(ctx context.Context, id string, in ProviderInput) (*repository.NotificationProvider, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching notification provider: %w", err)
+	}
+	if p == nil {
+		return nil, nil
+	}
+
+	var existing map[string]any
+	if repository.NotificationType(in.Type) == p.Type {
+		existing, err = s.decryptConfig(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.apply(p, in, existing); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, p); err != nil {
+		return nil, fmt.Errorf("updating notification provider: %w", err)
+	}
+	return p, nil
+}
+
+// Delete deletes a provider by ID.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// MaskedConfig returns the provider's config with secret values masked.
+func (s *Service) MaskedConfig(p *repository.NotificationProvider) map[string]any {
+	config, err := s.decryptConfig(p)
+	if err != nil {
+		return map[string]any{}
+	}
+	for _, key := range secretFields[p.Type] {
+		if v, ok := config[key]; ok {
+			config[key] = mask(v)
+		}
+	}
+	return config
+}
+
+// Test sends a test message through a saved provider regardless of its subscriptions.
+func (s *Service) Test(ctx context.Context, id string) error {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("fetching notification provider: %w", err)
+	}
+	if p == nil {
+		return ErrProviderNotFound
+	}
+
+	return s.send(ctx, p, Event{
+		Type:   EventTest,
+		Fields: map[string]string{"provider": p.Name},
+	})
+}
+
+// Notify delivers an event to every enabled provider subscribed to it.
+// Delivery failures are logged and returned joined; one failing provider
+// does not stop the others.
+func (s *Service) Notify(ctx context.Context, event Event) error {
+	providers, err := s.repo.GetAllEnabled(ctx)
+	if err != nil {
+		return fmt.Errorf("listing notification providers: %w", err)
+	}
+
+	var errs []error
+	for _, p := range providers {
+		if !slices.Contains(p.Events, string(event.Type)) {
+			continue
+		}
+		if err := s.send(ctx, p, event); err != nil {
+			log.Printf("Notify: %s via %s failed: %v", event.Type, p.Name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver sends an event in the background so a slow provider never holds up
+// whoever published it, such as a health check or a deletion run. The send
+// has its own deadline and is not cancelled with the publisher's context,
+// which may belong to a request that has already finished.
+func (s *Service) deliver(ctx context.Context, event Event) {
+	ctx = context.WithoutCancel(ctx)
+	s.deliveries.Add(1)
+	go func() {
+		defer s.deliveries.Done()
+		ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+		defer cancel()
+		_ = s.Notify(ctx, event)
+	}()
+}
+
+// Wait blocks until every background delivery has finished.
+func (s *Service) Wait() {
+	s.deliveries.Wait()
+}
+
+// Subscribe registers the service's handlers on the internal event bus.
+// Events are delivered in the background.
+func (s *Service) Subscribe(bus *events.Bus) {
+	bus.Subscribe(events.ConnectionStateChanged, s.onConnectionStateChanged)
+	bus.Subscribe(events.DeletionRecorded, s.onDeletionRecorded)
+	bus.Subscribe(events.ItemFlagged, s.onFlagged(EventItemFlagged))
+	bus.Subscribe(events.GraceExpiring, s.onFlagged(EventGraceExpiring))
+}
+
+// onConnectionStateChanged notifies when a connection becomes unhealthy or
+// recovers from being unhealthy. Transitions out of "unknown" into healthy
+// are not worth telling anyone about.
+func (s *Service) onConnectionStateChanged(ctx context.Context, e events.Event) {
+	change, ok := e.Payload.(connection.StateChange)
+	if !ok {
+		return
+	}
+
+	var eventType EventType
+	switch {
+	case change.Current == repository.ConnectionStatusUnhealthy:
+		eventType = EventConnectionUnhealthy
+	case change.Current == repository.ConnectionStatusHealthy && change.Previous == repository.ConnectionStatusUnhealthy:
+		eventType = EventConnectionRecovered
+	default:
+		return
+	}
+
+	s.deliver(ctx, Event{
+		Type: eventType,
+		Fields: map[string]string{
+			"connection": change.Connection.Name,
+			"type":       string(change.Connection.Type),
+			"url":        change.Connection.URL,
+			"error":      change.Reason,
+		},
+	})
+}
+
+func (s *Service) onDeletionRecorded(ctx context.Context, e events.Event) {
+	rec, ok := e.Payload.(*repository.DeletionRecord)
+	if !ok {
+		return
+	}
+
+	s.deliver(ctx, Event{
+		Type: EventDeletionExecuted,
+		Fields: map[string]string{
+			"title":      rec.Title,
+			"mediaType":  string(rec.MediaType),
+			"connection": rec.ConnectionName,
+			"rule":       rec.RuleName,
+			"approvedBy": rec.ApprovedBy,
+			"size":       formatBytes(rec.SizeBytes),
+			"path":       rec.FilePath,
+		},
+	})
+}
+
+// onFlagged notifies about an item flagged for direct deletion, either when
+// it is flagged or when its grace period is about to end.
+func (s *Service) onFlagged(eventType EventType) events.Handler {
+	return func(ctx context.Context, e events.Event) {
+		flagged, ok := e.Payload.(directdelete.Flagged)
+		if !ok {
+			return
+		}
+
+		s.deliver(ctx, Event{
+			Type: eventType,
+			Fields: map[string]string{
+				"title":        flagged.Candidate.ItemName,
+				"connection":   flagged.ConnectionName,
+				"flaggedBy":    flagged.Candidate.FlaggedBy,
+				"actionableAt": flagged.EligibleAt,
+				"size":         formatBytes(flagged.Candidate.SizeBytes),
+				"path":         flagged.Candidate.Path,
+			},
+		})
+	}
+}
+
+func (s *Service) send(ctx context.Context, p *repository.NotificationProvider, event Event) error {
+	config, err := s.encryptor.Decrypt(p.EncryptedConfig)
+	if err != nil {
+		return fmt.Errorf("decrypting provider config: %w", err)
+	}
+
+	provider, err := newProvider(p.Type, []byte(config), s.client)
+	if err != nil {
+		return err
+	}
+
+	msg, err := render(event, p.TitleTemplate, p.BodyTemplate)
+	if err != nil {
+		return err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	return provider.Send(sendCtx, msg)
+}
+
+// apply validates input and copies it onto p, merging masked secrets from existing.
+func (s *Service) apply(p *repository.NotificationProvider, in ProviderInput, existing map[string]any) error {
+	if in.Name == "" || in.Type == "" {
+		return fmt.Errorf("%w: name and type are required", ErrInvalidConfig)
+	}
+	providerType := repository.NotificationType(in.Type)
+	if _, ok := secretFields[providerType]; !ok {
+		return fmt.Errorf("%w: type must be discord, slack, webhook, smtp, or apprise", ErrInvalidConfig)
+	}
+
+	for _, e := range in.Events {
+		if !isKnownEvent(e) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidConfig, e)
+		}
+	}
+	for _, t := range []string{in.TitleTemplate, in.BodyTemplate} {
+		if err := validateTemplate(t); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+
+	config := in.Config
+	if config == nil {
+		config = map[string]any{}
+	}
+	for _, key := range secretFields[providerType] {
+		if old, ok := existing[key]; ok {
+			if v, present := config[key]; !present || isMasked(v) {
+				config[key] = old
+			}
+		}
+	}
+
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("encoding provider config: %w", err)
+	}
+	if _, err := newProvider(providerType, raw, s.client); err != nil {
+		return err
+	}
+
+	encrypted, err := s.encryptor.Encrypt(string(raw))
+	if err != nil {
+		return fmt.Errorf("encrypting provider config: %w", err)
+	}
+
+	p.Name = in.Name
+	p.Type = providerType
+	p.EncryptedConfig = encrypted
+	p.Events = in.Events
+	p.TitleTemplate = in.TitleTemplate
+	p.BodyTemplate = in.BodyTemplate
+	if in.Enabled != nil {
+		p.Enabled = *in.Enabled
+	}
+	return nil
+}
+
+func (s *Service) decryptConfig(p *repository.NotificationProvider) (map[string]any, error) {
+	plain, err := s.encryptor.Decrypt(p.EncryptedConfig)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting provider config: %w", err)
+	}
+	var config map[string]any
+	if err := json.Unmarshal([]byte(plain), &config); err != nil {
+		return nil, fmt.Errorf("decoding provider config: %w", err)
+	}
+	return config, nil
+}
+
+// mask hides a secret config value, keeping the last 4 characters of strings.
+func mask(v any) any {
+	switch val := v.(type) {
+	case string:
+		if len(val) < 8 {
+			return "****"
+		}
+		return "****" + val[len(val)-4:]
+	case map[string]any:
+		masked := make(map[string]any, len(val))
+		for k := range val {
+			masked[k] = "****"
+		}
+		return masked
+	default:
+		return "****"
+	}
+}
+
+func isMasked(v any) bool {
+	switch val := v.(type) {
+	case string:
+		return strings.HasPrefix(val, "****")
+	case map[string]any:
+		for _, inner := range val {
+			if s, ok := inner.(string); !ok || !strings.HasPrefix(s, "****") {
+				return false
+			}
+		}
+		return len(val) > 0
+	}
+	return false
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+	srv := oidctest.NewServer("media-reaper")
+	t.Cleanup(srv.Close)
+	p := NewProvider(Config{
+		Issuer:      srv.Issuer(),
+		ClientID:    "media-reaper",
+		RedirectURL: "http://localhost:8080/api/auth/oidc/callback",
+	}, srv.Client())
+	return p, srv
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	p, srv := newTestProvider(t)
+	ctx := context.Background()
+	srv.SetUser(map[string]any{"sub": "user-1", "preferred_username": "alice", "groups": []string{"media"}})
+
+	verifier, _ := RandomString()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if !strings.Contains(authURL, "code_challenge="+Challenge(verifier)) || !strings.Contains(authURL, "code_challenge_method=S256") {
+		t.Fatalf("auth URL missing PKCE challenge: %s", authURL)
+	}
+
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	_ = resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing redirect: %v", err)
+	}
+	if loc.Query().Get("state") != "state-1" {
+		t.Errorf("state not echoed: %s", loc)
+	}
+	code := loc.Query().Get("code")
+
+	if _, err := p.Exchange(ctx, code, "wrong-verifier", "nonce-1"); !errors.Is(err, ErrTokenExchange) {
+		t.Errorf("expected PKCE failure with wrong verifier, got %v", err)
+	}
+
+	// The failed attempt consumed the code, so authorize again.
+	resp, err = client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	_ = resp.Body.Close()
+	loc, _ = url.Parse(resp.Header.Get("Location"))
+
+	claims, err := p.Exchange(ctx, loc.Query().Get("code"), verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.String("sub") != "user-1" || claims.String("preferred_username") != "alice" {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+	if groups := claims.Strings("groups"); len(groups) != 1 || groups[0] != "media" {
+		t.Errorf("unexpected groups: %v", groups)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p, srv := newTestProvider(t)
+	other := oidctest.NewServer("media-reaper")
+	defer other.Close()
+
+	tests := []struct {
+		name  string
+		token func() string
+		nonce string
+		ok    bool
+	}{
+		{name: "valid", nonce: "n", ok: true, token: func() string {
+			return srv.Sign(srv.IDTokenClaims("n", map[string]any{"sub": "u"}))
+		}},
+		{name: "nonce mismatch", nonce: "expected", token: func() string {
+			return srv.Sign(srv.IDTokenClaims("other", map[string]any{"sub": "u"}))
+		}},
+		{name: "wrong audience", nonce: "n", token: func() string {
+			return srv.Sign(srv.IDTokenClaims("n", map[string]any{"sub": "u", "aud": "someone-else"}))
+		}},
+		{name: "wrong issuer", nonce: "n", token: func() string {
+			return srv.Sign(srv.IDTokenClaims("n", map[string]any{"sub": "u", "iss": "https://evil.example"}))
+		}},
+		{name: "expired", nonce: "n", token: func() string {
+			return srv.Sign(srv.IDTokenClaims("n", map[string]any{"sub": "u", "exp": time.Now().Add(-time.Hour).Unix()}))
+		}},
+		{name: "signed by another key", nonce: "n", token: func() string {
+			return other.Sign(srv.IDTokenClaims("n", map[string]any{"sub": "u"}))
+		}},
+		{name: "missing sub", nonce: "n", token: func() string {
+			return srv.Sign(srv.IDTokenClaims("n", nil))
+		}},
+		{name: "malformed", nonce: "n", token: func() string { return "not-a-jwt" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Verify(context.Background(), tt.token(), tt.nonce)
+			if tt.ok && err != nil {
+				t.Fatalf("expected valid token, got %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	srv := oidctest.NewServer("media-reaper")
+	defer srv.Close()
+
+	p := NewProvider(Config{Issuer: srv.Issuer() + "/realms/other", ClientID: "media-reaper"}, srv.Client())
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); !errors.Is(err, ErrDiscovery) {
+		t.Errorf("expected ErrDiscovery, got %v", err)
+	}
+}
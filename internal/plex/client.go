@@ -0,0 +1,307 @@
+package plex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/mediaserver/restclient"
+)
+
+const (
+	pageSize = 200
+
+	// ownerAccountID is the account of the Plex server's owner.
+	ownerAccountID = 1
+)
+
+var _ mediaserver.Server = (*Client)(nil)
+
+// itemTypes maps Emby item type names, which media-reaper uses throughout,
+// to Plex metadata type numbers.
+var itemTypes = map[string]int{
+	"Movie":       1,
+	"Series":      2,
+	"Season":      3,
+	"Episode":     4,
+	"MusicArtist": 8,
+	"MusicAlbum":  9,
+	"Audio":       10,
+}
+
+var plexTypeNames = map[string]string{
+	"movie":   "Movie",
+	"show":    "Series",
+	"season":  "Season",
+	"episode": "Episode",
+	"artist":  "MusicArtist",
+	"album":   "MusicAlbum",
+	"track":   "Audio",
+}
+
+// sectionItemTypes lists the metadata types each kind of section holds.
+var sectionItemTypes = map[string][]int{
+	"movie":  {1},
+	"show":   {2, 3, 4},
+	"artist": {8, 9, 10},
+}
+
+var collectionTypes = map[string]string{
+	"movie":  "movies",
+	"show":   "tvshows",
+	"artist": "music",
+	"photo":  "photos",
+}
+
+// Client provides access to the Plex Media Server API. Failed requests
+// return a *restclient.StatusError; server errors, rate limiting, and
+// network failures are retried first.
+type Client struct {
+	rest *restclient.Client
+}
+
+// New creates a Plex API client authenticated with an X-Plex-Token.
+func New(baseURL, token string) *Client {
+	return &Client{
+		rest: restclient.New("plex", baseURL, func(req *http.Request) {
+			req.Header.Set("X-Plex-Token", token)
+			req.Header.Set("X-Plex-Client-Identifier", "media-reaper")
+			req.Header.Set("X-Plex-Product", "media-reaper")
+		}),
+	}
+}
+
+// TestConnection verifies connectivity and the token by fetching server info.
+// It makes a single attempt, since health checks schedule their own retries.
+func (c *Client) TestConnection(ctx context.Context) (*mediaserver.SystemInfo, error) {
+	var resp mediaContainer[serverInfo]
+	if err := c.rest.Once(ctx, http.MethodGet, "/", nil, &resp); err != nil {
+		return nil, fmt.Errorf("plex connection test failed: %w", err)
+	}
+	info := resp.MediaContainer
+	return &mediaserver.SystemInfo{
+		ServerName: info.FriendlyName,
+		Version:    info.Version,
+		ID:         info.MachineIdentifier,
+	}, nil
+}
+
+// GetAccounts returns the accounts known to the server.
+func (c *Client) GetAccounts(ctx context.Context) ([]Account, error) {
+	var resp mediaContainer[accountList]
+	if err := c.rest.Get(ctx, "/accounts", nil, &resp); err != nil {
+		return nil, fmt.Errorf("getting accounts: %w", err)
+	}
+	return resp.MediaContainer.Account, nil
+}
+
+// GetUsers returns the server's accounts as users, so Plex accounts can be
+// tracked like Emby users. The server owner is reported as an administrator.
+func (c *Client) GetUsers(ctx context.Context) ([]*mediaserver.User, error) {
+	accounts, err := c.GetAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*mediaserver.User, 0, len(accounts))
+	for _, a := range accounts {
+		// Account 0 is the server itself and has no name.
+		if a.Name == "" {
+			continue
+		}
+		users = append(users, &mediaserver.User{
+			ID:     strconv.FormatInt(a.ID, 10),
+			Name:   a.Name,
+			Policy: &mediaserver.UserPolicy{IsAdministrator: a.ID == ownerAccountID, EnableAllFolders: true},
+		})
+	}
+	return users, nil
+}
+
+// GetSections returns all library sections.
+func (c *Client) GetSections(ctx context.Context) ([]Section, error) {
+	var resp mediaContainer[sectionList]
+	if err := c.rest.Get(ctx, "/library/sections", nil, &resp); err != nil {
+		return nil, fmt.Errorf("getting library sections: %w", err)
+	}
+	return resp.MediaContainer.Directory, nil
+}
+
+// GetLibraries returns all library sections as libraries.
+func (c *Client) GetLibraries(ctx context.Context) ([]mediaserver.Library, error) {
+	sections, err := c.GetSections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	libs := make([]mediaserver.Library, len(sections))
+	for i, s := range sections {
+		libs[i] = mediaserver.Library{ID: s.Key, Name: s.Title, CollectionType: collectionTypes[s.Type]}
+	}
+	return libs, nil
+}
+
+// GetSectionItems returns every item in a section, optionally only those of
+// a Plex metadata type. A type of 0 returns the section's top-level items.
+func (c *Client) GetSectionItems(ctx context.Context, sectionKey string, plexType int) ([]Metadata, error) {
+	qp := map[string]string{"includeGuids": "1"}
+	if plexType != 0 {
+		qp["type"] = strconv.Itoa(plexType)
+	}
+
+	var items []Metadata
+	for start := 0; ; start += pageSize {
+		qp["X-Plex-Container-Start"] = strconv.Itoa(start)
+		qp["X-Plex-Container-Size"] = strconv.Itoa(pageSize)
+
+		var resp mediaContainer[metadataList]
+		if err := c.rest.Get(ctx, "/library/sections/"+sectionKey+"/all", qp, &resp); err != nil {
+			return nil, fmt.Errorf("getting section items: %w", err)
+		}
+		page := resp.MediaContainer
+		items = append(items, page.Metadata...)
+		if len(page.Metadata) < pageSize || (page.TotalSize > 0 && len(items) >= page.TotalSize) {
+			return items, nil
+		}
+	}
+}
+
+// GetWatchHistory returns every play recorded for an account, newest first.
+func (c *Client) GetWatchHistory(ctx context.Context, accountID string) ([]HistoryEntry, error) {
+	qp := map[string]string{"accountID": accountID, "sort": "viewedAt:desc"}
+
+	var entries []HistoryEntry
+	for start := 0; ; start += pageSize {
+		qp["X-Plex-Container-Start"] = strconv.Itoa(start)
+		qp["X-Plex-Container-Size"] = strconv.Itoa(pageSize)
+
+		var resp mediaContainer[historyList]
+		if err := c.rest.Get(ctx, "/status/sessions/history/all", qp, &resp); err != nil {
+			return nil, fmt.Errorf("getting watch history: %w", err)
+		}
+		entries = append(entries, resp.MediaContainer.Metadata...)
+		if len(resp.MediaContainer.Metadata) < pageSize {
+			return entries, nil
+		}
+	}
+}
+
+// GetUserItems returns library items with play state taken from the
+// account's watch history, so Plex accounts look like Emby users to callers.
+// userID is a Plex account ID. Plex only reports play state for the token's
+// own account, which is why history is used instead.
+//
+// ParentID selects a section; without it every section is searched.
+// IncludeTypes takes Emby type names such as "Movie,Episode". IsPlayed is
+// applied after the merge. Since every call reads whole sections and the
+// whole history, all matching items come back in one page: StartIndex,
+// Limit, and SortBy are ignored and TotalRecordCount is len(Items), so
+// callers paging through the results stop after the first call.
+func (c *Client) GetUserItems(ctx context.Context, userID string, params *mediaserver.ItemQuery) (*mediaserver.ItemsResult, error) {
+	if params == nil {
+		params = &mediaserver.ItemQuery{}
+	}
+
+	sections, err := c.GetSections(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting user items: %w", err)
+	}
+	var types []int
+	for _, name := range strings.Split(params.IncludeTypes, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		t, ok := itemTypes[name]
+		if !ok {
+			return nil, fmt.Errorf("getting user items: unsupported item type %q", name)
+		}
+		types = append(types, t)
+	}
+
+	var items []Metadata
+	for _, section := range sections {
+		if params.ParentID != "" && section.Key != params.ParentID {
+			continue
+		}
+		sectionTypes := []int{0}
+		if len(types) > 0 {
+			sectionTypes = intersect(types, sectionItemTypes[section.Type])
+		}
+		for _, t := range sectionTypes {
+			found, err := c.GetSectionItems(ctx, section.Key, t)
+			if err != nil {
+				return nil, fmt.Errorf("getting user items: %w", err)
+			}
+			items = append(items, found...)
+		}
+	}
+
+	history, err := c.GetWatchHistory(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting user items: %w", err)
+	}
+	plays := make(map[string]*mediaserver.UserData)
+	for _, h := range history {
+		data := plays[h.RatingKey]
+		if data == nil {
+			// History is newest first, so the first entry is the last play.
+			data = &mediaserver.UserData{
+				Played:         true,
+				LastPlayedDate: time.Unix(h.ViewedAt, 0).UTC().Format(time.RFC3339),
+			}
+			plays[h.RatingKey] = data
+		}
+		data.PlayCount++
+	}
+
+	result := &mediaserver.ItemsResult{Items: []*mediaserver.Item{}}
+	for i := range items {
+		item := toItem(&items[i], plays[items[i].RatingKey])
+		if params.IsPlayed != nil && item.UserData.Played != *params.IsPlayed {
+			continue
+		}
+		result.Items = append(result.Items, item)
+	}
+	result.TotalRecordCount = len(result.Items)
+	return result, nil
+}
+
+func toItem(m *Metadata, data *mediaserver.UserData) *mediaserver.Item {
+	if data == nil {
+		data = &mediaserver.UserData{}
+	}
+	item := &mediaserver.Item{
+		ID:                m.RatingKey,
+		Name:              m.Title,
+		Type:              plexTypeNames[m.Type],
+		IndexNumber:       m.Index,
+		ParentIndexNumber: m.ParentIndex,
+		ProviderIDs:       ParseGUIDs(m),
+		UserData:          data,
+	}
+	switch m.Type {
+	case "episode":
+		item.SeriesName = m.GrandparentTitle
+		item.SeasonName = m.ParentTitle
+	case "season":
+		item.SeriesName = m.ParentTitle
+	}
+	if len(m.Media) > 0 && len(m.Media[0].Part) > 0 {
+		item.Path = m.Media[0].Part[0].File
+	}
+	return item
+}
+
+func intersect(a, b []int) []int {
+	var out []int
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				out = append(out, x)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,267 @@
+package plex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/mediaserver/restclient"
+)
+
+// fixtures maps requests to responses recorded from a Plex Media Server.
+// Keys are the path, plus the type or accountID query parameter if present.
+var fixtures = map[string]string{
+	"/":                                  "identity.json",
+	"/accounts":                          "accounts.json",
+	"/library/sections":                  "sections.json",
+	"/library/sections/1/all?1":          "section_1_movies.json",
+	"/library/sections/2/all?4":          "section_2_episodes.json",
+	"/status/sessions/history/all?52314": "history_52314.json",
+}
+
+func newFixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Plex-Token") != "test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		key := r.URL.Path
+		q := r.URL.Query()
+		if v := q.Get("type") + q.Get("accountID"); v != "" {
+			key += "?" + v
+		}
+		name, ok := fixtures[key]
+		if !ok {
+			t.Errorf("unexpected request: %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("reading fixture: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTestConnection(t *testing.T) {
+	server := newFixtureServer(t)
+
+	info, err := New(server.URL+"/", "test-token").TestConnection(context.Background())
+	if err != nil {
+		t.Fatalf("TestConnection failed: %v", err)
+	}
+	if info.ServerName != "Den" || info.Version != "1.41.3.9314-a0bfb8370" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	if _, err := New(server.URL, "bad-token").TestConnection(context.Background()); !errors.Is(err, restclient.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized for a bad token, got %v", err)
+	}
+}
+
+func TestGetUsers(t *testing.T) {
+	server := newFixtureServer(t)
+
+	users, err := New(server.URL, "test-token").GetUsers(context.Background())
+	if err != nil {
+		t.Fatalf("GetUsers failed: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users without the system account, got %d", len(users))
+	}
+	if users[0].Name != "owner" || !users[0].Policy.IsAdministrator {
+		t.Errorf("expected the owner to be an administrator, got %+v", users[0])
+	}
+	if users[1].ID != "52314" || users[1].Policy.IsAdministrator {
+		t.Errorf("unexpected user: %+v", users[1])
+	}
+}
+
+func TestGetLibraries(t *testing.T) {
+	server := newFixtureServer(t)
+
+	libs, err := New(server.URL, "test-token").GetLibraries(context.Background())
+	if err != nil {
+		t.Fatalf("GetLibraries failed: %v", err)
+	}
+	want := []mediaserver.Library{
+		{ID: "1", Name: "Movies", CollectionType: "movies"},
+		{ID: "2", Name: "TV Shows", CollectionType: "tvshows"},
+		{ID: "3", Name: "Photos", CollectionType: "photos"},
+	}
+	if len(libs) != len(want) {
+		t.Fatalf("expected %d libraries, got %d", len(want), len(libs))
+	}
+	for i := range want {
+		if libs[i] != want[i] {
+			t.Errorf("library %d: expected %+v, got %+v", i, want[i], libs[i])
+		}
+	}
+}
+
+func TestGetUserItems(t *testing.T) {
+	server := newFixtureServer(t)
+	var client mediaserver.Server = New(server.URL, "test-token")
+
+	result, err := client.GetUserItems(context.Background(), "52314", &mediaserver.ItemQuery{
+		IncludeTypes: "Movie,Episode",
+		Recursive:    true,
+	})
+	if err != nil {
+		t.Fatalf("GetUserItems failed: %v", err)
+	}
+	if result.TotalRecordCount != 4 {
+		t.Fatalf("expected 4 items, got %d", result.TotalRecordCount)
+	}
+
+	matrix := result.Items[0]
+	if matrix.Type != "Movie" || matrix.ProviderIDs.TMDB != "603" || matrix.ProviderIDs.IMDB != "tt0133093" {
+		t.Errorf("unexpected movie: %+v", matrix)
+	}
+	if matrix.Path != "/data/movies/The Matrix (1999)/The Matrix (1999).mkv" {
+		t.Errorf("unexpected path %q", matrix.Path)
+	}
+	if !matrix.UserData.Played || matrix.UserData.PlayCount != 2 || matrix.UserData.LastPlayedDate != "2024-05-01T12:00:00Z" {
+		t.Errorf("expected two plays, the latest on 2024-05-01, got %+v", matrix.UserData)
+	}
+
+	pilot := result.Items[2]
+	if pilot.Type != "Episode" || pilot.SeriesName != "Breaking Bad" || *pilot.ParentIndexNumber != 1 || *pilot.IndexNumber != 1 {
+		t.Errorf("unexpected episode: %+v", pilot)
+	}
+
+	played := false
+	unplayed, err := client.GetUserItems(context.Background(), "52314", &mediaserver.ItemQuery{
+		ParentID:     "1",
+		IncludeTypes: "Movie",
+		IsPlayed:     &played,
+		Limit:        10,
+	})
+	if err != nil {
+		t.Fatalf("GetUserItems failed: %v", err)
+	}
+	if unplayed.TotalRecordCount != 1 || unplayed.Items[0].Name != "The Shawshank Redemption" {
+		t.Errorf("expected only the unplayed movie, got %+v", unplayed.Items)
+	}
+}
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	hits int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.hits++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGetUserItemsOnePage(t *testing.T) {
+	server := newFixtureServer(t)
+	client := New(server.URL, "test-token")
+	transport := &countingTransport{}
+	client.rest.HTTPClient = &http.Client{Transport: transport}
+
+	// Page the way callers do. The sections, their items, and the history
+	// are each read once, however small the page.
+	query := &mediaserver.ItemQuery{IncludeTypes: "Movie,Episode", Recursive: true, Limit: 1}
+	var items []*mediaserver.Item
+	for {
+		page, err := client.GetUserItems(context.Background(), "52314", query)
+		if err != nil {
+			t.Fatalf("GetUserItems failed: %v", err)
+		}
+		items = append(items, page.Items...)
+		query.StartIndex += len(page.Items)
+		if len(page.Items) < query.Limit || query.StartIndex >= page.TotalRecordCount {
+			break
+		}
+	}
+	if len(items) != 4 {
+		t.Fatalf("expected 4 items, got %d", len(items))
+	}
+	if transport.hits != 4 {
+		t.Errorf("expected 4 requests, got %d", transport.hits)
+	}
+}
+
+func TestGetRetriesServerErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+	client := New(server.URL, "test-token")
+	client.rest.RetryDelay = time.Millisecond
+
+	_, err := client.GetSections(context.Background())
+	var statusErr *restclient.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Server != "plex" || !errors.Is(err, restclient.ErrNotFound) {
+		t.Fatalf("expected a plex 404 StatusError, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected one retry, got %d calls", calls)
+	}
+}
+
+func TestParseGUIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		item Metadata
+		want mediaserver.Providers
+	}{
+		{
+			name: "current agents",
+			item: Metadata{
+				GUID:  "plex://movie/5d7768258718ba001e311f10",
+				GUIDs: []GUID{{ID: "imdb://tt0133093"}, {ID: "tmdb://603"}, {ID: "tvdb://169"}},
+			},
+			want: mediaserver.Providers{TMDB: "603", TVDB: "169", IMDB: "tt0133093"},
+		},
+		{
+			name: "legacy imdb agent",
+			item: Metadata{GUID: "com.plexapp.agents.imdb://tt0111161?lang=en"},
+			want: mediaserver.Providers{IMDB: "tt0111161"},
+		},
+		{
+			name: "legacy themoviedb agent",
+			item: Metadata{GUID: "com.plexapp.agents.themoviedb://278?lang=en"},
+			want: mediaserver.Providers{TMDB: "278"},
+		},
+		{
+			name: "legacy tvdb series",
+			item: Metadata{GUID: "com.plexapp.agents.thetvdb://81189?lang=en"},
+			want: mediaserver.Providers{TVDB: "81189"},
+		},
+		{
+			name: "legacy tvdb episode has no ID of its own",
+			item: Metadata{GUID: "com.plexapp.agents.thetvdb://81189/1/2?lang=en"},
+			want: mediaserver.Providers{},
+		},
+		{
+			name: "local media",
+			item: Metadata{GUID: "local://12345"},
+			want: mediaserver.Providers{},
+		},
+	}
+	for _, tt := range tests {
+		if got := ParseGUIDs(&tt.item); got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
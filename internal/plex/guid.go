@@ -0,0 +1,50 @@
+package plex
+
+import (
+	"strings"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+)
+
+// ParseGUIDs extracts TMDB, TVDB and IMDb IDs from a Plex item. Items
+// matched by the current Plex agents list them in Guid as "tmdb://603";
+// items from the legacy agents only have a single guid such as
+// "com.plexapp.agents.imdb://tt0133093?lang=en".
+func ParseGUIDs(item *Metadata) mediaserver.Providers {
+	var p mediaserver.Providers
+	for _, g := range item.GUIDs {
+		setProvider(&p, g.ID)
+	}
+	if item.GUID != "" {
+		setProvider(&p, item.GUID)
+	}
+	return p
+}
+
+func setProvider(p *mediaserver.Providers, guid string) {
+	scheme, id, ok := strings.Cut(guid, "://")
+	if !ok {
+		return
+	}
+	id, _, _ = strings.Cut(id, "?")
+	// Legacy TV agents give episodes their series ID followed by season and
+	// episode, as in "thetvdb://81189/1/2", which is not the episode's own ID.
+	if id == "" || strings.Contains(id, "/") {
+		return
+	}
+
+	var dst *string
+	switch scheme {
+	case "tmdb", "com.plexapp.agents.themoviedb":
+		dst = &p.TMDB
+	case "tvdb", "com.plexapp.agents.thetvdb":
+		dst = &p.TVDB
+	case "imdb", "com.plexapp.agents.imdb":
+		dst = &p.IMDB
+	default:
+		return
+	}
+	if *dst == "" {
+		*dst = id
+	}
+}
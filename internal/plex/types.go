@@ -0,0 +1,85 @@
+package plex
+
+// mediaContainer is the envelope Plex wraps every JSON response in.
+type mediaContainer[T any] struct {
+	MediaContainer T `json:"MediaContainer"`
+}
+
+// serverInfo is the response from GET /.
+type serverInfo struct {
+	FriendlyName      string `json:"friendlyName"`
+	MachineIdentifier string `json:"machineIdentifier"`
+	Version           string `json:"version"`
+}
+
+// Account is a Plex account known to the server. Account 1 is the server
+// owner.
+type Account struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type accountList struct {
+	Account []Account `json:"Account"`
+}
+
+// Section is a Plex library section.
+type Section struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+type sectionList struct {
+	Directory []Section `json:"Directory"`
+}
+
+// Metadata is a Plex library item.
+type Metadata struct {
+	RatingKey        string  `json:"ratingKey"`
+	Type             string  `json:"type"`
+	Title            string  `json:"title"`
+	GrandparentTitle string  `json:"grandparentTitle,omitempty"`
+	ParentTitle      string  `json:"parentTitle,omitempty"`
+	Index            *int    `json:"index,omitempty"`
+	ParentIndex      *int    `json:"parentIndex,omitempty"`
+	GUID             string  `json:"guid,omitempty"`
+	GUIDs            []GUID  `json:"Guid,omitempty"`
+	Media            []Media `json:"Media,omitempty"`
+}
+
+// GUID is an external ID such as "tmdb://603".
+type GUID struct {
+	ID string `json:"id"`
+}
+
+// Media is one version of a library item.
+type Media struct {
+	Part []Part `json:"Part"`
+}
+
+// Part is a file belonging to a media version.
+type Part struct {
+	File string `json:"file"`
+}
+
+type metadataList struct {
+	TotalSize int        `json:"totalSize"`
+	Size      int        `json:"size"`
+	Metadata  []Metadata `json:"Metadata"`
+}
+
+// HistoryEntry is a single play recorded by Plex.
+type HistoryEntry struct {
+	RatingKey string `json:"ratingKey"`
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+	AccountID int64  `json:"accountID"`
+	// ViewedAt is a Unix timestamp.
+	ViewedAt int64 `json:"viewedAt"`
+}
+
+type historyList struct {
+	Size     int            `json:"size"`
+	Metadata []HistoryEntry `json:"Metadata"`
+}
@@ -2,28 +2,207 @@ package repository
 
 import "context"
 
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// Auth providers a user can be linked to. Local users log in with a
+// password; others are provisioned and authenticated by the provider.
+const (
+	AuthProviderLocal = "local"
+	AuthProviderOIDC  = "oidc"
+	AuthProviderEmby  = "emby"
+)
+
 type User struct {
-	ID           string
-	Username     string
-	PasswordHash string
-	Role         string
-	CreatedAt    string
-	UpdatedAt    string
+	ID                 string
+	Username           string
+	PasswordHash       string
+	Role               string
+	Disabled           bool
+	MustChangePassword bool
+	AuthProvider       string
+	// ExternalID is the user's ID at AuthProvider, empty for local users.
+	ExternalID string
+	CreatedAt  string
+	UpdatedAt  string
+}
+
+// EmbyUserID returns the Emby user ID of a user who signs in with Emby, or an
+// empty string for anyone else.
+func (u *User) EmbyUserID() string {
+	if u.AuthProvider != AuthProviderEmby {
+		return ""
+	}
+	return u.ExternalID
 }
 
 type UserRepository interface {
 	Create(ctx context.Context, user *User) error
 	GetByUsername(ctx context.Context, username string) (*User, error)
 	GetByID(ctx context.Context, id string) (*User, error)
+	GetByExternalID(ctx context.Context, provider, externalID string) (*User, error)
+	GetAll(ctx context.Context) ([]*User, error)
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id string) error
 	Count(ctx context.Context) (int, error)
+	// CountActiveAdmins counts admins that are not disabled.
+	CountActiveAdmins(ctx context.Context) (int, error)
+}
+
+// Session is a server-side login session. The cookie carries a random token;
+// only its SHA-256 hash is stored.
+type Session struct {
+	ID         string
+	UserID     string
+	TokenHash  string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  string
+	LastSeenAt string
+	ExpiresAt  string
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *Session) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (*Session, error)
+	ListByUser(ctx context.Context, userID string) ([]*Session, error)
+	Touch(ctx context.Context, id, lastSeenAt string) error
+	Delete(ctx context.Context, id string) error
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+	// DeleteExpired removes sessions past their absolute expiry or last seen
+	// before idleBefore.
+	DeleteExpired(ctx context.Context, now, idleBefore string) (int64, error)
+}
+
+// APIToken is a user-issued token for scripts. Only the SHA-256 hash of the
+// token is stored; Prefix is kept so users can tell tokens apart.
+type APIToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	TokenHash  string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  string
+	ExpiresAt  *string // nil for tokens that never expire
+	LastUsedAt *string
+}
+
+type APITokenRepository interface {
+	Create(ctx context.Context, token *APIToken) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (*APIToken, error)
+	ListByUser(ctx context.Context, userID string) ([]*APIToken, error)
+	Touch(ctx context.Context, id, lastUsedAt string) error
+	// Delete removes a user's token and reports whether it existed.
+	Delete(ctx context.Context, userID, id string) (bool, error)
+}
+
+// TOTP is a user's authenticator app enrollment. The secret is encrypted
+// with the master key; recovery codes are stored as SHA-256 hashes.
+type TOTP struct {
+	UserID          string
+	EncryptedSecret string
+	// Enabled is false until the user confirms a first code.
+	Enabled bool
+	// LastStep is the most recent time step accepted, so a code cannot be
+	// used twice.
+	LastStep      int64
+	RecoveryCodes []string
+}
+
+type TOTPRepository interface {
+	Get(ctx context.Context, userID string) (*TOTP, error)
+	// Save creates or replaces the enrollment.
+	Save(ctx context.Context, totp *TOTP) error
+	Delete(ctx context.Context, userID string) error
+	// AdvanceStep records step as used if it is newer than the last one, and
+	// reports whether it was.
+	AdvanceStep(ctx context.Context, userID string, step int64) (bool, error)
+	// ReplaceRecoveryCodes swaps the stored codes only if they still equal
+	// old, so a code cannot be spent twice by concurrent logins.
+	ReplaceRecoveryCodes(ctx context.Context, userID string, old, codes []string) (bool, error)
+}
+
+// Reasons recorded for failed login attempts.
+const (
+	LoginFailureInvalidCredentials = "invalid_credentials"
+	LoginFailureInvalidMFACode     = "invalid_mfa_code"
+	LoginFailureLocked             = "locked"
+)
+
+// LoginAttempt is one entry in the login audit log.
+type LoginAttempt struct {
+	ID        int64
+	Username  string
+	UserID    *string
+	IPAddress string
+	UserAgent string
+	Success   bool
+	Reason    string
+	CreatedAt string
+}
+
+// LoginAttemptFilter narrows a login audit listing. Zero values match everything.
+type LoginAttemptFilter struct {
+	Username   string
+	FailedOnly bool
+	Limit      int
+}
+
+// LoginLockout tracks consecutive failed logins for a username.
+type LoginLockout struct {
+	Username     string
+	FailedCount  int
+	LockedUntil  *string
+	LastFailedAt string
+}
+
+type LoginAttemptRepository interface {
+	Record(ctx context.Context, attempt *LoginAttempt) error
+	List(ctx context.Context, filter LoginAttemptFilter) ([]*LoginAttempt, error)
+	DeleteBefore(ctx context.Context, before string) (int64, error)
+	// TrimUnknownUser deletes all but the newest keep failed logins from
+	// ipAddress that are not linked to a user and failed with reason.
+	TrimUnknownUser(ctx context.Context, ipAddress, reason string, keep int) (int64, error)
+	GetLockout(ctx context.Context, username string) (*LoginLockout, error)
+	// ListLocked returns lockouts still in force at now.
+	ListLocked(ctx context.Context, now string) ([]*LoginLockout, error)
+	// RecordFailure counts a failed login at failedAt and returns the number
+	// of consecutive failures. Failures before resetBefore are forgotten.
+	RecordFailure(ctx context.Context, username, failedAt, resetBefore string) (int, error)
+	SetLockedUntil(ctx context.Context, username, lockedUntil string) error
+	// ClearLockout forgets username's failures and reports whether any were
+	// recorded.
+	ClearLockout(ctx context.Context, username string) (bool, error)
+	// DeleteStaleLockouts forgets usernames that are not locked at now and
+	// have not failed since resetBefore.
+	DeleteStaleLockouts(ctx context.Context, now, resetBefore string) (int64, error)
+}
+
+// Keys for application settings changed at runtime.
+const (
+	SettingRequireAdminMFA = "require_admin_mfa"
+)
+
+type SettingsRepository interface {
+	// Get returns the value of key, or "" if it is not set.
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string) error
 }
 
 type ConnectionType string
 
 const (
-	ConnectionTypeSonarr ConnectionType = "sonarr"
-	ConnectionTypeRadarr ConnectionType = "radarr"
-	ConnectionTypeEmby   ConnectionType = "emby"
+	ConnectionTypeSonarr   ConnectionType = "sonarr"
+	ConnectionTypeRadarr   ConnectionType = "radarr"
+	ConnectionTypeLidarr   ConnectionType = "lidarr"
+	ConnectionTypeReadarr  ConnectionType = "readarr"
+	ConnectionTypeEmby     ConnectionType = "emby"
+	ConnectionTypeJellyfin ConnectionType = "jellyfin"
+	ConnectionTypePlex     ConnectionType = "plex"
 )
 
 type ConnectionStatus string
@@ -43,8 +222,24 @@ type Connection struct {
 	Enabled         bool
 	Status          ConnectionStatus
 	LastCheckedAt   *string
-	CreatedAt       string
-	UpdatedAt       string
+	// CheckIntervalSeconds of 0 means the global health check interval applies.
+	CheckIntervalSeconds int
+	CheckTimeoutSeconds  int
+	ConsecutiveFailures  int
+	NextCheckAt          *string
+	// AllowDirectDelete permits deleting items on the media server itself
+	// rather than through an *arr. Only Emby supports it.
+	AllowDirectDelete bool
+	CreatedAt         string
+	UpdatedAt         string
+}
+
+// HealthState is the outcome of a health check as stored on the connection row.
+type HealthState struct {
+	Status              ConnectionStatus
+	CheckedAt           string
+	ConsecutiveFailures int
+	NextCheckAt         string
 }
 
 type ConnectionRepository interface {
@@ -55,4 +250,236 @@ type ConnectionRepository interface {
 	Update(ctx context.Context, conn *Connection) error
 	Delete(ctx context.Context, id string) error
 	UpdateStatus(ctx context.Context, id string, status ConnectionStatus, checkedAt string) error
+	UpdateHealth(ctx context.Context, id string, state HealthState) error
+}
+
+// HealthCheck is the result of a single connection health check.
+type HealthCheck struct {
+	ID           string
+	ConnectionID string
+	Outcome      ConnectionStatus
+	LatencyMS    int64
+	ErrorMessage string
+	AppVersion   string
+	CheckedAt    string
+}
+
+// HealthSummary aggregates health checks for a connection over a window.
+type HealthSummary struct {
+	TotalChecks      int
+	HealthyChecks    int
+	AverageLatencyMS float64
+}
+
+type HealthCheckRepository interface {
+	Create(ctx context.Context, check *HealthCheck) error
+	Summary(ctx context.Context, connectionID, since string) (*HealthSummary, error)
+	ListFailures(ctx context.Context, connectionID, since string, limit int) ([]*HealthCheck, error)
+	DeleteBefore(ctx context.Context, before string) (int64, error)
+}
+
+type SecretKind string
+
+const (
+	SecretKindConnection   SecretKind = "connection"
+	SecretKindNotification SecretKind = "notification"
+	SecretKindTOTP         SecretKind = "totp"
+)
+
+// EncryptedSecret is one value encrypted with the master key, wherever it is stored.
+type EncryptedSecret struct {
+	Kind       SecretKind
+	ID         string
+	Name       string
+	Ciphertext string
+}
+
+type SecretRepository interface {
+	List(ctx context.Context) ([]*EncryptedSecret, error)
+	// ReplaceAll calls fn for every stored secret inside one transaction and
+	// writes back values that changed. Any error from fn rolls everything back.
+	ReplaceAll(ctx context.Context, fn func(*EncryptedSecret) (string, error)) (int, error)
+}
+
+type MediaType string
+
+const (
+	MediaTypeMovie   MediaType = "movie"
+	MediaTypeSeries  MediaType = "series"
+	MediaTypeEpisode MediaType = "episode"
+	MediaTypeAlbum   MediaType = "album"
+	MediaTypeBook    MediaType = "book"
+	// MediaTypeVideo is a media server item no *arr manages, such as a home
+	// video.
+	MediaTypeVideo MediaType = "video"
+)
+
+// DeletionRecord is a permanent record of an executed deletion. It carries
+// enough metadata to re-add the title to the originating *arr instance.
+type DeletionRecord struct {
+	ID                   string
+	ConnectionID         string
+	ConnectionName       string
+	ConnectionType       ConnectionType
+	MediaType            MediaType
+	Title                string
+	Year                 int
+	SeasonNumber         *int
+	EpisodeNumber        *int
+	ArrID                int64
+	TMDBID               int64
+	TVDBID               int64
+	IMDBID               string
+	SizeBytes            int64
+	FilePath             string
+	Quality              string
+	QualityProfileID     int64
+	RootFolderPath       string
+	RuleName             string
+	WatchedBy            []string
+	ApprovedBy           string
+	ImportExclusionAdded bool
+	DeletedAt            string
+	RestoredAt           *string
+	RestoredBy           string
+}
+
+// HistoryFilter narrows a deletion history listing. Zero values match everything.
+type HistoryFilter struct {
+	Query        string
+	MediaType    MediaType
+	ConnectionID string
+	Since        string
+	Until        string
+	Limit        int
+	Offset       int
+}
+
+type HistoryRepository interface {
+	Create(ctx context.Context, record *DeletionRecord) error
+	GetByID(ctx context.Context, id string) (*DeletionRecord, error)
+	List(ctx context.Context, filter HistoryFilter) ([]*DeletionRecord, int, error)
+	MarkRestored(ctx context.Context, id, restoredBy, restoredAt string) error
+}
+
+// Sources of imported watch history.
+const (
+	WatchSourcePlaybackReporting = "playback_reporting"
+	WatchSourceCSV               = "csv"
+)
+
+// WatchPlay is a play imported from an external watch history. A play names
+// the user by media server ID, by name, or both, and the item by media server
+// ID, by provider IDs, or both.
+type WatchPlay struct {
+	ID              int64
+	ConnectionID    string
+	MediaUserID     string
+	UserName        string
+	ItemID          string
+	ItemName        string
+	ItemType        string
+	TMDBID          string
+	TVDBID          string
+	IMDBID          string
+	PlayedAt        string
+	DurationSeconds int
+	Source          string
+	ImportedAt      string
+}
+
+// WatchPlayFilter narrows a watch history listing. UserID and UserName match
+// either the media server user ID or the user name, ignoring case. Zero
+// values match everything.
+type WatchPlayFilter struct {
+	ConnectionID string
+	UserID       string
+	UserName     string
+	Limit        int
+}
+
+type WatchPlayRepository interface {
+	// Import stores plays, skipping any that were imported before, and
+	// returns how many were added.
+	Import(ctx context.Context, plays []*WatchPlay) (int, error)
+	// List returns plays matching filter, newest first.
+	List(ctx context.Context, filter WatchPlayFilter) ([]*WatchPlay, error)
+}
+
+// DirectDeletePolicy holds the guardrails for deleting unmanaged items
+// directly on an Emby server. Only items in LibraryIDs can be deleted, each
+// must have been flagged at least GracePeriodDays earlier, and a single run
+// deletes at most MaxBytesPerRun.
+type DirectDeletePolicy struct {
+	ConnectionID    string
+	LibraryIDs      []string
+	GracePeriodDays int
+	MaxBytesPerRun  int64
+	UpdatedBy       string
+	UpdatedAt       string
+}
+
+// DirectDeleteCandidate is an item flagged for direct deletion. Path and
+// SizeBytes are as seen when it was flagged.
+type DirectDeleteCandidate struct {
+	ConnectionID string
+	ItemID       string
+	ItemName     string
+	Path         string
+	SizeBytes    int64
+	FlaggedBy    string
+	FlaggedAt    string
+	// GraceWarnedAt is when notice that the grace period is ending was sent,
+	// or empty if it has not been.
+	GraceWarnedAt string
+}
+
+type DirectDeleteRepository interface {
+	// GetPolicy returns nil if the connection has no policy.
+	GetPolicy(ctx context.Context, connectionID string) (*DirectDeletePolicy, error)
+	SavePolicy(ctx context.Context, policy *DirectDeletePolicy) error
+	// Flag stores candidates, keeping the original flag time of any that are
+	// already flagged, and returns how many were newly flagged.
+	Flag(ctx context.Context, candidates []*DirectDeleteCandidate) (int, error)
+	// ListCandidates returns a connection's candidates, oldest flag first.
+	ListCandidates(ctx context.Context, connectionID string) ([]*DirectDeleteCandidate, error)
+	// Unflag removes a candidate and reports whether it existed.
+	Unflag(ctx context.Context, connectionID, itemID string) (bool, error)
+	// MarkGraceWarned records that notice was sent for candidates whose grace
+	// period is ending.
+	MarkGraceWarned(ctx context.Context, connectionID string, itemIDs []string, warnedAt string) error
+}
+
+type NotificationType string
+
+const (
+	NotificationTypeDiscord NotificationType = "discord"
+	NotificationTypeSlack   NotificationType = "slack"
+	NotificationTypeWebhook NotificationType = "webhook"
+	NotificationTypeSMTP    NotificationType = "smtp"
+	NotificationTypeApprise NotificationType = "apprise"
+)
+
+// NotificationProvider is a configured notification target. Its config,
+// which typically embeds webhook tokens or passwords, is stored encrypted.
+type NotificationProvider struct {
+	ID              string
+	Name            string
+	Type            NotificationType
+	EncryptedConfig string
+	Events          []string
+	TitleTemplate   string
+	BodyTemplate    string
+	Enabled         bool
+	CreatedAt       string
+	UpdatedAt       string
+}
+
+type NotificationProviderRepository interface {
+	Create(ctx context.Context, provider *NotificationProvider) error
+	GetByID(ctx context.Context, id string) (*NotificationProvider, error)
+	GetAll(ctx context.Context) ([]*NotificationProvider, error)
+	GetAllEnabled(ctx context.Context) ([]*NotificationProvider, error)
+	Update(ctx context.Context, provider *NotificationProvider) error
+	Delete(ctx context.Context, id string) error
 }
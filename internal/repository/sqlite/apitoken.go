@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const apiTokenColumns = `id, user_id, name, token_hash, prefix, scopes, created_at, expires_at, last_used_at`
+
+type APITokenRepository struct {
+	db *sql.DB
+}
+
+func NewAPITokenRepository(db *sql.DB) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+func (r *APITokenRepository) Create(ctx context.Context, token *repository.APIToken) error {
+	scopes := token.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	encoded, err := json.Marshal(scopes)
+	if err != nil {
+		return fmt.Errorf("encoding token scopes: %w", err)
+	}
+
+	query := `INSERT INTO api_tokens (` + apiTokenColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = r.db.ExecContext(ctx, query,
+		token.ID, token.UserID, token.Name, token.TokenHash, token.Prefix, string(encoded),
+		token.CreatedAt, token.ExpiresAt, token.LastUsedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("creating api token: %w", err)
+	}
+	return nil
+}
+
+func (r *APITokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*repository.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = ?`
+	token, err := scanAPIToken(r.db.QueryRowContext(ctx, query, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting api token: %w", err)
+	}
+	return token, nil
+}
+
+func (r *APITokenRepository) ListByUser(ctx context.Context, userID string) ([]*repository.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing api tokens: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tokens []*repository.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning api token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating api tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (r *APITokenRepository) Touch(ctx context.Context, id, lastUsedAt string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, lastUsedAt, id)
+	if err != nil {
+		return fmt.Errorf("touching api token: %w", err)
+	}
+	return nil
+}
+
+func (r *APITokenRepository) Delete(ctx context.Context, userID, id string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("deleting api token: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func scanAPIToken(s rowScanner) (*repository.APIToken, error) {
+	token := &repository.APIToken{}
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullString
+	err := s.Scan(
+		&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Prefix, &scopes,
+		&token.CreatedAt, &expiresAt, &lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &token.Scopes); err != nil {
+		return nil, fmt.Errorf("decoding token scopes: %w", err)
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.String
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.String
+	}
+	return token, nil
+}
@@ -8,6 +8,10 @@ import (
 	"github.com/sydlexius/media-reaper/internal/repository"
 )
 
+const connectionColumns = `id, name, type, url, encrypted_api_key, enabled, status, last_checked_at,
+	check_interval_seconds, check_timeout_seconds, consecutive_failures, next_check_at, allow_direct_delete,
+	created_at, updated_at`
+
 type ConnectionRepository struct {
 	db *sql.DB
 }
@@ -17,11 +21,13 @@ func NewConnectionRepository(db *sql.DB) *ConnectionRepository {
 }
 
 func (r *ConnectionRepository) Create(ctx context.Context, conn *repository.Connection) error {
-	query := `INSERT INTO connections (id, name, type, url, encrypted_api_key, enabled, status, created_at, updated_at)
-	          VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+	query := `INSERT INTO connections (id, name, type, url, encrypted_api_key, enabled, status,
+	              check_interval_seconds, check_timeout_seconds, allow_direct_delete, created_at, updated_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
 	_, err := r.db.ExecContext(ctx, query,
 		conn.ID, conn.Name, string(conn.Type), conn.URL, conn.EncryptedAPIKey,
 		boolToInt(conn.Enabled), string(conn.Status),
+		conn.CheckIntervalSeconds, checkTimeoutOrDefault(conn.CheckTimeoutSeconds), boolToInt(conn.AllowDirectDelete),
 	)
 	if err != nil {
 		return fmt.Errorf("creating connection: %w", err)
@@ -30,7 +36,7 @@ func (r *ConnectionRepository) Create(ctx context.Context, conn *repository.Conn
 }
 
 func (r *ConnectionRepository) GetByID(ctx context.Context, id string) (*repository.Connection, error) {
-	query := `SELECT id, name, type, url, encrypted_api_key, enabled, status, last_checked_at, created_at, updated_at
+	query := `SELECT ` + connectionColumns + `
 	          FROM connections WHERE id = ?`
 	conn, err := r.scanConnection(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
@@ -43,7 +49,7 @@ func (r *ConnectionRepository) GetByID(ctx context.Context, id string) (*reposit
 }
 
 func (r *ConnectionRepository) GetAll(ctx context.Context) ([]*repository.Connection, error) {
-	query := `SELECT id, name, type, url, encrypted_api_key, enabled, status, last_checked_at, created_at, updated_at
+	query := `SELECT ` + connectionColumns + `
 	          FROM connections ORDER BY created_at DESC`
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
@@ -55,7 +61,7 @@ func (r *ConnectionRepository) GetAll(ctx context.Context) ([]*repository.Connec
 }
 
 func (r *ConnectionRepository) GetAllEnabled(ctx context.Context) ([]*repository.Connection, error) {
-	query := `SELECT id, name, type, url, encrypted_api_key, enabled, status, last_checked_at, created_at, updated_at
+	query := `SELECT ` + connectionColumns + `
 	          FROM connections WHERE enabled = 1 ORDER BY created_at DESC`
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
@@ -68,11 +74,14 @@ func (r *ConnectionRepository) GetAllEnabled(ctx context.Context) ([]*repository
 
 func (r *ConnectionRepository) Update(ctx context.Context, conn *repository.Connection) error {
 	query := `UPDATE connections
-	          SET name = ?, type = ?, url = ?, encrypted_api_key = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+	          SET name = ?, type = ?, url = ?, encrypted_api_key = ?, enabled = ?,
+	              check_interval_seconds = ?, check_timeout_seconds = ?, next_check_at = ?,
+	              allow_direct_delete = ?, updated_at = CURRENT_TIMESTAMP
 	          WHERE id = ?`
 	_, err := r.db.ExecContext(ctx, query,
-		conn.Name, string(conn.Type), conn.URL, conn.EncryptedAPIKey,
-		boolToInt(conn.Enabled), conn.ID,
+		conn.Name, string(conn.Type), conn.URL, conn.EncryptedAPIKey, boolToInt(conn.Enabled),
+		conn.CheckIntervalSeconds, checkTimeoutOrDefault(conn.CheckTimeoutSeconds), conn.NextCheckAt,
+		boolToInt(conn.AllowDirectDelete), conn.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("updating connection: %w", err)
@@ -97,15 +106,29 @@ func (r *ConnectionRepository) UpdateStatus(ctx context.Context, id string, stat
 	return nil
 }
 
+func (r *ConnectionRepository) UpdateHealth(ctx context.Context, id string, state repository.HealthState) error {
+	query := `UPDATE connections
+	          SET status = ?, last_checked_at = ?, consecutive_failures = ?, next_check_at = ?, updated_at = CURRENT_TIMESTAMP
+	          WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query,
+		string(state.Status), state.CheckedAt, state.ConsecutiveFailures, state.NextCheckAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("updating connection health: %w", err)
+	}
+	return nil
+}
+
 func (r *ConnectionRepository) scanConnection(row *sql.Row) (*repository.Connection, error) {
 	conn := &repository.Connection{}
-	var enabled int
+	var enabled, allowDirectDelete int
 	var connType, status string
-	var lastCheckedAt sql.NullString
+	var lastCheckedAt, nextCheckAt sql.NullString
 
 	err := row.Scan(
 		&conn.ID, &conn.Name, &connType, &conn.URL, &conn.EncryptedAPIKey,
 		&enabled, &status, &lastCheckedAt,
+		&conn.CheckIntervalSeconds, &conn.CheckTimeoutSeconds, &conn.ConsecutiveFailures, &nextCheckAt, &allowDirectDelete,
 		&conn.CreatedAt, &conn.UpdatedAt,
 	)
 	if err != nil {
@@ -115,9 +138,13 @@ func (r *ConnectionRepository) scanConnection(row *sql.Row) (*repository.Connect
 	conn.Type = repository.ConnectionType(connType)
 	conn.Status = repository.ConnectionStatus(status)
 	conn.Enabled = enabled == 1
+	conn.AllowDirectDelete = allowDirectDelete == 1
 	if lastCheckedAt.Valid {
 		conn.LastCheckedAt = &lastCheckedAt.String
 	}
+	if nextCheckAt.Valid {
+		conn.NextCheckAt = &nextCheckAt.String
+	}
 
 	return conn, nil
 }
@@ -126,13 +153,14 @@ func (r *ConnectionRepository) scanConnections(rows *sql.Rows) ([]*repository.Co
 	var connections []*repository.Connection
 	for rows.Next() {
 		conn := &repository.Connection{}
-		var enabled int
+		var enabled, allowDirectDelete int
 		var connType, status string
-		var lastCheckedAt sql.NullString
+		var lastCheckedAt, nextCheckAt sql.NullString
 
 		err := rows.Scan(
 			&conn.ID, &conn.Name, &connType, &conn.URL, &conn.EncryptedAPIKey,
 			&enabled, &status, &lastCheckedAt,
+			&conn.CheckIntervalSeconds, &conn.CheckTimeoutSeconds, &conn.ConsecutiveFailures, &nextCheckAt, &allowDirectDelete,
 			&conn.CreatedAt, &conn.UpdatedAt,
 		)
 		if err != nil {
@@ -142,9 +170,13 @@ func (r *ConnectionRepository) scanConnections(rows *sql.Rows) ([]*repository.Co
 		conn.Type = repository.ConnectionType(connType)
 		conn.Status = repository.ConnectionStatus(status)
 		conn.Enabled = enabled == 1
+		conn.AllowDirectDelete = allowDirectDelete == 1
 		if lastCheckedAt.Valid {
 			conn.LastCheckedAt = &lastCheckedAt.String
 		}
+		if nextCheckAt.Valid {
+			conn.NextCheckAt = &nextCheckAt.String
+		}
 
 		connections = append(connections, conn)
 	}
@@ -156,6 +188,14 @@ func (r *ConnectionRepository) scanConnections(rows *sql.Rows) ([]*repository.Co
 	return connections, nil
 }
 
+// checkTimeoutOrDefault mirrors the column default for connections built in code.
+func checkTimeoutOrDefault(seconds int) int {
+	if seconds <= 0 {
+		return 15
+	}
+	return seconds
+}
+
 func boolToInt(b bool) int {
 	if b {
 		return 1
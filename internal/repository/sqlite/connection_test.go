@@ -32,6 +32,11 @@ func setupTestDB(t *testing.T) *sql.DB {
 		enabled         INTEGER NOT NULL DEFAULT 1,
 		status          TEXT NOT NULL DEFAULT 'unknown' CHECK(status IN ('healthy', 'unhealthy', 'unknown')),
 		last_checked_at TIMESTAMP,
+		check_interval_seconds INTEGER NOT NULL DEFAULT 0,
+		check_timeout_seconds  INTEGER NOT NULL DEFAULT 15,
+		consecutive_failures   INTEGER NOT NULL DEFAULT 0,
+		next_check_at          TIMESTAMP,
+		allow_direct_delete    INTEGER NOT NULL DEFAULT 0,
 		created_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		updated_at      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 	);
@@ -274,6 +279,42 @@ func TestUpdateStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateHealth(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewConnectionRepository(db)
+	ctx := context.Background()
+
+	conn := testConnection()
+	conn.CheckIntervalSeconds = 600
+	if err := repo.Create(ctx, conn); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	state := repository.HealthState{
+		Status:              repository.ConnectionStatusUnhealthy,
+		CheckedAt:           "2025-01-15T10:30:00Z",
+		ConsecutiveFailures: 3,
+		NextCheckAt:         "2025-01-15T11:10:00Z",
+	}
+	if err := repo.UpdateHealth(ctx, conn.ID, state); err != nil {
+		t.Fatalf("UpdateHealth: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, conn.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Status != repository.ConnectionStatusUnhealthy || got.ConsecutiveFailures != 3 {
+		t.Errorf("unexpected health state: status=%q failures=%d", got.Status, got.ConsecutiveFailures)
+	}
+	if got.NextCheckAt == nil || *got.NextCheckAt != state.NextCheckAt {
+		t.Errorf("next_check_at: got %v, want %q", got.NextCheckAt, state.NextCheckAt)
+	}
+	if got.CheckIntervalSeconds != 600 || got.CheckTimeoutSeconds != 15 {
+		t.Errorf("check settings: got interval=%d timeout=%d", got.CheckIntervalSeconds, got.CheckTimeoutSeconds)
+	}
+}
+
 func TestLastCheckedAtNullable(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewConnectionRepository(db)
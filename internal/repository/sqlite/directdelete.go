@@ -0,0 +1,163 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type DirectDeleteRepository struct {
+	db *sql.DB
+}
+
+func NewDirectDeleteRepository(db *sql.DB) *DirectDeleteRepository {
+	return &DirectDeleteRepository{db: db}
+}
+
+func (r *DirectDeleteRepository) GetPolicy(ctx context.Context, connectionID string) (*repository.DirectDeletePolicy, error) {
+	query := `SELECT connection_id, library_ids, grace_period_days, max_bytes_per_run, updated_by, updated_at
+	          FROM direct_delete_policies WHERE connection_id = ?`
+	policy := &repository.DirectDeletePolicy{}
+	var libraryIDs string
+	err := r.db.QueryRowContext(ctx, query, connectionID).Scan(
+		&policy.ConnectionID, &libraryIDs, &policy.GracePeriodDays, &policy.MaxBytesPerRun,
+		&policy.UpdatedBy, &policy.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting direct delete policy: %w", err)
+	}
+	if err := json.Unmarshal([]byte(libraryIDs), &policy.LibraryIDs); err != nil {
+		return nil, fmt.Errorf("decoding library ids: %w", err)
+	}
+	return policy, nil
+}
+
+func (r *DirectDeleteRepository) SavePolicy(ctx context.Context, policy *repository.DirectDeletePolicy) error {
+	libraryIDs := policy.LibraryIDs
+	if libraryIDs == nil {
+		libraryIDs = []string{}
+	}
+	libraryJSON, err := json.Marshal(libraryIDs)
+	if err != nil {
+		return fmt.Errorf("encoding library ids: %w", err)
+	}
+
+	query := `INSERT INTO direct_delete_policies
+	              (connection_id, library_ids, grace_period_days, max_bytes_per_run, updated_by, updated_at)
+	          VALUES (?, ?, ?, ?, ?, ?)
+	          ON CONFLICT(connection_id) DO UPDATE SET
+	              library_ids = excluded.library_ids,
+	              grace_period_days = excluded.grace_period_days,
+	              max_bytes_per_run = excluded.max_bytes_per_run,
+	              updated_by = excluded.updated_by,
+	              updated_at = excluded.updated_at`
+	_, err = r.db.ExecContext(ctx, query,
+		policy.ConnectionID, string(libraryJSON), policy.GracePeriodDays, policy.MaxBytesPerRun,
+		policy.UpdatedBy, policy.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("saving direct delete policy: %w", err)
+	}
+	return nil
+}
+
+func (r *DirectDeleteRepository) Flag(ctx context.Context, candidates []*repository.DirectDeleteCandidate) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO direct_delete_candidates
+		(connection_id, item_id, item_name, path, size_bytes, flagged_by, flagged_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("preparing candidate insert: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	added := 0
+	for _, c := range candidates {
+		result, err := stmt.ExecContext(ctx,
+			c.ConnectionID, c.ItemID, c.ItemName, c.Path, c.SizeBytes, c.FlaggedBy, c.FlaggedAt,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("flagging item: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing flagged items: %w", err)
+	}
+	return added, nil
+}
+
+func (r *DirectDeleteRepository) ListCandidates(ctx context.Context, connectionID string) ([]*repository.DirectDeleteCandidate, error) {
+	query := `SELECT connection_id, item_id, item_name, path, size_bytes, flagged_by, flagged_at, grace_warned_at
+	          FROM direct_delete_candidates WHERE connection_id = ?
+	          ORDER BY flagged_at, item_id`
+	rows, err := r.db.QueryContext(ctx, query, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("listing direct delete candidates: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var candidates []*repository.DirectDeleteCandidate
+	for rows.Next() {
+		c := &repository.DirectDeleteCandidate{}
+		var warnedAt sql.NullString
+		if err := rows.Scan(&c.ConnectionID, &c.ItemID, &c.ItemName, &c.Path, &c.SizeBytes, &c.FlaggedBy, &c.FlaggedAt, &warnedAt); err != nil {
+			return nil, fmt.Errorf("scanning candidate row: %w", err)
+		}
+		c.GraceWarnedAt = warnedAt.String
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating candidate rows: %w", err)
+	}
+	return candidates, nil
+}
+
+func (r *DirectDeleteRepository) Unflag(ctx context.Context, connectionID, itemID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM direct_delete_candidates WHERE connection_id = ? AND item_id = ?`, connectionID, itemID)
+	if err != nil {
+		return false, fmt.Errorf("unflagging item: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("counting unflagged items: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *DirectDeleteRepository) MarkGraceWarned(ctx context.Context, connectionID string, itemIDs []string, warnedAt string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, id := range itemIDs {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE direct_delete_candidates SET grace_warned_at = ? WHERE connection_id = ? AND item_id = ?`,
+			warnedAt, connectionID, id)
+		if err != nil {
+			return fmt.Errorf("marking grace warning sent: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing grace warnings: %w", err)
+	}
+	return nil
+}
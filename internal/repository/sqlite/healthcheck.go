@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type HealthCheckRepository struct {
+	db *sql.DB
+}
+
+func NewHealthCheckRepository(db *sql.DB) *HealthCheckRepository {
+	return &HealthCheckRepository{db: db}
+}
+
+func (r *HealthCheckRepository) Create(ctx context.Context, check *repository.HealthCheck) error {
+	query := `INSERT INTO connection_health_checks (id, connection_id, outcome, latency_ms, error_message, app_version, checked_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.db.ExecContext(ctx, query,
+		check.ID, check.ConnectionID, string(check.Outcome), check.LatencyMS,
+		check.ErrorMessage, check.AppVersion, check.CheckedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("creating health check: %w", err)
+	}
+	return nil
+}
+
+func (r *HealthCheckRepository) Summary(ctx context.Context, connectionID, since string) (*repository.HealthSummary, error) {
+	query := `SELECT COUNT(*),
+	                 COALESCE(SUM(CASE WHEN outcome = 'healthy' THEN 1 ELSE 0 END), 0),
+	                 COALESCE(AVG(latency_ms), 0)
+	          FROM connection_health_checks WHERE connection_id = ? AND checked_at >= ?`
+	summary := &repository.HealthSummary{}
+	err := r.db.QueryRowContext(ctx, query, connectionID, since).Scan(
+		&summary.TotalChecks, &summary.HealthyChecks, &summary.AverageLatencyMS,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("summarizing health checks: %w", err)
+	}
+	return summary, nil
+}
+
+func (r *HealthCheckRepository) ListFailures(ctx context.Context, connectionID, since string, limit int) ([]*repository.HealthCheck, error) {
+	query := `SELECT id, connection_id, outcome, latency_ms, error_message, app_version, checked_at
+	          FROM connection_health_checks
+	          WHERE connection_id = ? AND checked_at >= ? AND outcome = 'unhealthy'
+	          ORDER BY checked_at DESC LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, query, connectionID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing health check failures: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var checks []*repository.HealthCheck
+	for rows.Next() {
+		check := &repository.HealthCheck{}
+		var outcome string
+		if err := rows.Scan(
+			&check.ID, &check.ConnectionID, &outcome, &check.LatencyMS,
+			&check.ErrorMessage, &check.AppVersion, &check.CheckedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scanning health check: %w", err)
+		}
+		check.Outcome = repository.ConnectionStatus(outcome)
+		checks = append(checks, check)
+	}
+	return checks, rows.Err()
+}
+
+func (r *HealthCheckRepository) DeleteBefore(ctx context.Context, before string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM connection_health_checks WHERE checked_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("pruning health checks: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,190 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const historyInsertColumns = `id, connection_id, connection_name, connection_type, media_type, title, year,
+	season_number, episode_number, arr_id, tmdb_id, tvdb_id, imdb_id, size_bytes, file_path,
+	quality, quality_profile_id, root_folder_path, rule_name, watched_by, approved_by,
+	import_exclusion_added, deleted_at`
+
+const historyColumns = historyInsertColumns + `, restored_at, restored_by`
+
+type HistoryRepository struct {
+	db *sql.DB
+}
+
+func NewHistoryRepository(db *sql.DB) *HistoryRepository {
+	return &HistoryRepository{db: db}
+}
+
+func (r *HistoryRepository) Create(ctx context.Context, record *repository.DeletionRecord) error {
+	watchedBy := record.WatchedBy
+	if watchedBy == nil {
+		watchedBy = []string{}
+	}
+	watchedJSON, err := json.Marshal(watchedBy)
+	if err != nil {
+		return fmt.Errorf("encoding watched_by: %w", err)
+	}
+
+	query := `INSERT INTO deletion_history (` + historyInsertColumns + `)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = r.db.ExecContext(ctx, query,
+		record.ID, record.ConnectionID, record.ConnectionName, string(record.ConnectionType),
+		string(record.MediaType), record.Title, record.Year,
+		nullableInt(record.SeasonNumber), nullableInt(record.EpisodeNumber),
+		record.ArrID, record.TMDBID, record.TVDBID, record.IMDBID, record.SizeBytes, record.FilePath,
+		record.Quality, record.QualityProfileID, record.RootFolderPath, record.RuleName,
+		string(watchedJSON), record.ApprovedBy, boolToInt(record.ImportExclusionAdded), record.DeletedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("creating deletion record: %w", err)
+	}
+	return nil
+}
+
+func (r *HistoryRepository) GetByID(ctx context.Context, id string) (*repository.DeletionRecord, error) {
+	query := `SELECT ` + historyColumns + ` FROM deletion_history WHERE id = ?`
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting deletion record by id: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	records, err := scanDeletionRecords(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+func (r *HistoryRepository) List(ctx context.Context, filter repository.HistoryFilter) ([]*repository.DeletionRecord, int, error) {
+	var where []string
+	var args []any
+
+	if filter.Query != "" {
+		like := "%" + escapeLike(filter.Query) + "%"
+		where = append(where, `(title LIKE ? ESCAPE '\' OR file_path LIKE ? ESCAPE '\' OR imdb_id = ?)`)
+		args = append(args, like, like, filter.Query)
+	}
+	if filter.MediaType != "" {
+		where = append(where, "media_type = ?")
+		args = append(args, string(filter.MediaType))
+	}
+	if filter.ConnectionID != "" {
+		where = append(where, "connection_id = ?")
+		args = append(args, filter.ConnectionID)
+	}
+	if filter.Since != "" {
+		where = append(where, "deleted_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Until != "" {
+		where = append(where, "deleted_at <= ?")
+		args = append(args, filter.Until)
+	}
+
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM deletion_history"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("counting deletion records: %w", err)
+	}
+
+	query := `SELECT ` + historyColumns + ` FROM deletion_history` + clause +
+		` ORDER BY deleted_at DESC, id LIMIT ? OFFSET ?`
+	rows, err := r.db.QueryContext(ctx, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing deletion records: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	records, err := scanDeletionRecords(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+func (r *HistoryRepository) MarkRestored(ctx context.Context, id, restoredBy, restoredAt string) error {
+	query := `UPDATE deletion_history SET restored_at = ?, restored_by = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, restoredAt, restoredBy, id)
+	if err != nil {
+		return fmt.Errorf("marking deletion record restored: %w", err)
+	}
+	return nil
+}
+
+func scanDeletionRecords(rows *sql.Rows) ([]*repository.DeletionRecord, error) {
+	var records []*repository.DeletionRecord
+	for rows.Next() {
+		rec := &repository.DeletionRecord{}
+		var connType, mediaType, watchedBy string
+		var season, episode sql.NullInt64
+		var restoredAt sql.NullString
+		var exclusion int
+
+		err := rows.Scan(
+			&rec.ID, &rec.ConnectionID, &rec.ConnectionName, &connType, &mediaType, &rec.Title, &rec.Year,
+			&season, &episode, &rec.ArrID, &rec.TMDBID, &rec.TVDBID, &rec.IMDBID, &rec.SizeBytes, &rec.FilePath,
+			&rec.Quality, &rec.QualityProfileID, &rec.RootFolderPath, &rec.RuleName, &watchedBy, &rec.ApprovedBy,
+			&exclusion, &rec.DeletedAt, &restoredAt, &rec.RestoredBy,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning deletion record row: %w", err)
+		}
+
+		rec.ConnectionType = repository.ConnectionType(connType)
+		rec.MediaType = repository.MediaType(mediaType)
+		rec.ImportExclusionAdded = exclusion == 1
+		if restoredAt.Valid {
+			rec.RestoredAt = &restoredAt.String
+		}
+		if season.Valid {
+			v := int(season.Int64)
+			rec.SeasonNumber = &v
+		}
+		if episode.Valid {
+			v := int(episode.Int64)
+			rec.EpisodeNumber = &v
+		}
+		if err := json.Unmarshal([]byte(watchedBy), &rec.WatchedBy); err != nil {
+			return nil, fmt.Errorf("decoding watched_by: %w", err)
+		}
+
+		records = append(records, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating deletion record rows: %w", err)
+	}
+
+	return records, nil
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally, for use with
+// ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func nullableInt(v *int) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
@@ -0,0 +1,176 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+func setupHistoryTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+
+	schema := `
+	CREATE TABLE deletion_history (
+		id                     TEXT PRIMARY KEY,
+		connection_id          TEXT NOT NULL,
+		connection_name        TEXT NOT NULL,
+		connection_type        TEXT NOT NULL,
+		media_type             TEXT NOT NULL,
+		title                  TEXT NOT NULL,
+		year                   INTEGER NOT NULL DEFAULT 0,
+		season_number          INTEGER,
+		episode_number         INTEGER,
+		arr_id                 INTEGER NOT NULL DEFAULT 0,
+		tmdb_id                INTEGER NOT NULL DEFAULT 0,
+		tvdb_id                INTEGER NOT NULL DEFAULT 0,
+		imdb_id                TEXT NOT NULL DEFAULT '',
+		size_bytes             INTEGER NOT NULL DEFAULT 0,
+		file_path              TEXT NOT NULL DEFAULT '',
+		quality                TEXT NOT NULL DEFAULT '',
+		quality_profile_id     INTEGER NOT NULL DEFAULT 0,
+		root_folder_path       TEXT NOT NULL DEFAULT '',
+		rule_name              TEXT NOT NULL DEFAULT '',
+		watched_by             TEXT NOT NULL DEFAULT '[]',
+		approved_by            TEXT NOT NULL DEFAULT '',
+		import_exclusion_added INTEGER NOT NULL DEFAULT 0,
+		deleted_at             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		restored_at            TIMESTAMP,
+		restored_by            TEXT NOT NULL DEFAULT ''
+	);`
+
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func testDeletionRecord(id, title, deletedAt string) *repository.DeletionRecord {
+	return &repository.DeletionRecord{
+		ID:                   id,
+		ConnectionID:         "conn-1",
+		ConnectionName:       "Radarr",
+		ConnectionType:       repository.ConnectionTypeRadarr,
+		MediaType:            repository.MediaTypeMovie,
+		Title:                title,
+		Year:                 1999,
+		ArrID:                42,
+		TMDBID:               603,
+		IMDBID:               "tt0133093",
+		SizeBytes:            8 << 30,
+		FilePath:             "/movies/" + title + "/" + title + ".mkv",
+		Quality:              "Bluray-1080p",
+		QualityProfileID:     4,
+		RootFolderPath:       "/movies",
+		RuleName:             "Watched by everyone",
+		WatchedBy:            []string{"alice", "bob"},
+		ApprovedBy:           "admin",
+		ImportExclusionAdded: true,
+		DeletedAt:            deletedAt,
+	}
+}
+
+func TestHistoryCreateAndGet(t *testing.T) {
+	repo := NewHistoryRepository(setupHistoryTestDB(t))
+	ctx := context.Background()
+
+	season, episode := 2, 5
+	rec := testDeletionRecord("rec-1", "The Matrix", "2025-01-15T10:30:00Z")
+	rec.SeasonNumber = &season
+	rec.EpisodeNumber = &episode
+
+	if err := repo.Create(ctx, rec); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, rec.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got == nil {
+		t.Fatal("expected record, got nil")
+	}
+	if got.Title != rec.Title || got.TMDBID != rec.TMDBID || got.RootFolderPath != rec.RootFolderPath {
+		t.Errorf("round-trip mismatch: got %+v", got)
+	}
+	if len(got.WatchedBy) != 2 || got.WatchedBy[1] != "bob" {
+		t.Errorf("watched_by: got %v", got.WatchedBy)
+	}
+	if !got.ImportExclusionAdded {
+		t.Error("expected import_exclusion_added=true")
+	}
+	if got.SeasonNumber == nil || *got.SeasonNumber != 2 || got.EpisodeNumber == nil || *got.EpisodeNumber != 5 {
+		t.Errorf("season/episode: got %v/%v", got.SeasonNumber, got.EpisodeNumber)
+	}
+
+	missing, err := repo.GetByID(ctx, "nonexistent")
+	if err != nil {
+		t.Fatalf("GetByID missing: %v", err)
+	}
+	if missing != nil {
+		t.Errorf("expected nil, got %+v", missing)
+	}
+}
+
+func TestHistoryListFilters(t *testing.T) {
+	repo := NewHistoryRepository(setupHistoryTestDB(t))
+	ctx := context.Background()
+
+	records := []*repository.DeletionRecord{
+		testDeletionRecord("rec-1", "The Matrix", "2025-01-01T00:00:00Z"),
+		testDeletionRecord("rec-2", "The Matrix Reloaded", "2025-02-01T00:00:00Z"),
+		testDeletionRecord("rec-3", "Alien", "2025-03-01T00:00:00Z"),
+	}
+	records[2].MediaType = repository.MediaTypeSeries
+	records[2].ConnectionID = "conn-2"
+
+	for _, rec := range records {
+		if err := repo.Create(ctx, rec); err != nil {
+			t.Fatalf("Create %s: %v", rec.ID, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter repository.HistoryFilter
+		want   []string
+		total  int
+	}{
+		{"all newest first", repository.HistoryFilter{Limit: 10}, []string{"rec-3", "rec-2", "rec-1"}, 3},
+		{"title search", repository.HistoryFilter{Query: "matrix", Limit: 10}, []string{"rec-2", "rec-1"}, 2},
+		{"media type", repository.HistoryFilter{MediaType: repository.MediaTypeSeries, Limit: 10}, []string{"rec-3"}, 1},
+		{"connection", repository.HistoryFilter{ConnectionID: "conn-1", Limit: 10}, []string{"rec-2", "rec-1"}, 2},
+		{"wildcards match literally", repository.HistoryFilter{Query: "%", Limit: 10}, nil, 0},
+		{"underscore matches literally", repository.HistoryFilter{Query: "Matrix_", Limit: 10}, nil, 0},
+		{"since", repository.HistoryFilter{Since: "2025-02-01T00:00:00Z", Limit: 10}, []string{"rec-3", "rec-2"}, 2},
+		{"paged", repository.HistoryFilter{Limit: 1, Offset: 1}, []string{"rec-2"}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := repo.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if total != tt.total {
+				t.Errorf("total: got %d, want %d", total, tt.total)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d records, got %d", len(tt.want), len(got))
+			}
+			for i, id := range tt.want {
+				if got[i].ID != id {
+					t.Errorf("record %d: got %q, want %q", i, got[i].ID, id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const (
+	loginAttemptColumns = `id, username, user_id, ip_address, user_agent, success, reason, created_at`
+	loginLockoutColumns = `username, failed_count, locked_until, last_failed_at`
+)
+
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+func (r *LoginAttemptRepository) Record(ctx context.Context, attempt *repository.LoginAttempt) error {
+	query := `INSERT INTO login_attempts (username, user_id, ip_address, user_agent, success, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, query,
+		attempt.Username, attempt.UserID, attempt.IPAddress, attempt.UserAgent,
+		attempt.Success, attempt.Reason, attempt.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("recording login attempt: %w", err)
+	}
+	attempt.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *LoginAttemptRepository) List(ctx context.Context, filter repository.LoginAttemptFilter) ([]*repository.LoginAttempt, error) {
+	query := `SELECT ` + loginAttemptColumns + ` FROM login_attempts WHERE 1 = 1`
+	var args []any
+	if filter.Username != "" {
+		query += ` AND username = ?`
+		args = append(args, filter.Username)
+	}
+	if filter.FailedOnly {
+		query += ` AND success = 0`
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing login attempts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var attempts []*repository.LoginAttempt
+	for rows.Next() {
+		a := &repository.LoginAttempt{}
+		var userID sql.NullString
+		if err := rows.Scan(&a.ID, &a.Username, &userID, &a.IPAddress, &a.UserAgent, &a.Success, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning login attempt: %w", err)
+		}
+		if userID.Valid {
+			a.UserID = &userID.String
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func (r *LoginAttemptRepository) DeleteBefore(ctx context.Context, before string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("pruning login attempts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *LoginAttemptRepository) TrimUnknownUser(ctx context.Context, ipAddress, reason string, keep int) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM login_attempts
+		WHERE user_id IS NULL AND ip_address = ? AND success = 0 AND reason = ?
+		AND id NOT IN (
+			SELECT id FROM login_attempts
+			WHERE user_id IS NULL AND ip_address = ? AND success = 0 AND reason = ?
+			ORDER BY id DESC LIMIT ?
+		)`,
+		ipAddress, reason, ipAddress, reason, keep,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("trimming login attempts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *LoginAttemptRepository) GetLockout(ctx context.Context, username string) (*repository.LoginLockout, error) {
+	query := `SELECT ` + loginLockoutColumns + ` FROM login_lockouts WHERE username = ?`
+	lockout, err := scanLoginLockout(r.db.QueryRowContext(ctx, query, username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting login lockout: %w", err)
+	}
+	return lockout, nil
+}
+
+func (r *LoginAttemptRepository) ListLocked(ctx context.Context, now string) ([]*repository.LoginLockout, error) {
+	query := `SELECT ` + loginLockoutColumns + ` FROM login_lockouts
+		WHERE locked_until IS NOT NULL AND locked_until > ? ORDER BY locked_until DESC`
+	rows, err := r.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, fmt.Errorf("listing login lockouts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var lockouts []*repository.LoginLockout
+	for rows.Next() {
+		lockout, err := scanLoginLockout(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning login lockout: %w", err)
+		}
+		lockouts = append(lockouts, lockout)
+	}
+	return lockouts, rows.Err()
+}
+
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, username, failedAt, resetBefore string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO login_lockouts (username, failed_count, last_failed_at) VALUES (?, 1, ?)
+		ON CONFLICT(username) DO UPDATE SET
+			failed_count = CASE WHEN last_failed_at < ? THEN 1 ELSE failed_count + 1 END,
+			last_failed_at = excluded.last_failed_at
+		RETURNING failed_count`,
+		username, failedAt, resetBefore,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("recording login failure: %w", err)
+	}
+	return count, nil
+}
+
+func (r *LoginAttemptRepository) SetLockedUntil(ctx context.Context, username, lockedUntil string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE login_lockouts SET locked_until = ? WHERE username = ?`, lockedUntil, username)
+	if err != nil {
+		return fmt.Errorf("locking login: %w", err)
+	}
+	return nil
+}
+
+func (r *LoginAttemptRepository) ClearLockout(ctx context.Context, username string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM login_lockouts WHERE username = ?`, username)
+	if err != nil {
+		return false, fmt.Errorf("clearing login lockout: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *LoginAttemptRepository) DeleteStaleLockouts(ctx context.Context, now, resetBefore string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM login_lockouts
+		WHERE (locked_until IS NULL OR locked_until <= ?) AND last_failed_at < ?`,
+		now, resetBefore,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("pruning login lockouts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func scanLoginLockout(s rowScanner) (*repository.LoginLockout, error) {
+	l := &repository.LoginLockout{}
+	var lockedUntil sql.NullString
+	if err := s.Scan(&l.Username, &l.FailedCount, &lockedUntil, &l.LastFailedAt); err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		l.LockedUntil = &lockedUntil.String
+	}
+	return l, nil
+}
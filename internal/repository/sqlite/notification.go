@@ -0,0 +1,149 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const notificationColumns = `id, name, type, encrypted_config, events, title_template, body_template,
+	enabled, created_at, updated_at`
+
+type NotificationProviderRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationProviderRepository(db *sql.DB) *NotificationProviderRepository {
+	return &NotificationProviderRepository{db: db}
+}
+
+func (r *NotificationProviderRepository) Create(ctx context.Context, p *repository.NotificationProvider) error {
+	events, err := encodeEvents(p.Events)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO notification_providers (id, name, type, encrypted_config, events, title_template, body_template, enabled, created_at, updated_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+	_, err = r.db.ExecContext(ctx, query,
+		p.ID, p.Name, string(p.Type), p.EncryptedConfig, events,
+		p.TitleTemplate, p.BodyTemplate, boolToInt(p.Enabled),
+	)
+	if err != nil {
+		return fmt.Errorf("creating notification provider: %w", err)
+	}
+	return nil
+}
+
+func (r *NotificationProviderRepository) GetByID(ctx context.Context, id string) (*repository.NotificationProvider, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notification_providers WHERE id = ?`
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting notification provider by id: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	providers, err := scanNotificationProviders(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(providers) == 0 {
+		return nil, nil
+	}
+	return providers[0], nil
+}
+
+func (r *NotificationProviderRepository) GetAll(ctx context.Context) ([]*repository.NotificationProvider, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notification_providers ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("listing notification providers: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	return scanNotificationProviders(rows)
+}
+
+func (r *NotificationProviderRepository) GetAllEnabled(ctx context.Context) ([]*repository.NotificationProvider, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notification_providers WHERE enabled = 1 ORDER BY created_at DESC`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("listing enabled notification providers: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	return scanNotificationProviders(rows)
+}
+
+func (r *NotificationProviderRepository) Update(ctx context.Context, p *repository.NotificationProvider) error {
+	events, err := encodeEvents(p.Events)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE notification_providers
+	          SET name = ?, type = ?, encrypted_config = ?, events = ?, title_template = ?, body_template = ?,
+	              enabled = ?, updated_at = CURRENT_TIMESTAMP
+	          WHERE id = ?`
+	_, err = r.db.ExecContext(ctx, query,
+		p.Name, string(p.Type), p.EncryptedConfig, events,
+		p.TitleTemplate, p.BodyTemplate, boolToInt(p.Enabled), p.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("updating notification provider: %w", err)
+	}
+	return nil
+}
+
+func (r *NotificationProviderRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM notification_providers WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting notification provider: %w", err)
+	}
+	return nil
+}
+
+func scanNotificationProviders(rows *sql.Rows) ([]*repository.NotificationProvider, error) {
+	var providers []*repository.NotificationProvider
+	for rows.Next() {
+		p := &repository.NotificationProvider{}
+		var providerType, events string
+		var enabled int
+
+		err := rows.Scan(
+			&p.ID, &p.Name, &providerType, &p.EncryptedConfig, &events,
+			&p.TitleTemplate, &p.BodyTemplate, &enabled, &p.CreatedAt, &p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning notification provider row: %w", err)
+		}
+
+		p.Type = repository.NotificationType(providerType)
+		p.Enabled = enabled == 1
+		if err := json.Unmarshal([]byte(events), &p.Events); err != nil {
+			return nil, fmt.Errorf("decoding notification events: %w", err)
+		}
+
+		providers = append(providers, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating notification provider rows: %w", err)
+	}
+
+	return providers, nil
+}
+
+func encodeEvents(events []string) (string, error) {
+	if events == nil {
+		events = []string{}
+	}
+	b, err := json.Marshal(events)
+	if err != nil {
+		return "", fmt.Errorf("encoding notification events: %w", err)
+	}
+	return string(b), nil
+}
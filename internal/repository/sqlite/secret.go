@@ -0,0 +1,113 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// secretColumn is a column encrypted with the master key, with the
+// expressions that identify and name each row.
+type secretColumn struct {
+	kind   repository.SecretKind
+	table  string
+	column string
+	id     string
+	name   string
+}
+
+// secretColumns lists every column encrypted with the master key.
+var secretColumns = []secretColumn{
+	{repository.SecretKindConnection, "connections", "encrypted_api_key", "id", "name"},
+	{repository.SecretKindNotification, "notification_providers", "encrypted_config", "id", "name"},
+	{repository.SecretKindTOTP, "user_totp", "encrypted_secret", "user_id",
+		"(SELECT username FROM users WHERE users.id = user_totp.user_id)"},
+}
+
+type SecretRepository struct {
+	db *sql.DB
+}
+
+func NewSecretRepository(db *sql.DB) *SecretRepository {
+	return &SecretRepository{db: db}
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (r *SecretRepository) List(ctx context.Context) ([]*repository.EncryptedSecret, error) {
+	return listSecrets(ctx, r.db)
+}
+
+func (r *SecretRepository) ReplaceAll(ctx context.Context, fn func(*repository.EncryptedSecret) (string, error)) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	secrets, err := listSecrets(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, secret := range secrets {
+		replacement, err := fn(secret)
+		if err != nil {
+			return 0, err
+		}
+		if replacement == secret.Ciphertext {
+			continue
+		}
+
+		sc := secretColumnFor(secret.Kind)
+		query := `UPDATE ` + sc.table + ` SET ` + sc.column + ` = ?, updated_at = CURRENT_TIMESTAMP WHERE ` + sc.id + ` = ?` //nolint:gosec // table and columns come from secretColumns, not input
+		if _, err := tx.ExecContext(ctx, query, replacement, secret.ID); err != nil {
+			return 0, fmt.Errorf("updating %s %s: %w", secret.Kind, secret.ID, err)
+		}
+		changed++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing secret rotation: %w", err)
+	}
+	return changed, nil
+}
+
+func listSecrets(ctx context.Context, q queryer) ([]*repository.EncryptedSecret, error) {
+	var secrets []*repository.EncryptedSecret
+	for _, sc := range secretColumns {
+		query := `SELECT ` + sc.id + `, ` + sc.name + `, ` + sc.column + ` FROM ` + sc.table + ` ORDER BY created_at` //nolint:gosec // table and columns come from secretColumns, not input
+		rows, err := q.QueryContext(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s secrets: %w", sc.kind, err)
+		}
+		for rows.Next() {
+			secret := &repository.EncryptedSecret{Kind: sc.kind}
+			if err := rows.Scan(&secret.ID, &secret.Name, &secret.Ciphertext); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("scanning %s secret: %w", sc.kind, err)
+			}
+			secrets = append(secrets, secret)
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("iterating %s secrets: %w", sc.kind, err)
+		}
+	}
+	return secrets, nil
+}
+
+func secretColumnFor(kind repository.SecretKind) secretColumn {
+	for _, sc := range secretColumns {
+		if sc.kind == kind {
+			return sc
+		}
+	}
+	return secretColumn{}
+}
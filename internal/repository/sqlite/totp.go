@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type TOTPRepository struct {
+	db *sql.DB
+}
+
+func NewTOTPRepository(db *sql.DB) *TOTPRepository {
+	return &TOTPRepository{db: db}
+}
+
+func (r *TOTPRepository) Get(ctx context.Context, userID string) (*repository.TOTP, error) {
+	totp := &repository.TOTP{}
+	var codes string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT user_id, encrypted_secret, enabled, last_step, recovery_codes FROM user_totp WHERE user_id = ?`, userID,
+	).Scan(&totp.UserID, &totp.EncryptedSecret, &totp.Enabled, &totp.LastStep, &codes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting totp: %w", err)
+	}
+	if err := json.Unmarshal([]byte(codes), &totp.RecoveryCodes); err != nil {
+		return nil, fmt.Errorf("decoding recovery codes: %w", err)
+	}
+	return totp, nil
+}
+
+func (r *TOTPRepository) Save(ctx context.Context, totp *repository.TOTP) error {
+	codes, err := encodeRecoveryCodes(totp.RecoveryCodes)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO user_totp (user_id, encrypted_secret, enabled, last_step, recovery_codes)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			encrypted_secret = excluded.encrypted_secret,
+			enabled = excluded.enabled,
+			last_step = excluded.last_step,
+			recovery_codes = excluded.recovery_codes,
+			updated_at = CURRENT_TIMESTAMP`,
+		totp.UserID, totp.EncryptedSecret, totp.Enabled, totp.LastStep, codes)
+	if err != nil {
+		return fmt.Errorf("saving totp: %w", err)
+	}
+	return nil
+}
+
+func (r *TOTPRepository) Delete(ctx context.Context, userID string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("deleting totp: %w", err)
+	}
+	return nil
+}
+
+func (r *TOTPRepository) AdvanceStep(ctx context.Context, userID string, step int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("recording totp step: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *TOTPRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, old, codes []string) (bool, error) {
+	oldEncoded, err := encodeRecoveryCodes(old)
+	if err != nil {
+		return false, err
+	}
+	newEncoded, err := encodeRecoveryCodes(codes)
+	if err != nil {
+		return false, err
+	}
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE user_totp SET recovery_codes = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND recovery_codes = ?`,
+		newEncoded, userID, oldEncoded)
+	if err != nil {
+		return false, fmt.Errorf("updating recovery codes: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func encodeRecoveryCodes(codes []string) (string, error) {
+	if codes == nil {
+		codes = []string{}
+	}
+	b, err := json.Marshal(codes)
+	if err != nil {
+		return "", fmt.Errorf("encoding recovery codes: %w", err)
+	}
+	return string(b), nil
+}
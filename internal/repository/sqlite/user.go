@@ -8,6 +8,9 @@ import (
 	"github.com/sydlexius/media-reaper/internal/repository"
 )
 
+const userColumns = `id, username, password_hash, role, disabled, must_change_password,
+	auth_provider, COALESCE(external_id, ''), created_at, updated_at`
+
 type UserRepository struct {
 	db *sql.DB
 }
@@ -17,9 +20,12 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 }
 
 func (r *UserRepository) Create(ctx context.Context, user *repository.User) error {
-	query := `INSERT INTO users (id, username, password_hash, role, created_at, updated_at)
-	          VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
-	_, err := r.db.ExecContext(ctx, query, user.ID, user.Username, user.PasswordHash, user.Role)
+	query := `INSERT INTO users (id, username, password_hash, role, disabled, must_change_password,
+	          auth_provider, external_id, created_at, updated_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+	_, err := r.db.ExecContext(ctx, query,
+		user.ID, user.Username, user.PasswordHash, user.Role, user.Disabled, user.MustChangePassword,
+		authProviderOrLocal(user.AuthProvider), nullIfEmpty(user.ExternalID))
 	if err != nil {
 		return fmt.Errorf("creating user: %w", err)
 	}
@@ -27,13 +33,8 @@ func (r *UserRepository) Create(ctx context.Context, user *repository.User) erro
 }
 
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*repository.User, error) {
-	query := `SELECT id, username, password_hash, role, created_at, updated_at
-	          FROM users WHERE username = ?`
-	user := &repository.User{}
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
-		&user.ID, &user.Username, &user.PasswordHash, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, username))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -44,13 +45,8 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*r
 }
 
 func (r *UserRepository) GetByID(ctx context.Context, id string) (*repository.User, error) {
-	query := `SELECT id, username, password_hash, role, created_at, updated_at
-	          FROM users WHERE id = ?`
-	user := &repository.User{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Username, &user.PasswordHash, &user.Role,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -60,6 +56,58 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*repository.Us
 	return user, nil
 }
 
+func (r *UserRepository) GetByExternalID(ctx context.Context, provider, externalID string) (*repository.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE auth_provider = ? AND external_id = ?`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, provider, externalID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting user by external id: %w", err)
+	}
+	return user, nil
+}
+
+func (r *UserRepository) GetAll(ctx context.Context) ([]*repository.User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("listing users: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var users []*repository.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating users: %w", err)
+	}
+	return users, nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, user *repository.User) error {
+	query := `UPDATE users SET username = ?, password_hash = ?, role = ?, disabled = ?, must_change_password = ?,
+	          updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query,
+		user.Username, user.PasswordHash, user.Role, user.Disabled, user.MustChangePassword, user.ID)
+	if err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("deleting user: %w", err)
+	}
+	return nil
+}
+
 func (r *UserRepository) Count(ctx context.Context) (int, error) {
 	var count int
 	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
@@ -68,3 +116,41 @@ func (r *UserRepository) Count(ctx context.Context) (int, error) {
 	}
 	return count, nil
 }
+
+func (r *UserRepository) CountActiveAdmins(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM users WHERE role = ? AND disabled = 0`, repository.RoleAdmin).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting admins: %w", err)
+	}
+	return count, nil
+}
+
+func scanUser(s rowScanner) (*repository.User, error) {
+	user := &repository.User{}
+	err := s.Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Role,
+		&user.Disabled, &user.MustChangePassword,
+		&user.AuthProvider, &user.ExternalID,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func authProviderOrLocal(provider string) string {
+	if provider == "" {
+		return repository.AuthProviderLocal
+	}
+	return provider
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
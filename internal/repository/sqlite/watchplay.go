@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+const watchPlayColumns = `id, connection_id, media_user_id, user_name, item_id, item_name, item_type,
+	tmdb_id, tvdb_id, imdb_id, played_at, duration_seconds, source, imported_at`
+
+type WatchPlayRepository struct {
+	db *sql.DB
+}
+
+func NewWatchPlayRepository(db *sql.DB) *WatchPlayRepository {
+	return &WatchPlayRepository{db: db}
+}
+
+func (r *WatchPlayRepository) Import(ctx context.Context, plays []*repository.WatchPlay) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO watch_plays
+		(connection_id, media_user_id, user_name, item_id, item_name, item_type,
+		 tmdb_id, tvdb_id, imdb_id, played_at, duration_seconds, source, imported_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("preparing watch play insert: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	added := 0
+	for _, p := range plays {
+		result, err := stmt.ExecContext(ctx,
+			p.ConnectionID, p.MediaUserID, p.UserName, p.ItemID, p.ItemName, p.ItemType,
+			p.TMDBID, p.TVDBID, p.IMDBID, p.PlayedAt, p.DurationSeconds, p.Source, p.ImportedAt,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("importing watch play: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing watch plays: %w", err)
+	}
+	return added, nil
+}
+
+func (r *WatchPlayRepository) List(ctx context.Context, filter repository.WatchPlayFilter) ([]*repository.WatchPlay, error) {
+	query := `SELECT ` + watchPlayColumns + ` FROM watch_plays WHERE 1 = 1`
+	var args []any
+	if filter.ConnectionID != "" {
+		query += ` AND connection_id = ?`
+		args = append(args, filter.ConnectionID)
+	}
+	switch {
+	case filter.UserID != "" && filter.UserName != "":
+		query += ` AND (media_user_id = ? OR user_name = ? COLLATE NOCASE)`
+		args = append(args, filter.UserID, filter.UserName)
+	case filter.UserID != "":
+		query += ` AND media_user_id = ?`
+		args = append(args, filter.UserID)
+	case filter.UserName != "":
+		query += ` AND user_name = ? COLLATE NOCASE`
+		args = append(args, filter.UserName)
+	}
+	query += ` ORDER BY played_at DESC, id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing watch plays: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var plays []*repository.WatchPlay
+	for rows.Next() {
+		p := &repository.WatchPlay{}
+		if err := rows.Scan(&p.ID, &p.ConnectionID, &p.MediaUserID, &p.UserName, &p.ItemID, &p.ItemName, &p.ItemType,
+			&p.TMDBID, &p.TVDBID, &p.IMDBID, &p.PlayedAt, &p.DurationSeconds, &p.Source, &p.ImportedAt); err != nil {
+			return nil, fmt.Errorf("scanning watch play: %w", err)
+		}
+		plays = append(plays, p)
+	}
+	return plays, rows.Err()
+}
@@ -0,0 +1,66 @@
+package safeguard
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxTargets caps how many targets one check may name.
+const maxTargets = 1000
+
+type checkRequest struct {
+	Targets []Target `json:"targets"`
+}
+
+type checkResponse struct {
+	Results []*Result `json:"results"`
+	// Skipped counts results with status skipped.
+	Skipped int `json:"skipped"`
+}
+
+// CheckHandler reports which titles are safe to delete through Sonarr or Radarr.
+// Requires actions:execute.
+// @Summary Check titles before deleting them
+// @Description Check movies, series, or episodes against their Sonarr or Radarr queue and recent history before deleting them. Nothing in media-reaper calls this itself. Targets with a queue entry, or with a file imported or upgraded within MEDIA_REAPER_RECENT_IMPORT_WINDOW, are skipped with a reason. A series is matched by any of its episodes. Fails if a connection cannot be read.
+// @Tags safeguards
+// @Accept json
+// @Produce json
+// @Param request body checkRequest true "Targets"
+// @Success 200 {object} checkResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /safeguards/check [post]
+func (s *Service) CheckHandler(c echo.Context) error {
+	var req checkRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if len(req.Targets) == 0 || len(req.Targets) > maxTargets {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "targets must list 1 to 1000 items"})
+	}
+
+	results, err := s.Check(c.Request().Context(), req.Targets)
+	switch {
+	case errors.Is(err, ErrConnectionNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrInvalidTarget):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrArrUnavailable):
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to check targets"})
+	}
+
+	resp := checkResponse{Results: results}
+	for _, r := range results {
+		if r.Status == StatusSkipped {
+			resp.Skipped++
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
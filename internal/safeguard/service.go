@@ -0,0 +1,206 @@
+package safeguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/arrclient"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+var (
+	ErrConnectionNotFound = errors.New("connection not found")
+	ErrInvalidTarget      = errors.New("invalid target")
+	ErrArrUnavailable     = errors.New("could not read *arr instance")
+)
+
+// Result statuses.
+const (
+	StatusOK      = "ok"
+	StatusSkipped = "skipped"
+)
+
+// Target is something an action would delete through Sonarr or Radarr: a
+// movie, a whole series, or one episode.
+type Target struct {
+	ConnectionID string `json:"connectionId"`
+	MovieID      int64  `json:"movieId,omitempty"`
+	SeriesID     int64  `json:"seriesId,omitempty"`
+	EpisodeID    int64  `json:"episodeId,omitempty"`
+	Title        string `json:"title,omitempty"`
+}
+
+// Result says whether a target is safe to act on, and if not, why.
+type Result struct {
+	Target
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// activity is the queue and history of a Sonarr or Radarr instance.
+// Implemented by arrclient.SonarrClient and arrclient.RadarrClient.
+type activity interface {
+	GetQueue(ctx context.Context) ([]*arrclient.QueueItem, error)
+	GetHistorySince(ctx context.Context, since time.Time) ([]*arrclient.HistoryEvent, error)
+}
+
+// ConnectionSource looks up saved connections and decrypts their API keys.
+type ConnectionSource interface {
+	GetByID(ctx context.Context, id string) (*repository.Connection, error)
+	DecryptAPIKey(encrypted string) (string, error)
+}
+
+func newArrActivity(conn *repository.Connection, apiKey string) (activity, error) {
+	switch conn.Type {
+	case repository.ConnectionTypeRadarr:
+		return arrclient.NewRadarrClient(conn.URL, apiKey), nil
+	case repository.ConnectionTypeSonarr:
+		return arrclient.NewSonarrClient(conn.URL, apiKey), nil
+	default:
+		return nil, fmt.Errorf("%w: %s is not a sonarr or radarr connection", ErrInvalidTarget, conn.Name)
+	}
+}
+
+// Service tells whether titles are safe to delete through Sonarr or Radarr:
+// a target is skipped while it has an entry in the download queue, or if a
+// file for it was imported or upgraded within the recent import window.
+type Service struct {
+	connections ConnectionSource
+	window      time.Duration
+	newActivity func(conn *repository.Connection, apiKey string) (activity, error)
+	now         func() time.Time
+}
+
+// NewService creates a safeguard service. A window of 0 turns off the recent import
+// check; the queue is always checked.
+func NewService(connections ConnectionSource, window time.Duration) *Service {
+	return &Service{
+		connections: connections,
+		window:      window,
+		newActivity: newArrActivity,
+		now:         time.Now,
+	}
+}
+
+// Check returns a result for each target, in order. Each connection's queue
+// and history are read once. If any connection cannot be read the whole
+// check fails, since its targets would otherwise look safe.
+func (s *Service) Check(ctx context.Context, targets []Target) ([]*Result, error) {
+	byConn := make(map[string]*connActivity)
+	results := make([]*Result, len(targets))
+	for i, t := range targets {
+		act, ok := byConn[t.ConnectionID]
+		if !ok {
+			var err error
+			if act, err = s.load(ctx, t.ConnectionID); err != nil {
+				return nil, err
+			}
+			byConn[t.ConnectionID] = act
+		}
+		if err := act.validate(t); err != nil {
+			return nil, err
+		}
+
+		result := &Result{Target: t, Status: StatusOK}
+		if reason := act.reason(t, s.window); reason != "" {
+			result.Status = StatusSkipped
+			result.Reason = reason
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// connActivity is what one connection is working on.
+type connActivity struct {
+	conn    *repository.Connection
+	queue   []*arrclient.QueueItem
+	history []*arrclient.HistoryEvent
+}
+
+func (s *Service) load(ctx context.Context, connectionID string) (*connActivity, error) {
+	conn, err := s.connections.GetByID(ctx, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching connection: %w", err)
+	}
+	if conn == nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnectionNotFound, connectionID)
+	}
+	apiKey, err := s.connections.DecryptAPIKey(conn.EncryptedAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting api key: %w", err)
+	}
+	client, err := s.newActivity(conn, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	act := &connActivity{conn: conn}
+	if act.queue, err = client.GetQueue(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrArrUnavailable, conn.Name, err)
+	}
+	if s.window > 0 {
+		var events []*arrclient.HistoryEvent
+		if events, err = client.GetHistorySince(ctx, s.now().Add(-s.window)); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrArrUnavailable, conn.Name, err)
+		}
+		for _, e := range events {
+			if e.Imported() {
+				act.history = append(act.history, e)
+			}
+		}
+	}
+	return act, nil
+}
+
+func (a *connActivity) validate(t Target) error {
+	switch a.conn.Type {
+	case repository.ConnectionTypeRadarr:
+		if t.MovieID <= 0 || t.SeriesID != 0 || t.EpisodeID != 0 {
+			return fmt.Errorf("%w: radarr targets need a movieId", ErrInvalidTarget)
+		}
+	case repository.ConnectionTypeSonarr:
+		if t.SeriesID <= 0 || t.MovieID != 0 {
+			return fmt.Errorf("%w: sonarr targets need a seriesId", ErrInvalidTarget)
+		}
+	}
+	return nil
+}
+
+// reason returns why t must be skipped, or "" if it is safe. A series is
+// matched by any of its episodes, an episode only by itself.
+func (a *connActivity) reason(t Target, window time.Duration) string {
+	matches := func(movieID, seriesID, episodeID int64) bool {
+		switch {
+		case t.MovieID != 0:
+			return movieID == t.MovieID
+		case t.EpisodeID != 0:
+			return episodeID == t.EpisodeID
+		default:
+			return seriesID == t.SeriesID
+		}
+	}
+
+	for _, q := range a.queue {
+		if matches(q.MovieID, q.SeriesID, q.EpisodeID) {
+			return fmt.Sprintf("in the download queue (%s): %s", q.Status, q.Title)
+		}
+	}
+	for _, e := range a.history {
+		if matches(e.MovieID, e.SeriesID, e.EpisodeID) {
+			return fmt.Sprintf("file imported or upgraded at %s, within the last %s",
+				e.Date.UTC().Format(time.RFC3339), formatWindow(window))
+		}
+	}
+	return ""
+}
+
+// formatWindow prints whole hours as "48h" rather than "48h0m0s".
+func formatWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return d.String()
+}
@@ -0,0 +1,140 @@
+package safeguard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/arrclient"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type stubConnections map[string]*repository.Connection
+
+func (s stubConnections) GetByID(_ context.Context, id string) (*repository.Connection, error) {
+	return s[id], nil
+}
+
+func (s stubConnections) DecryptAPIKey(encrypted string) (string, error) {
+	return encrypted, nil
+}
+
+type fakeActivity struct {
+	queue   []*arrclient.QueueItem
+	history []*arrclient.HistoryEvent
+	since   time.Time
+	err     error
+}
+
+func (f *fakeActivity) GetQueue(context.Context) ([]*arrclient.QueueItem, error) {
+	return f.queue, f.err
+}
+
+func (f *fakeActivity) GetHistorySince(_ context.Context, since time.Time) ([]*arrclient.HistoryEvent, error) {
+	f.since = since
+	return f.history, f.err
+}
+
+func setupTestService(t *testing.T, window time.Duration) (*Service, map[string]*fakeActivity) {
+	t.Helper()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	arrs := map[string]*fakeActivity{
+		"radarr-1": {
+			queue: []*arrclient.QueueItem{{ID: 1, MovieID: 10, Title: "Heat.2160p", Status: "downloading"}},
+			history: []*arrclient.HistoryEvent{
+				{MovieID: 11, EventType: arrclient.EventDownloadFolderImported, Date: now.Add(-2 * time.Hour)},
+				{MovieID: 12, EventType: "grabbed", Date: now.Add(-time.Hour)},
+			},
+		},
+		"sonarr-1": {
+			queue: []*arrclient.QueueItem{{ID: 2, SeriesID: 5, EpisodeID: 51, Title: "Show.S01E01", Status: "queued"}},
+			history: []*arrclient.HistoryEvent{
+				{SeriesID: 6, EpisodeID: 61, EventType: arrclient.EventDownloadFolderImported, Date: now.Add(-time.Hour)},
+			},
+		},
+	}
+	svc := NewService(stubConnections{
+		"radarr-1": {ID: "radarr-1", Name: "Radarr", Type: repository.ConnectionTypeRadarr},
+		"sonarr-1": {ID: "sonarr-1", Name: "Sonarr", Type: repository.ConnectionTypeSonarr},
+		"emby-1":   {ID: "emby-1", Name: "Emby", Type: repository.ConnectionTypeEmby},
+	}, window)
+	svc.newActivity = func(conn *repository.Connection, _ string) (activity, error) {
+		if a, ok := arrs[conn.ID]; ok {
+			return a, nil
+		}
+		return newArrActivity(conn, "")
+	}
+	svc.now = func() time.Time { return now }
+	return svc, arrs
+}
+
+func TestCheck(t *testing.T) {
+	svc, arrs := setupTestService(t, 48*time.Hour)
+
+	results, err := svc.Check(context.Background(), []Target{
+		{ConnectionID: "radarr-1", MovieID: 10},
+		{ConnectionID: "radarr-1", MovieID: 11},
+		{ConnectionID: "radarr-1", MovieID: 12},
+		{ConnectionID: "sonarr-1", SeriesID: 5},
+		{ConnectionID: "sonarr-1", SeriesID: 5, EpisodeID: 52},
+		{ConnectionID: "sonarr-1", SeriesID: 6, EpisodeID: 61},
+		{ConnectionID: "sonarr-1", SeriesID: 7},
+	})
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	want := []struct{ status, reason string }{
+		{StatusSkipped, "in the download queue (downloading)"},
+		{StatusSkipped, "imported or upgraded"},
+		{StatusOK, ""}, // grabbed, not imported
+		{StatusSkipped, "in the download queue (queued)"},
+		{StatusOK, ""}, // another episode of the series is queued
+		{StatusSkipped, "within the last 48h"},
+		{StatusOK, ""},
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.Status != w.status || !strings.Contains(r.Reason, w.reason) {
+			t.Errorf("result %d = %s %q, want %s containing %q", i, r.Status, r.Reason, w.status, w.reason)
+		}
+	}
+	if got := arrs["radarr-1"].since; !got.Equal(svc.now().Add(-48 * time.Hour)) {
+		t.Errorf("history read since %v, want 48h ago", got)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	svc, arrs := setupTestService(t, 0)
+	ctx := context.Background()
+
+	results, err := svc.Check(ctx, []Target{{ConnectionID: "radarr-1", MovieID: 11}})
+	if err != nil || results[0].Status != StatusOK {
+		t.Errorf("with no window, recent imports should not skip: %+v, %v", results, err)
+	}
+	if !arrs["radarr-1"].since.IsZero() {
+		t.Error("history should not be read with no window")
+	}
+
+	for _, tc := range []struct {
+		target Target
+		want   error
+	}{
+		{Target{ConnectionID: "missing", MovieID: 1}, ErrConnectionNotFound},
+		{Target{ConnectionID: "emby-1", MovieID: 1}, ErrInvalidTarget},
+		{Target{ConnectionID: "radarr-1", SeriesID: 1}, ErrInvalidTarget},
+		{Target{ConnectionID: "sonarr-1", EpisodeID: 1}, ErrInvalidTarget},
+	} {
+		if _, err := svc.Check(ctx, []Target{tc.target}); !errors.Is(err, tc.want) {
+			t.Errorf("Check(%+v) = %v, want %v", tc.target, err, tc.want)
+		}
+	}
+
+	arrs["sonarr-1"].err = errors.New("connection refused")
+	if _, err := svc.Check(ctx, []Target{{ConnectionID: "sonarr-1", SeriesID: 5}}); !errors.Is(err, ErrArrUnavailable) {
+		t.Errorf("unreachable sonarr: got %v, want ErrArrUnavailable", err)
+	}
+}
@@ -2,20 +2,66 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sydlexius/media-reaper/internal/auth"
+	"github.com/sydlexius/media-reaper/internal/repository"
 )
 
+// passwordChangePath is the only protected route a user with a forced
+// password reset may call.
+const passwordChangePath = "/api/auth/password"
+
+// mfaEnrollmentPaths are the protected routes an admin who must enroll in
+// two-factor authentication may call before enrolling.
+var mfaEnrollmentPaths = []string{
+	"/api/auth/mfa",
+	"/api/auth/mfa/totp",
+	"/api/auth/mfa/totp/confirm",
+	passwordChangePath,
+}
+
+// contextKeyAPIToken holds the API token a request authenticated with, if any.
+const contextKeyAPIToken = "apiToken"
+
+// RequireAuth accepts either a session cookie or an API token sent as
+// "Authorization: Bearer <token>" or "X-Api-Key: <token>". A request that
+// presents a token is judged on the token alone.
 func RequireAuth(authService *auth.Service) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			user, err := authService.GetUserFromSession(c.Request().Context(), c.Request())
-			if err != nil {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+			var user *repository.User
+			var err error
+			if raw := apiTokenFromRequest(c.Request()); raw != "" {
+				var token *repository.APIToken
+				user, token, err = authService.AuthenticateToken(c.Request().Context(), raw)
+				if err != nil || user == nil {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid api token"})
+				}
+				c.Set(contextKeyAPIToken, token)
+			} else {
+				user, err = authService.GetUserFromSession(c.Request().Context(), c.Request())
+				if err != nil {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid session"})
+				}
+				if user == nil {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+				}
 			}
-			if user == nil {
-				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+
+			if user.MustChangePassword && c.Path() != passwordChangePath {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "password change required"})
+			}
+			if !slices.Contains(mfaEnrollmentPaths, c.Path()) {
+				required, err := authService.MFAEnrollmentRequired(c.Request().Context(), user)
+				if err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+				}
+				if required {
+					return c.JSON(http.StatusForbidden, map[string]string{"error": "two-factor enrollment required"})
+				}
 			}
 
 			c.Set("user", user)
@@ -23,3 +69,49 @@ func RequireAuth(authService *auth.Service) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// RequirePermission rejects users whose role does not grant perm, and API
+// tokens that were not given perm as a scope. It must run after RequireAuth.
+func RequirePermission(perm auth.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, ok := c.Get("user").(*repository.User)
+			if !ok || !auth.HasPermission(user.Role, perm) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "insufficient permissions: " + string(perm) + " required",
+				})
+			}
+			if token, ok := c.Get(contextKeyAPIToken).(*repository.APIToken); ok && !auth.TokenAllows(token, perm) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "api token lacks scope: " + string(perm),
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireSession rejects requests authenticated with an API token, for
+// account endpoints such as password changes and token management that a
+// leaked token must not be able to reach. It must run after RequireAuth.
+func RequireSession() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Get(contextKeyAPIToken) != nil {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "this endpoint requires a browser session"})
+			}
+			return next(c)
+		}
+	}
+}
+
+func apiTokenFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
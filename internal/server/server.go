@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -15,7 +16,13 @@ import (
 	"github.com/sydlexius/media-reaper/internal/auth"
 	"github.com/sydlexius/media-reaper/internal/config"
 	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/directdelete"
+	"github.com/sydlexius/media-reaper/internal/history"
+	"github.com/sydlexius/media-reaper/internal/notify"
+	"github.com/sydlexius/media-reaper/internal/safeguard"
 	authmw "github.com/sydlexius/media-reaper/internal/server/middleware"
+	"github.com/sydlexius/media-reaper/internal/user"
+	"github.com/sydlexius/media-reaper/internal/watch"
 	"github.com/sydlexius/media-reaper/web"
 
 	_ "github.com/sydlexius/media-reaper/docs"
@@ -26,45 +33,172 @@ type Server struct {
 	cfg               *config.Config
 	authService       *auth.Service
 	connectionService *connection.Service
+	historyService    *history.Service
+	watchService      *watch.Service
+	directDelete      *directdelete.Service
+	safeguards        *safeguard.Service
+	notifyService     *notify.Service
+	keyRotator        *connection.KeyRotator
+	userService       *user.Service
 }
 
-func New(cfg *config.Config, authService *auth.Service, connectionService *connection.Service) *Server {
+func New(
+	cfg *config.Config,
+	authService *auth.Service,
+	connectionService *connection.Service,
+	historyService *history.Service,
+	watchService *watch.Service,
+	directDelete *directdelete.Service,
+	safeguards *safeguard.Service,
+	notifyService *notify.Service,
+	keyRotator *connection.KeyRotator,
+	userService *user.Service,
+) *Server {
 	e := echo.New()
 	e.HideBanner = true
+	e.IPExtractor = ipExtractor(cfg.TrustedProxies)
 
 	e.Use(echomw.Logger()) //nolint:staticcheck // TODO(#59): replace with slog RequestLogger
 	e.Use(echomw.Recover())
+	e.Use(securityHeaders(cfg.SecureCookies))
 
-	s := &Server{echo: e, cfg: cfg, authService: authService, connectionService: connectionService}
+	s := &Server{
+		echo:              e,
+		cfg:               cfg,
+		authService:       authService,
+		connectionService: connectionService,
+		historyService:    historyService,
+		watchService:      watchService,
+		directDelete:      directDelete,
+		safeguards:        safeguards,
+		notifyService:     notifyService,
+		keyRotator:        keyRotator,
+		userService:       userService,
+	}
 	s.registerRoutes()
 	s.registerSPA()
 	return s
 }
 
 func (s *Server) registerRoutes() {
-	api := s.echo.Group("/api")
+	api := s.echo.Group("/api", authmw.CSRF(s.cfg.SecureCookies))
 
 	// Public routes
 	api.GET("/health", s.healthHandler)
-	api.GET("/docs/*", echoSwagger.WrapHandler)
+	api.GET("/docs/*", echoSwagger.WrapHandler, docsContentSecurityPolicy)
 
 	// Auth routes (public, login has rate limiting)
 	authGroup := api.Group("/auth")
 	authGroup.POST("/login", s.authService.LoginHandler, s.loginRateLimiter())
+	authGroup.POST("/login/mfa", s.authService.MFALoginHandler, s.loginRateLimiter())
 	authGroup.POST("/logout", s.authService.LogoutHandler)
 	authGroup.GET("/me", s.authService.MeHandler)
+	authGroup.GET("/providers", s.authService.ProvidersHandler)
+	authGroup.GET("/csrf", s.csrfHandler)
+	authGroup.GET("/oidc/login", s.authService.OIDCLoginHandler, s.loginRateLimiter())
+	authGroup.GET("/oidc/callback", s.authService.OIDCCallbackHandler)
 
 	// Protected routes
 	protected := api.Group("", authmw.RequireAuth(s.authService))
 
+	// Own account, sessions, API tokens, and two-factor setup. These need a
+	// browser session so an API token cannot change the password or mint more
+	// tokens.
+	account := protected.Group("/auth", authmw.RequireSession())
+	account.PUT("/password", s.authService.ChangePasswordHandler)
+	account.GET("/sessions", s.authService.ListSessionsHandler)
+	account.DELETE("/sessions", s.authService.RevokeOtherSessionsHandler)
+	account.DELETE("/sessions/:id", s.authService.RevokeSessionHandler)
+	account.GET("/tokens", s.authService.ListTokensHandler)
+	account.POST("/tokens", s.authService.CreateTokenHandler)
+	account.DELETE("/tokens/:id", s.authService.RevokeTokenHandler)
+	account.GET("/mfa", s.authService.MFAStatusHandler)
+	account.POST("/mfa/totp", s.authService.BeginTOTPHandler)
+	account.POST("/mfa/totp/confirm", s.authService.ConfirmTOTPHandler)
+	account.POST("/mfa/totp/disable", s.authService.DisableTOTPHandler)
+	account.POST("/mfa/recovery-codes", s.authService.RegenerateRecoveryCodesHandler)
+	account.GET("/mfa/policy", s.authService.MFAPolicyHandler, authmw.RequirePermission(auth.PermSystemManage))
+	account.PUT("/mfa/policy", s.authService.UpdateMFAPolicyHandler, authmw.RequirePermission(auth.PermSystemManage))
+
+	// Routes below are grouped by the permission they require; see
+	// auth.rolePermissions for which roles grant what.
+	connRead := authmw.RequirePermission(auth.PermConnectionsRead)
+	connWrite := authmw.RequirePermission(auth.PermConnectionsWrite)
+	activityRead := authmw.RequirePermission(auth.PermActivityRead)
+	mediaRead := authmw.RequirePermission(auth.PermMediaRead)
+
+	// User management
+	usersGroup := protected.Group("/users", authmw.RequirePermission(auth.PermUsersManage))
+	usersGroup.GET("", s.userService.ListHandler)
+	usersGroup.GET("/login-attempts", s.authService.ListLoginAttemptsHandler)
+	usersGroup.GET("/lockouts", s.authService.ListLockoutsHandler)
+	usersGroup.POST("", s.userService.CreateHandler)
+	usersGroup.GET("/:id", s.userService.GetHandler)
+	usersGroup.PUT("/:id", s.userService.UpdateHandler)
+	usersGroup.DELETE("/:id", s.userService.DeleteHandler)
+	usersGroup.POST("/:id/reset-password", s.userService.ResetPasswordHandler)
+	usersGroup.DELETE("/:id/sessions", s.authService.RevokeUserSessionsHandler)
+	usersGroup.DELETE("/:id/mfa", s.authService.ResetUserMFAHandler)
+	usersGroup.DELETE("/:id/lockout", s.authService.UnlockUserHandler)
+
 	// Connection management (test routes before :id to avoid param capture)
-	protected.POST("/connections/test", s.connectionService.TestUnsavedHandler)
-	protected.POST("/connections", s.connectionService.CreateHandler)
-	protected.GET("/connections", s.connectionService.ListHandler)
-	protected.GET("/connections/:id", s.connectionService.GetHandler)
-	protected.PUT("/connections/:id", s.connectionService.UpdateHandler)
-	protected.DELETE("/connections/:id", s.connectionService.DeleteHandler)
-	protected.POST("/connections/:id/test", s.connectionService.TestSavedHandler)
+	connGroup := protected.Group("/connections")
+	connGroup.POST("/test", s.connectionService.TestUnsavedHandler, connWrite)
+	connGroup.POST("", s.connectionService.CreateHandler, connWrite)
+	connGroup.GET("", s.connectionService.ListHandler, connRead)
+	connGroup.GET("/:id", s.connectionService.GetHandler, connRead)
+	connGroup.PUT("/:id", s.connectionService.UpdateHandler, connWrite)
+	connGroup.DELETE("/:id", s.connectionService.DeleteHandler, connWrite)
+	connGroup.POST("/:id/test", s.connectionService.TestSavedHandler, connWrite)
+	connGroup.GET("/:id/health", s.connectionService.HealthHandler, connRead)
+	connGroup.GET("/:id/direct-delete", s.directDelete.GetPolicyHandler, connRead)
+	connGroup.PUT("/:id/direct-delete", s.directDelete.SetPolicyHandler, connWrite)
+	connGroup.GET("/:id/direct-delete/candidates", s.directDelete.ListCandidatesHandler, activityRead)
+	connGroup.POST("/:id/direct-delete/candidates", s.directDelete.FlagHandler, authmw.RequirePermission(auth.PermActionsExecute))
+	connGroup.DELETE("/:id/direct-delete/candidates/:itemId", s.directDelete.UnflagHandler, authmw.RequirePermission(auth.PermActionsExecute))
+	connGroup.POST("/:id/direct-delete/run", s.directDelete.RunHandler, authmw.RequirePermission(auth.PermActionsExecute))
+
+	// Deletion history
+	historyGroup := protected.Group("/history")
+	historyGroup.GET("", s.historyService.ListHandler, activityRead)
+	historyGroup.GET("/:id", s.historyService.GetHandler, activityRead)
+	historyGroup.POST("/:id/restore", s.historyService.RestoreHandler, authmw.RequirePermission(auth.PermActionsExecute))
+
+	// Queue and recent import checks for bulk action targets
+	protected.POST("/safeguards/check", s.safeguards.CheckHandler, authmw.RequirePermission(auth.PermActionsExecute))
+
+	// What is playing on the media servers, for the dashboard
+	protected.GET("/now-playing", s.connectionService.NowPlayingHandler, activityRead)
+
+	// Items flagged for direct deletion, without paths or who flagged them
+	protected.GET("/leaving-soon", s.directDelete.LeavingSoonHandler, mediaRead)
+
+	// The caller's own sessions and plays, for users without activity:read
+	meGroup := protected.Group("/me", mediaRead)
+	meGroup.GET("/now-playing", s.connectionService.MyNowPlayingHandler)
+	meGroup.GET("/watch-history", s.watchService.MyListHandler)
+
+	// Imported watch history
+	watchGroup := protected.Group("/watch-history")
+	watchGroup.GET("", s.watchService.ListHandler, activityRead)
+	watchGroup.GET("/played", s.watchService.PlayedHandler, activityRead)
+	watchGroup.GET("/unplayed-albums", s.watchService.UnplayedAlbumsHandler, activityRead)
+	watchGroup.POST("/import", s.watchService.ImportHandler, connWrite)
+
+	// Notification providers (events before :id to avoid param capture)
+	notifyGroup := protected.Group("/notifications", authmw.RequirePermission(auth.PermNotificationsWrite))
+	notifyGroup.GET("/events", s.notifyService.EventsHandler)
+	notifyGroup.POST("", s.notifyService.CreateHandler)
+	notifyGroup.GET("", s.notifyService.ListHandler)
+	notifyGroup.GET("/:id", s.notifyService.GetHandler)
+	notifyGroup.PUT("/:id", s.notifyService.UpdateHandler)
+	notifyGroup.DELETE("/:id", s.notifyService.DeleteHandler)
+	notifyGroup.POST("/:id/test", s.notifyService.TestHandler)
+
+	// Master key rotation
+	encryptionGroup := protected.Group("/encryption", authmw.RequirePermission(auth.PermSystemManage))
+	encryptionGroup.GET("/status", s.keyRotator.StatusHandler)
+	encryptionGroup.POST("/rotate", s.keyRotator.RotateHandler)
 }
 
 func (s *Server) registerSPA() {
@@ -109,6 +243,58 @@ func (s *Server) registerSPA() {
 	})
 }
 
+// contentSecurityPolicy fits the embedded SPA: everything is served from this
+// origin, and only inline styles are allowed, which the UI library uses.
+const contentSecurityPolicy = "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data:; font-src 'self' data:; connect-src 'self'; object-src 'none'; " +
+	"base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// securityHeaders sets hardening headers on every response. HSTS is only
+// sent when cookies are marked secure, as that means the app is served over
+// HTTPS.
+func securityHeaders(https bool) echo.MiddlewareFunc {
+	config := echomw.SecureConfig{
+		XSSProtection:         "0",
+		ContentTypeNosniff:    "nosniff",
+		XFrameOptions:         "DENY",
+		ContentSecurityPolicy: contentSecurityPolicy,
+		ReferrerPolicy:        "same-origin",
+	}
+	if https {
+		config.HSTSMaxAge = 365 * 24 * 60 * 60
+	}
+	return echomw.SecureWithConfig(config)
+}
+
+// docsContentSecurityPolicy relaxes the policy for Swagger UI, whose page
+// starts up with an inline script.
+func docsContentSecurityPolicy(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentSecurityPolicy,
+			"default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; "+
+				"img-src 'self' data:; object-src 'none'; base-uri 'self'; frame-ancestors 'none'")
+		return next(c)
+	}
+}
+
+// ipExtractor decides how RealIP finds the client address. Forwarding headers
+// are only believed from the given proxies; otherwise anyone could pick the
+// address their login attempts are rate limited and audited under.
+func ipExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipNet := range trustedProxies {
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
 func (s *Server) loginRateLimiter() echo.MiddlewareFunc {
 	rateLimiterConfig := echomw.RateLimiterConfig{
 		Skipper: echomw.DefaultSkipper,
@@ -136,15 +322,29 @@ func (s *Server) loginRateLimiter() echo.MiddlewareFunc {
 
 // healthHandler returns the service health status.
 // @Summary Health check
-// @Description Returns service health status
+// @Description Returns service health status. Status is "degraded" when stored secrets could not all be decrypted with the configured master keys at startup or the last key check; /encryption/status has the details.
 // @Tags system
 // @Produce json
 // @Success 200 {object} map[string]string
 // @Router /health [get]
 func (s *Server) healthHandler(c echo.Context) error {
+	if s.keyRotator.Degraded() {
+		return c.JSON(http.StatusOK, map[string]string{"status": "degraded"})
+	}
 	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
 }
 
+// csrfHandler returns the CSRF token to send with state-changing requests.
+// @Summary CSRF token
+// @Description Return the CSRF token for this browser and set its cookie. Send the token in the X-CSRF-Token header on every request that is not GET, HEAD, or OPTIONS. Requests authenticated with an API token do not need it.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /auth/csrf [get]
+func (s *Server) csrfHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"token": authmw.CSRFToken(c)})
+}
+
 func (s *Server) Start() error {
 	return s.echo.Start(fmt.Sprintf(":%d", s.cfg.Port))
 }
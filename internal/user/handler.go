@@ -0,0 +1,220 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+type createRequest struct {
+	Username           string `json:"username"`
+	Password           string `json:"password"` //nolint:gosec // request DTO, not a hardcoded secret
+	Role               string `json:"role"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+}
+
+type updateRequest struct {
+	Username *string `json:"username,omitempty"`
+	Role     *string `json:"role,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
+}
+
+type resetPasswordRequest struct {
+	Password string `json:"password"` //nolint:gosec // request DTO, not a hardcoded secret
+}
+
+type userResponse struct {
+	ID                 string `json:"id"`
+	Username           string `json:"username"`
+	Role               string `json:"role"`
+	Disabled           bool   `json:"disabled"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+	AuthProvider       string `json:"authProvider"`
+	CreatedAt          string `json:"createdAt"`
+	UpdatedAt          string `json:"updatedAt"`
+}
+
+func toResponse(u *repository.User) userResponse {
+	return userResponse{
+		ID:                 u.ID,
+		Username:           u.Username,
+		Role:               u.Role,
+		Disabled:           u.Disabled,
+		MustChangePassword: u.MustChangePassword,
+		AuthProvider:       u.AuthProvider,
+		CreatedAt:          u.CreatedAt,
+		UpdatedAt:          u.UpdatedAt,
+	}
+}
+
+// errorResponse maps service errors to HTTP responses.
+func errorResponse(c echo.Context, err error, fallback string) error {
+	switch {
+	case errors.Is(err, ErrInvalidUser):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrLastAdmin):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fallback})
+	}
+}
+
+// ListHandler lists users.
+// @Summary List users
+// @Description List all local users
+// @Tags users
+// @Produce json
+// @Success 200 {array} userResponse
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users [get]
+func (s *Service) ListHandler(c echo.Context) error {
+	users, err := s.GetAll(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list users"})
+	}
+
+	resp := make([]userResponse, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, toResponse(u))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// CreateHandler creates a user.
+// @Summary Create user
+// @Description Create a local user with the admin, operator, or viewer role
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body createRequest true "User details"
+// @Success 201 {object} userResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users [post]
+func (s *Service) CreateHandler(c echo.Context) error {
+	var req createRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	u, err := s.Create(c.Request().Context(), CreateInput(req))
+	if err != nil {
+		return errorResponse(c, err, "failed to create user")
+	}
+	return c.JSON(http.StatusCreated, toResponse(u))
+}
+
+// GetHandler returns a single user.
+// @Summary Get user
+// @Description Get a local user by ID
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} userResponse
+// @Failure 404 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/{id} [get]
+func (s *Service) GetHandler(c echo.Context) error {
+	u, err := s.GetByID(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get user"})
+	}
+	if u == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	return c.JSON(http.StatusOK, toResponse(u))
+}
+
+// UpdateHandler updates a user's username, role, or disabled state.
+// @Summary Update user
+// @Description Rename, change the role of, or disable a user. Disabling logs the user out. The last enabled admin cannot be demoted or disabled.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body updateRequest true "Fields to change"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/{id} [put]
+func (s *Service) UpdateHandler(c echo.Context) error {
+	var req updateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	u, err := s.Update(c.Request().Context(), c.Param("id"), UpdateInput(req))
+	if err != nil {
+		return errorResponse(c, err, "failed to update user")
+	}
+	if u == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	return c.JSON(http.StatusOK, toResponse(u))
+}
+
+// DeleteHandler deletes a user.
+// @Summary Delete user
+// @Description Delete a user and their sessions. The last enabled admin cannot be deleted.
+// @Tags users
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/{id} [delete]
+func (s *Service) DeleteHandler(c echo.Context) error {
+	found, err := s.Delete(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return errorResponse(c, err, "failed to delete user")
+	}
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ResetPasswordHandler sets a temporary password for a user.
+// @Summary Force password reset
+// @Description Set a temporary password that the user must change at next login. The user is logged out everywhere.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body resetPasswordRequest true "Temporary password"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /users/{id}/reset-password [post]
+func (s *Service) ResetPasswordHandler(c echo.Context) error {
+	var req resetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	u, err := s.ResetPassword(c.Request().Context(), c.Param("id"), req.Password)
+	if err != nil {
+		return errorResponse(c, err, "failed to reset password")
+	}
+	if u == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+	return c.JSON(http.StatusOK, toResponse(u))
+}
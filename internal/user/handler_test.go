@@ -0,0 +1,248 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	_ "modernc.org/sqlite"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+)
+
+type testEnv struct {
+	svc *Service
+	db  *sql.DB
+}
+
+func setupTestService(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := db.Exec("PRAGMA foreign_keys=ON"); err != nil {
+		t.Fatalf("enabling foreign keys: %v", err)
+	}
+
+	schema := `
+	CREATE TABLE users (
+		id                   TEXT PRIMARY KEY,
+		username             TEXT NOT NULL UNIQUE,
+		password_hash        TEXT NOT NULL,
+		role                 TEXT NOT NULL DEFAULT 'admin',
+		disabled             INTEGER NOT NULL DEFAULT 0,
+		must_change_password INTEGER NOT NULL DEFAULT 0,
+		auth_provider        TEXT NOT NULL DEFAULT 'local',
+		external_id          TEXT,
+		created_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE sessions (
+		id           TEXT PRIMARY KEY,
+		user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash   TEXT NOT NULL UNIQUE,
+		user_agent   TEXT NOT NULL DEFAULT '',
+		ip_address   TEXT NOT NULL DEFAULT '',
+		created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at   TIMESTAMP NOT NULL
+	)`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+
+	users := sqliterepo.NewUserRepository(db)
+	sessions := sqliterepo.NewSessionRepository(db)
+	for _, u := range []*repository.User{
+		{ID: "u-admin", Username: "admin", PasswordHash: "x", Role: repository.RoleAdmin},
+		{ID: "u-viewer", Username: "viewer", PasswordHash: "x", Role: repository.RoleViewer},
+	} {
+		if err := users.Create(context.Background(), u); err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+	}
+	return &testEnv{svc: NewService(users, sessions), db: db}
+}
+
+func (env *testEnv) addSession(t *testing.T, userID string) {
+	t.Helper()
+	_, err := env.db.Exec(`INSERT INTO sessions (id, user_id, token_hash, expires_at) VALUES (?, ?, ?, '2999-01-01T00:00:00Z')`,
+		userID+"-session", userID, userID+"-hash")
+	if err != nil {
+		t.Fatalf("adding session: %v", err)
+	}
+}
+
+func (env *testEnv) sessionCount(t *testing.T, userID string) int {
+	t.Helper()
+	var n int
+	if err := env.db.QueryRow(`SELECT COUNT(*) FROM sessions WHERE user_id = ?`, userID).Scan(&n); err != nil {
+		t.Fatalf("counting sessions: %v", err)
+	}
+	return n
+}
+
+func newTestContext(method, path, body string, params ...string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	var req *http.Request
+	if body != "" {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if len(params) == 2 {
+		c.SetParamNames(params[0])
+		c.SetParamValues(params[1])
+	}
+	return c, rec
+}
+
+func TestCreateHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "valid operator", body: `{"username":"ops","password":"longenough","role":"operator"}`, wantCode: http.StatusCreated},
+		{name: "unknown role", body: `{"username":"ops","password":"longenough","role":"root"}`, wantCode: http.StatusBadRequest},
+		{name: "short password", body: `{"username":"ops","password":"short","role":"viewer"}`, wantCode: http.StatusBadRequest},
+		{name: "missing username", body: `{"username":" ","password":"longenough","role":"viewer"}`, wantCode: http.StatusBadRequest},
+		{name: "duplicate username", body: `{"username":"viewer","password":"longenough","role":"viewer"}`, wantCode: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setupTestService(t)
+			c, rec := newTestContext(http.MethodPost, "/api/users", tt.body)
+			if err := env.svc.CreateHandler(c); err != nil {
+				t.Fatalf("CreateHandler: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if rec.Code != http.StatusCreated {
+				return
+			}
+
+			var resp userResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Role != repository.RoleOperator || resp.Disabled || resp.ID == "" {
+				t.Errorf("unexpected user: %+v", resp)
+			}
+			if strings.Contains(rec.Body.String(), "longenough") || strings.Contains(rec.Body.String(), "password_hash") {
+				t.Error("response must not contain the password or its hash")
+			}
+		})
+	}
+}
+
+func TestLastAdminSafeguard(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(env *testEnv) (echo.Context, *httptest.ResponseRecorder, func(echo.Context) error)
+	}{
+		{name: "demote", call: func(env *testEnv) (echo.Context, *httptest.ResponseRecorder, func(echo.Context) error) {
+			c, rec := newTestContext(http.MethodPut, "/api/users/u-admin", `{"role":"viewer"}`, "id", "u-admin")
+			return c, rec, env.svc.UpdateHandler
+		}},
+		{name: "disable", call: func(env *testEnv) (echo.Context, *httptest.ResponseRecorder, func(echo.Context) error) {
+			c, rec := newTestContext(http.MethodPut, "/api/users/u-admin", `{"disabled":true}`, "id", "u-admin")
+			return c, rec, env.svc.UpdateHandler
+		}},
+		{name: "delete", call: func(env *testEnv) (echo.Context, *httptest.ResponseRecorder, func(echo.Context) error) {
+			c, rec := newTestContext(http.MethodDelete, "/api/users/u-admin", "", "id", "u-admin")
+			return c, rec, env.svc.DeleteHandler
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setupTestService(t)
+			c, rec, handler := tt.call(env)
+			if err := handler(c); err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("expected 409 for last admin, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			// With a second admin the same change is allowed.
+			second := `{"username":"admin2","password":"longenough","role":"admin"}`
+			cc, crec := newTestContext(http.MethodPost, "/api/users", second)
+			if err := env.svc.CreateHandler(cc); err != nil || crec.Code != http.StatusCreated {
+				t.Fatalf("creating second admin: %v (%d)", err, crec.Code)
+			}
+			c, rec, handler = tt.call(env)
+			if err := handler(c); err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			if rec.Code != http.StatusOK && rec.Code != http.StatusNoContent {
+				t.Errorf("expected success with another admin, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDisableRevokesSessions(t *testing.T) {
+	env := setupTestService(t)
+	env.addSession(t, "u-viewer")
+
+	c, rec := newTestContext(http.MethodPut, "/api/users/u-viewer", `{"disabled":true}`, "id", "u-viewer")
+	if err := env.svc.UpdateHandler(c); err != nil {
+		t.Fatalf("UpdateHandler: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if n := env.sessionCount(t, "u-viewer"); n != 0 {
+		t.Errorf("expected sessions to be revoked, %d remain", n)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	env := setupTestService(t)
+	env.addSession(t, "u-viewer")
+
+	c, rec := newTestContext(http.MethodPost, "/api/users/u-viewer/reset-password", `{"password":"temporary1"}`, "id", "u-viewer")
+	if err := env.svc.ResetPasswordHandler(c); err != nil {
+		t.Fatalf("ResetPasswordHandler: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp userResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if !resp.MustChangePassword {
+		t.Error("expected mustChangePassword after reset")
+	}
+	if n := env.sessionCount(t, "u-viewer"); n != 0 {
+		t.Errorf("expected sessions to be revoked, %d remain", n)
+	}
+
+	c, rec = newTestContext(http.MethodPost, "/api/users/missing/reset-password", `{"password":"temporary1"}`, "id", "missing")
+	if err := env.svc.ResetPasswordHandler(c); err != nil {
+		t.Fatalf("ResetPasswordHandler: %v", err)
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown user, got %d", rec.Code)
+	}
+}
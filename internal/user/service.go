@@ -0,0 +1,221 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sydlexius/media-reaper/internal/auth"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+var (
+	ErrInvalidUser   = errors.New("invalid user")
+	ErrUsernameTaken = errors.New("username is already taken")
+	ErrLastAdmin     = errors.New("at least one enabled admin is required")
+)
+
+// Roles lists the assignable roles.
+var Roles = []string{repository.RoleAdmin, repository.RoleOperator, repository.RoleViewer}
+
+// CreateInput holds the fields for a new user.
+type CreateInput struct {
+	Username           string
+	Password           string
+	Role               string
+	MustChangePassword bool
+}
+
+// UpdateInput holds the fields an admin can change. Nil fields are left as is.
+type UpdateInput struct {
+	Username *string
+	Role     *string
+	Disabled *bool
+}
+
+// Service manages local user accounts.
+type Service struct {
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+}
+
+// NewService creates a user management service. Sessions are revoked when a
+// user is disabled or has their password reset.
+func NewService(users repository.UserRepository, sessions repository.SessionRepository) *Service {
+	return &Service{users: users, sessions: sessions}
+}
+
+// GetAll returns all users ordered by username.
+func (s *Service) GetAll(ctx context.Context) ([]*repository.User, error) {
+	return s.users.GetAll(ctx)
+}
+
+// GetByID returns a single user, or nil if not found.
+func (s *Service) GetByID(ctx context.Context, id string) (*repository.User, error) {
+	return s.users.GetByID(ctx, id)
+}
+
+// Create validates and stores a new user.
+func (s *Service) Create(ctx context.Context, in CreateInput) (*repository.User, error) {
+	username := strings.TrimSpace(in.Username)
+	if username == "" {
+		return nil, fmt.Errorf("%w: username is required", ErrInvalidUser)
+	}
+	if err := validateRole(in.Role); err != nil {
+		return nil, err
+	}
+	if err := s.checkUsernameFree(ctx, username, ""); err != nil {
+		return nil, err
+	}
+
+	hash, err := auth.HashPassword(in.Password)
+	if errors.Is(err, auth.ErrPasswordTooShort) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUser, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user := &repository.User{
+		ID:                 uuid.New().String(),
+		Username:           username,
+		PasswordHash:       hash,
+		Role:               in.Role,
+		MustChangePassword: in.MustChangePassword,
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return s.users.GetByID(ctx, user.ID)
+}
+
+// Update applies an admin's changes to a user. Disabling a user logs them
+// out everywhere. It returns nil if the user does not exist.
+func (s *Service) Update(ctx context.Context, id string, in UpdateInput) (*repository.User, error) {
+	user, err := s.users.GetByID(ctx, id)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	if in.Username != nil {
+		username := strings.TrimSpace(*in.Username)
+		if username == "" {
+			return nil, fmt.Errorf("%w: username is required", ErrInvalidUser)
+		}
+		if err := s.checkUsernameFree(ctx, username, user.ID); err != nil {
+			return nil, err
+		}
+		user.Username = username
+	}
+	if in.Role != nil {
+		if err := validateRole(*in.Role); err != nil {
+			return nil, err
+		}
+	}
+
+	wasActiveAdmin := isActiveAdmin(user)
+	if in.Role != nil {
+		user.Role = *in.Role
+	}
+	disabling := in.Disabled != nil && *in.Disabled && !user.Disabled
+	if in.Disabled != nil {
+		user.Disabled = *in.Disabled
+	}
+	if wasActiveAdmin && !isActiveAdmin(user) {
+		if err := s.ensureAnotherAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if disabling {
+		if _, err := s.sessions.DeleteByUser(ctx, user.ID); err != nil {
+			return nil, fmt.Errorf("revoking sessions: %w", err)
+		}
+	}
+	return s.users.GetByID(ctx, user.ID)
+}
+
+// Delete removes a user and, through the foreign key, their sessions. It
+// returns false if the user does not exist.
+func (s *Service) Delete(ctx context.Context, id string) (bool, error) {
+	user, err := s.users.GetByID(ctx, id)
+	if err != nil || user == nil {
+		return false, err
+	}
+	if isActiveAdmin(user) {
+		if err := s.ensureAnotherAdmin(ctx); err != nil {
+			return false, err
+		}
+	}
+	return true, s.users.Delete(ctx, id)
+}
+
+// ResetPassword sets a temporary password that the user must change at next
+// login, and logs them out everywhere. It returns nil if the user does not exist.
+func (s *Service) ResetPassword(ctx context.Context, id, password string) (*repository.User, error) {
+	user, err := s.users.GetByID(ctx, id)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	if user.AuthProvider != repository.AuthProviderLocal {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUser, auth.ErrExternalPassword)
+	}
+
+	hash, err := auth.HashPassword(password)
+	if errors.Is(err, auth.ErrPasswordTooShort) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUser, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user.PasswordHash = hash
+	user.MustChangePassword = true
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if _, err := s.sessions.DeleteByUser(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("revoking sessions: %w", err)
+	}
+	return user, nil
+}
+
+func (s *Service) checkUsernameFree(ctx context.Context, username, selfID string) error {
+	existing, err := s.users.GetByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != selfID {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+// ensureAnotherAdmin fails if removing one active admin would leave none.
+func (s *Service) ensureAnotherAdmin(ctx context.Context) error {
+	admins, err := s.users.CountActiveAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func isActiveAdmin(user *repository.User) bool {
+	return user.Role == repository.RoleAdmin && !user.Disabled
+}
+
+func validateRole(role string) error {
+	if !slices.Contains(Roles, role) {
+		return fmt.Errorf("%w: role must be admin, operator, or viewer", ErrInvalidUser)
+	}
+	return nil
+}
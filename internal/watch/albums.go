@@ -0,0 +1,174 @@
+package watch
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/sydlexius/media-reaper/internal/arrclient"
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+var (
+	ErrNotLidarr = errors.New("not a lidarr connection")
+	// ErrArrUnavailable wraps failures talking to Lidarr.
+	ErrArrUnavailable = errors.New("could not read lidarr")
+)
+
+// albumSource lists what a Lidarr instance manages. Implemented by
+// arrclient.LidarrClient.
+type albumSource interface {
+	GetArtists(ctx context.Context) ([]*arrclient.Artist, error)
+	GetAlbums(ctx context.Context, artistID int64) ([]*arrclient.Album, error)
+}
+
+func newLidarr(url, apiKey string) albumSource {
+	return arrclient.NewLidarrClient(url, apiKey)
+}
+
+// UnplayedAlbum is a Lidarr album with files that the media server has but
+// no user has played a track of.
+type UnplayedAlbum struct {
+	AlbumID        int64  `json:"albumId"`
+	Title          string `json:"title"`
+	ArtistID       int64  `json:"artistId"`
+	ArtistName     string `json:"artistName"`
+	ForeignAlbumID string `json:"foreignAlbumId"`
+	// ItemID is the album's ID on the media server.
+	ItemID     string `json:"itemId"`
+	SizeOnDisk int64  `json:"sizeOnDisk"`
+}
+
+// UnplayedAlbums returns the albums Lidarr holds files for that are in the
+// media server's libraries but that no media server user has played a
+// track of. Albums are matched on their MusicBrainz release group, which
+// Lidarr calls the foreign album ID; see matchAlbums.
+func (s *Service) UnplayedAlbums(ctx context.Context, lidarrID, connectionID string) ([]*UnplayedAlbum, error) {
+	conn, err := s.connections.GetByID(ctx, lidarrID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching connection: %w", err)
+	}
+	if conn == nil {
+		return nil, ErrConnectionNotFound
+	}
+	if conn.Type != repository.ConnectionTypeLidarr {
+		return nil, fmt.Errorf("%w: %s", ErrNotLidarr, conn.Type)
+	}
+	apiKey, err := s.connections.DecryptAPIKey(conn.EncryptedAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting api key: %w", err)
+	}
+	lidarr := s.newLidarr(conn.URL, apiKey)
+	artists, err := lidarr.GetArtists(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArrUnavailable, err)
+	}
+	albums, err := lidarr.GetAlbums(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrArrUnavailable, err)
+	}
+
+	server, err := s.connections.MediaServer(ctx, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if server == nil {
+		return nil, ErrConnectionNotFound
+	}
+	users, err := server.GetUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServerUnavailable, err)
+	}
+	userIDs := make([]string, len(users))
+	for i, u := range users {
+		userIDs[i] = u.ID
+	}
+
+	// Users can see different libraries, so every user's albums count.
+	libraryAlbums, err := mediaserver.ItemsByUser(ctx, server, userIDs, &mediaserver.ItemQuery{
+		IncludeTypes: "MusicAlbum",
+		Recursive:    true,
+		Fields:       "ProviderIds",
+		SortBy:       "SortName",
+	}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServerUnavailable, err)
+	}
+	played := true
+	playedTracks, err := mediaserver.ItemsByUser(ctx, server, userIDs, &mediaserver.ItemQuery{
+		IncludeTypes: "Audio",
+		Recursive:    true,
+		IsPlayed:     &played,
+		Fields:       "ProviderIds",
+		SortBy:       "SortName",
+	}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServerUnavailable, err)
+	}
+
+	var inLibrary, tracks []*mediaserver.Item
+	for _, id := range userIDs {
+		inLibrary = append(inLibrary, libraryAlbums[id]...)
+		tracks = append(tracks, playedTracks[id]...)
+	}
+	return matchAlbums(artists, albums, inLibrary, tracks), nil
+}
+
+// matchAlbums returns the albums with files that match an item in
+// libraryAlbums and none in playedTracks, sorted by artist and title. An
+// album matches a media server item whose MusicBrainz release group is the
+// album's foreign ID and whose album artist, if the item has one, is the
+// artist's foreign ID. Played tracks are matched on their release group
+// alone.
+func matchAlbums(artists []*arrclient.Artist, albums []*arrclient.Album, libraryAlbums, playedTracks []*mediaserver.Item) []*UnplayedAlbum {
+	byID := make(map[int64]*arrclient.Artist, len(artists))
+	for _, a := range artists {
+		byID[a.ID] = a
+	}
+	played := make(map[string]bool)
+	for _, t := range playedTracks {
+		if id := t.ProviderIDs.MusicBrainzReleaseGroup; id != "" {
+			played[id] = true
+		}
+	}
+	byReleaseGroup := make(map[string][]*mediaserver.Item)
+	for _, item := range libraryAlbums {
+		if id := item.ProviderIDs.MusicBrainzReleaseGroup; id != "" {
+			byReleaseGroup[id] = append(byReleaseGroup[id], item)
+		}
+	}
+
+	unplayed := []*UnplayedAlbum{}
+	for _, album := range albums {
+		if album.ForeignAlbumID == "" || played[album.ForeignAlbumID] ||
+			album.Statistics == nil || album.Statistics.TrackFileCount == 0 {
+			continue
+		}
+		artist := byID[album.ArtistID]
+		if artist == nil {
+			continue
+		}
+		for _, item := range byReleaseGroup[album.ForeignAlbumID] {
+			if mbArtist := item.ProviderIDs.MusicBrainzAlbumArtist; mbArtist != "" && mbArtist != artist.ForeignArtistID {
+				continue
+			}
+			unplayed = append(unplayed, &UnplayedAlbum{
+				AlbumID:        album.ID,
+				Title:          album.Title,
+				ArtistID:       artist.ID,
+				ArtistName:     artist.ArtistName,
+				ForeignAlbumID: album.ForeignAlbumID,
+				ItemID:         item.ID,
+				SizeOnDisk:     album.Statistics.SizeOnDisk,
+			})
+			break
+		}
+	}
+	slices.SortFunc(unplayed, func(a, b *UnplayedAlbum) int {
+		return cmp.Or(cmp.Compare(a.ArtistName, b.ArtistName), cmp.Compare(a.Title, b.Title))
+	})
+	return unplayed
+}
@@ -0,0 +1,266 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// maxUploadBytes caps the size of an uploaded export.
+const maxUploadBytes = 512 << 20
+
+type playResponse struct {
+	ID              int64  `json:"id"`
+	ConnectionID    string `json:"connectionId"`
+	MediaUserID     string `json:"mediaUserId,omitempty"`
+	UserName        string `json:"userName,omitempty"`
+	ItemID          string `json:"itemId,omitempty"`
+	ItemName        string `json:"itemName,omitempty"`
+	ItemType        string `json:"itemType,omitempty"`
+	TMDBID          string `json:"tmdbId,omitempty"`
+	TVDBID          string `json:"tvdbId,omitempty"`
+	IMDBID          string `json:"imdbId,omitempty"`
+	PlayedAt        string `json:"playedAt"`
+	DurationSeconds int    `json:"durationSeconds"`
+	Source          string `json:"source"`
+	ImportedAt      string `json:"importedAt"`
+}
+
+type playedItemResponse struct {
+	ItemID       string `json:"itemId"`
+	ItemName     string `json:"itemName"`
+	ItemType     string `json:"itemType"`
+	SeriesName   string `json:"seriesName,omitempty"`
+	TMDBID       string `json:"tmdbId,omitempty"`
+	TVDBID       string `json:"tvdbId,omitempty"`
+	IMDBID       string `json:"imdbId,omitempty"`
+	PlayCount    int    `json:"playCount"`
+	LastPlayedAt string `json:"lastPlayedAt,omitempty"`
+}
+
+// ImportHandler imports an external watch history export.
+// @Summary Import watch history
+// @Description Import historical plays for a media server connection from a Playback Reporting plugin database (playback_reporting_db) or backup export (playback_reporting_tsv), or from a CSV (csv) whose header names user, timestamp, and item_id or provider_id columns, with an optional item column. provider_id holds tmdb:ID, tvdb:ID, or imdb:ID values separated by "|". Times without a zone are read in the given timezone, or UTC if none is given; Playback Reporting records the server's local time. Plays imported before are skipped.
+// @Tags watch-history
+// @Accept multipart/form-data
+// @Produce json
+// @Param connectionId formData string true "Emby, Jellyfin, or Plex connection the plays belong to"
+// @Param format formData string true "Export format" Enums(playback_reporting_db, playback_reporting_tsv, csv)
+// @Param file formData file true "Export file"
+// @Param timezone formData string false "IANA timezone for times without a zone, such as Europe/Berlin (default UTC)"
+// @Success 200 {object} ImportResult
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /watch-history/import [post]
+func (s *Service) ImportHandler(c echo.Context) error {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "file is required"})
+	}
+	if fh.Size > maxUploadBytes {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("file must be at most %d MB", maxUploadBytes>>20),
+		})
+	}
+	loc := time.UTC
+	if tz := c.FormValue("timezone"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "timezone must be an IANA name such as Europe/Berlin"})
+		}
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "failed to read upload"})
+	}
+	defer func() { _ = f.Close() }()
+
+	result, err := s.Import(c.Request().Context(), c.FormValue("connectionId"), Format(c.FormValue("format")), f, loc)
+	switch {
+	case errors.Is(err, ErrConnectionNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrUnknownFormat), errors.Is(err, ErrInvalidExport), errors.Is(err, connection.ErrNotMediaServer):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to import watch history"})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// ListHandler lists imported plays.
+// @Summary List imported watch history
+// @Description List imported plays, newest first
+// @Tags watch-history
+// @Produce json
+// @Param connectionId query string false "Only plays for this connection"
+// @Param user query string false "Only plays by this media server user ID or name"
+// @Param limit query int false "Maximum results (default 100, max 1000)"
+// @Success 200 {array} playResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /watch-history [get]
+func (s *Service) ListHandler(c echo.Context) error {
+	filter := repository.WatchPlayFilter{
+		ConnectionID: c.QueryParam("connectionId"),
+		UserID:       c.QueryParam("user"),
+		UserName:     c.QueryParam("user"),
+	}
+	return s.listPlays(c, filter)
+}
+
+// MyListHandler lists the signed-in user's own imported plays.
+// @Summary List my watch history
+// @Description List the signed-in user's imported plays, newest first. Only users who sign in with Emby have plays; everyone else gets an empty list.
+// @Tags watch-history
+// @Produce json
+// @Param limit query int false "Maximum results (default 100, max 1000)"
+// @Success 200 {array} playResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /me/watch-history [get]
+func (s *Service) MyListHandler(c echo.Context) error {
+	var filter repository.WatchPlayFilter
+	if user, ok := c.Get("user").(*repository.User); ok {
+		filter.UserID = user.EmbyUserID()
+	}
+	if filter.UserID == "" {
+		return c.JSON(http.StatusOK, []playResponse{})
+	}
+	return s.listPlays(c, filter)
+}
+
+// listPlays applies the limit query parameter to filter and writes the
+// matching plays.
+func (s *Service) listPlays(c echo.Context, filter repository.WatchPlayFilter) error {
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("limit must be between 1 and %d", maxListLimit),
+			})
+		}
+		filter.Limit = limit
+	}
+
+	plays, err := s.List(c.Request().Context(), filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list watch history"})
+	}
+	resp := make([]playResponse, len(plays))
+	for i, p := range plays {
+		resp[i] = playResponse{
+			ID:              p.ID,
+			ConnectionID:    p.ConnectionID,
+			MediaUserID:     p.MediaUserID,
+			UserName:        p.UserName,
+			ItemID:          p.ItemID,
+			ItemName:        p.ItemName,
+			ItemType:        p.ItemType,
+			TMDBID:          p.TMDBID,
+			TVDBID:          p.TVDBID,
+			IMDBID:          p.IMDBID,
+			PlayedAt:        p.PlayedAt,
+			DurationSeconds: p.DurationSeconds,
+			Source:          p.Source,
+			ImportedAt:      p.ImportedAt,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// PlayedHandler lists what a media server user has played.
+// @Summary List played items
+// @Description List the movies and episodes a media server user has played, with play counts and when each was last played, as reported by an Emby, Jellyfin, or Plex connection and merged with plays imported for that user
+// @Tags watch-history
+// @Produce json
+// @Param connectionId query string true "Media server connection"
+// @Param userId query string true "Media server user ID"
+// @Success 200 {array} playedItemResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /watch-history/played [get]
+func (s *Service) PlayedHandler(c echo.Context) error {
+	connectionID, userID := c.QueryParam("connectionId"), c.QueryParam("userId")
+	if connectionID == "" || userID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "connectionId and userId are required"})
+	}
+
+	items, err := s.Played(c.Request().Context(), connectionID, userID)
+	switch {
+	case errors.Is(err, ErrConnectionNotFound), errors.Is(err, ErrUserNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, connection.ErrNotMediaServer):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrServerUnavailable):
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list played items"})
+	}
+
+	resp := make([]playedItemResponse, len(items))
+	for i, item := range items {
+		resp[i] = playedItemResponse{
+			ItemID:       item.ID,
+			ItemName:     item.Name,
+			ItemType:     item.Type,
+			SeriesName:   item.SeriesName,
+			TMDBID:       item.ProviderIDs.TMDB,
+			TVDBID:       item.ProviderIDs.TVDB,
+			IMDBID:       item.ProviderIDs.IMDB,
+			PlayCount:    item.UserData.PlayCount,
+			LastPlayedAt: item.UserData.LastPlayedDate,
+		}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// UnplayedAlbumsHandler lists Lidarr albums nobody has played.
+// @Summary List unplayed Lidarr albums
+// @Description List the albums a Lidarr connection holds files for that an Emby or Jellyfin connection has in its libraries but no user has played a track of. Albums are matched on their MusicBrainz release group and, where the media server has one, album artist.
+// @Tags watch-history
+// @Produce json
+// @Param connectionId query string true "Media server connection"
+// @Param lidarrConnectionId query string true "Lidarr connection"
+// @Success 200 {array} UnplayedAlbum
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security SessionCookie
+// @Security ApiKeyAuth
+// @Router /watch-history/unplayed-albums [get]
+func (s *Service) UnplayedAlbumsHandler(c echo.Context) error {
+	connectionID, lidarrID := c.QueryParam("connectionId"), c.QueryParam("lidarrConnectionId")
+	if connectionID == "" || lidarrID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "connectionId and lidarrConnectionId are required"})
+	}
+
+	albums, err := s.UnplayedAlbums(c.Request().Context(), lidarrID, connectionID)
+	switch {
+	case errors.Is(err, ErrConnectionNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, connection.ErrNotMediaServer), errors.Is(err, ErrNotLidarr):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, ErrServerUnavailable), errors.Is(err, ErrArrUnavailable):
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list unplayed albums"})
+	}
+	return c.JSON(http.StatusOK, albums)
+}
@@ -0,0 +1,252 @@
+package watch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/repository"
+)
+
+// Format names a watch history export format.
+type Format string
+
+const (
+	// FormatPlaybackReportingDB is the playback_reporting.db file from the
+	// Emby or Jellyfin Playback Reporting plugin.
+	FormatPlaybackReportingDB Format = "playback_reporting_db"
+	// FormatPlaybackReportingTSV is the plugin's backup export: tab-separated
+	// DateCreated, UserId, ItemId, ItemType, ItemName, PlaybackMethod,
+	// ClientName, DeviceName, and PlayDuration, without a header.
+	FormatPlaybackReportingTSV Format = "playback_reporting_tsv"
+	// FormatCSV is a CSV with a header naming user, item, item_id,
+	// provider_id, and timestamp columns. See parseCSV.
+	FormatCSV Format = "csv"
+)
+
+// maxReportedErrors caps the row errors returned from one import.
+const maxReportedErrors = 20
+
+var ErrUnknownFormat = errors.New("format must be playback_reporting_db, playback_reporting_tsv, or csv")
+
+// parseResult collects plays parsed from an export along with rows that could
+// not be used.
+type parseResult struct {
+	plays   []*repository.WatchPlay
+	invalid int
+	errors  []string
+}
+
+func (r *parseResult) reject(line int, format string, args ...any) {
+	r.invalid++
+	if len(r.errors) < maxReportedErrors {
+		r.errors = append(r.errors, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+	}
+}
+
+// parsePlaybackReportingTSV reads a Playback Reporting backup export.
+func parsePlaybackReportingTSV(r io.Reader, loc *time.Location) (*parseResult, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	result := &parseResult{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tsv: %w", err)
+		}
+		if len(record) < 9 {
+			result.reject(line, "expected 9 columns, got %d", len(record))
+			continue
+		}
+		duration, _ := strconv.Atoi(strings.TrimSpace(record[8]))
+		play, err := playbackActivity(record[0], record[1], record[2], record[3], record[4], duration, loc)
+		if err != nil {
+			result.reject(line, "%v", err)
+			continue
+		}
+		result.plays = append(result.plays, play)
+	}
+}
+
+// parsePlaybackReportingDB reads the PlaybackActivity table of a Playback
+// Reporting database.
+func parsePlaybackReportingDB(ctx context.Context, db *sql.DB, loc *time.Location) (*parseResult, error) {
+	rows, err := db.QueryContext(ctx, `SELECT DateCreated, UserId, ItemId, ItemType, ItemName, PlayDuration
+		FROM PlaybackActivity ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("reading PlaybackActivity: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	result := &parseResult{}
+	for line := 1; rows.Next(); line++ {
+		var created, userID, itemID, itemType, itemName sql.NullString
+		var duration sql.NullInt64
+		if err := rows.Scan(&created, &userID, &itemID, &itemType, &itemName, &duration); err != nil {
+			return nil, fmt.Errorf("scanning PlaybackActivity: %w", err)
+		}
+		play, err := playbackActivity(created.String, userID.String, itemID.String, itemType.String, itemName.String, int(duration.Int64), loc)
+		if err != nil {
+			result.reject(line, "%v", err)
+			continue
+		}
+		result.plays = append(result.plays, play)
+	}
+	return result, rows.Err()
+}
+
+func playbackActivity(created, userID, itemID, itemType, itemName string, duration int, loc *time.Location) (*repository.WatchPlay, error) {
+	playedAt, err := parseTimestamp(created, loc)
+	if err != nil {
+		return nil, err
+	}
+	userID, itemID = strings.TrimSpace(userID), strings.TrimSpace(itemID)
+	if userID == "" || itemID == "" {
+		return nil, errors.New("user and item IDs are required")
+	}
+	return &repository.WatchPlay{
+		MediaUserID:     userID,
+		ItemID:          itemID,
+		ItemType:        strings.TrimSpace(itemType),
+		ItemName:        strings.TrimSpace(itemName),
+		PlayedAt:        playedAt,
+		DurationSeconds: duration,
+		Source:          repository.WatchSourcePlaybackReporting,
+	}, nil
+}
+
+// parseCSV reads a generic watch history CSV. The header row names the
+// columns, in any order and case:
+//
+//   - user: the media server user name (required)
+//   - timestamp: when the item was played (required)
+//   - item: the item's title
+//   - item_id: the media server item ID
+//   - provider_id: one or more of tmdb:ID, tvdb:ID, or imdb:ID, separated by
+//     "|" or spaces
+//
+// Each row needs an item_id or a provider_id.
+func parseCSV(r io.Reader, loc *time.Location) (*parseResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return &parseResult{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"user", "timestamp"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv header has no %q column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	result := &parseResult{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading csv: %w", err)
+		}
+
+		play := &repository.WatchPlay{
+			UserName: field(record, "user"),
+			ItemName: field(record, "item"),
+			ItemID:   field(record, "item_id"),
+			Source:   repository.WatchSourceCSV,
+		}
+		if play.UserName == "" {
+			result.reject(line, "user is required")
+			continue
+		}
+		if play.PlayedAt, err = parseTimestamp(field(record, "timestamp"), loc); err != nil {
+			result.reject(line, "%v", err)
+			continue
+		}
+		if err := setProviderIDs(play, field(record, "provider_id")); err != nil {
+			result.reject(line, "%v", err)
+			continue
+		}
+		if play.ItemID == "" && play.TMDBID == "" && play.TVDBID == "" && play.IMDBID == "" {
+			result.reject(line, "item_id or provider_id is required")
+			continue
+		}
+		result.plays = append(result.plays, play)
+	}
+}
+
+func setProviderIDs(play *repository.WatchPlay, value string) error {
+	for _, id := range strings.FieldsFunc(value, func(r rune) bool { return r == '|' || r == ' ' }) {
+		provider, v, ok := strings.Cut(id, ":")
+		if !ok || v == "" {
+			return fmt.Errorf("provider_id %q must look like tmdb:603", id)
+		}
+		switch strings.ToLower(provider) {
+		case "tmdb":
+			play.TMDBID = v
+		case "tvdb":
+			play.TVDBID = v
+		case "imdb":
+			play.IMDBID = v
+		default:
+			return fmt.Errorf("unknown provider %q", provider)
+		}
+	}
+	return nil
+}
+
+// timestampLayouts are tried in order. Playback Reporting writes
+// server-local times without a zone, so times without one are read in the
+// location the import names.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.9999999",
+	"2006-01-02T15:04:05.9999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimestamp parses a play time in one of timestampLayouts or as Unix
+// seconds and returns it in RFC3339 UTC. A time without a zone is read in loc.
+func parseTimestamp(value string, loc *time.Location) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("timestamp is required")
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC().Format(time.RFC3339), nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UTC().Format(time.RFC3339), nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized timestamp %q", value)
+}
@@ -0,0 +1,223 @@
+package watch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/repository"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var (
+	ErrConnectionNotFound = errors.New("connection not found")
+	ErrInvalidExport      = errors.New("invalid export")
+)
+
+// ConnectionSource looks up saved connections, decrypts their API keys, and
+// builds media server clients for them.
+type ConnectionSource interface {
+	GetByID(ctx context.Context, id string) (*repository.Connection, error)
+	MediaServer(ctx context.Context, id string) (mediaserver.Server, error)
+	DecryptAPIKey(encrypted string) (string, error)
+}
+
+// Service imports external watch history and merges it with the play state
+// media servers report.
+type Service struct {
+	plays       repository.WatchPlayRepository
+	connections ConnectionSource
+	newLidarr   func(url, apiKey string) albumSource
+}
+
+// NewService creates a watch history service.
+func NewService(plays repository.WatchPlayRepository, connections ConnectionSource) *Service {
+	return &Service{plays: plays, connections: connections, newLidarr: newLidarr}
+}
+
+// ImportResult reports what an import did.
+type ImportResult struct {
+	// Read is the number of usable plays in the export.
+	Read int `json:"read"`
+	// Imported is the number of plays that were new.
+	Imported int `json:"imported"`
+	// Duplicates were imported before and were skipped.
+	Duplicates int `json:"duplicates"`
+	// Invalid rows could not be parsed. Errors describes the first few.
+	Invalid int      `json:"invalid"`
+	Errors  []string `json:"errors"`
+}
+
+// Import reads an export in the given format and stores its plays against a
+// media server connection. Times in the export without a zone are read in
+// loc, or in UTC when loc is nil. Plays already imported are skipped, so the
+// same export can be imported again safely.
+func (s *Service) Import(ctx context.Context, connectionID string, format Format, r io.Reader, loc *time.Location) (*ImportResult, error) {
+	conn, err := s.connections.GetByID(ctx, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching connection: %w", err)
+	}
+	if conn == nil {
+		return nil, ErrConnectionNotFound
+	}
+	if !connection.IsMediaServer(conn.Type) {
+		return nil, fmt.Errorf("%w: %s", connection.ErrNotMediaServer, conn.Type)
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+	var parsed *parseResult
+	switch format {
+	case FormatPlaybackReportingTSV:
+		parsed, err = parsePlaybackReportingTSV(r, loc)
+	case FormatPlaybackReportingDB:
+		parsed, err = readPlaybackReportingDB(ctx, r, loc)
+	case FormatCSV:
+		parsed, err = parseCSV(r, loc)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, p := range parsed.plays {
+		p.ConnectionID = conn.ID
+		p.ImportedAt = now
+	}
+	imported, err := s.plays.Import(ctx, parsed.plays)
+	if err != nil {
+		return nil, fmt.Errorf("storing plays: %w", err)
+	}
+
+	errs := parsed.errors
+	if errs == nil {
+		errs = []string{}
+	}
+	return &ImportResult{
+		Read:       len(parsed.plays),
+		Imported:   imported,
+		Duplicates: len(parsed.plays) - imported,
+		Invalid:    parsed.invalid,
+		Errors:     errs,
+	}, nil
+}
+
+// readPlaybackReportingDB copies an uploaded database to a temporary file,
+// since SQLite can only open files, and reads it.
+func readPlaybackReportingDB(ctx context.Context, r io.Reader, loc *time.Location) (*parseResult, error) {
+	f, err := os.CreateTemp("", "playback-reporting-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("saving upload: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("saving upload: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+f.Name()+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("opening playback reporting database: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+	return parsePlaybackReportingDB(ctx, db, loc)
+}
+
+// List returns imported plays, newest first.
+func (s *Service) List(ctx context.Context, filter repository.WatchPlayFilter) ([]*repository.WatchPlay, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	if filter.Limit > maxListLimit {
+		filter.Limit = maxListLimit
+	}
+	return s.plays.List(ctx, filter)
+}
+
+// ApplyHistory merges imported plays into the play state a media server
+// reported for user's items. An item with imported plays is marked played,
+// its last played date becomes the later of the two, and its play count is
+// at least the number of imported plays. Plays match an item by media server
+// item ID or by any provider ID, and by user ID or name.
+func (s *Service) ApplyHistory(ctx context.Context, connectionID string, user *mediaserver.User, items []*mediaserver.Item) error {
+	plays, err := s.plays.List(ctx, repository.WatchPlayFilter{
+		ConnectionID: connectionID,
+		UserID:       user.ID,
+		UserName:     user.Name,
+	})
+	if err != nil {
+		return fmt.Errorf("listing imported plays: %w", err)
+	}
+	if len(plays) == 0 {
+		return nil
+	}
+
+	index := make(map[string][]*repository.WatchPlay)
+	for _, p := range plays {
+		for _, key := range playKeys(p.ItemID, p.TMDBID, p.TVDBID, p.IMDBID) {
+			index[key] = append(index[key], p)
+		}
+	}
+
+	for _, item := range items {
+		matched := make(map[int64]*repository.WatchPlay)
+		for _, key := range playKeys(item.ID, item.ProviderIDs.TMDB, item.ProviderIDs.TVDB, item.ProviderIDs.IMDB) {
+			for _, p := range index[key] {
+				if p.ItemType == "" || strings.EqualFold(p.ItemType, item.Type) {
+					matched[p.ID] = p
+				}
+			}
+		}
+		if len(matched) > 0 {
+			mergePlays(item, matched)
+		}
+	}
+	return nil
+}
+
+func playKeys(itemID, tmdb, tvdb, imdb string) []string {
+	var keys []string
+	for _, k := range []struct{ prefix, id string }{
+		{"item:", itemID}, {"tmdb:", tmdb}, {"tvdb:", tvdb}, {"imdb:", imdb},
+	} {
+		if k.id != "" {
+			keys = append(keys, k.prefix+k.id)
+		}
+	}
+	return keys
+}
+
+func mergePlays(item *mediaserver.Item, plays map[int64]*repository.WatchPlay) {
+	if item.UserData == nil {
+		item.UserData = &mediaserver.UserData{}
+	}
+	data := item.UserData
+	data.Played = true
+	data.PlayCount = max(data.PlayCount, len(plays))
+
+	last, _ := time.Parse(time.RFC3339Nano, data.LastPlayedDate)
+	for _, p := range plays {
+		if played, err := time.Parse(time.RFC3339, p.PlayedAt); err == nil && played.After(last) {
+			last = played
+			data.LastPlayedDate = played.Format(time.RFC3339)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package watch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/sydlexius/media-reaper/internal/arrclient"
+	"github.com/sydlexius/media-reaper/internal/connection"
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+	"github.com/sydlexius/media-reaper/internal/repository"
+	sqliterepo "github.com/sydlexius/media-reaper/internal/repository/sqlite"
+)
+
+type stubConnections struct {
+	conns   map[string]*repository.Connection
+	servers map[string]mediaserver.Server
+}
+
+func (s stubConnections) GetByID(_ context.Context, id string) (*repository.Connection, error) {
+	return s.conns[id], nil
+}
+
+func (s stubConnections) MediaServer(_ context.Context, id string) (mediaserver.Server, error) {
+	if conn := s.conns[id]; conn != nil && !connection.IsMediaServer(conn.Type) {
+		return nil, connection.ErrNotMediaServer
+	}
+	return s.servers[id], nil
+}
+
+func (s stubConnections) DecryptAPIKey(encrypted string) (string, error) {
+	return encrypted, nil
+}
+
+// fakeServer is a media server with fixed users and items.
+type fakeServer struct {
+	mediaserver.Server
+	users []*mediaserver.User
+	items []*mediaserver.Item
+	err   error
+}
+
+func (f *fakeServer) GetUsers(context.Context) ([]*mediaserver.User, error) {
+	return f.users, f.err
+}
+
+func (f *fakeServer) GetUserItems(_ context.Context, _ string, q *mediaserver.ItemQuery) (*mediaserver.ItemsResult, error) {
+	start := min(q.StartIndex, len(f.items))
+	end := min(start+q.Limit, len(f.items))
+	return &mediaserver.ItemsResult{Items: f.items[start:end], TotalRecordCount: len(f.items)}, f.err
+}
+
+func setupTestService(t *testing.T) *Service {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("opening test db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	schema := `
+	CREATE TABLE watch_plays (
+		id               INTEGER PRIMARY KEY AUTOINCREMENT,
+		connection_id    TEXT NOT NULL,
+		media_user_id    TEXT NOT NULL DEFAULT '',
+		user_name        TEXT NOT NULL DEFAULT '',
+		item_id          TEXT NOT NULL DEFAULT '',
+		item_name        TEXT NOT NULL DEFAULT '',
+		item_type        TEXT NOT NULL DEFAULT '',
+		tmdb_id          TEXT NOT NULL DEFAULT '',
+		tvdb_id          TEXT NOT NULL DEFAULT '',
+		imdb_id          TEXT NOT NULL DEFAULT '',
+		played_at        TIMESTAMP NOT NULL,
+		duration_seconds INTEGER NOT NULL DEFAULT 0,
+		source           TEXT NOT NULL,
+		imported_at      TIMESTAMP NOT NULL
+	);
+	CREATE UNIQUE INDEX idx_watch_plays_unique ON watch_plays(
+		connection_id, media_user_id, user_name, item_id, tmdb_id, tvdb_id, imdb_id, played_at
+	)`
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+
+	return NewService(sqliterepo.NewWatchPlayRepository(db), stubConnections{
+		conns: map[string]*repository.Connection{
+			"emby-1":   {ID: "emby-1", Type: repository.ConnectionTypeEmby},
+			"sonarr-1": {ID: "sonarr-1", Type: repository.ConnectionTypeSonarr},
+		},
+		servers: map[string]mediaserver.Server{},
+	})
+}
+
+const testCSV = "User,Item,Provider_ID,Timestamp\n" +
+	"dana,The Matrix,tmdb:603|imdb:tt0133093,2024-05-01T12:00:00Z\n" +
+	"dana,The Matrix,tmdb:603,2023-10-01 08:30:00\n" +
+	"lee,Pilot,tvdb:349232,1717243200\n" +
+	",Missing User,tmdb:1,2024-01-01\n" +
+	"dana,No IDs,,2024-01-01\n" +
+	"dana,Bad Time,tmdb:2,yesterday\n" +
+	"dana,Bad Provider,anidb:5,2024-01-01\n"
+
+func TestImportCSV(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	result, err := svc.Import(ctx, "emby-1", FormatCSV, strings.NewReader(testCSV), nil)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Read != 3 || result.Imported != 3 || result.Invalid != 4 || len(result.Errors) != 4 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if !strings.HasPrefix(result.Errors[0], "line 5: ") {
+		t.Errorf("expected errors to name the line, got %q", result.Errors[0])
+	}
+
+	again, err := svc.Import(ctx, "emby-1", FormatCSV, strings.NewReader(testCSV), nil)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if again.Imported != 0 || again.Duplicates != 3 {
+		t.Errorf("expected a second import to add nothing, got %+v", again)
+	}
+
+	plays, err := svc.List(ctx, repository.WatchPlayFilter{UserName: "DANA"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(plays) != 2 || plays[0].PlayedAt != "2024-05-01T12:00:00Z" || plays[0].IMDBID != "tt0133093" {
+		t.Errorf("unexpected plays: %+v", plays)
+	}
+	if plays[1].PlayedAt != "2023-10-01T08:30:00Z" {
+		t.Errorf("expected a zoneless time to be read as UTC, got %s", plays[1].PlayedAt)
+	}
+
+	tests := []struct {
+		name    string
+		connID  string
+		format  Format
+		body    string
+		wantErr error
+	}{
+		{"unknown connection", "missing", FormatCSV, testCSV, ErrConnectionNotFound},
+		{"not a media server", "sonarr-1", FormatCSV, testCSV, connection.ErrNotMediaServer},
+		{"unknown format", "emby-1", "xml", testCSV, ErrUnknownFormat},
+		{"missing column", "emby-1", FormatCSV, "user,item\ndana,x\n", ErrInvalidExport},
+	}
+	for _, tt := range tests {
+		if _, err := svc.Import(ctx, tt.connID, tt.format, strings.NewReader(tt.body), nil); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestImportPlaybackReporting(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	tsv := "2024-03-02 21:15:07.1234567\tuser1\t101\tMovie\tThe Matrix\tDirectPlay\tEmby Web\tChrome\t8160\n" +
+		"2024-03-03 20:00:00\tuser1\t401\tEpisode\tBreaking Bad - s01e01 - Pilot\tTranscode\tEmby Theater\tTV\t3480\n" +
+		"not a date\tuser1\t102\tMovie\tOther\tDirectPlay\tEmby Web\tChrome\t60\n"
+	result, err := svc.Import(ctx, "emby-1", FormatPlaybackReportingTSV, strings.NewReader(tsv), nil)
+	if err != nil {
+		t.Fatalf("Import tsv: %v", err)
+	}
+	if result.Imported != 2 || result.Invalid != 1 {
+		t.Errorf("unexpected tsv result: %+v", result)
+	}
+
+	// The plugin's database holds the same rows, so importing it as well adds
+	// only the play the export did not have.
+	path := filepath.Join(t.TempDir(), "playback_reporting.db")
+	pr, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("opening playback reporting db: %v", err)
+	}
+	_, err = pr.Exec(`CREATE TABLE PlaybackActivity (
+		DateCreated DATETIME NOT NULL, UserId TEXT, ItemId TEXT, ItemType TEXT, ItemName TEXT,
+		PlaybackMethod TEXT, ClientName TEXT, DeviceName TEXT, PlayDuration INT);
+	INSERT INTO PlaybackActivity VALUES
+		('2024-03-02 21:15:07.1234567', 'user1', '101', 'Movie', 'The Matrix', 'DirectPlay', 'Emby Web', 'Chrome', 8160),
+		('2024-04-10 19:00:00', 'user2', '101', 'Movie', 'The Matrix', 'DirectPlay', 'Emby Web', 'Firefox', 8100)`)
+	_ = pr.Close()
+	if err != nil {
+		t.Fatalf("creating playback reporting db: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening db file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	result, err = svc.Import(ctx, "emby-1", FormatPlaybackReportingDB, f, nil)
+	if err != nil {
+		t.Fatalf("Import db: %v", err)
+	}
+	if result.Read != 2 || result.Imported != 1 || result.Duplicates != 1 {
+		t.Errorf("unexpected db result: %+v", result)
+	}
+
+	if _, err := svc.Import(ctx, "emby-1", FormatPlaybackReportingDB, strings.NewReader("not sqlite"), nil); !errors.Is(err, ErrInvalidExport) {
+		t.Errorf("expected ErrInvalidExport for a bad database, got %v", err)
+	}
+}
+
+func TestImportTimezone(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	eastern := time.FixedZone("EST", -5*60*60)
+
+	tsv := "2024-03-02 21:15:07\tuser1\t101\tMovie\tThe Matrix\tDirectPlay\tEmby Web\tChrome\t8160\n"
+	if _, err := svc.Import(ctx, "emby-1", FormatPlaybackReportingTSV, strings.NewReader(tsv), eastern); err != nil {
+		t.Fatalf("Import tsv: %v", err)
+	}
+	csv := "user,item_id,timestamp\ndana,102,2024-05-01T12:00:00Z\n"
+	if _, err := svc.Import(ctx, "emby-1", FormatCSV, strings.NewReader(csv), eastern); err != nil {
+		t.Fatalf("Import csv: %v", err)
+	}
+
+	plays, err := svc.List(ctx, repository.WatchPlayFilter{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(plays) != 2 || plays[0].PlayedAt != "2024-05-01T12:00:00Z" || plays[1].PlayedAt != "2024-03-03T02:15:07Z" {
+		t.Errorf("expected only the zoneless time to move, got %+v and %+v", plays[0], plays[1])
+	}
+
+	var body strings.Builder
+	form := multipart.NewWriter(&body)
+	_ = form.WriteField("connectionId", "emby-1")
+	_ = form.WriteField("format", string(FormatPlaybackReportingTSV))
+	_ = form.WriteField("timezone", "Mars/Olympus_Mons")
+	part, _ := form.CreateFormFile("file", "backup.tsv")
+	_, _ = part.Write([]byte(tsv))
+	_ = form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/watch-history/import", strings.NewReader(body.String()))
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	if err := svc.ImportHandler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatalf("ImportHandler: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown timezone: status %d, want 400", rec.Code)
+	}
+}
+
+func TestMyListHandler(t *testing.T) {
+	svc := setupTestService(t)
+	tsv := "2024-03-02 21:15:07\tuser1\t101\tMovie\tThe Matrix\tDirectPlay\tEmby Web\tChrome\t8160\n" +
+		"2024-03-03 20:00:00\tuser2\t401\tEpisode\tPilot\tTranscode\tEmby Theater\tTV\t3480\n"
+	if _, err := svc.Import(context.Background(), "emby-1", FormatPlaybackReportingTSV, strings.NewReader(tsv), nil); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		user *repository.User
+		want int
+	}{
+		{"emby user", &repository.User{AuthProvider: repository.AuthProviderEmby, ExternalID: "user1"}, 1},
+		{"local user", &repository.User{AuthProvider: repository.AuthProviderLocal, Username: "user1"}, 0},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/me/watch-history?user=user2", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set("user", tt.user)
+		if err := svc.MyListHandler(c); err != nil {
+			t.Fatalf("%s: MyListHandler: %v", tt.name, err)
+		}
+		var plays []playResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &plays); err != nil {
+			t.Fatalf("%s: decoding: %v", tt.name, err)
+		}
+		if len(plays) != tt.want {
+			t.Errorf("%s: got %d plays, want %d", tt.name, len(plays), tt.want)
+		}
+		for _, p := range plays {
+			if p.MediaUserID != "user1" {
+				t.Errorf("%s: got another user's play %+v", tt.name, p)
+			}
+		}
+	}
+}
+
+func TestApplyHistory(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+
+	csv := "user,item_id,provider_id,timestamp\n" +
+		"dana,,tmdb:603,2024-05-01T12:00:00Z\n" +
+		"dana,m1,tmdb:603,2024-04-01T12:00:00Z\n" +
+		"dana,,imdb:tt0111161,2020-01-01T00:00:00Z\n" +
+		"lee,m3,,2024-01-01T00:00:00Z\n"
+	if _, err := svc.Import(ctx, "emby-1", FormatCSV, strings.NewReader(csv), nil); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	matrix := &mediaserver.Item{ID: "m1", Type: "Movie", ProviderIDs: mediaserver.Providers{TMDB: "603"}}
+	shawshank := &mediaserver.Item{
+		ID: "m2", Type: "Movie", ProviderIDs: mediaserver.Providers{IMDB: "tt0111161"},
+		UserData: &mediaserver.UserData{Played: true, PlayCount: 4, LastPlayedDate: "2023-06-01T10:00:00.0000000Z"},
+	}
+	unwatched := &mediaserver.Item{ID: "m3", Type: "Movie"}
+
+	user := &mediaserver.User{ID: "e-dana", Name: "Dana"}
+	if err := svc.ApplyHistory(ctx, "emby-1", user, []*mediaserver.Item{matrix, shawshank, unwatched}); err != nil {
+		t.Fatalf("ApplyHistory: %v", err)
+	}
+
+	if !matrix.UserData.Played || matrix.UserData.PlayCount != 2 || matrix.UserData.LastPlayedDate != "2024-05-01T12:00:00Z" {
+		t.Errorf("expected two imported plays, the latest on 2024-05-01, got %+v", matrix.UserData)
+	}
+	if shawshank.UserData.PlayCount != 4 || shawshank.UserData.LastPlayedDate != "2023-06-01T10:00:00.0000000Z" {
+		t.Errorf("expected the later server play state to be kept, got %+v", shawshank.UserData)
+	}
+	if unwatched.UserData != nil {
+		t.Errorf("expected another user's play to be ignored, got %+v", unwatched.UserData)
+	}
+}
+
+func TestPlayed(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	server := &fakeServer{users: []*mediaserver.User{{ID: "e-dana", Name: "Dana"}}}
+	for i := range statusPageSize + 2 {
+		item := &mediaserver.Item{ID: fmt.Sprintf("m%d", i), Type: "Movie", UserData: &mediaserver.UserData{}}
+		if i%2 == 0 {
+			item.UserData = &mediaserver.UserData{Played: true, PlayCount: 1}
+		}
+		server.items = append(server.items, item)
+	}
+	svc.connections.(stubConnections).servers["emby-1"] = server
+
+	played, err := svc.Played(ctx, "emby-1", "e-dana")
+	if err != nil {
+		t.Fatalf("Played: %v", err)
+	}
+	if len(played) != statusPageSize/2+1 || played[0].ID != "m0" || played[len(played)-1].ID != fmt.Sprintf("m%d", statusPageSize) {
+		t.Errorf("expected every other item across both pages, got %d", len(played))
+	}
+
+	// An imported play marks an item the server reports unplayed.
+	csv := "user,item_id,timestamp\nDana,m1,2023-10-01T08:30:00Z\n"
+	if _, err := svc.Import(ctx, "emby-1", FormatCSV, strings.NewReader(csv), nil); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	played, err = svc.Played(ctx, "emby-1", "e-dana")
+	if err != nil {
+		t.Fatalf("Played: %v", err)
+	}
+	if len(played) != statusPageSize/2+2 || played[1].ID != "m1" || played[1].UserData.LastPlayedDate != "2023-10-01T08:30:00Z" {
+		t.Errorf("expected the imported play to count, got %d items", len(played))
+	}
+
+	tests := []struct {
+		name    string
+		connID  string
+		userID  string
+		wantErr error
+	}{
+		{"unknown connection", "missing", "e-dana", ErrConnectionNotFound},
+		{"not a media server", "sonarr-1", "e-dana", connection.ErrNotMediaServer},
+		{"unknown user", "emby-1", "e-lee", ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := svc.Played(ctx, tt.connID, tt.userID); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+
+	server.err = errors.New("connection refused")
+	if _, err := svc.Played(ctx, "emby-1", "e-dana"); !errors.Is(err, ErrServerUnavailable) {
+		t.Errorf("expected ErrServerUnavailable, got %v", err)
+	}
+}
+
+// musicServer is a media server whose users see albums and have played
+// tracks, keyed by user ID.
+type musicServer struct {
+	mediaserver.Server
+	users  []*mediaserver.User
+	albums map[string][]*mediaserver.Item
+	played map[string][]*mediaserver.Item
+}
+
+func (m *musicServer) GetUsers(context.Context) ([]*mediaserver.User, error) {
+	return m.users, nil
+}
+
+func (m *musicServer) GetUserItems(_ context.Context, userID string, q *mediaserver.ItemQuery) (*mediaserver.ItemsResult, error) {
+	items := m.albums[userID]
+	if q.IncludeTypes == "Audio" && q.IsPlayed != nil && *q.IsPlayed {
+		items = m.played[userID]
+	}
+	return &mediaserver.ItemsResult{Items: items, TotalRecordCount: len(items)}, nil
+}
+
+type fakeLidarr struct {
+	artists []*arrclient.Artist
+	albums  []*arrclient.Album
+	err     error
+}
+
+func (f *fakeLidarr) GetArtists(context.Context) ([]*arrclient.Artist, error) {
+	return f.artists, f.err
+}
+
+func (f *fakeLidarr) GetAlbums(context.Context, int64) ([]*arrclient.Album, error) {
+	return f.albums, f.err
+}
+
+func musicItem(id, releaseGroup, albumArtist string) *mediaserver.Item {
+	return &mediaserver.Item{ID: id, ProviderIDs: mediaserver.Providers{
+		MusicBrainzReleaseGroup: releaseGroup,
+		MusicBrainzAlbumArtist:  albumArtist,
+	}}
+}
+
+func TestUnplayedAlbums(t *testing.T) {
+	svc := setupTestService(t)
+	ctx := context.Background()
+	conns := svc.connections.(stubConnections)
+	conns.conns["lidarr-1"] = &repository.Connection{ID: "lidarr-1", Type: repository.ConnectionTypeLidarr}
+	conns.servers["emby-1"] = &musicServer{
+		users: []*mediaserver.User{{ID: "e-dana"}, {ID: "e-lee"}},
+		albums: map[string][]*mediaserver.Item{
+			"e-dana": {musicItem("a-ok", "rg-ok", "mb-radiohead"), musicItem("a-played", "rg-played", "")},
+			// Only lee can see the second library.
+			"e-lee": {musicItem("a-kid", "rg-kid", ""), musicItem("a-wrong", "rg-wrong", "mb-someone-else")},
+		},
+		played: map[string][]*mediaserver.Item{
+			"e-lee": {musicItem("t-1", "rg-played", "")},
+		},
+	}
+	files := &arrclient.MusicStatistics{TrackFileCount: 10, SizeOnDisk: 1000}
+	lidarr := &fakeLidarr{
+		artists: []*arrclient.Artist{{ID: 1, ArtistName: "Radiohead", ForeignArtistID: "mb-radiohead"}},
+		albums: []*arrclient.Album{
+			{ID: 10, Title: "OK Computer", ForeignAlbumID: "rg-ok", ArtistID: 1, Statistics: files},
+			{ID: 11, Title: "Kid A", ForeignAlbumID: "rg-kid", ArtistID: 1, Statistics: files},
+			{ID: 12, Title: "Amnesiac", ForeignAlbumID: "rg-played", ArtistID: 1, Statistics: files},
+			{ID: 13, Title: "Hail to the Thief", ForeignAlbumID: "rg-wrong", ArtistID: 1, Statistics: files},
+			{ID: 14, Title: "In Rainbows", ForeignAlbumID: "rg-missing", ArtistID: 1, Statistics: files},
+			{ID: 15, Title: "Pablo Honey", ForeignAlbumID: "rg-ok", ArtistID: 1},
+		},
+	}
+	svc.newLidarr = func(string, string) albumSource { return lidarr }
+
+	albums, err := svc.UnplayedAlbums(ctx, "lidarr-1", "emby-1")
+	if err != nil {
+		t.Fatalf("UnplayedAlbums: %v", err)
+	}
+	if len(albums) != 2 || albums[0].Title != "Kid A" || albums[1].Title != "OK Computer" {
+		t.Fatalf("expected Kid A and OK Computer, got %+v", albums)
+	}
+	if a := albums[1]; a.ItemID != "a-ok" || a.ArtistName != "Radiohead" || a.SizeOnDisk != 1000 {
+		t.Errorf("unexpected album %+v", a)
+	}
+
+	tests := []struct {
+		name     string
+		lidarrID string
+		serverID string
+		want     error
+	}{
+		{"unknown lidarr", "missing", "emby-1", ErrConnectionNotFound},
+		{"not lidarr", "sonarr-1", "emby-1", ErrNotLidarr},
+		{"not a media server", "lidarr-1", "sonarr-1", connection.ErrNotMediaServer},
+	}
+	for _, tt := range tests {
+		if _, err := svc.UnplayedAlbums(ctx, tt.lidarrID, tt.serverID); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+	lidarr.err = errors.New("connection refused")
+	if _, err := svc.UnplayedAlbums(ctx, "lidarr-1", "emby-1"); !errors.Is(err, ErrArrUnavailable) {
+		t.Errorf("expected ErrArrUnavailable, got %v", err)
+	}
+}
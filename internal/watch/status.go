@@ -0,0 +1,81 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sydlexius/media-reaper/internal/mediaserver"
+)
+
+const (
+	// trackedTypes are the item types whose play state is reported.
+	trackedTypes   = "Movie,Episode"
+	statusPageSize = 500
+)
+
+var (
+	ErrUserNotFound = errors.New("media server user not found")
+	// ErrServerUnavailable wraps failures talking to the media server.
+	ErrServerUnavailable = errors.New("media server unavailable")
+)
+
+// Played returns the movies and episodes a media server user has played,
+// reading play state from the connection through mediaserver.Server, so
+// Emby, Jellyfin, and Plex are handled alike. Plays imported for the user
+// are merged in first, so an item played before the server kept history
+// counts as played.
+func (s *Service) Played(ctx context.Context, connectionID, userID string) ([]*mediaserver.Item, error) {
+	server, err := s.connections.MediaServer(ctx, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if server == nil {
+		return nil, ErrConnectionNotFound
+	}
+
+	users, err := server.GetUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServerUnavailable, err)
+	}
+	var user *mediaserver.User
+	for _, u := range users {
+		if u.ID == userID {
+			user = u
+			break
+		}
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	items, err := userItems(ctx, server, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServerUnavailable, err)
+	}
+	if err := s.ApplyHistory(ctx, connectionID, user, items); err != nil {
+		return nil, err
+	}
+	played := []*mediaserver.Item{}
+	for _, item := range items {
+		if item.UserData != nil && item.UserData.Played {
+			played = append(played, item)
+		}
+	}
+	return played, nil
+}
+
+// userItems fetches every tracked item for a user, a page at a time.
+func userItems(ctx context.Context, server mediaserver.Server, userID string) ([]*mediaserver.Item, error) {
+	items, err := mediaserver.AllUserItems(ctx, server, userID, &mediaserver.ItemQuery{
+		IncludeTypes: trackedTypes,
+		Recursive:    true,
+		Fields:       "ProviderIds",
+		SortBy:       "SortName",
+		Limit:        statusPageSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing items: %w", err)
+	}
+	return items, nil
+}
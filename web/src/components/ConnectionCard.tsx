@@ -18,10 +18,26 @@ const typeBadges: Record<string, { label: string; className: string }> = {
     label: "R",
     className: "bg-orange-100 text-orange-700 dark:bg-orange-900 dark:text-orange-200",
   },
+  lidarr: {
+    label: "L",
+    className: "bg-teal-100 text-teal-700 dark:bg-teal-900 dark:text-teal-200",
+  },
+  readarr: {
+    label: "Rd",
+    className: "bg-red-100 text-red-700 dark:bg-red-900 dark:text-red-200",
+  },
   emby: {
     label: "E",
     className: "bg-green-100 text-green-700 dark:bg-green-900 dark:text-green-200",
   },
+  jellyfin: {
+    label: "J",
+    className: "bg-purple-100 text-purple-700 dark:bg-purple-900 dark:text-purple-200",
+  },
+  plex: {
+    label: "P",
+    className: "bg-yellow-100 text-yellow-700 dark:bg-yellow-900 dark:text-yellow-200",
+  },
 };
 
 const statusDots: Record<string, string> = {
@@ -64,6 +80,11 @@ export function ConnectionCard({
                   Disabled
                 </span>
               )}
+              {connection.allowDirectDelete && (
+                <span className="rounded bg-red-100 px-1.5 py-0.5 text-xs text-red-700 dark:bg-red-900/50 dark:text-red-200">
+                  Direct delete
+                </span>
+              )}
             </div>
             <p className="text-sm text-gray-500 dark:text-gray-400">
               {connection.url}
@@ -14,6 +14,7 @@ interface ConnectionModalProps {
     url: string;
     apiKey: string;
     enabled?: boolean;
+    allowDirectDelete?: boolean;
   }) => void;
   onCancel: () => void;
   isSaving: boolean;
@@ -48,6 +49,7 @@ interface ConnectionFormProps {
     url: string;
     apiKey: string;
     enabled?: boolean;
+    allowDirectDelete?: boolean;
   }) => void;
   onCancel: () => void;
   isSaving: boolean;
@@ -64,6 +66,9 @@ function ConnectionForm({
   const [url, setUrl] = useState(connection?.url ?? "");
   const [apiKey, setApiKey] = useState("");
   const [enabled, setEnabled] = useState(connection?.enabled ?? true);
+  const [allowDirectDelete, setAllowDirectDelete] = useState(
+    connection?.allowDirectDelete ?? false,
+  );
   const [testResult, setTestResult] = useState<TestResult | null>(null);
 
   const testMutation = useTestUnsavedConnection();
@@ -77,6 +82,8 @@ function ConnectionForm({
       url,
       apiKey,
       enabled: isEditing ? enabled : undefined,
+      allowDirectDelete:
+        isEditing && type === "emby" ? allowDirectDelete : undefined,
     });
   }
 
@@ -94,7 +101,11 @@ function ConnectionForm({
   const placeholderUrls: Record<string, string> = {
     sonarr: "http://localhost:8989",
     radarr: "http://localhost:7878",
+    lidarr: "http://localhost:8686",
+    readarr: "http://localhost:8787",
     emby: "http://localhost:8096",
+    jellyfin: "http://localhost:8096",
+    plex: "http://localhost:32400",
   };
 
   return (
@@ -137,7 +148,11 @@ function ConnectionForm({
           >
             <option value="sonarr">Sonarr</option>
             <option value="radarr">Radarr</option>
+            <option value="lidarr">Lidarr</option>
+            <option value="readarr">Readarr</option>
             <option value="emby">Emby</option>
+            <option value="jellyfin">Jellyfin</option>
+            <option value="plex">Plex</option>
           </select>
         </div>
 
@@ -164,7 +179,7 @@ function ConnectionForm({
             htmlFor="conn-apikey"
             className="mb-1 block text-sm font-medium text-gray-700 dark:text-gray-300"
           >
-            API Key
+            {type === "plex" ? "Plex Token" : "API Key"}
           </label>
           <input
             id="conn-apikey"
@@ -197,6 +212,28 @@ function ConnectionForm({
           </div>
         )}
 
+        {isEditing && type === "emby" && (
+          <div className="flex items-start gap-2">
+            <input
+              id="conn-direct-delete"
+              type="checkbox"
+              checked={allowDirectDelete}
+              onChange={(e) => setAllowDirectDelete(e.target.checked)}
+              className="mt-0.5 h-4 w-4 rounded border-gray-300 text-blue-600 focus:ring-blue-500"
+            />
+            <label
+              htmlFor="conn-direct-delete"
+              className="text-sm text-gray-700 dark:text-gray-300"
+            >
+              <span className="font-medium">Allow direct deletion</span>
+              <span className="block text-xs text-gray-500 dark:text-gray-400">
+                Lets media-reaper delete items no Sonarr or Radarr manages
+                straight from Emby, files included.
+              </span>
+            </label>
+          </div>
+        )}
+
         {testResult && (
           <div
             className={`rounded p-3 text-sm ${
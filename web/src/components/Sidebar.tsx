@@ -2,12 +2,14 @@ import { NavLink } from "react-router";
 import { useAuth } from "../queries/auth";
 import { useTheme } from "../hooks/useTheme";
 
-const navItems = [
+// permission hides an item from users without it, so viewers such as
+// non-admin Emby users get a reduced menu.
+const navItems: { to: string; label: string; permission?: string }[] = [
   { to: "/", label: "Dashboard" },
-  { to: "/media", label: "Media" },
-  { to: "/rules", label: "Rules" },
-  { to: "/actions", label: "Actions" },
-  { to: "/connections", label: "Connections" },
+  { to: "/media", label: "Media", permission: "media:read" },
+  { to: "/rules", label: "Rules", permission: "rules:write" },
+  { to: "/actions", label: "Actions", permission: "actions:execute" },
+  { to: "/connections", label: "Connections", permission: "connections:read" },
   { to: "/settings", label: "Settings" },
 ];
 
@@ -36,23 +38,25 @@ export function Sidebar({ isOpen, onClose }: SidebarProps) {
         </div>
 
         <nav className="flex-1 space-y-1 p-4">
-          {navItems.map((item) => (
-            <NavLink
-              key={item.to}
-              to={item.to}
-              end={item.to === "/"}
-              onClick={onClose}
-              className={({ isActive }) =>
-                `block rounded px-3 py-2 text-sm font-medium transition-colors ${
-                  isActive
-                    ? "bg-blue-100 text-blue-700 dark:bg-blue-900 dark:text-blue-200"
-                    : "text-gray-700 hover:bg-gray-100 dark:text-gray-300 dark:hover:bg-gray-700"
-                }`
-              }
-            >
-              {item.label}
-            </NavLink>
-          ))}
+          {navItems
+            .filter((item) => !item.permission || user?.permissions.includes(item.permission))
+            .map((item) => (
+              <NavLink
+                key={item.to}
+                to={item.to}
+                end={item.to === "/"}
+                onClick={onClose}
+                className={({ isActive }) =>
+                  `block rounded px-3 py-2 text-sm font-medium transition-colors ${
+                    isActive
+                      ? "bg-blue-100 text-blue-700 dark:bg-blue-900 dark:text-blue-200"
+                      : "text-gray-700 hover:bg-gray-100 dark:text-gray-300 dark:hover:bg-gray-700"
+                  }`
+                }
+              >
+                {item.label}
+              </NavLink>
+            ))}
         </nav>
 
         <div className="border-t border-gray-200 p-4 dark:border-gray-700">
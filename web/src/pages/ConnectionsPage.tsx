@@ -44,6 +44,7 @@ export function ConnectionsPage() {
     url: string;
     apiKey: string;
     enabled?: boolean;
+    allowDirectDelete?: boolean;
   }) {
     try {
       if (editingConnection) {
@@ -55,6 +56,7 @@ export function ConnectionsPage() {
             url: data.url,
             apiKey: data.apiKey || undefined,
             enabled: data.enabled,
+            allowDirectDelete: data.allowDirectDelete,
           },
         });
       } else {
@@ -140,7 +142,7 @@ export function ConnectionsPage() {
             No connections configured yet.
           </p>
           <p className="mt-1 text-sm text-gray-400 dark:text-gray-500">
-            Add a Sonarr, Radarr, or Emby connection to get started.
+            Add an *arr or media server connection to get started.
           </p>
         </div>
       )}
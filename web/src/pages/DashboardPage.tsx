@@ -1,8 +1,63 @@
+import { useAuth } from "../queries/auth";
+import { useNowPlaying, type NowPlaying } from "../queries/sessions";
+
+function title(np: NowPlaying): string {
+  if (np.itemType === "Episode" && np.seriesName) {
+    const episode =
+      np.seasonNumber != null && np.episodeNumber != null
+        ? ` S${String(np.seasonNumber).padStart(2, "0")}E${String(np.episodeNumber).padStart(2, "0")}`
+        : "";
+    return `${np.seriesName}${episode} - ${np.itemName}`;
+  }
+  return np.itemName;
+}
+
+function progress(np: NowPlaying): number {
+  if (np.runtimeSeconds <= 0) {
+    return 0;
+  }
+  return Math.min(100, (np.positionSeconds / np.runtimeSeconds) * 100);
+}
+
 export function DashboardPage() {
+  const { user } = useAuth();
+  const own = !user?.permissions.includes("activity:read");
+  const { data, isLoading } = useNowPlaying(own);
+
   return (
     <div>
       <h1 className="text-2xl font-bold text-gray-900 dark:text-white">Dashboard</h1>
-      <p className="mt-2 text-gray-600 dark:text-gray-400">Dashboard content will appear here.</p>
+
+      <h2 className="mt-6 text-lg font-semibold text-gray-900 dark:text-white">Now playing</h2>
+      {isLoading ? (
+        <p className="mt-2 text-gray-500 dark:text-gray-400">Loading sessions...</p>
+      ) : data && data.sessions.length > 0 ? (
+        <ul className="mt-3 grid gap-4 sm:grid-cols-2 lg:grid-cols-3">
+          {data.sessions.map((np) => (
+            <li
+              key={`${np.connectionId}-${np.sessionId}`}
+              className="rounded-lg border border-gray-200 bg-white p-4 shadow-sm dark:border-gray-700 dark:bg-gray-800"
+            >
+              <p className="font-medium text-gray-900 dark:text-white">{title(np)}</p>
+              <p className="mt-1 text-sm text-gray-500 dark:text-gray-400">
+                {np.userName || "Unknown user"}
+                {np.deviceName ? ` on ${np.deviceName}` : ""} · {np.connectionName}
+                {np.isPaused ? " · Paused" : ""}
+              </p>
+              <div className="mt-3 h-1.5 rounded bg-gray-200 dark:bg-gray-700">
+                <div className="h-1.5 rounded bg-blue-600" style={{ width: `${progress(np)}%` }} />
+              </div>
+            </li>
+          ))}
+        </ul>
+      ) : (
+        <p className="mt-2 text-gray-500 dark:text-gray-400">Nothing is playing right now.</p>
+      )}
+      {data?.errors.map((e) => (
+        <p key={e.connectionId} className="mt-2 text-sm text-red-600 dark:text-red-400">
+          Could not read sessions from {e.connectionName}: {e.error}
+        </p>
+      ))}
     </div>
   );
 }
@@ -1,13 +1,28 @@
 import { useState, type FormEvent } from "react";
-import { useNavigate, useLocation } from "react-router";
-import { useAuth } from "../queries/auth";
+import { useNavigate, useLocation, useSearchParams } from "react-router";
+import { isMFAChallenge, useAuth, useLoginProviders } from "../queries/auth";
+
+const ssoErrors: Record<string, string> = {
+  sso_denied: "Sign-in was cancelled at the identity provider.",
+  sso_state_mismatch: "Sign-in expired or was tampered with. Please try again.",
+  sso_no_role: "Your account is not in a group allowed to use Media Reaper.",
+  sso_username_taken: "A local account already uses your username. Ask an admin to resolve it.",
+  sso_disabled: "Your account is disabled.",
+  sso_failed: "Single sign-on failed. Please try again.",
+};
 
 export function LoginPage() {
   const [username, setUsername] = useState("");
   const [password, setPassword] = useState("");
-  const { login, loginError, isLoggingIn, isAuthenticated } = useAuth();
+  const [mfaStep, setMFAStep] = useState(false);
+  const [code, setCode] = useState("");
+  const { login, verifyMFA, loginError, isLoggingIn, isAuthenticated } = useAuth();
+  const { data: providers } = useLoginProviders();
   const navigate = useNavigate();
   const location = useLocation();
+  const [searchParams] = useSearchParams();
+  const ssoError = ssoErrors[searchParams.get("error") ?? ""];
+  const showPassword = providers?.password ?? true;
 
   const from = (location.state as { from?: string })?.from || "/";
 
@@ -19,7 +34,22 @@ export function LoginPage() {
   async function handleSubmit(e: FormEvent) {
     e.preventDefault();
     try {
-      await login({ username, password });
+      if (isMFAChallenge(await login({ username, password }))) {
+        setMFAStep(true);
+        return;
+      }
+      navigate(from, { replace: true });
+    } catch {
+      // Error is captured by loginError
+    }
+  }
+
+  async function handleMFASubmit(e: FormEvent) {
+    e.preventDefault();
+    const trimmed = code.replace(/\s/g, "");
+    try {
+      // Authenticator codes are digits; anything else is a recovery code.
+      await verifyMFA(/^\d+$/.test(trimmed) ? { code: trimmed } : { recoveryCode: trimmed });
       navigate(from, { replace: true });
     } catch {
       // Error is captured by loginError
@@ -32,53 +62,106 @@ export function LoginPage() {
         <h1 className="mb-6 text-center text-2xl font-bold text-gray-900 dark:text-white">
           Media Reaper
         </h1>
-        <form onSubmit={handleSubmit} className="space-y-4">
-          {loginError && (
-            <div className="rounded bg-red-100 p-3 text-sm text-red-700 dark:bg-red-900/50 dark:text-red-200">
-              {loginError}
+        {ssoError && (
+          <div className="mb-4 rounded bg-red-100 p-3 text-sm text-red-700 dark:bg-red-900/50 dark:text-red-200">
+            {ssoError}
+          </div>
+        )}
+        {providers?.oidc && (
+          <a
+            href="/api/auth/oidc/login"
+            className="mb-4 block w-full rounded border border-gray-300 px-4 py-2 text-center font-medium text-gray-900 hover:bg-gray-100 dark:border-gray-600 dark:text-white dark:hover:bg-gray-700"
+          >
+            Sign in with {providers.oidcName}
+          </a>
+        )}
+        {mfaStep && (
+          <form onSubmit={handleMFASubmit} className="space-y-4">
+            {loginError && (
+              <div className="rounded bg-red-100 p-3 text-sm text-red-700 dark:bg-red-900/50 dark:text-red-200">
+                {loginError}
+              </div>
+            )}
+            <div>
+              <label
+                htmlFor="code"
+                className="mb-1 block text-sm font-medium text-gray-700 dark:text-gray-300"
+              >
+                Authentication code
+              </label>
+              <input
+                id="code"
+                type="text"
+                inputMode="numeric"
+                autoComplete="one-time-code"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                required
+                autoFocus
+                className="w-full rounded border border-gray-300 px-3 py-2 text-gray-900 focus:border-blue-500 focus:outline-none dark:border-gray-600 dark:bg-gray-700 dark:text-white"
+              />
+              <p className="mt-1 text-xs text-gray-500 dark:text-gray-400">
+                Enter the code from your authenticator app, or a recovery code.
+              </p>
             </div>
-          )}
-          <div>
-            <label
-              htmlFor="username"
-              className="mb-1 block text-sm font-medium text-gray-700 dark:text-gray-300"
+            <button
+              type="submit"
+              disabled={isLoggingIn}
+              className="w-full rounded bg-blue-600 px-4 py-2 font-medium text-white hover:bg-blue-700 disabled:opacity-50"
             >
-              Username
-            </label>
-            <input
-              id="username"
-              type="text"
-              value={username}
-              onChange={(e) => setUsername(e.target.value)}
-              required
-              autoFocus
-              className="w-full rounded border border-gray-300 px-3 py-2 text-gray-900 focus:border-blue-500 focus:outline-none dark:border-gray-600 dark:bg-gray-700 dark:text-white"
-            />
-          </div>
-          <div>
-            <label
-              htmlFor="password"
-              className="mb-1 block text-sm font-medium text-gray-700 dark:text-gray-300"
+              {isLoggingIn ? "Verifying..." : "Verify"}
+            </button>
+          </form>
+        )}
+        {showPassword && !mfaStep && (
+          <form onSubmit={handleSubmit} className="space-y-4">
+            {loginError && (
+              <div className="rounded bg-red-100 p-3 text-sm text-red-700 dark:bg-red-900/50 dark:text-red-200">
+                {loginError}
+              </div>
+            )}
+            <div>
+              <label
+                htmlFor="username"
+                className="mb-1 block text-sm font-medium text-gray-700 dark:text-gray-300"
+              >
+                Username
+              </label>
+              <input
+                id="username"
+                type="text"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                required
+                autoFocus
+                className="w-full rounded border border-gray-300 px-3 py-2 text-gray-900 focus:border-blue-500 focus:outline-none dark:border-gray-600 dark:bg-gray-700 dark:text-white"
+              />
+            </div>
+            <div>
+              <label
+                htmlFor="password"
+                className="mb-1 block text-sm font-medium text-gray-700 dark:text-gray-300"
+              >
+                Password
+              </label>
+              <input
+                id="password"
+                type="password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                required
+                className="w-full rounded border border-gray-300 px-3 py-2 text-gray-900 focus:border-blue-500 focus:outline-none dark:border-gray-600 dark:bg-gray-700 dark:text-white"
+              />
+            </div>
+            <button
+              type="submit"
+              disabled={isLoggingIn}
+              className="w-full rounded bg-blue-600 px-4 py-2 font-medium text-white hover:bg-blue-700 disabled:opacity-50"
             >
-              Password
-            </label>
-            <input
-              id="password"
-              type="password"
-              value={password}
-              onChange={(e) => setPassword(e.target.value)}
-              required
-              className="w-full rounded border border-gray-300 px-3 py-2 text-gray-900 focus:border-blue-500 focus:outline-none dark:border-gray-600 dark:bg-gray-700 dark:text-white"
-            />
-          </div>
-          <button
-            type="submit"
-            disabled={isLoggingIn}
-            className="w-full rounded bg-blue-600 px-4 py-2 font-medium text-white hover:bg-blue-700 disabled:opacity-50"
-          >
-            {isLoggingIn ? "Signing in..." : "Sign in"}
-          </button>
-        </form>
+              {isLoggingIn ? "Signing in..." : "Sign in"}
+            </button>
+          </form>
+        )}
       </div>
     </div>
   );
@@ -0,0 +1,45 @@
+let csrfToken: Promise<string> | null = null;
+
+function getCSRFToken(): Promise<string> {
+  if (!csrfToken) {
+    csrfToken = fetch("/api/auth/csrf")
+      .then((res) => {
+        if (!res.ok) {
+          throw new Error("Failed to fetch CSRF token");
+        }
+        return res.json();
+      })
+      .then((data: { token: string }) => data.token)
+      .catch((err: unknown) => {
+        csrfToken = null;
+        throw err;
+      });
+  }
+  return csrfToken;
+}
+
+// apiFetch is fetch with the CSRF token the API requires on state-changing
+// requests. If the token was rotated, it is fetched again and the request
+// retried once.
+export async function apiFetch(input: string, init: RequestInit = {}): Promise<Response> {
+  const method = (init.method ?? "GET").toUpperCase();
+  if (method === "GET" || method === "HEAD") {
+    return fetch(input, init);
+  }
+
+  const send = async () => {
+    const headers = new Headers(init.headers);
+    headers.set("X-CSRF-Token", await getCSRFToken());
+    return fetch(input, { ...init, headers });
+  };
+
+  const res = await send();
+  if (res.status === 403) {
+    const data = await res.clone().json().catch(() => null);
+    if (data?.error === "invalid csrf token") {
+      csrfToken = null;
+      return send();
+    }
+  }
+  return res;
+}
@@ -1,9 +1,25 @@
 import { useQuery, useMutation, useQueryClient } from "@tanstack/react-query";
+import { apiFetch } from "./api";
 
 export interface User {
   id: string;
   username: string;
   role: string;
+  permissions: string[];
+  mustChangePassword: boolean;
+  authProvider: string;
+  embyUserId?: string;
+  mfaEnrollmentRequired?: boolean;
+}
+
+export interface MFAChallenge {
+  mfaRequired: true;
+}
+
+export interface LoginProviders {
+  password: boolean;
+  oidc: boolean;
+  oidcName?: string;
 }
 
 interface LoginCredentials {
@@ -12,7 +28,7 @@ interface LoginCredentials {
 }
 
 async function fetchMe(): Promise<User | null> {
-  const res = await fetch("/api/auth/me");
+  const res = await apiFetch("/api/auth/me");
   if (res.status === 401) {
     return null;
   }
@@ -22,8 +38,15 @@ async function fetchMe(): Promise<User | null> {
   return res.json();
 }
 
-async function login(credentials: LoginCredentials): Promise<User> {
-  const res = await fetch("/api/auth/login", {
+interface MFACode {
+  code?: string;
+  recoveryCode?: string;
+}
+
+// login resolves to an MFAChallenge when the account needs a second factor;
+// finish it with verifyMFA.
+async function login(credentials: LoginCredentials): Promise<User | MFAChallenge> {
+  const res = await apiFetch("/api/auth/login", {
     method: "POST",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify(credentials),
@@ -35,8 +58,41 @@ async function login(credentials: LoginCredentials): Promise<User> {
   return res.json();
 }
 
+async function verifyMFA(code: MFACode): Promise<User> {
+  const res = await apiFetch("/api/auth/login/mfa", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(code),
+  });
+  if (!res.ok) {
+    const data = await res.json();
+    throw new Error(data.error || "Verification failed");
+  }
+  return res.json();
+}
+
+export function isMFAChallenge(result: User | MFAChallenge): result is MFAChallenge {
+  return "mfaRequired" in result;
+}
+
+async function fetchProviders(): Promise<LoginProviders> {
+  const res = await apiFetch("/api/auth/providers");
+  if (!res.ok) {
+    throw new Error("Failed to fetch login providers");
+  }
+  return res.json();
+}
+
+export function useLoginProviders() {
+  return useQuery({
+    queryKey: ["auth", "providers"],
+    queryFn: fetchProviders,
+    staleTime: Infinity,
+  });
+}
+
 async function logout(): Promise<void> {
-  const res = await fetch("/api/auth/logout", { method: "POST" });
+  const res = await apiFetch("/api/auth/logout", { method: "POST" });
   if (!res.ok) {
     throw new Error("Logout failed");
   }
@@ -54,6 +110,15 @@ export function useAuth() {
 
   const loginMutation = useMutation({
     mutationFn: login,
+    onSuccess: (result) => {
+      if (!isMFAChallenge(result)) {
+        queryClient.setQueryData(["auth", "me"], result);
+      }
+    },
+  });
+
+  const mfaMutation = useMutation({
+    mutationFn: verifyMFA,
     onSuccess: (user) => {
       queryClient.setQueryData(["auth", "me"], user);
     },
@@ -72,7 +137,8 @@ export function useAuth() {
     isAuthenticated: userQuery.data != null,
     login: loginMutation.mutateAsync,
     logout: logoutMutation.mutateAsync,
-    loginError: loginMutation.error?.message ?? null,
-    isLoggingIn: loginMutation.isPending,
+    verifyMFA: mfaMutation.mutateAsync,
+    loginError: loginMutation.error?.message ?? mfaMutation.error?.message ?? null,
+    isLoggingIn: loginMutation.isPending || mfaMutation.isPending,
   };
 }
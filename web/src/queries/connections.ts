@@ -1,14 +1,16 @@
 import { useQuery, useMutation, useQueryClient } from "@tanstack/react-query";
+import { apiFetch } from "./api";
 
 export interface Connection {
   id: string;
   name: string;
-  type: "sonarr" | "radarr" | "emby";
+  type: "sonarr" | "radarr" | "lidarr" | "readarr" | "emby" | "jellyfin" | "plex";
   url: string;
   maskedApiKey: string;
   enabled: boolean;
   status: "healthy" | "unhealthy" | "unknown";
   lastCheckedAt: string | null;
+  allowDirectDelete: boolean;
   createdAt: string;
   updatedAt: string;
 }
@@ -26,6 +28,7 @@ export interface UpdateConnectionInput {
   url: string;
   apiKey?: string;
   enabled?: boolean;
+  allowDirectDelete?: boolean;
 }
 
 export interface TestResult {
@@ -36,7 +39,7 @@ export interface TestResult {
 }
 
 async function fetchConnections(): Promise<Connection[]> {
-  const res = await fetch("/api/connections");
+  const res = await apiFetch("/api/connections");
   if (!res.ok) {
     throw new Error("Failed to fetch connections");
   }
@@ -46,7 +49,7 @@ async function fetchConnections(): Promise<Connection[]> {
 async function createConnection(
   input: CreateConnectionInput,
 ): Promise<Connection> {
-  const res = await fetch("/api/connections", {
+  const res = await apiFetch("/api/connections", {
     method: "POST",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify(input),
@@ -65,7 +68,7 @@ async function updateConnection({
   id: string;
   input: UpdateConnectionInput;
 }): Promise<Connection> {
-  const res = await fetch(`/api/connections/${id}`, {
+  const res = await apiFetch(`/api/connections/${id}`, {
     method: "PUT",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify(input),
@@ -78,14 +81,14 @@ async function updateConnection({
 }
 
 async function deleteConnection(id: string): Promise<void> {
-  const res = await fetch(`/api/connections/${id}`, { method: "DELETE" });
+  const res = await apiFetch(`/api/connections/${id}`, { method: "DELETE" });
   if (!res.ok) {
     throw new Error("Failed to delete connection");
   }
 }
 
 async function testSavedConnection(id: string): Promise<TestResult> {
-  const res = await fetch(`/api/connections/${id}/test`, { method: "POST" });
+  const res = await apiFetch(`/api/connections/${id}/test`, { method: "POST" });
   if (!res.ok) {
     const data = await res.json();
     throw new Error(data.error || "Failed to test connection");
@@ -98,7 +101,7 @@ async function testUnsavedConnection(input: {
   url: string;
   apiKey: string;
 }): Promise<TestResult> {
-  const res = await fetch("/api/connections/test", {
+  const res = await apiFetch("/api/connections/test", {
     method: "POST",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify(input),
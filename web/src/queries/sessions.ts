@@ -0,0 +1,45 @@
+import { useQuery } from "@tanstack/react-query";
+import { apiFetch } from "./api";
+
+export interface NowPlaying {
+  connectionId: string;
+  connectionName: string;
+  sessionId: string;
+  userId?: string;
+  userName?: string;
+  client?: string;
+  deviceName?: string;
+  itemId: string;
+  itemName: string;
+  itemType: string;
+  seriesId?: string;
+  seriesName?: string;
+  seasonNumber?: number;
+  episodeNumber?: number;
+  positionSeconds: number;
+  runtimeSeconds: number;
+  isPaused: boolean;
+  playMethod?: string;
+}
+
+export interface NowPlayingResult {
+  sessions: NowPlaying[];
+  errors: { connectionId: string; connectionName: string; error: string }[];
+}
+
+// Users without activity:read see only their own sessions.
+async function fetchNowPlaying(own: boolean): Promise<NowPlayingResult> {
+  const res = await apiFetch(own ? "/api/me/now-playing" : "/api/now-playing");
+  if (!res.ok) {
+    throw new Error("Failed to fetch sessions");
+  }
+  return res.json();
+}
+
+export function useNowPlaying(own: boolean) {
+  return useQuery({
+    queryKey: ["now-playing", own],
+    queryFn: () => fetchNowPlaying(own),
+    refetchInterval: 15_000,
+  });
+}